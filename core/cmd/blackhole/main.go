@@ -0,0 +1,27 @@
+// Command blackhole is the Blackhole node and plugin tooling CLI.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blackhole-pro/blackhole/core/internal/core"
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:           "blackhole",
+		Short:         "Blackhole distributed content sharing platform",
+		Version:       fmt.Sprintf("%s (commit %s, built %s)", core.Version, core.Commit, core.BuildTime),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.AddCommand(newPluginCommand(), newSnapshotCommand())
+
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/trust"
+)
+
+func newPluginCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Build and inspect plugin packages",
+	}
+	cmd.AddCommand(newPluginPackCommand(), newPluginVerifyCommand(), newPluginUnpackCommand(), newPluginKeygenCommand())
+	return cmd
+}
+
+func newPluginPackCommand() *cobra.Command {
+	var output, keyFile string
+	var platforms []string
+
+	cmd := &cobra.Command{
+		Use:   "pack [plugin-dir]",
+		Short: "Build a .plugin package from a plugin directory",
+		Long: `Build a .plugin package from a plugin directory containing plugin.yaml
+and per-platform binaries in bin/<os>-<arch>/. proto/, docs/, LICENSE,
+README.md and CHANGELOG.md are included when present.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+
+			if output == "" {
+				manifest, err := archive.ReadManifest(dir)
+				if err != nil {
+					return err
+				}
+				output = filepath.Join(dir, "dist", fmt.Sprintf("%s-%s.plugin", manifest.Name, manifest.Version))
+			}
+
+			opts := archive.PackOptions{Platforms: platforms}
+			if keyFile != "" {
+				signer, err := trust.LoadSigner(keyFile)
+				if err != nil {
+					return err
+				}
+				opts.Signer = signer
+			}
+
+			pkg, err := archive.PackFile(dir, output, opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Packed %s %s for %s\n", pkg.Manifest.Name, pkg.Manifest.Version,
+				strings.Join(pkg.Platforms, ", "))
+			fmt.Fprintf(cmd.OutOrStdout(), "Package: %s\n", output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "package file (default dist/<name>-<version>.plugin)")
+	cmd.Flags().StringSliceVar(&platforms, "platform", nil, "platforms to include, e.g. linux-amd64 (default all)")
+	cmd.Flags().StringVar(&keyFile, "key", "", "private key file to sign the package with")
+	return cmd
+}
+
+func newPluginVerifyCommand() *cobra.Command {
+	var trustDir, policy string
+
+	cmd := &cobra.Command{
+		Use:   "verify <package>",
+		Short: "Check a .plugin package against its checksums and signature",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var verifier archive.SignatureVerifier
+			if trustDir != "" {
+				mode, err := trust.ParseMode(policy)
+				if err != nil {
+					return err
+				}
+				store, err := trust.LoadStore(trustDir)
+				if err != nil {
+					return err
+				}
+				verifier = trust.NewVerifier(store, trust.Policy{Mode: mode}, nil)
+			}
+
+			pkg, err := archive.Verify(args[0], verifier)
+			if err != nil {
+				return err
+			}
+			printPackage(cmd, pkg)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&trustDir, "trust-dir", "", "trust store to check the signature against")
+	cmd.Flags().StringVar(&policy, "policy", string(trust.ModeRequire), "signature policy: require, warn or allow")
+	return cmd
+}
+
+func newPluginKeygenCommand() *cobra.Command {
+	var publisher, output string
+
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate an ed25519 key for signing plugin packages",
+		Long: `Generate an ed25519 signing key. The private key is written to <output>.key
+and the public key to <output>.pub.json, ready to be placed in a node's
+trust directory under official/, community/ or local/.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if publisher == "" {
+				return fmt.Errorf("--publisher is required")
+			}
+			if output == "" {
+				output = strings.ToLower(strings.ReplaceAll(publisher, " ", "-"))
+			}
+
+			signer, key, err := trust.GenerateKey(publisher)
+			if err != nil {
+				return err
+			}
+			if err := signer.WriteFile(output + ".key"); err != nil {
+				return err
+			}
+			if err := key.WriteFile(output + ".pub.json"); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Key ID:      %s\n", key.ID)
+			fmt.Fprintf(cmd.OutOrStdout(), "Private key: %s.key\n", output)
+			fmt.Fprintf(cmd.OutOrStdout(), "Public key:  %s.pub.json\n", output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&publisher, "publisher", "", "publisher name recorded in signatures")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file prefix (default derived from publisher)")
+	return cmd
+}
+
+func newPluginUnpackCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unpack <package> <dir>",
+		Short: "Verify and extract a .plugin package",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkg, err := archive.Unpack(args[0], args[1], nil)
+			if err != nil {
+				return err
+			}
+			printPackage(cmd, pkg)
+			return nil
+		},
+	}
+}
+
+func printPackage(cmd *cobra.Command, pkg *archive.Package) {
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Name:        %s\n", pkg.Manifest.Name)
+	fmt.Fprintf(out, "Version:     %s\n", pkg.Manifest.Version)
+	fmt.Fprintf(out, "Platforms:   %s\n", strings.Join(pkg.Platforms, ", "))
+	fmt.Fprintf(out, "Files:       %d\n", len(pkg.Checksums))
+	fmt.Fprintf(out, "Permissions: %s\n", formatPermissions(plugins.PermissionsFromCapabilities(pkg.Manifest.Capabilities)))
+	if pkg.Signature != nil {
+		fmt.Fprintf(out, "Signed by:   %s (%s)\n", pkg.Signature.Publisher, pkg.Signature.KeyID)
+	} else {
+		fmt.Fprintln(out, "Signed by:   unsigned")
+	}
+}
+
+func formatPermissions(perms []plugins.PluginPermission) string {
+	if len(perms) == 0 {
+		return "none"
+	}
+	names := make([]string, len(perms))
+	for i, p := range perms {
+		names[i] = string(p)
+	}
+	return strings.Join(names, ", ")
+}
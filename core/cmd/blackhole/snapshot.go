@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+)
+
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Create, restore and inspect node snapshots",
+	}
+	cmd.AddCommand(newSnapshotCreateCommand(), newSnapshotRestoreCommand(), newSnapshotVerifyCommand())
+	return cmd
+}
+
+func newSnapshotCreateCommand() *cobra.Command {
+	var node, output string
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Snapshot every plugin on a node",
+		Long: `Snapshot every plugin on a node through its snapshot API. Plugins are
+quiesced while their state is exported, so the snapshot is consistent
+across plugins. The snapshot is checked before it is reported written.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = fmt.Sprintf("node-%s.snapshot", time.Now().UTC().Format("20060102-150405"))
+			}
+
+			resp, err := http.Get(node)
+			if err != nil {
+				return fmt.Errorf("failed to reach node: %w", err)
+			}
+			defer resp.Body.Close()
+			if err := snapshotResponseError(resp); err != nil {
+				return err
+			}
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return fmt.Errorf("failed to download snapshot: %w", err)
+			}
+
+			snapshot, err := state.ReadNodeSnapshot(bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(output, data, 0600); err != nil {
+				return fmt.Errorf("failed to write snapshot: %w", err)
+			}
+			printSnapshot(cmd, snapshot)
+			fmt.Fprintf(cmd.OutOrStdout(), "\nSnapshot: %s\n", output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&node, "node", "", "URL of the node's snapshot API")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "snapshot file (default node-<time>.snapshot)")
+	cmd.MarkFlagRequired("node")
+	return cmd
+}
+
+func newSnapshotRestoreCommand() *cobra.Command {
+	var node string
+
+	cmd := &cobra.Command{
+		Use:   "restore <snapshot>",
+		Short: "Restore a node to a snapshot",
+		Long: `Restore a node to a snapshot through its snapshot API. Plugins the node
+hasn't loaded are loaded, those loaded at another version are hot-swapped
+to the snapshot's version, and the snapshot's state is imported into each.
+Plugins not in the snapshot are left alone.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read snapshot: %w", err)
+			}
+			// A snapshot that doesn't verify isn't sent
+			snapshot, err := state.ReadNodeSnapshot(bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+
+			resp, err := http.Post(node, "application/gzip", bytes.NewReader(data))
+			if err != nil {
+				return fmt.Errorf("failed to reach node: %w", err)
+			}
+			defer resp.Body.Close()
+			if err := snapshotResponseError(resp); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Restored %d plugin(s) from snapshot of %s\n", len(snapshot.Manifest.Plugins),
+				snapshot.Manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&node, "node", "", "URL of the node's snapshot API")
+	cmd.MarkFlagRequired("node")
+	return cmd
+}
+
+// snapshotResponseError returns the error a node's snapshot API reported
+func snapshotResponseError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("node returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
+
+func newSnapshotVerifyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify <snapshot>",
+		Short: "Check a node snapshot against its manifest and list its plugins",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open snapshot: %w", err)
+			}
+			defer f.Close()
+
+			snapshot, err := state.ReadNodeSnapshot(f)
+			if err != nil {
+				return err
+			}
+			printSnapshot(cmd, snapshot)
+			return nil
+		},
+	}
+}
+
+func printSnapshot(cmd *cobra.Command, snapshot *state.NodeSnapshot) {
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Created: %s\n", snapshot.Manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(out, "Plugins: %d\n\n", len(snapshot.Manifest.Plugins))
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tSTATE\tSHA256")
+	for _, entry := range snapshot.Manifest.Plugins {
+		if entry.State == "" {
+			fmt.Fprintf(tw, "%s\t%s\tnone\t\n", entry.Spec.Name, entry.Spec.Version)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d bytes\t%s\n", entry.Spec.Name, entry.Spec.Version, entry.Size, entry.SHA256[:16])
+	}
+	tw.Flush()
+}
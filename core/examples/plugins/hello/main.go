@@ -2,47 +2,14 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
-	"time"
-)
-
-// RPC message types matching the framework protocol
-type rpcMessage struct {
-	ID     string          `json:"id"`
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params,omitempty"`
-}
-
-type rpcResponse struct {
-	ID     string          `json:"id"`
-	Result json.RawMessage `json:"result,omitempty"`
-	Error  string          `json:"error,omitempty"`
-}
-
-// Plugin request/response types
-type pluginRequest struct {
-	ID      string                 `json:"id"`
-	Method  string                 `json:"method"`
-	Params  map[string]interface{} `json:"params"`
-	Data    []byte                 `json:"data,omitempty"`
-}
+	"sync"
 
-type pluginResponse struct {
-	ID       string                 `json:"id"`
-	Success  bool                   `json:"success"`
-	Result   map[string]interface{} `json:"result,omitempty"`
-	Data     []byte                 `json:"data,omitempty"`
-	Error    string                 `json:"error,omitempty"`
-	Metadata responseMetadata       `json:"metadata"`
-}
-
-type responseMetadata struct {
-	ProcessingTime time.Duration `json:"processing_time"`
-}
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/base"
+)
 
 // Plugin state
 type pluginState struct {
@@ -50,90 +17,55 @@ type pluginState struct {
 	LastGreeting  string `json:"last_greeting"`
 }
 
-var (
-	encoder *json.Encoder
-	decoder *json.Decoder
-	state   pluginState
-	running bool
-)
+// helloPlugin greets callers and remembers how often it has done so
+type helloPlugin struct {
+	state pluginState
+	mu    sync.Mutex
+}
 
 func main() {
-	// Set up JSON RPC communication
-	encoder = json.NewEncoder(os.Stdout)
-	decoder = json.NewDecoder(os.Stdin)
-	running = true
-
-	// Log to stderr
-	log.SetOutput(os.Stderr)
-	log.Println("Hello plugin starting...")
-
-	// Main RPC loop
-	scanner := bufio.NewScanner(os.Stdin)
-	for running && scanner.Scan() {
-		var msg rpcMessage
-		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
-			log.Printf("Failed to decode message: %v", err)
-			continue
-		}
-
-		response := handleMessage(msg)
-		if err := encoder.Encode(response); err != nil {
-			log.Printf("Failed to encode response: %v", err)
-		}
+	if err := base.Serve(&helloPlugin{}); err != nil {
+		log.Fatalf("Hello plugin failed: %v", err)
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Scanner error: %v", err)
+// Info returns plugin information
+func (p *helloPlugin) Info() base.PluginInfo {
+	return base.PluginInfo{
+		Name:         "hello-plugin",
+		Version:      "1.0.0",
+		Description:  "A simple hello world plugin",
+		Author:       "Blackhole Team",
+		License:      "MIT",
+		Capabilities: []string{"integration"},
 	}
+}
 
-	log.Println("Hello plugin exiting...")
+// Initialize initializes the plugin
+func (p *helloPlugin) Initialize(ctx context.Context, config map[string]interface{}) error {
+	return nil
 }
 
-func handleMessage(msg rpcMessage) rpcResponse {
-	switch msg.Method {
-	case "initialize":
-		return handleInitialize(msg)
-	case "handle":
-		return handleRequest(msg)
-	case "healthcheck":
-		return handleHealthCheck(msg)
-	case "prepare_shutdown":
-		return handlePrepareShutdown(msg)
-	case "shutdown":
-		return handleShutdown(msg)
-	case "export_state":
-		return handleExportState(msg)
-	case "import_state":
-		return handleImportState(msg)
-	default:
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("unknown method: %s", msg.Method),
-		}
-	}
+// Start starts the plugin
+func (p *helloPlugin) Start(ctx context.Context) error {
+	return nil
 }
 
-func handleInitialize(msg rpcMessage) rpcResponse {
-	log.Println("Plugin initialized")
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"initialized"}`),
-	}
+// Stop stops the plugin
+func (p *helloPlugin) Stop(ctx context.Context) error {
+	return nil
 }
 
-func handleRequest(msg rpcMessage) rpcResponse {
-	var req pluginRequest
-	if err := json.Unmarshal(msg.Params, &req); err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to unmarshal request: %v", err),
-		}
-	}
+// HealthCheck reports the plugin as healthy
+func (p *helloPlugin) HealthCheck(ctx context.Context) error {
+	return nil
+}
 
-	startTime := time.Now()
+// Handle handles greet and get_stats requests
+func (p *helloPlugin) Handle(ctx context.Context, req base.Request) (base.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Handle different methods
-	var resp pluginResponse
 	switch req.Method {
 	case "greet":
 		name := "World"
@@ -142,113 +74,58 @@ func handleRequest(msg rpcMessage) rpcResponse {
 		}
 
 		greeting := fmt.Sprintf("Hello, %s!", name)
-		state.GreetingCount++
-		state.LastGreeting = greeting
+		p.state.GreetingCount++
+		p.state.LastGreeting = greeting
 
-		resp = pluginResponse{
+		return base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
 				"greeting": greeting,
-				"count":    state.GreetingCount,
+				"count":    p.state.GreetingCount,
 			},
-		}
+		}, nil
 
 	case "get_stats":
-		resp = pluginResponse{
+		return base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
-				"greeting_count": state.GreetingCount,
-				"last_greeting":  state.LastGreeting,
+				"greeting_count": p.state.GreetingCount,
+				"last_greeting":  p.state.LastGreeting,
 			},
-		}
+		}, nil
 
 	default:
-		resp = pluginResponse{
+		return base.Response{
 			ID:      req.ID,
 			Success: false,
 			Error:   fmt.Sprintf("unknown method: %s", req.Method),
-		}
-	}
-
-	resp.Metadata.ProcessingTime = time.Since(startTime)
-
-	// Marshal response
-	result, err := json.Marshal(resp)
-	if err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to marshal response: %v", err),
-		}
-	}
-
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: result,
-	}
-}
-
-func handleHealthCheck(msg rpcMessage) rpcResponse {
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"healthy"}`),
-	}
-}
-
-func handlePrepareShutdown(msg rpcMessage) rpcResponse {
-	log.Println("Preparing for shutdown...")
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"prepared"}`),
+		}, nil
 	}
 }
 
-func handleShutdown(msg rpcMessage) rpcResponse {
-	log.Println("Shutting down...")
-	running = false
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"shutdown"}`),
-	}
-}
+// ExportState exports the greeting statistics
+func (p *helloPlugin) ExportState(ctx context.Context) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-func handleExportState(msg rpcMessage) rpcResponse {
-	data, err := json.Marshal(state)
+	data, err := json.Marshal(p.state)
 	if err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to marshal state: %v", err),
-		}
-	}
-
-	// Return state as string (base64 encoding could be added)
-	result, _ := json.Marshal(string(data))
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: result,
+		return nil, fmt.Errorf("failed to marshal state: %w", err)
 	}
+	return data, nil
 }
 
-func handleImportState(msg rpcMessage) rpcResponse {
-	var stateData string
-	if err := json.Unmarshal(msg.Params, &stateData); err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to unmarshal state data: %v", err),
-		}
-	}
-
-	if err := json.Unmarshal([]byte(stateData), &state); err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to unmarshal state: %v", err),
-		}
-	}
+// ImportState restores previously exported greeting statistics
+func (p *helloPlugin) ImportState(ctx context.Context, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	log.Printf("State imported: count=%d, last=%s", state.GreetingCount, state.LastGreeting)
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"imported"}`),
+	var state pluginState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to unmarshal state: %w", err)
 	}
-}
\ No newline at end of file
+	p.state = state
+	return nil
+}
@@ -2,60 +2,29 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
+	"sync"
 	"time"
-)
-
-// RPC message types matching the framework protocol
-type rpcMessage struct {
-	ID     string          `json:"id"`
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params,omitempty"`
-}
-
-type rpcResponse struct {
-	ID     string          `json:"id"`
-	Result json.RawMessage `json:"result,omitempty"`
-	Error  string          `json:"error,omitempty"`
-}
-
-// Plugin request/response types
-type pluginRequest struct {
-	ID      string                 `json:"id"`
-	Method  string                 `json:"method"`
-	Params  map[string]interface{} `json:"params"`
-	Data    []byte                 `json:"data,omitempty"`
-}
 
-type pluginResponse struct {
-	ID       string                 `json:"id"`
-	Success  bool                   `json:"success"`
-	Result   map[string]interface{} `json:"result,omitempty"`
-	Data     []byte                 `json:"data,omitempty"`
-	Error    string                 `json:"error,omitempty"`
-	Metadata responseMetadata       `json:"metadata"`
-}
-
-type responseMetadata struct {
-	ProcessingTime time.Duration `json:"processing_time"`
-}
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/base"
+	"go.uber.org/zap"
+)
 
 // Plugin state with versioning
 type pluginStateV1 struct {
-	Version  string            `json:"version"`
-	Counters map[string]int64  `json:"counters"`
+	Version  string           `json:"version"`
+	Counters map[string]int64 `json:"counters"`
 }
 
 type pluginStateV2 struct {
-	Version     string                 `json:"version"`
-	Counters    map[string]int64       `json:"counters"`
-	Labels      map[string]string      `json:"labels"`
-	History     []historyEntry         `json:"history"`
-	LastUpdated time.Time              `json:"last_updated"`
+	Version     string            `json:"version"`
+	Counters    map[string]int64  `json:"counters"`
+	Labels      map[string]string `json:"labels"`
+	History     []historyEntry    `json:"history"`
+	LastUpdated time.Time         `json:"last_updated"`
 }
 
 type historyEntry struct {
@@ -65,128 +34,104 @@ type historyEntry struct {
 	Operation string    `json:"operation"`
 }
 
-var (
-	encoder      *json.Encoder
-	decoder      *json.Decoder
-	state        pluginStateV2
-	running      bool
-	pluginVersion = "2.0.0"
-)
+var pluginVersion = stateVersionV2
+
+// counterPlugin maintains named counters that survive hot-swaps
+type counterPlugin struct {
+	state  pluginStateV2
+	logger *zap.Logger
+	mu     sync.Mutex
+}
 
 func main() {
-	// Set up JSON RPC communication
-	encoder = json.NewEncoder(os.Stdout)
-	decoder = json.NewDecoder(os.Stdin)
-	running = true
-
-	// Initialize state
-	state = pluginStateV2{
-		Version:  pluginVersion,
-		Counters: make(map[string]int64),
-		Labels:   make(map[string]string),
-		History:  make([]historyEntry, 0),
+	logger := base.NewLogger("stateful-counter")
+	defer logger.Sync()
+
+	plugin := &counterPlugin{
+		state: pluginStateV2{
+			Version:  pluginVersion,
+			Counters: make(map[string]int64),
+			Labels:   make(map[string]string),
+			History:  make([]historyEntry, 0),
+		},
+		logger: logger,
 	}
 
-	// Log to stderr
-	log.SetOutput(os.Stderr)
-	log.Printf("Stateful Counter plugin v%s starting...", pluginVersion)
-
-	// Main RPC loop
-	scanner := bufio.NewScanner(os.Stdin)
-	for running && scanner.Scan() {
-		var msg rpcMessage
-		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
-			log.Printf("Failed to decode message: %v", err)
-			continue
-		}
-
-		response := handleMessage(msg)
-		if err := encoder.Encode(response); err != nil {
-			log.Printf("Failed to encode response: %v", err)
-		}
+	if err := base.Serve(plugin, base.WithLogger(logger)); err != nil {
+		log.Fatalf("Stateful Counter plugin failed: %v", err)
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Scanner error: %v", err)
+// Info returns plugin information
+func (p *counterPlugin) Info() base.PluginInfo {
+	return base.PluginInfo{
+		Name:        "stateful-counter",
+		Version:     pluginVersion,
+		Description: "Stateful counter demonstrating hot-swapping",
 	}
+}
 
-	log.Println("Stateful Counter plugin exiting...")
+// Initialize initializes the plugin
+func (p *counterPlugin) Initialize(ctx context.Context, config map[string]interface{}) error {
+	return nil
 }
 
-func handleMessage(msg rpcMessage) rpcResponse {
-	switch msg.Method {
-	case "initialize":
-		return handleInitialize(msg)
-	case "handle":
-		return handleRequest(msg)
-	case "healthcheck":
-		return handleHealthCheck(msg)
-	case "prepare_shutdown":
-		return handlePrepareShutdown(msg)
-	case "shutdown":
-		return handleShutdown(msg)
-	case "export_state":
-		return handleExportState(msg)
-	case "import_state":
-		return handleImportState(msg)
-	default:
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("unknown method: %s", msg.Method),
-		}
-	}
+// Start starts the plugin
+func (p *counterPlugin) Start(ctx context.Context) error {
+	return nil
 }
 
-func handleInitialize(msg rpcMessage) rpcResponse {
-	log.Println("Plugin initialized")
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"initialized"}`),
-	}
+// Stop stops the plugin
+func (p *counterPlugin) Stop(ctx context.Context) error {
+	return nil
 }
 
-func handleRequest(msg rpcMessage) rpcResponse {
-	var req pluginRequest
-	if err := json.Unmarshal(msg.Params, &req); err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to unmarshal request: %v", err),
-		}
-	}
+// HealthCheck reports the plugin as healthy
+func (p *counterPlugin) HealthCheck(ctx context.Context) error {
+	return nil
+}
 
-	startTime := time.Now()
+// PrepareShutdown logs that the plugin is about to be stopped
+func (p *counterPlugin) PrepareShutdown(ctx context.Context) error {
+	p.logger.Info("Preparing for shutdown")
+	return nil
+}
 
-	// Handle different methods
-	var resp pluginResponse
+// Handle handles counter requests
+func (p *counterPlugin) Handle(ctx context.Context, req base.Request) (base.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var resp base.Response
 	switch req.Method {
 	case "increment":
 		counter := "default"
 		if c, ok := req.Params["counter"].(string); ok {
 			counter = c
 		}
-		
-		state.Counters[counter]++
-		state.LastUpdated = time.Now()
-		
+
+		p.state.Counters[counter]++
+		p.state.LastUpdated = time.Now()
+
 		// Add to history
-		state.History = append(state.History, historyEntry{
+		p.state.History = append(p.state.History, historyEntry{
 			Timestamp: time.Now(),
 			Counter:   counter,
-			Value:     state.Counters[counter],
+			Value:     p.state.Counters[counter],
 			Operation: "increment",
 		})
-		
+
 		// Keep history limited
-		if len(state.History) > 100 {
-			state.History = state.History[len(state.History)-100:]
+		if len(p.state.History) > 100 {
+			p.state.History = p.state.History[len(p.state.History)-100:]
 		}
 
-		resp = pluginResponse{
+		resp = base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
 				"counter": counter,
-				"value":   state.Counters[counter],
+				"value":   p.state.Counters[counter],
 			},
 		}
 
@@ -195,24 +140,24 @@ func handleRequest(msg rpcMessage) rpcResponse {
 		if c, ok := req.Params["counter"].(string); ok {
 			counter = c
 		}
-		
-		state.Counters[counter]--
-		state.LastUpdated = time.Now()
-		
+
+		p.state.Counters[counter]--
+		p.state.LastUpdated = time.Now()
+
 		// Add to history
-		state.History = append(state.History, historyEntry{
+		p.state.History = append(p.state.History, historyEntry{
 			Timestamp: time.Now(),
 			Counter:   counter,
-			Value:     state.Counters[counter],
+			Value:     p.state.Counters[counter],
 			Operation: "decrement",
 		})
 
-		resp = pluginResponse{
+		resp = base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
 				"counter": counter,
-				"value":   state.Counters[counter],
+				"value":   p.state.Counters[counter],
 			},
 		}
 
@@ -222,13 +167,13 @@ func handleRequest(msg rpcMessage) rpcResponse {
 			counter = c
 		}
 
-		resp = pluginResponse{
+		resp = base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
 				"counter": counter,
-				"value":   state.Counters[counter],
-				"label":   state.Labels[counter],
+				"value":   p.state.Counters[counter],
+				"label":   p.state.Labels[counter],
 			},
 		}
 
@@ -237,16 +182,16 @@ func handleRequest(msg rpcMessage) rpcResponse {
 		if c, ok := req.Params["counter"].(string); ok {
 			counter = c
 		}
-		
+
 		label := ""
 		if l, ok := req.Params["label"].(string); ok {
 			label = l
 		}
-		
-		state.Labels[counter] = label
-		state.LastUpdated = time.Now()
 
-		resp = pluginResponse{
+		p.state.Labels[counter] = label
+		p.state.LastUpdated = time.Now()
+
+		resp = base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
@@ -256,13 +201,13 @@ func handleRequest(msg rpcMessage) rpcResponse {
 		}
 
 	case "get_all":
-		resp = pluginResponse{
+		resp = base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
-				"counters":     state.Counters,
-				"labels":       state.Labels,
-				"last_updated": state.LastUpdated,
+				"counters":     p.state.Counters,
+				"labels":       p.state.Labels,
+				"last_updated": p.state.LastUpdated,
 			},
 		}
 
@@ -271,13 +216,13 @@ func handleRequest(msg rpcMessage) rpcResponse {
 		if l, ok := req.Params["limit"].(float64); ok {
 			limit = int(l)
 		}
-		
-		history := state.History
+
+		history := p.state.History
 		if len(history) > limit {
 			history = history[len(history)-limit:]
 		}
 
-		resp = pluginResponse{
+		resp = base.Response{
 			ID:      req.ID,
 			Success: true,
 			Result: map[string]interface{}{
@@ -286,120 +231,54 @@ func handleRequest(msg rpcMessage) rpcResponse {
 		}
 
 	default:
-		resp = pluginResponse{
+		resp = base.Response{
 			ID:      req.ID,
 			Success: false,
 			Error:   fmt.Sprintf("unknown method: %s", req.Method),
 		}
 	}
 
-	resp.Metadata.ProcessingTime = time.Since(startTime)
-
-	// Marshal response
-	result, err := json.Marshal(resp)
-	if err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to marshal response: %v", err),
-		}
-	}
-
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: result,
-	}
-}
-
-func handleHealthCheck(msg rpcMessage) rpcResponse {
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"healthy"}`),
-	}
-}
-
-func handlePrepareShutdown(msg rpcMessage) rpcResponse {
-	log.Println("Preparing for shutdown...")
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"prepared"}`),
-	}
+	return resp, nil
 }
 
-func handleShutdown(msg rpcMessage) rpcResponse {
-	log.Println("Shutting down...")
-	running = false
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"shutdown"}`),
-	}
-}
+// ExportState exports the counters in the V2 format
+func (p *counterPlugin) ExportState(ctx context.Context) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-func handleExportState(msg rpcMessage) rpcResponse {
-	data, err := json.Marshal(state)
+	data, err := json.Marshal(p.state)
 	if err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to marshal state: %v", err),
-		}
-	}
-
-	// Return state as string
-	result, _ := json.Marshal(string(data))
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: result,
+		return nil, fmt.Errorf("failed to marshal state: %w", err)
 	}
+	return data, nil
 }
 
-func handleImportState(msg rpcMessage) rpcResponse {
-	var stateData string
-	if err := json.Unmarshal(msg.Params, &stateData); err != nil {
-		return rpcResponse{
-			ID:    msg.ID,
-			Error: fmt.Sprintf("failed to unmarshal state data: %v", err),
-		}
-	}
+// ImportState imports V2 state, migrating V1 state when necessary
+func (p *counterPlugin) ImportState(ctx context.Context, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	// Try to unmarshal as V2 first
 	var newState pluginStateV2
-	if err := json.Unmarshal([]byte(stateData), &newState); err == nil && newState.Version == "2.0.0" {
-		state = newState
-		log.Printf("State imported (V2): %d counters, %d labels, %d history entries", 
-			len(state.Counters), len(state.Labels), len(state.History))
-	} else {
-		// Try V1 format for migration
-		var v1State pluginStateV1
-		if err := json.Unmarshal([]byte(stateData), &v1State); err == nil {
-			// Migrate from V1 to V2
-			state = pluginStateV2{
-				Version:     pluginVersion,
-				Counters:    v1State.Counters,
-				Labels:      make(map[string]string),
-				History:     make([]historyEntry, 0),
-				LastUpdated: time.Now(),
-			}
-			
-			// Add migration history entry
-			for counter, value := range state.Counters {
-				state.History = append(state.History, historyEntry{
-					Timestamp: time.Now(),
-					Counter:   counter,
-					Value:     value,
-					Operation: "migrated_from_v1",
-				})
-			}
-			
-			log.Printf("State migrated from V1 to V2: %d counters", len(state.Counters))
-		} else {
-			return rpcResponse{
-				ID:    msg.ID,
-				Error: fmt.Sprintf("failed to unmarshal state: %v", err),
-			}
-		}
+	if err := json.Unmarshal(data, &newState); err == nil && newState.Version == stateVersionV2 {
+		p.state = newState
+		p.logger.Info("State imported (V2)",
+			zap.Int("counters", len(p.state.Counters)),
+			zap.Int("labels", len(p.state.Labels)),
+			zap.Int("history", len(p.state.History)))
+		return nil
 	}
 
-	return rpcResponse{
-		ID:     msg.ID,
-		Result: json.RawMessage(`{"status":"imported"}`),
+	// Anything else is V1 state, which hosts without the migrator registered
+	// pass through unchanged
+	migrated, err := v1ToV2{}.Migrate(ctx, data, stateVersionV1, stateVersionV2)
+	if err != nil {
+		return err
 	}
-}
\ No newline at end of file
+	if err := json.Unmarshal(migrated, &p.state); err != nil {
+		return fmt.Errorf("failed to unmarshal state: %w", err)
+	}
+
+	p.logger.Info("State migrated from V1 to V2", zap.Int("counters", len(p.state.Counters)))
+	return nil
+}
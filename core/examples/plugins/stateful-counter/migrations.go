@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Versions of the plugin whose state formats differ
+const (
+	stateVersionV1 = "1.0.0"
+	stateVersionV2 = "2.0.0"
+)
+
+// v1ToV2 migrates V1 state to the V2 format. It has the methods of the
+// host's state migrator, so the host can register it for the 1.0.0 to
+// 2.0.0 edge and chain it with migrators for later versions.
+type v1ToV2 struct{}
+
+// CanMigrate reports whether the migration is from V1 to V2
+func (v1ToV2) CanMigrate(fromVersion, toVersion string) bool {
+	return fromVersion == stateVersionV1 && toVersion == stateVersionV2
+}
+
+// Migrate keeps every counter, starts with no labels and records the
+// migration in the history
+func (v1ToV2) Migrate(ctx context.Context, fromState []byte, fromVersion, toVersion string) ([]byte, error) {
+	var v1State pluginStateV1
+	if err := json.Unmarshal(fromState, &v1State); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal V1 state: %w", err)
+	}
+
+	now := time.Now()
+	v2State := pluginStateV2{
+		Version:     stateVersionV2,
+		Counters:    v1State.Counters,
+		Labels:      make(map[string]string),
+		History:     make([]historyEntry, 0, len(v1State.Counters)),
+		LastUpdated: now,
+	}
+	if v2State.Counters == nil {
+		v2State.Counters = make(map[string]int64)
+	}
+	for counter, value := range v2State.Counters {
+		v2State.History = append(v2State.History, historyEntry{
+			Timestamp: now,
+			Counter:   counter,
+			Value:     value,
+			Operation: "migrated_from_v1",
+		})
+	}
+
+	return json.Marshal(v2State)
+}
+
+// Validate checks that migrated state is in the V2 format
+func (v1ToV2) Validate(state []byte, version string) error {
+	var v2State pluginStateV2
+	if err := json.Unmarshal(state, &v2State); err != nil {
+		return err
+	}
+	if v2State.Version != version || v2State.Counters == nil {
+		return fmt.Errorf("state is not in the %s format", version)
+	}
+	return nil
+}
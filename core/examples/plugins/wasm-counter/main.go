@@ -0,0 +1,109 @@
+//go:build wasip1
+
+// Package main implements a counter plugin that runs in the WebAssembly
+// sandbox
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/wasm"
+)
+
+// counterPlugin keeps named counters, which survive hot-swaps
+type counterPlugin struct {
+	counters map[string]int64
+	mu       sync.Mutex
+}
+
+func init() {
+	wasm.Register(&counterPlugin{counters: make(map[string]int64)})
+}
+
+// main isn't run for reactor modules, but package main requires it
+func main() {}
+
+// Handle serves increment, get, note, allocate, spin and loop requests
+func (p *counterPlugin) Handle(req wasm.Request) (wasm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name, _ := req.Params["name"].(string)
+	if name == "" {
+		name = "default"
+	}
+
+	switch req.Method {
+	case "increment":
+		p.counters[name]++
+		return wasm.Response{Success: true, Result: map[string]interface{}{"name": name, "value": p.counters[name]}}, nil
+
+	case "get":
+		return wasm.Response{Success: true, Result: map[string]interface{}{"name": name, "value": p.counters[name]}}, nil
+
+	case "note":
+		// Notes are kept in the plugin's data directory, the only
+		// directory it can reach
+		text, _ := req.Params["text"].(string)
+		path := filepath.Join(wasm.DataDir, name+".txt")
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return wasm.Response{}, fmt.Errorf("failed to write note: %w", err)
+		}
+		wasm.Log(wasm.LogInfo, "wrote note "+path)
+		return wasm.Response{Success: true, Result: map[string]interface{}{"path": path}}, nil
+
+	case "allocate":
+		// Allocates mb megabytes, to show the host's memory limit
+		mb, _ := req.Params["mb"].(float64)
+		buf := make([]byte, int(mb)<<20)
+		for i := range buf {
+			buf[i] = 1
+		}
+		return wasm.Response{Success: true, Result: map[string]interface{}{"bytes": len(buf)}}, nil
+
+	case "spin":
+		// Never returns, to show the host stopping runaway plugins
+		for {
+			spin()
+		}
+
+	case "loop":
+		// Never returns and never calls a function, to show the host
+		// metering instructions rather than calls
+		for i := 0; ; i++ {
+			looped = i
+		}
+
+	default:
+		return wasm.Response{}, fmt.Errorf("unknown method: %s", req.Method)
+	}
+}
+
+//go:noinline
+func spin() {}
+
+// looped is written by the loop method so the loop isn't optimized away
+var looped int
+
+// ExportState returns the counters
+func (p *counterPlugin) ExportState() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return json.Marshal(p.counters)
+}
+
+// ImportState restores the counters
+func (p *counterPlugin) ImportState(state []byte) error {
+	counters := make(map[string]int64)
+	if err := json.Unmarshal(state, &counters); err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counters = counters
+	return nil
+}
@@ -0,0 +1,233 @@
+package routing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCallDenied is matched by errors for calls the caller isn't granted
+var ErrCallDenied = errors.New("call denied")
+
+// CallDeniedError reports a call rejected by the caller's grants. It carries
+// the PermissionDenied gRPC status.
+type CallDeniedError struct {
+	Caller  string
+	Service string
+	Method  string
+}
+
+func (e *CallDeniedError) Error() string {
+	return fmt.Sprintf("call denied: plugin %s may not call %s on %s", e.Caller, e.Method, e.Service)
+}
+
+// Is makes errors.Is(err, ErrCallDenied) true
+func (e *CallDeniedError) Is(target error) bool {
+	return target == ErrCallDenied
+}
+
+// GRPCStatus implements the interface used by the status package
+func (e *CallDeniedError) GRPCStatus() *status.Status {
+	return status.New(codes.PermissionDenied, e.Error())
+}
+
+// Grant allows a caller to invoke methods of a service. Methods are full
+// gRPC method names such as "/storage.v1.Storage/Get" or patterns like
+// "/storage.v1.Storage/*"; no methods allows every method.
+type Grant struct {
+	Service string
+	Methods []string
+}
+
+// allows reports whether the grant covers a call
+func (g Grant) allows(service, method string) bool {
+	if g.Service != service {
+		return false
+	}
+	if len(g.Methods) == 0 {
+		return true
+	}
+	for _, pattern := range g.Methods {
+		if pattern == "*" || pattern == method {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type callerKey struct{}
+
+// WithCaller records the plugin making a request so the router can apply
+// its grants
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the plugin making a request, if known
+func CallerFromContext(ctx context.Context) (string, bool) {
+	caller, ok := ctx.Value(callerKey{}).(string)
+	return caller, ok && caller != ""
+}
+
+// SetCallerGrants replaces the services and methods a caller may invoke.
+// Callers without grants can't invoke anything.
+func (pr *ProtocolRouter) SetCallerGrants(caller string, grants []Grant) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.grants[caller] = append([]Grant(nil), grants...)
+}
+
+// CallerGrants returns the grants of a caller
+func (pr *ProtocolRouter) CallerGrants(caller string) []Grant {
+	pr.mutex.RLock()
+	defer pr.mutex.RUnlock()
+	return append([]Grant(nil), pr.grants[caller]...)
+}
+
+// IssueCallerToken creates the token a plugin presents to the ingress where
+// it can't be identified by peer credentials, replacing any earlier token
+func (pr *ProtocolRouter) IssueCallerToken(caller string) (string, error) {
+	token, err := newCallerToken()
+	if err != nil {
+		return "", err
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	for t, name := range pr.callerTokens {
+		if name == caller {
+			delete(pr.callerTokens, t)
+		}
+	}
+	pr.callerTokens[token] = caller
+	return token, nil
+}
+
+// RegisterCallerPID attributes calls arriving through the ingress from the
+// process pid to caller
+func (pr *ProtocolRouter) RegisterCallerPID(caller string, pid int) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	for p, name := range pr.callerPIDs {
+		if name == caller {
+			delete(pr.callerPIDs, p)
+		}
+	}
+	pr.callerPIDs[pid] = caller
+}
+
+// newCallerToken generates a random caller token
+func newCallerToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate caller token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// AddCallerToken issues a caller another token, keeping the ones it has,
+// such as for a second version of a plugin running alongside the first
+func (pr *ProtocolRouter) AddCallerToken(caller string) (string, error) {
+	token, err := newCallerToken()
+	if err != nil {
+		return "", err
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.callerTokens[token] = caller
+	return token, nil
+}
+
+// AddCallerPID attributes calls from the process pid to caller, keeping
+// the caller's other processes
+func (pr *ProtocolRouter) AddCallerPID(caller string, pid int) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.callerPIDs[pid] = caller
+}
+
+// RevokeCallerIdentity forgets a process and a token a caller was
+// identified by, leaving its other ones and its grants
+func (pr *ProtocolRouter) RevokeCallerIdentity(pid int, token string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	delete(pr.callerPIDs, pid)
+	delete(pr.callerTokens, token)
+}
+
+// ReleaseCaller forgets a caller's identity and grants
+func (pr *ProtocolRouter) ReleaseCaller(caller string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	for pid, name := range pr.callerPIDs {
+		if name == caller {
+			delete(pr.callerPIDs, pid)
+		}
+	}
+	for token, name := range pr.callerTokens {
+		if name == caller {
+			delete(pr.callerTokens, token)
+		}
+	}
+	delete(pr.grants, caller)
+}
+
+// IdentifyCaller attributes a connection to a plugin, preferring the
+// kernel-reported pid of the peer over a presented token
+func (pr *ProtocolRouter) IdentifyCaller(pid int, token string) (string, bool) {
+	pr.mutex.RLock()
+	defer pr.mutex.RUnlock()
+	if caller, ok := pr.callerPIDs[pid]; ok && pid > 0 {
+		return caller, true
+	}
+	caller, ok := pr.callerTokens[token]
+	return caller, ok && token != ""
+}
+
+// DeniedCalls returns the number of denied calls per caller
+func (pr *ProtocolRouter) DeniedCalls() map[string]uint64 {
+	pr.mutex.RLock()
+	defer pr.mutex.RUnlock()
+	counts := make(map[string]uint64, len(pr.denied))
+	for caller, n := range pr.denied {
+		counts[caller] = n
+	}
+	return counts
+}
+
+// authorize checks the caller in ctx against its grants. Requests without a
+// caller come from the node itself and are allowed.
+func (pr *ProtocolRouter) authorize(ctx context.Context, service, method string) error {
+	caller, ok := CallerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	pr.mutex.RLock()
+	grants := pr.grants[caller]
+	pr.mutex.RUnlock()
+	for _, grant := range grants {
+		if grant.allows(service, method) {
+			return nil
+		}
+	}
+
+	pr.recordDenied(caller)
+	return &CallDeniedError{Caller: caller, Service: service, Method: method}
+}
+
+func (pr *ProtocolRouter) recordDenied(caller string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.denied[caller]++
+}
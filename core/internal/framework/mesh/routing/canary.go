@@ -0,0 +1,201 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
+)
+
+// Split divides a service's traffic between its stable version and a canary
+// version. Requests pinned to either version are sent to it; the others are
+// sent to the canary with the split's weight, in percent.
+type Split struct {
+	stable string
+	canary string
+
+	mu     sync.Mutex
+	weight int
+}
+
+// NewSplit creates a split that sends no unpinned traffic to the canary yet
+func NewSplit(stable, canary string) *Split {
+	return &Split{stable: stable, canary: canary}
+}
+
+// Stable returns the stable version
+func (s *Split) Stable() string { return s.stable }
+
+// Canary returns the canary version
+func (s *Split) Canary() string { return s.canary }
+
+// SetWeight sets the percentage of unpinned requests sent to the canary
+func (s *Split) SetWeight(percent int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weight = min(max(percent, 0), 100)
+}
+
+// Weight returns the percentage of unpinned requests sent to the canary
+func (s *Split) Weight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.weight
+}
+
+// Pick chooses the version a request is sent to. pinned is the version the
+// request asked for, if any; versions the split doesn't have are ignored.
+func (s *Split) Pick(pinned string) string {
+	if pinned == s.stable || pinned == s.canary {
+		return pinned
+	}
+	if rand.IntN(100) < s.Weight() {
+		return s.canary
+	}
+	return s.stable
+}
+
+type pinnedVersionKey struct{}
+
+// WithPinnedVersion pins requests made with ctx to a version of the service
+// while it is split
+func WithPinnedVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, pinnedVersionKey{}, version)
+}
+
+// PinnedVersion returns the version requests made with ctx are pinned to
+func PinnedVersion(ctx context.Context) string {
+	version, _ := ctx.Value(pinnedVersionKey{}).(string)
+	return version
+}
+
+// canaryRoute is the canary version of a split service
+type canaryRoute struct {
+	split    *Split
+	endpoint mesh.ServiceEndpoint
+	pool     *pool.ProtocolLevelConnectionPool
+}
+
+// StartCanary splits a service's traffic between its endpoint and a canary
+// version on endpoint, as split decides
+func (pr *ProtocolRouter) StartCanary(serviceName string, split *Split, endpoint mesh.ServiceEndpoint) error {
+	// The canary's connections are accounted separately, so the stable
+	// version's don't count against them
+	connectionPool, err := pool.NewProtocolLevelConnectionPool(
+		fmt.Sprintf("%s@%s", serviceName, split.Canary()),
+		endpoint,
+		pr.resourceManager,
+		pr.logger,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool for service %s: %w", serviceName, err)
+	}
+
+	pr.mutex.Lock()
+	if _, exists := pr.connectionPools[serviceName]; !exists {
+		pr.mutex.Unlock()
+		connectionPool.Close()
+		return fmt.Errorf("service %s not registered", serviceName)
+	}
+	previous := pr.canaries[serviceName]
+	pr.canaries[serviceName] = &canaryRoute{split: split, endpoint: endpoint, pool: connectionPool}
+	pr.mutex.Unlock()
+
+	if previous != nil {
+		previous.pool.Close()
+	}
+
+	pr.logger.Info("Started canary",
+		zap.String("service", serviceName),
+		zap.String("stable", split.Stable()),
+		zap.String("canary", split.Canary()))
+	return nil
+}
+
+// Split returns the split of a service with a canary
+func (pr *ProtocolRouter) Split(serviceName string) (*Split, bool) {
+	pr.mutex.RLock()
+	defer pr.mutex.RUnlock()
+	if canary, exists := pr.canaries[serviceName]; exists {
+		return canary.split, true
+	}
+	return nil, false
+}
+
+// PromoteCanary makes a service's canary its only endpoint and resumes the
+// service if drained. The stable version's connections are closed.
+func (pr *ProtocolRouter) PromoteCanary(serviceName string) error {
+	pr.mutex.Lock()
+	canary, exists := pr.canaries[serviceName]
+	if !exists {
+		pr.mutex.Unlock()
+		return fmt.Errorf("service %s has no canary", serviceName)
+	}
+	delete(pr.canaries, serviceName)
+	previous := pr.connectionPools[serviceName]
+	pr.services[serviceName] = []mesh.ServiceEndpoint{canary.endpoint}
+	pr.connectionPools[serviceName] = canary.pool
+	pr.serviceHealth[serviceName] = mesh.HealthStatusUnknown
+	pr.resume(serviceName)
+	pr.mutex.Unlock()
+
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			pr.logger.Warn("Failed to close connection pool",
+				zap.String("service", serviceName),
+				zap.Error(err))
+		}
+	}
+
+	pr.logger.Info("Promoted canary",
+		zap.String("service", serviceName),
+		zap.String("version", canary.split.Canary()))
+	return nil
+}
+
+// AbortCanary sends all of a service's traffic back to its stable version
+// and closes the canary's connections
+func (pr *ProtocolRouter) AbortCanary(serviceName string) {
+	pr.mutex.Lock()
+	canary, exists := pr.canaries[serviceName]
+	delete(pr.canaries, serviceName)
+	pr.mutex.Unlock()
+
+	if !exists {
+		return
+	}
+	if err := canary.pool.Close(); err != nil {
+		pr.logger.Warn("Failed to close connection pool",
+			zap.String("service", serviceName),
+			zap.Error(err))
+	}
+
+	pr.logger.Info("Aborted canary",
+		zap.String("service", serviceName),
+		zap.String("version", canary.split.Canary()))
+}
+
+// routeFor returns the connection pool a request to a service goes to, and
+// the version it was picked if the service has a canary. Callers must hold
+// pr.mutex.
+func (pr *ProtocolRouter) routeFor(ctx context.Context, serviceName string) (*pool.ProtocolLevelConnectionPool, string, bool) {
+	connectionPool, exists := pr.connectionPools[serviceName]
+	if !exists {
+		return nil, "", false
+	}
+	canary, split := pr.canaries[serviceName]
+	if !split {
+		return connectionPool, "", true
+	}
+
+	version := canary.split.Pick(PinnedVersion(ctx))
+	if version == canary.split.Canary() {
+		return canary.pool, version, true
+	}
+	return connectionPool, version, true
+}
@@ -0,0 +1,183 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
+	lifecyclev1 "github.com/blackhole-pro/blackhole/core/pkg/plugins/lifecycle/proto/v1"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// IngressSocketName is the ingress socket's file name in the plugin socket
+// directory
+const IngressSocketName = "mesh-ingress.sock"
+
+// unknownCaller is the caller denied calls are counted under when the
+// calling process couldn't be identified
+const unknownCaller = "unknown"
+
+// lifecycleMethodPrefix prefixes the methods of the lifecycle service every
+// mesh plugin serves to the host
+var lifecycleMethodPrefix = "/" + lifecyclev1.PluginLifecycle_ServiceDesc.ServiceName + "/"
+
+// Ingress is the endpoint plugins call other services through. It
+// identifies the calling plugin by the peer credentials of its socket or by
+// its token, then routes the call subject to the plugin's grants.
+type Ingress struct {
+	router *ProtocolRouter
+	server *grpc.Server
+	logger *zap.Logger
+}
+
+// NewIngress creates an ingress for router
+func NewIngress(router *ProtocolRouter, logger *zap.Logger) *Ingress {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	i := &Ingress{router: router, logger: logger}
+	i.server = grpc.NewServer(
+		grpc.Creds(PeerCredentials()),
+		grpc.ForceServerCodec(pool.RawCodec{}),
+		grpc.UnknownServiceHandler(i.forward),
+	)
+	return i
+}
+
+// Listen creates the ingress unix socket, replacing a stale one
+func (i *Ingress) Listen(socketPath string) (net.Listener, error) {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale ingress socket: %w", err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on ingress socket: %w", err)
+	}
+	return listener, nil
+}
+
+// Serve accepts plugin calls on listener until Stop is called
+func (i *Ingress) Serve(listener net.Listener) error {
+	return i.server.Serve(listener)
+}
+
+// Stop waits for in-flight calls and stops serving
+func (i *Ingress) Stop() {
+	i.server.GracefulStop()
+}
+
+// forward handles every call made to the ingress
+func (i *Ingress) forward(_ interface{}, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	method, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "method not available")
+	}
+	// Only the host may manage a plugin's lifecycle or read its state
+	if strings.HasPrefix(method, lifecycleMethodPrefix) {
+		return status.Error(codes.PermissionDenied, "plugin lifecycle calls are reserved for the host")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	caller, pid, ok := i.identify(ctx, md)
+	if !ok {
+		i.router.recordDenied(unknownCaller)
+		i.logger.Warn("Denied call from unidentified process",
+			zap.Int("pid", pid),
+			zap.String("method", method))
+		return status.Error(codes.PermissionDenied, "caller is not a registered plugin")
+	}
+
+	service := first(md.Get(protocol.MetadataService))
+	if service == "" {
+		return status.Errorf(codes.InvalidArgument, "missing %s metadata", protocol.MetadataService)
+	}
+
+	// Calls are proxied as streams, which carries unary and streaming
+	// methods alike without knowing which a method is
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if version := first(md.Get(protocol.MetadataPluginVersion)); version != "" {
+		ctx = WithPinnedVersion(ctx, version)
+	}
+	upstream, done, err := i.router.RouteStream(WithCaller(ctx, caller), service, method)
+	if err != nil {
+		return status.Convert(err).Err()
+	}
+	err = proxy(stream, upstream)
+	done(err)
+	return err
+}
+
+// proxy copies messages from the caller to the service until the caller
+// finishes sending, and from the service to the caller until it ends the
+// call, passing its headers and trailers through
+func proxy(downstream grpc.ServerStream, upstream grpc.ClientStream) error {
+	go func() {
+		for {
+			var msg []byte
+			if err := downstream.RecvMsg(&msg); err != nil {
+				// The call is cancelled if the caller failed rather than
+				// finished
+				if err == io.EOF {
+					upstream.CloseSend()
+				}
+				return
+			}
+			if err := upstream.SendMsg(&msg); err != nil {
+				// The service ended the call; RecvMsg reports why
+				return
+			}
+		}
+	}()
+
+	header, err := upstream.Header()
+	if err == nil && len(header) > 0 {
+		if err := downstream.SendHeader(header); err != nil {
+			return err
+		}
+	}
+	for {
+		var msg []byte
+		if err := upstream.RecvMsg(&msg); err != nil {
+			downstream.SetTrailer(upstream.Trailer())
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := downstream.SendMsg(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// identify attributes a call to a plugin
+func (i *Ingress) identify(ctx context.Context, md metadata.MD) (string, int, bool) {
+	pid := 0
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(PeerInfo); ok {
+			pid = info.PID
+		}
+	}
+	caller, ok := i.router.IdentifyCaller(pid, first(md.Get(protocol.MetadataToken)))
+	return caller, pid, ok
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
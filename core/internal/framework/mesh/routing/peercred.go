@@ -0,0 +1,57 @@
+package routing
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// PeerInfo is the credentials.AuthInfo of an ingress connection: the
+// process on the other end of the unix socket as reported by the kernel
+type PeerInfo struct {
+	credentials.CommonAuthInfo
+	PID int
+	UID int
+}
+
+// AuthType implements credentials.AuthInfo
+func (PeerInfo) AuthType() string {
+	return "peercred"
+}
+
+// peerCredentials is gRPC transport security for unix sockets. It adds no
+// encryption; the server side records who the peer is.
+type peerCredentials struct{}
+
+// PeerCredentials returns transport credentials that attach a PeerInfo to
+// every connection accepted over a unix socket
+func PeerCredentials() credentials.TransportCredentials {
+	return peerCredentials{}
+}
+
+func (peerCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, PeerInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}, nil
+}
+
+func (peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	info := PeerInfo{CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity}}
+	if pid, uid, err := protocol.PeerCred(conn); err == nil {
+		info.PID, info.UID = pid, uid
+	}
+	return conn, info, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
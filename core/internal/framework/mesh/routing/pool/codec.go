@@ -0,0 +1,35 @@
+package pool
+
+import "fmt"
+
+// RawCodec passes already-encoded messages through unchanged, so the mesh
+// can route calls without knowing their protobuf types
+type RawCodec struct{}
+
+// Marshal returns the bytes of a *[]byte or []byte
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case *[]byte:
+		return *b, nil
+	default:
+		return nil, fmt.Errorf("raw codec cannot marshal %T", v)
+	}
+}
+
+// Unmarshal stores data in a *[]byte
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Name implements encoding.Codec. The bytes are protobuf on the wire, so
+// peers see an ordinary proto call.
+func (RawCodec) Name() string {
+	return "proto"
+}
@@ -231,7 +231,7 @@ func (p *ProtocolLevelConnectionPool) InvokeMethod(ctx context.Context, fullMeth
 	
 	// Execute the gRPC call
 	var respBytes []byte
-	err = conn.conn.Invoke(ctx, fullMethod, reqBytes, &respBytes)
+	err = conn.conn.Invoke(ctx, fullMethod, reqBytes, &respBytes, grpc.ForceCodec(RawCodec{}))
 	
 	// Record metrics and release connection
 	duration := time.Since(start)
@@ -245,6 +245,34 @@ func (p *ProtocolLevelConnectionPool) InvokeMethod(ctx context.Context, fullMeth
 	return respBytes, nil
 }
 
+// streamDesc describes a call whose client and server may both stream, which
+// also carries unary and one-sided streaming calls unchanged
+var streamDesc = &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+
+// NewStream opens a streaming gRPC call using protocol-level routing. done
+// must be called with the call's final error to return the connection to
+// the pool.
+func (p *ProtocolLevelConnectionPool) NewStream(ctx context.Context, fullMethod string) (grpc.ClientStream, func(error), error) {
+	start := time.Now()
+
+	conn, err := p.GetConnection(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stream, err := conn.conn.NewStream(ctx, streamDesc, fullMethod, grpc.ForceCodec(RawCodec{}))
+	if err != nil {
+		p.ReleaseConnection(conn, time.Since(start), false)
+		return nil, nil, fmt.Errorf("gRPC stream failed: %w", err)
+	}
+
+	var once sync.Once
+	done := func(err error) {
+		once.Do(func() { p.ReleaseConnection(conn, time.Since(start), err == nil) })
+	}
+	return stream, done, nil
+}
+
 // Close closes all connections in the pool
 func (p *ProtocolLevelConnectionPool) Close() error {
 	// Stop health check routine
@@ -5,12 +5,16 @@ package routing
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
@@ -23,6 +27,21 @@ type ProtocolRouter struct {
 	connectionPools  map[string]*pool.ProtocolLevelConnectionPool  // service -> connection pool
 	serviceHealth    map[string]mesh.HealthStatus                 // service -> health status
 
+	// Caller authorization
+	grants       map[string][]Grant // caller -> services and methods it may invoke
+	callerPIDs   map[int]string     // pid -> caller
+	callerTokens map[string]string  // token -> caller
+	denied       map[string]uint64  // caller -> denied calls
+
+	// In-flight requests, counted so services can be drained
+	traffic map[string]*traffic // service -> in-flight requests
+
+	// Canary versions services' traffic is split with
+	canaries map[string]*canaryRoute // service -> canary
+
+	// Told about every request routed to a service
+	observer RouteObserver
+
 	// Resource management
 	resourceDetector *pool.ResourceDetector
 	resourceManager  *pool.ResourceManager
@@ -60,6 +79,12 @@ func NewProtocolRouter(logger *zap.Logger) *ProtocolRouter {
 		services:           make(map[string][]mesh.ServiceEndpoint),
 		connectionPools:    make(map[string]*pool.ProtocolLevelConnectionPool),
 		serviceHealth:      make(map[string]mesh.HealthStatus),
+		grants:             make(map[string][]Grant),
+		callerPIDs:         make(map[int]string),
+		callerTokens:       make(map[string]string),
+		denied:             make(map[string]uint64),
+		traffic:            make(map[string]*traffic),
+		canaries:           make(map[string]*canaryRoute),
 		resourceDetector:   resourceDetector,
 		resourceManager:    resourceManager,
 		logger:             logger,
@@ -113,13 +138,76 @@ func (pr *ProtocolRouter) RegisterService(serviceName string, endpoint mesh.Serv
 	return nil
 }
 
+// RouteObserver is told about the requests the router sends to services,
+// such as to record metrics of the plugins serving them
+type RouteObserver interface {
+	// BeginRequest is called as a request is sent to a service, with the
+	// version it was sent to if the service has a canary. The returned
+	// function is called once the request is done, with its error if it
+	// points at the service, not at the caller giving up or being refused.
+	BeginRequest(serviceName, version, fullMethod string) func(err error)
+}
+
+// SetRouteObserver sets what is told about routed requests
+func (pr *ProtocolRouter) SetRouteObserver(observer RouteObserver) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.observer = observer
+}
+
+// observe tells the observer, if any, that a request is being sent, and
+// returns the function to call with its outcome
+func observe(observer RouteObserver, serviceName, version, fullMethod string) func(error) {
+	if observer == nil {
+		return func(error) {}
+	}
+	done := observer.BeginRequest(serviceName, version, fullMethod)
+	return func(err error) {
+		if !serviceFailed(err) {
+			err = nil
+		}
+		done(err)
+	}
+}
+
+// serviceFailed reports whether err means the service failed a request
+func serviceFailed(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange:
+		return false
+	}
+	return true
+}
+
 // RouteRequest routes a gRPC request using protocol-level routing
 func (pr *ProtocolRouter) RouteRequest(ctx context.Context, serviceName, fullMethod string, requestData []byte) ([]byte, error) {
 	start := time.Now()
 
-	// Get connection pool for service
+	// Check the caller is granted the method
+	if err := pr.authorize(ctx, serviceName, fullMethod); err != nil {
+		caller, _ := CallerFromContext(ctx)
+		pr.logger.Warn("Denied call from plugin",
+			zap.String("plugin", caller),
+			zap.String("service", serviceName),
+			zap.String("method", fullMethod))
+		return nil, err
+	}
+
+	// Count the request, waiting while the service is drained
+	finish, err := pr.TrackRequest(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	defer finish()
+
+	// Get connection pool for service, or for its canary
 	pr.mutex.RLock()
-	connectionPool, exists := pr.connectionPools[serviceName]
+	connectionPool, version, exists := pr.routeFor(ctx, serviceName)
+	observer := pr.observer
 	pr.mutex.RUnlock()
 
 	if !exists {
@@ -133,7 +221,9 @@ func (pr *ProtocolRouter) RouteRequest(ctx context.Context, serviceName, fullMet
 	}
 
 	// Route the request through the connection pool
+	done := observe(observer, serviceName, version, fullMethod)
 	responseData, err := connectionPool.InvokeMethod(ctx, fullMethod, requestData)
+	done(err)
 	if err != nil {
 		// Update service health on failure
 		pr.updateServiceHealth(serviceName, mesh.HealthStatusDegraded)
@@ -152,6 +242,59 @@ func (pr *ProtocolRouter) RouteRequest(ctx context.Context, serviceName, fullMet
 	return responseData, nil
 }
 
+// RouteStream opens a streaming call to a service using protocol-level
+// routing. done must be called with the call's final error once it ends.
+func (pr *ProtocolRouter) RouteStream(ctx context.Context, serviceName, fullMethod string) (grpc.ClientStream, func(error), error) {
+	if err := pr.authorize(ctx, serviceName, fullMethod); err != nil {
+		caller, _ := CallerFromContext(ctx)
+		pr.logger.Warn("Denied call from plugin",
+			zap.String("plugin", caller),
+			zap.String("service", serviceName),
+			zap.String("method", fullMethod))
+		return nil, nil, err
+	}
+
+	if !strings.HasPrefix(fullMethod, "/") {
+		return nil, nil, fmt.Errorf("invalid gRPC method format: %s", fullMethod)
+	}
+
+	finish, err := pr.TrackRequest(ctx, serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pr.mutex.RLock()
+	connectionPool, version, exists := pr.routeFor(ctx, serviceName)
+	observer := pr.observer
+	pr.mutex.RUnlock()
+
+	if !exists {
+		finish()
+		return nil, nil, fmt.Errorf("service %s not registered", serviceName)
+	}
+
+	observed := observe(observer, serviceName, version, fullMethod)
+	stream, release, err := connectionPool.NewStream(ctx, fullMethod)
+	if err != nil {
+		observed(err)
+		finish()
+		pr.updateServiceHealth(serviceName, mesh.HealthStatusDegraded)
+		return nil, nil, fmt.Errorf("failed to route stream to %s: %w", serviceName, err)
+	}
+
+	done := func(err error) {
+		release(err)
+		finish()
+		observed(err)
+		// Only transport failures make the service unhealthy, not errors it
+		// returned or callers giving up
+		if status.Code(err) == codes.Unavailable {
+			pr.updateServiceHealth(serviceName, mesh.HealthStatusDegraded)
+		}
+	}
+	return stream, done, nil
+}
+
 // DiscoverService returns endpoint information for a service
 func (pr *ProtocolRouter) DiscoverService(serviceName string) (mesh.ServiceEndpoint, error) {
 	pr.mutex.RLock()
@@ -273,11 +416,15 @@ func (pr *ProtocolRouter) Close() error {
 				zap.Error(err))
 		}
 	}
+	for _, canary := range pr.canaries {
+		canary.pool.Close()
+	}
 
 	// Clear all data
 	pr.services = make(map[string][]mesh.ServiceEndpoint)
 	pr.connectionPools = make(map[string]*pool.ProtocolLevelConnectionPool)
 	pr.serviceHealth = make(map[string]mesh.HealthStatus)
+	pr.canaries = make(map[string]*canaryRoute)
 
 	pr.logger.Info("Protocol router closed")
 	return lastError
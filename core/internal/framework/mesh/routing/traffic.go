@@ -0,0 +1,163 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
+)
+
+// traffic counts a service's in-flight requests and holds new ones while
+// the service is drained
+type traffic struct {
+	inFlight int
+	// resume is closed when a drained service takes requests again; nil
+	// while it isn't drained
+	resume chan struct{}
+	// idle is closed when the last in-flight request of a drained service
+	// finishes
+	idle chan struct{}
+}
+
+// trafficFor returns a service's traffic. Callers must hold pr.mutex.
+func (pr *ProtocolRouter) trafficFor(serviceName string) *traffic {
+	t, exists := pr.traffic[serviceName]
+	if !exists {
+		t = &traffic{}
+		pr.traffic[serviceName] = t
+	}
+	return t
+}
+
+// TrackRequest counts a request to a service as in flight until the
+// returned function is called. While the service is drained it waits for
+// the service to resume, or for ctx to end.
+func (pr *ProtocolRouter) TrackRequest(ctx context.Context, serviceName string) (func(), error) {
+	for {
+		pr.mutex.Lock()
+		t := pr.trafficFor(serviceName)
+		if t.resume == nil {
+			t.inFlight++
+			pr.mutex.Unlock()
+			return func() { pr.finishRequest(serviceName) }, nil
+		}
+		resume := t.resume
+		pr.mutex.Unlock()
+
+		select {
+		case <-resume:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (pr *ProtocolRouter) finishRequest(serviceName string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	t := pr.trafficFor(serviceName)
+	t.inFlight--
+	if t.inFlight == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// InFlight returns the number of requests to a service still in flight
+func (pr *ProtocolRouter) InFlight(serviceName string) int {
+	pr.mutex.RLock()
+	defer pr.mutex.RUnlock()
+
+	if t, exists := pr.traffic[serviceName]; exists {
+		return t.inFlight
+	}
+	return 0
+}
+
+// Drain holds new requests to a service and waits for those in flight to
+// finish. The service stays drained, even if ctx ends first, until Resume
+// or SwitchEndpoint is called.
+func (pr *ProtocolRouter) Drain(ctx context.Context, serviceName string) error {
+	pr.mutex.Lock()
+	t := pr.trafficFor(serviceName)
+	if t.resume == nil {
+		t.resume = make(chan struct{})
+	}
+	if t.inFlight == 0 {
+		pr.mutex.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	inFlight := t.inFlight
+	pr.mutex.Unlock()
+
+	pr.logger.Info("Draining service",
+		zap.String("service", serviceName),
+		zap.Int("in_flight", inFlight))
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain %s: %w", serviceName, ctx.Err())
+	}
+}
+
+// Resume lets held requests to a drained service proceed
+func (pr *ProtocolRouter) Resume(serviceName string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.resume(serviceName)
+}
+
+// resume reopens a drained service. Callers must hold pr.mutex.
+func (pr *ProtocolRouter) resume(serviceName string) {
+	t := pr.trafficFor(serviceName)
+	if t.resume != nil {
+		close(t.resume)
+		t.resume = nil
+	}
+}
+
+// SwitchEndpoint replaces a service's endpoints with endpoint and resumes
+// it if drained. Requests see either the old endpoint or the new one; the
+// old connections are closed.
+func (pr *ProtocolRouter) SwitchEndpoint(serviceName string, endpoint mesh.ServiceEndpoint) error {
+	connectionPool, err := pool.NewProtocolLevelConnectionPool(
+		serviceName,
+		endpoint,
+		pr.resourceManager,
+		pr.logger,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool for service %s: %w", serviceName, err)
+	}
+
+	pr.mutex.Lock()
+	previous := pr.connectionPools[serviceName]
+	pr.services[serviceName] = []mesh.ServiceEndpoint{endpoint}
+	pr.connectionPools[serviceName] = connectionPool
+	pr.serviceHealth[serviceName] = mesh.HealthStatusUnknown
+	pr.resume(serviceName)
+	pr.mutex.Unlock()
+
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			pr.logger.Warn("Failed to close connection pool",
+				zap.String("service", serviceName),
+				zap.Error(err))
+		}
+	}
+
+	pr.logger.Info("Switched service endpoint",
+		zap.String("service", serviceName),
+		zap.Bool("is_local", endpoint.IsLocal))
+	return nil
+}
@@ -0,0 +1,243 @@
+// Package archive implements the .plugin package format.
+//
+// A package is a gzip-compressed tar archive with the layout
+//
+//	plugin.yaml                  manifest
+//	CHECKSUMS                    sha256sum-style list of every other file
+//	SIGNATURE                    optional signature over CHECKSUMS
+//	bin/<os>-<arch>/<binary>     one executable per supported platform, or
+//	                             bin/wasip1-wasm for WebAssembly plugins
+//	proto/...                    optional .proto files and descriptor sets
+//	docs/..., LICENSE, ...       optional documentation
+//
+// The manifest and CHECKSUMS come first so a reader can identify a package
+// without reading the binaries.
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Well-known entries
+const (
+	ManifestFile  = "plugin.yaml"
+	ChecksumsFile = "CHECKSUMS"
+	SignatureFile = "SIGNATURE"
+	BinDir        = "bin"
+	ProtoDir      = "proto"
+)
+
+// Package errors
+var (
+	ErrNotPackage          = errors.New("not a plugin package")
+	ErrMissingManifest     = errors.New("package has no plugin.yaml")
+	ErrMissingChecksums    = errors.New("package has no CHECKSUMS")
+	ErrChecksumMismatch    = errors.New("package checksum mismatch")
+	ErrUnlistedFile        = errors.New("package file not listed in CHECKSUMS")
+	ErrMissingFile         = errors.New("package file listed in CHECKSUMS is missing")
+	ErrUnsafePath          = errors.New("unsafe path in package")
+	ErrNoBinaries          = errors.New("package has no binaries")
+	ErrPlatformUnsupported = errors.New("package has no binary for platform")
+)
+
+// Manifest is the part of plugin.yaml the package format relies on
+type Manifest struct {
+	Name         string   `yaml:"name"`
+	Version      string   `yaml:"version"`
+	Description  string   `yaml:"description"`
+	Architecture []string `yaml:"architecture"`
+	Binary       struct {
+		Name string `yaml:"name"`
+	} `yaml:"binary"`
+
+	// Capabilities declare what the plugin needs access to, such as
+	// "network" or "filesystem:write"
+	Capabilities []string `yaml:"capabilities"`
+}
+
+// BinaryName returns the file name of the plugin executable
+func (m Manifest) BinaryName() string {
+	if m.Binary.Name != "" {
+		return m.Binary.Name
+	}
+	return m.Name
+}
+
+// Signature is the signature block stored in SIGNATURE. It signs the exact
+// bytes of CHECKSUMS, which in turn cover every other file.
+type Signature struct {
+	Algorithm string    `json:"algorithm"`
+	KeyID     string    `json:"key_id"`
+	Publisher string    `json:"publisher,omitempty"`
+	SignedAt  time.Time `json:"signed_at"`
+	Value     []byte    `json:"signature"`
+}
+
+// Signer signs the CHECKSUMS of a package being packed
+type Signer interface {
+	Sign(manifest Manifest, checksums []byte) (*Signature, error)
+}
+
+// SignatureVerifier checks the signature of a package. It is called with a
+// nil signature for unsigned packages so it can decide whether to accept them.
+type SignatureVerifier interface {
+	VerifySignature(manifest Manifest, checksums []byte, sig *Signature) error
+}
+
+// Package describes a verified plugin package
+type Package struct {
+	Manifest  Manifest
+	Checksums map[string]string // path -> sha256
+	Signature *Signature
+	Platforms []string
+	Protos    []string
+
+	// Dir is where the package was unpacked, empty if it was only verified
+	Dir string
+
+	checksumData []byte
+}
+
+// ChecksumData returns the raw CHECKSUMS file
+func (p *Package) ChecksumData() []byte {
+	return p.checksumData
+}
+
+// Binary returns the path of the executable for a platform such as
+// "linux-amd64", relative to the package root
+func (p *Package) Binary(platform string) (string, error) {
+	for _, supported := range p.Platforms {
+		if supported == platform {
+			return path.Join(BinDir, platform, p.Manifest.BinaryName()), nil
+		}
+	}
+	return "", fmt.Errorf("%w %s: %s supports %s", ErrPlatformUnsupported, platform,
+		p.Manifest.Name, strings.Join(p.Platforms, ", "))
+}
+
+// BinaryPath returns the unpacked executable for a platform
+func (p *Package) BinaryPath(platform string) (string, error) {
+	if p.Dir == "" {
+		return "", errors.New("package has not been unpacked")
+	}
+	rel, err := p.Binary(platform)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(p.Dir, filepath.FromSlash(rel)), nil
+}
+
+// WASMPlatform is the platform of WebAssembly plugin binaries, which run on
+// every node
+const WASMPlatform = "wasip1-wasm"
+
+// CurrentPlatform returns the platform of the running binary, e.g. "linux-amd64"
+func CurrentPlatform() string {
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+// IsPackage reports whether the file at path looks like a plugin package
+// rather than a bare executable
+func IsPackage(filePath string) bool {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, 2)
+	if _, err := f.Read(magic); err != nil {
+		return false
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// ReadManifest reads plugin.yaml from a plugin directory
+func ReadManifest(dir string) (Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return Manifest{}, fmt.Errorf("%w: %v", ErrMissingManifest, err)
+	}
+	return parseManifest(data)
+}
+
+// parseManifest decodes plugin.yaml
+func parseManifest(data []byte) (Manifest, error) {
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("failed to parse %s: %w", ManifestFile, err)
+	}
+	if m.Name == "" || m.Version == "" {
+		return m, fmt.Errorf("%s must declare name and version", ManifestFile)
+	}
+	return m, nil
+}
+
+// formatChecksums renders checksums in sha256sum format, sorted by path
+func formatChecksums(sums map[string]string) []byte {
+	paths := make([]string, 0, len(sums))
+	for p := range sums {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", sums[p], p)
+	}
+	return []byte(b.String())
+}
+
+// parseChecksums reads a CHECKSUMS file
+func parseChecksums(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != 64 {
+			return nil, fmt.Errorf("invalid %s line %d", ChecksumsFile, i+1)
+		}
+		name = strings.TrimPrefix(name, "*")
+		if err := checkPath(name); err != nil {
+			return nil, err
+		}
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums, nil
+}
+
+// checkPath rejects entry names that could escape the unpack directory
+func checkPath(name string) error {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") ||
+		path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	return nil
+}
+
+// platformOf returns the platform of a binary entry such as
+// "bin/linux-amd64/node", or "" if the entry isn't a binary
+func platformOf(name string) string {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] != BinDir {
+		return ""
+	}
+	goos, goarch, ok := strings.Cut(parts[1], "-")
+	if !ok || goos == "" || goarch == "" {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,291 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PackOptions controls how a package is built
+type PackOptions struct {
+	// Platforms limits the binaries included, all platforms under bin/ are
+	// included if empty
+	Platforms []string
+	// Signer signs the package, which is left unsigned if nil
+	Signer Signer
+}
+
+// optionalFiles are copied from the plugin directory when present
+var optionalFiles = []string{"LICENSE", "README.md", "CHANGELOG.md"}
+
+// optionalDirs are copied recursively from the plugin directory when present
+var optionalDirs = []string{ProtoDir, "docs"}
+
+// Pack builds a package from a plugin directory laid out like the output of
+// the plugin Makefiles: plugin.yaml, bin/<os>-<arch>/<binary>, and optionally
+// proto/, docs/ and license files. Packages are reproducible: the same
+// inputs always produce the same bytes.
+func Pack(dir string, w io.Writer, opts PackOptions) (*Package, error) {
+	manifestData, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMissingManifest, err)
+	}
+	manifest, err := parseManifest(manifestData)
+	if err != nil {
+		return nil, err
+	}
+
+	files, platforms, err := collectFiles(dir, manifest, opts.Platforms)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[string]string{ManifestFile: sha256Hex(manifestData)}
+	for _, name := range files {
+		sum, err := hashFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		sums[name] = sum
+	}
+	checksumData := formatChecksums(sums)
+
+	pkg := &Package{
+		Manifest:     manifest,
+		Checksums:    sums,
+		Platforms:    platforms,
+		checksumData: checksumData,
+	}
+	for _, name := range files {
+		if isProto(name) {
+			pkg.Protos = append(pkg.Protos, name)
+		}
+	}
+
+	var signatureData []byte
+	if opts.Signer != nil {
+		sig, err := opts.Signer.Sign(manifest, checksumData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign package: %w", err)
+		}
+		if signatureData, err = json.MarshalIndent(sig, "", "  "); err != nil {
+			return nil, fmt.Errorf("failed to encode signature: %w", err)
+		}
+		pkg.Signature = sig
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := writeEntry(tw, ManifestFile, manifestData, 0644); err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, ChecksumsFile, checksumData, 0644); err != nil {
+		return nil, err
+	}
+	if signatureData != nil {
+		if err := writeEntry(tw, SignatureFile, signatureData, 0644); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range files {
+		mode := int64(0644)
+		if platformOf(name) != "" {
+			mode = 0755
+		}
+		if err := copyEntry(tw, name, filepath.Join(dir, filepath.FromSlash(name)), mode); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish package: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish package: %w", err)
+	}
+
+	return pkg, nil
+}
+
+// PackFile builds a package and writes it to outPath
+func PackFile(dir, outPath string, opts PackOptions) (*Package, error) {
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), ".pack-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create package file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	pkg, err := Pack(dir, tmp, opts)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write package: %w", closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), outPath); err != nil {
+		return nil, fmt.Errorf("failed to write package: %w", err)
+	}
+	return pkg, nil
+}
+
+// collectFiles returns the package entries found in dir, other than the
+// manifest, sorted by name
+func collectFiles(dir string, manifest Manifest, only []string) ([]string, []string, error) {
+	var files, platforms []string
+
+	wanted := make(map[string]bool)
+	for _, p := range only {
+		wanted[p] = true
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, BinDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", BinDir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := path.Join(BinDir, entry.Name(), manifest.BinaryName())
+		platform := platformOf(name)
+		if platform == "" || (len(wanted) > 0 && !wanted[platform]) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, name)
+		platforms = append(platforms, platform)
+	}
+	for _, p := range platforms {
+		delete(wanted, p)
+	}
+	if len(wanted) > 0 {
+		missing := make([]string, 0, len(wanted))
+		for p := range wanted {
+			missing = append(missing, p)
+		}
+		sort.Strings(missing)
+		return nil, nil, fmt.Errorf("%w %v", ErrPlatformUnsupported, missing)
+	}
+	if len(platforms) == 0 {
+		return nil, nil, fmt.Errorf("%w: expected %s/<os>-<arch>/%s", ErrNoBinaries, BinDir, manifest.BinaryName())
+	}
+
+	for _, name := range optionalFiles {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			files = append(files, name)
+		}
+	}
+
+	for _, sub := range optionalDirs {
+		root := filepath.Join(dir, sub)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", sub, err)
+		}
+	}
+
+	sort.Strings(files)
+	sort.Strings(platforms)
+	return files, platforms, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte, mode int64) error {
+	if err := tw.WriteHeader(entryHeader(name, int64(len(data)), mode)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func copyEntry(tw *tar.Writer, name, src string, mode int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+	if err := tw.WriteHeader(entryHeader(name, info.Size(), mode)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func entryHeader(name string, size, mode int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     mode,
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatPAX,
+	}
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", p, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", p, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func isProto(name string) bool {
+	if !strings.HasPrefix(name, ProtoDir+"/") {
+		return false
+	}
+	ext := path.Ext(name)
+	return ext == ".proto" || ext == ".pb" || ext == ".protoset"
+}
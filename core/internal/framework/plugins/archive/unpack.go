@@ -0,0 +1,303 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// maxMetadataSize bounds the manifest, CHECKSUMS and SIGNATURE entries
+const maxMetadataSize = 1 << 20
+
+// Verify checks that the package at path is well-formed, that every file
+// matches CHECKSUMS, and, if verifier is not nil, that the signature is
+// acceptable
+func Verify(path string, verifier SignatureVerifier) (*Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %w", err)
+	}
+	defer f.Close()
+
+	return read(f, verifier, nil)
+}
+
+// Unpack verifies the package at path and extracts it to destDir. Nothing is
+// left in destDir unless the whole package verifies.
+func Unpack(path, destDir string, verifier SignatureVerifier) (*Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %w", err)
+	}
+	defer f.Close()
+
+	parent := filepath.Dir(destDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(parent, ".unpack-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	pkg, err := read(f, verifier, func(name string, mode int64, r io.Reader) error {
+		return extract(staging, name, mode, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(destDir); err != nil {
+		return nil, fmt.Errorf("failed to replace %s: %w", destDir, err)
+	}
+	if err := os.Rename(staging, destDir); err != nil {
+		return nil, fmt.Errorf("failed to move package into place: %w", err)
+	}
+	pkg.Dir = destDir
+	return pkg, nil
+}
+
+// OpenDir reads a previously unpacked package without re-hashing its files
+func OpenDir(dir string) (*Package, error) {
+	manifestData, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMissingManifest, err)
+	}
+	checksumData, err := os.ReadFile(filepath.Join(dir, ChecksumsFile))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMissingChecksums, err)
+	}
+
+	pkg, err := newPackage(manifestData, checksumData)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, SignatureFile)); err == nil {
+		if pkg.Signature, err = parseSignature(data); err != nil {
+			return nil, err
+		}
+	}
+	pkg.Dir = dir
+	return pkg, nil
+}
+
+// VerifyFile re-hashes a file of an unpacked package, named relative to the
+// package root, and checks it against CHECKSUMS
+func (p *Package) VerifyFile(name string) error {
+	if p.Dir == "" {
+		return errors.New("package has not been unpacked")
+	}
+	expected, ok := p.Checksums[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnlistedFile, name)
+	}
+
+	f, err := os.Open(filepath.Join(p.Dir, filepath.FromSlash(name)))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrMissingFile, name)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != expected {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, name)
+	}
+	return nil
+}
+
+// read walks a package, hashing each file and passing it to sink if set
+func read(r io.Reader, verifier SignatureVerifier, sink func(name string, mode int64, r io.Reader) error) (*Package, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotPackage, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var manifestData, checksumData, signatureData []byte
+	actual := make(map[string]string)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read package: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := checkPath(filepath.ToSlash(filepath.Clean(header.Name))); err != nil {
+				return nil, err
+			}
+			continue
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("%w: %q is not a regular file", ErrUnsafePath, header.Name)
+		}
+
+		name := header.Name
+		if err := checkPath(name); err != nil {
+			return nil, err
+		}
+		if _, dup := actual[name]; dup {
+			return nil, fmt.Errorf("%w: %q appears twice", ErrUnsafePath, name)
+		}
+
+		var body io.Reader = tr
+		switch name {
+		case ManifestFile, ChecksumsFile, SignatureFile:
+			data, err := io.ReadAll(io.LimitReader(tr, maxMetadataSize+1))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			if len(data) > maxMetadataSize {
+				return nil, fmt.Errorf("%s is too large", name)
+			}
+			switch name {
+			case ManifestFile:
+				manifestData = data
+			case ChecksumsFile:
+				checksumData = data
+			case SignatureFile:
+				signatureData = data
+			}
+			body = bytes.NewReader(data)
+		}
+
+		h := sha256.New()
+		tee := io.TeeReader(body, h)
+		if sink != nil {
+			if err := sink(name, header.Mode, tee); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := io.Copy(io.Discard, tee); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		actual[name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	if manifestData == nil {
+		return nil, ErrMissingManifest
+	}
+	if checksumData == nil {
+		return nil, ErrMissingChecksums
+	}
+	pkg, err := newPackage(manifestData, checksumData)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(actual, ChecksumsFile)
+	delete(actual, SignatureFile)
+	for name, sum := range actual {
+		expected, ok := pkg.Checksums[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnlistedFile, name)
+		}
+		if sum != expected {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, name)
+		}
+	}
+	for name := range pkg.Checksums {
+		if _, ok := actual[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingFile, name)
+		}
+	}
+
+	if signatureData != nil {
+		if pkg.Signature, err = parseSignature(signatureData); err != nil {
+			return nil, err
+		}
+	}
+	if verifier != nil {
+		if err := verifier.VerifySignature(pkg.Manifest, checksumData, pkg.Signature); err != nil {
+			return nil, err
+		}
+	}
+
+	return pkg, nil
+}
+
+// newPackage builds a package description from its metadata files
+func newPackage(manifestData, checksumData []byte) (*Package, error) {
+	manifest, err := parseManifest(manifestData)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := parseChecksums(checksumData)
+	if err != nil {
+		return nil, err
+	}
+	if sums[ManifestFile] != sha256Hex(manifestData) {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, ManifestFile)
+	}
+
+	pkg := &Package{
+		Manifest:     manifest,
+		Checksums:    sums,
+		checksumData: checksumData,
+	}
+	for name := range sums {
+		if platform := platformOf(name); platform != "" && name == filepath.ToSlash(filepath.Join(BinDir, platform, manifest.BinaryName())) {
+			pkg.Platforms = append(pkg.Platforms, platform)
+		}
+		if isProto(name) {
+			pkg.Protos = append(pkg.Protos, name)
+		}
+	}
+	if len(pkg.Platforms) == 0 {
+		return nil, ErrNoBinaries
+	}
+	sort.Strings(pkg.Platforms)
+	sort.Strings(pkg.Protos)
+	return pkg, nil
+}
+
+func parseSignature(data []byte) (*Signature, error) {
+	var sig Signature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", SignatureFile, err)
+	}
+	return &sig, nil
+}
+
+// extract writes one entry below dir
+func extract(dir, name string, mode int64, r io.Reader) error {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/semver"
+)
+
+// Dependency errors
+var (
+	ErrDependencyNotSatisfied = errors.New("plugin dependency not satisfied")
+	ErrDependencyCycle        = errors.New("plugin dependency cycle")
+	ErrPluginHasDependents    = errors.New("plugin has dependents")
+)
+
+// DependencyRequirement records which plugin asked for which version range
+type DependencyRequirement struct {
+	Plugin     string
+	Constraint string
+	Optional   bool
+}
+
+// DependencyConflict describes a dependency that cannot be satisfied
+type DependencyConflict struct {
+	Dependency   string
+	Requirements []DependencyRequirement
+	Provided     string // version that would be used, empty if none
+	Source       string // "batch", "loaded" or "registry"
+	Installed    []string
+}
+
+// String formats the conflict as "B: A needs ^2, C needs ^1 (have 1.4.0)"
+func (c DependencyConflict) String() string {
+	needs := make([]string, 0, len(c.Requirements))
+	for _, req := range c.Requirements {
+		need := fmt.Sprintf("%s needs %s", req.Plugin, displayConstraint(req.Constraint))
+		if req.Optional {
+			need += " (optional)"
+		}
+		needs = append(needs, need)
+	}
+
+	s := fmt.Sprintf("%s: %s", c.Dependency, strings.Join(needs, ", "))
+	switch {
+	case c.Provided != "":
+		s += fmt.Sprintf(" (have %s, %s)", c.Provided, c.Source)
+	case len(c.Installed) > 0:
+		s += fmt.Sprintf(" (not loaded; installed: %s)", strings.Join(c.Installed, ", "))
+	default:
+		s += " (not available)"
+	}
+	return s
+}
+
+func displayConstraint(constraint string) string {
+	if strings.TrimSpace(constraint) == "" {
+		return "any version"
+	}
+	return constraint
+}
+
+// DependencyError reports every conflict found while resolving dependencies
+type DependencyError struct {
+	Conflicts []DependencyConflict
+}
+
+// Error implements the error interface
+func (e *DependencyError) Error() string {
+	lines := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		lines = append(lines, c.String())
+	}
+	return fmt.Sprintf("%v:\n  %s", ErrDependencyNotSatisfied, strings.Join(lines, "\n  "))
+}
+
+// Unwrap returns ErrDependencyNotSatisfied
+func (e *DependencyError) Unwrap() error {
+	return ErrDependencyNotSatisfied
+}
+
+// DependentsError is returned when unloading a plugin that others depend on
+type DependentsError struct {
+	Plugin     string
+	Dependents []string
+}
+
+// Error implements the error interface
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("cannot unload %s: required by %s", e.Plugin, strings.Join(e.Dependents, ", "))
+}
+
+// Unwrap returns ErrPluginHasDependents
+func (e *DependentsError) Unwrap() error {
+	return ErrPluginHasDependents
+}
+
+// provider is a version of a plugin that can satisfy dependencies
+type provider struct {
+	version string
+	source  string
+}
+
+// ResolveDependencies checks the dependencies of specs against each other,
+// the already loaded plugins and the registry, and returns specs in an order
+// in which every plugin is loaded after the plugins it depends on.
+//
+// A dependency is satisfied by a plugin in the same batch, a loaded plugin, or
+// a plugin the registry reports as running. Optional dependencies may be
+// absent, but if present their version must still match.
+func ResolveDependencies(specs []PluginSpec, loaded []PluginSpec, registry PluginRegistry) ([]PluginSpec, error) {
+	providers := make(map[string]provider)
+	for _, spec := range loaded {
+		providers[spec.Name] = provider{version: spec.Version, source: "loaded"}
+	}
+	batch := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		providers[spec.Name] = provider{version: spec.Version, source: "batch"}
+		batch[spec.Name] = i
+	}
+
+	// Collect requirements per dependency from the batch and loaded plugins.
+	// Loaded plugins replaced by the batch are not considered.
+	requirements := make(map[string][]DependencyRequirement)
+	var order []string
+	addRequirements := func(spec PluginSpec) {
+		for _, dep := range spec.Dependencies {
+			if _, seen := requirements[dep.Name]; !seen {
+				order = append(order, dep.Name)
+			}
+			requirements[dep.Name] = append(requirements[dep.Name], DependencyRequirement{
+				Plugin:     spec.Name,
+				Constraint: dep.Version,
+				Optional:   dep.Optional,
+			})
+		}
+	}
+	for _, spec := range specs {
+		addRequirements(spec)
+	}
+	for _, spec := range loaded {
+		if _, replaced := batch[spec.Name]; !replaced {
+			addRequirements(spec)
+		}
+	}
+
+	var conflicts []DependencyConflict
+	for _, name := range order {
+		reqs := requirements[name]
+
+		p, ok := providers[name]
+		var installed []string
+		if !ok && registry != nil {
+			p, ok, installed = registryProvider(registry, name)
+		}
+
+		conflict := DependencyConflict{
+			Dependency:   name,
+			Requirements: reqs,
+			Installed:    installed,
+		}
+
+		if !ok {
+			for _, req := range reqs {
+				if !req.Optional {
+					conflicts = append(conflicts, conflict)
+					break
+				}
+			}
+			continue
+		}
+
+		conflict.Provided = p.version
+		conflict.Source = p.source
+		if !satisfiesAll(p.version, reqs) {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, &DependencyError{Conflicts: conflicts}
+	}
+
+	return sortByDependencies(specs, batch)
+}
+
+// unloadedSpecs drops the specs of plugins that are already loaded at the
+// same version, so that loading a batch twice is harmless
+func unloadedSpecs(specs []PluginSpec, loaded []PluginSpec) []PluginSpec {
+	versions := make(map[string]string, len(loaded))
+	for _, spec := range loaded {
+		versions[spec.Name] = spec.Version
+	}
+
+	var remaining []PluginSpec
+	for _, spec := range specs {
+		if version, ok := versions[spec.Name]; ok && version == spec.Version {
+			continue
+		}
+		remaining = append(remaining, spec)
+	}
+	return remaining
+}
+
+// registryProvider looks for a running plugin with the given name in the registry
+func registryProvider(registry PluginRegistry, name string) (provider, bool, []string) {
+	infos, err := registry.SearchPlugins(SearchCriteria{Name: name})
+	if err != nil {
+		return provider{}, false, nil
+	}
+
+	var installed []string
+	for _, info := range infos {
+		if info.Name != name {
+			continue
+		}
+		if info.Status == PluginStatusRunning {
+			return provider{version: info.Version, source: "registry"}, true, nil
+		}
+		installed = append(installed, info.Version)
+	}
+	return provider{}, false, installed
+}
+
+// satisfiesAll reports whether version matches every requirement
+func satisfiesAll(version string, reqs []DependencyRequirement) bool {
+	v, err := semver.Parse(version)
+	if err != nil {
+		return false
+	}
+	for _, req := range reqs {
+		c, err := semver.ParseConstraint(req.Constraint)
+		if err != nil || !c.Check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortByDependencies orders specs topologically, keeping the input order
+// among plugins that do not depend on each other
+func sortByDependencies(specs []PluginSpec, batch map[string]int) ([]PluginSpec, error) {
+	indegree := make([]int, len(specs))
+	dependents := make([][]int, len(specs))
+	for i, spec := range specs {
+		for _, dep := range spec.Dependencies {
+			j, ok := batch[dep.Name]
+			if !ok || j == i {
+				continue
+			}
+			indegree[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	var ready []int
+	for i := range specs {
+		if indegree[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	ordered := make([]PluginSpec, 0, len(specs))
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		i := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, specs[i])
+		for _, j := range dependents[i] {
+			indegree[j]--
+			if indegree[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	if len(ordered) != len(specs) {
+		var cycle []string
+		for i, spec := range specs {
+			if indegree[i] > 0 {
+				cycle = append(cycle, spec.Name)
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, ", "))
+	}
+
+	return ordered, nil
+}
+
+// findDependents returns the loaded plugins that require name, directly or
+// transitively, ordered so that each plugin comes before the plugins it
+// depends on. Optional dependencies are not counted.
+func findDependents(name string, loaded []PluginSpec, transitive bool) []string {
+	required := make(map[string][]string)
+	for _, spec := range loaded {
+		for _, dep := range spec.Dependencies {
+			if !dep.Optional {
+				required[dep.Name] = append(required[dep.Name], spec.Name)
+			}
+		}
+	}
+	for _, names := range required {
+		sort.Strings(names)
+	}
+
+	if !transitive {
+		return required[name]
+	}
+
+	// Depth-first post-order yields dependents before their dependencies
+	visited := map[string]bool{name: true}
+	var result []string
+	var visit func(string)
+	visit = func(n string) {
+		for _, dependent := range required[n] {
+			if visited[dependent] {
+				continue
+			}
+			visited[dependent] = true
+			visit(dependent)
+			result = append(result, dependent)
+		}
+	}
+	visit(name)
+
+	return result
+}
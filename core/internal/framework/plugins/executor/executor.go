@@ -15,7 +15,7 @@ import (
 // Common errors
 var (
 	ErrInvalidIsolationLevel = errors.New("invalid isolation level")
-	ErrExecutionTimeout      = errors.New("plugin execution timeout")
+	ErrExecutionTimeout      = plugins.ErrTimeout
 	ErrResourceLimitExceeded = errors.New("resource limit exceeded")
 	ErrPluginNotResponding   = errors.New("plugin not responding")
 )
@@ -112,10 +112,18 @@ func NewExecutor(maxConcurrent int, updateInterval time.Duration) plugins.Plugin
 
 // ExecutePlugin executes a plugin request with proper isolation
 func (e *pluginExecutor) ExecutePlugin(plugin plugins.Plugin, request plugins.PluginRequest) (plugins.PluginResponse, error) {
+	return e.ExecutePluginContext(context.Background(), plugin, request)
+}
+
+// ExecutePluginContext executes a plugin request with proper isolation until
+// ctx ends. Requests without a deadline get the default timeout.
+func (e *pluginExecutor) ExecutePluginContext(ctx context.Context, plugin plugins.Plugin, request plugins.PluginRequest) (plugins.PluginResponse, error) {
 	// Create execution context with timeout
-	timeout := e.defaultTimeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.defaultTimeout)
+		defer cancel()
+	}
 
 	// Get or create execution environment
 	_, err := e.GetExecutionEnvironment(plugin)
@@ -161,13 +169,14 @@ func (e *pluginExecutor) ExecutePlugin(plugin plugins.Plugin, request plugins.Pl
 			}
 		}
 
-		return r.response, r.err
+		return r.response, plugins.CheckTimeout(ctx, plugin.Info().Name, request, r.err)
 
 	case <-ctx.Done():
+		err := plugins.CheckTimeout(ctx, plugin.Info().Name, request, ctx.Err())
 		return plugins.PluginResponse{
 			Success: false,
-			Error:   ErrExecutionTimeout.Error(),
-		}, ErrExecutionTimeout
+			Error:   err.Error(),
+		}, err
 	}
 }
 
@@ -0,0 +1,500 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+const (
+	// DefaultAllocSampleRate is how many calls to an in-process plugin
+	// share one allocation measurement
+	DefaultAllocSampleRate = 16
+
+	// DefaultMaxPanics is how many panics within the panic window move an
+	// in-process plugin to its own process
+	DefaultMaxPanics = 3
+)
+
+// ErrPluginPanicked is matched by errors for calls an in-process plugin
+// panicked in
+var ErrPluginPanicked = errors.New("plugin panicked")
+
+// PanicError reports a panic recovered from an in-process plugin.
+// errors.Is matches it against ErrPluginPanicked.
+type PanicError struct {
+	Plugin string
+	Method string
+	Value  interface{} // what the plugin panicked with
+	Stack  []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("plugin %s panicked in %s: %v", e.Plugin, e.Method, e.Value)
+}
+
+// Is makes the error match ErrPluginPanicked
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPluginPanicked
+}
+
+// Unwrap returns the value the plugin panicked with, if it was an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// AllocationError reports a call that allocated more than its budget. The
+// call itself succeeds; the overrun counts against the plugin like a panic.
+// errors.Is matches it against ErrResourceLimitExceeded.
+type AllocationError struct {
+	Plugin    string
+	Method    string
+	Allocated uint64
+	Budget    uint64
+}
+
+func (e *AllocationError) Error() string {
+	return fmt.Sprintf("plugin %s allocated %d bytes in %s, over its budget of %d",
+		e.Plugin, e.Allocated, e.Method, e.Budget)
+}
+
+// Is makes the error match ErrResourceLimitExceeded
+func (e *AllocationError) Is(target error) bool {
+	return target == ErrResourceLimitExceeded
+}
+
+// InProcessConfig configures the supervision of in-process plugins
+type InProcessConfig struct {
+	CallTimeout   time.Duration // Deadline of calls without one, defaults to 30s
+	MaxConcurrent int           // Calls at once, defaults to the plugin's request limit or DefaultMaxInFlight
+
+	// AllocBudget is the number of bytes a call may allocate, 0 for no
+	// budget, unless the plugin's resources set one. Go doesn't count
+	// allocations per goroutine, so a measured call is charged for
+	// everything the node allocated while it ran, and only one in
+	// AllocSampleRate calls is measured.
+	AllocBudget     uint64
+	AllocSampleRate int // Defaults to DefaultAllocSampleRate
+
+	// Panics and allocation overruns within PanicWindow that move the
+	// plugin to Fallback
+	MaxPanics   int           // Defaults to DefaultMaxPanics
+	PanicWindow time.Duration // Defaults to a minute
+
+	// Fallback creates a process-isolated instance of the plugin, nil if
+	// there is none and the plugin is marked failed instead
+	Fallback func() (plugins.Plugin, error)
+
+	Logger *zap.Logger
+}
+
+// inProcessPlugin runs a plugin loaded into the node process under
+// supervision: every call runs in its own goroutine, so a panic fails the
+// call rather than the node, and a call that runs past its deadline is
+// abandoned and the plugin marked failed. After repeated panics the plugin
+// is moved to its own process, where the calls go from then on.
+type inProcessPlugin struct {
+	spec   plugins.PluginSpec
+	config InProcessConfig
+	logger *zap.Logger
+	slots  chan struct{}
+	calls  atomic.Uint64
+
+	plugin   plugins.Plugin // the in-process instance, or the fallback once isolated
+	isolated bool
+	failed   bool
+	panics   []time.Time
+	mu       sync.RWMutex
+
+	// isolateMu is held while the plugin moves to its fallback
+	isolateMu sync.Mutex
+}
+
+// NewInProcessPlugin supervises a plugin instance loaded into the node process
+func NewInProcessPlugin(spec plugins.PluginSpec, plugin plugins.Plugin, config InProcessConfig) plugins.Plugin {
+	if config.Logger == nil {
+		config.Logger = zap.NewNop()
+	}
+	if config.CallTimeout == 0 {
+		config.CallTimeout = 30 * time.Second
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = spec.Resources.Requests
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = DefaultMaxInFlight
+	}
+	if spec.Resources.Allocation > 0 {
+		config.AllocBudget = uint64(spec.Resources.Allocation) << 20
+	}
+	if config.AllocSampleRate <= 0 {
+		config.AllocSampleRate = DefaultAllocSampleRate
+	}
+	if config.MaxPanics <= 0 {
+		config.MaxPanics = DefaultMaxPanics
+	}
+	if config.PanicWindow == 0 {
+		config.PanicWindow = time.Minute
+	}
+
+	return &inProcessPlugin{
+		spec:   spec,
+		config: config,
+		logger: config.Logger.With(zap.String("plugin", spec.Name)),
+		slots:  make(chan struct{}, config.MaxConcurrent),
+		plugin: plugin,
+	}
+}
+
+// current returns the instance calls go to and whether it's the fallback
+func (p *inProcessPlugin) current() (plugins.Plugin, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.plugin, p.isolated
+}
+
+// Info returns plugin information
+func (p *inProcessPlugin) Info() plugins.PluginInfo {
+	target, isolated := p.current()
+	var info plugins.PluginInfo
+	if err := p.protect("info", func() { info = target.Info() }); err != nil {
+		info = plugins.PluginInfo{Name: p.spec.Name, Version: p.spec.Version}
+	}
+	if !isolated {
+		info.Status = p.GetStatus()
+	}
+	return info
+}
+
+// GetStatus returns the plugin status
+func (p *inProcessPlugin) GetStatus() plugins.PluginStatus {
+	target, isolated := p.current()
+	p.mu.RLock()
+	failed := p.failed
+	p.mu.RUnlock()
+	if failed && !isolated {
+		return plugins.PluginStatusFailed
+	}
+
+	status := plugins.PluginStatusFailed
+	p.protect("status", func() { status = target.GetStatus() })
+	return status
+}
+
+// Start starts the plugin, clearing a failure
+func (p *inProcessPlugin) Start(ctx context.Context) error {
+	p.mu.Lock()
+	p.failed = false
+	p.mu.Unlock()
+
+	return p.call(ctx, "start", func(ctx context.Context, plugin plugins.Plugin) error {
+		return plugin.Start(ctx)
+	})
+}
+
+// Stop stops the plugin
+func (p *inProcessPlugin) Stop(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.call(ctx, "stop", func(ctx context.Context, plugin plugins.Plugin) error {
+		return plugin.Stop(ctx)
+	})
+}
+
+// Handle handles a plugin request
+func (p *inProcessPlugin) Handle(ctx context.Context, request plugins.PluginRequest) (plugins.PluginResponse, error) {
+	if status := p.GetStatus(); status == plugins.PluginStatusFailed {
+		return plugins.PluginResponse{}, fmt.Errorf("plugin not running: status=%s", status)
+	}
+
+	var resp plugins.PluginResponse
+	err := p.call(ctx, request.Method, func(ctx context.Context, plugin plugins.Plugin) error {
+		var err error
+		resp, err = plugin.Handle(ctx, request)
+		return err
+	})
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// An abandoned call may still write its response
+		return plugins.PluginResponse{}, plugins.CheckTimeout(ctx, p.spec.Name, request, err)
+	}
+	return resp, err
+}
+
+// HealthCheck checks if the plugin is healthy
+func (p *inProcessPlugin) HealthCheck() error {
+	if status := p.GetStatus(); status == plugins.PluginStatusFailed {
+		return fmt.Errorf("plugin not running: status=%s", status)
+	}
+	return p.call(context.Background(), "health", func(ctx context.Context, plugin plugins.Plugin) error {
+		return plugin.HealthCheck()
+	})
+}
+
+// PrepareShutdown prepares the plugin for shutdown
+func (p *inProcessPlugin) PrepareShutdown() error {
+	return p.call(context.Background(), "prepare_shutdown", func(ctx context.Context, plugin plugins.Plugin) error {
+		return plugin.PrepareShutdown()
+	})
+}
+
+// ExportState exports the plugin state
+func (p *inProcessPlugin) ExportState() ([]byte, error) {
+	var state []byte
+	err := p.call(context.Background(), "export_state", func(ctx context.Context, plugin plugins.Plugin) error {
+		var err error
+		state, err = plugin.ExportState()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// ImportState imports plugin state
+func (p *inProcessPlugin) ImportState(state []byte) error {
+	return p.call(context.Background(), "import_state", func(ctx context.Context, plugin plugins.Plugin) error {
+		return plugin.ImportState(state)
+	})
+}
+
+// OpenStream opens a streamed request, running in-process stream handlers
+// under supervision. Streams have no deadline unless ctx has one.
+func (p *inProcessPlugin) OpenStream(ctx context.Context, request plugins.PluginRequest, mode plugins.StreamMode) (plugins.PluginStream, error) {
+	target, isolated := p.current()
+	if isolated {
+		if streaming, ok := target.(plugins.StreamingPlugin); ok {
+			return streaming.OpenStream(ctx, request, mode)
+		}
+		return nil, plugins.ErrStreamingUnsupported
+	}
+	handler, ok := target.(plugins.StreamHandler)
+	if !ok {
+		return nil, plugins.ErrStreamingUnsupported
+	}
+	return plugins.NewLocalStream(ctx, supervisedStream{p, handler}, request, mode), nil
+}
+
+// supervisedStream runs an in-process stream handler under supervision
+type supervisedStream struct {
+	p       *inProcessPlugin
+	handler plugins.StreamHandler
+}
+
+func (s supervisedStream) HandleStream(ctx context.Context, request plugins.PluginRequest, in io.Reader, out io.Writer) (plugins.PluginResponse, error) {
+	var resp plugins.PluginResponse
+	overrun, err := s.p.supervise(ctx, request.Method, func(ctx context.Context) error {
+		var err error
+		resp, err = s.handler.HandleStream(ctx, request, in, out)
+		return err
+	})
+	s.p.countFault(err, overrun)
+	if err != nil {
+		return plugins.PluginResponse{}, err
+	}
+	return resp, nil
+}
+
+// call runs fn on the plugin. Calls to the in-process instance are
+// supervised and get a deadline; the fallback isolates itself.
+func (p *inProcessPlugin) call(ctx context.Context, method string, fn func(ctx context.Context, plugin plugins.Plugin) error) error {
+	target, isolated := p.current()
+	if isolated {
+		return fn(ctx, target)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.CallTimeout)
+		defer cancel()
+	}
+	overrun, err := p.supervise(ctx, method, func(ctx context.Context) error {
+		return fn(ctx, target)
+	})
+	p.countFault(err, overrun)
+	return err
+}
+
+// supervise runs fn in its own goroutine once a slot is free, recovering
+// a panic into a *PanicError and measuring sampled calls' allocations,
+// returning an overrun of the budget alongside the call's result. If ctx
+// ends first the call is abandoned and keeps its slot until it returns;
+// past its deadline, the plugin is marked failed and the call fails with a
+// *plugins.TimeoutError.
+func (p *inProcessPlugin) supervise(ctx context.Context, method string, fn func(ctx context.Context) error) (*AllocationError, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	measure := p.config.AllocBudget > 0 && p.calls.Add(1)%uint64(p.config.AllocSampleRate) == 0
+	var before uint64
+	if measure {
+		before = allocatedBytes()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &PanicError{Plugin: p.spec.Name, Method: method, Value: r, Stack: debug.Stack()}
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		<-p.slots
+		if measure && err == nil {
+			if allocated := allocatedBytes() - before; allocated > p.config.AllocBudget {
+				return &AllocationError{Plugin: p.spec.Name, Method: method, Allocated: allocated, Budget: p.config.AllocBudget}, nil
+			}
+		}
+		return nil, err
+
+	case <-ctx.Done():
+		go func() {
+			<-done
+			<-p.slots
+		}()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ctx.Err()
+		}
+		p.logger.Error("Abandoned plugin call past its deadline", zap.String("method", method))
+		p.mu.Lock()
+		p.failed = true
+		p.mu.Unlock()
+		deadline, _ := ctx.Deadline()
+		return nil, &plugins.TimeoutError{Plugin: p.spec.Name, Method: method, Deadline: deadline}
+	}
+}
+
+// protect runs fn in the caller's goroutine, recovering a panic
+func (p *inProcessPlugin) protect(method string, fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Plugin: p.spec.Name, Method: method, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// countFault counts a call's panic or allocation overrun, moving the
+// plugin to its fallback once there have been MaxPanics within PanicWindow
+func (p *inProcessPlugin) countFault(err error, overrun *AllocationError) {
+	var panicked *PanicError
+	switch {
+	case errors.As(err, &panicked):
+		p.logger.Error("Recovered plugin panic",
+			zap.String("method", panicked.Method),
+			zap.Any("panic", panicked.Value),
+			zap.ByteString("stack", panicked.Stack))
+	case overrun != nil:
+		p.logger.Warn("Plugin call allocated over its budget",
+			zap.String("method", overrun.Method),
+			zap.Uint64("allocated", overrun.Allocated),
+			zap.Uint64("budget", overrun.Budget))
+	default:
+		return
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	recent := p.panics[:0]
+	for _, at := range p.panics {
+		if now.Sub(at) < p.config.PanicWindow {
+			recent = append(recent, at)
+		}
+	}
+	p.panics = append(recent, now)
+	repeated := len(p.panics) >= p.config.MaxPanics
+	p.mu.Unlock()
+
+	if repeated {
+		p.isolate()
+	}
+}
+
+// isolate moves the plugin to a process-isolated instance, carrying its
+// state across when the in-process instance can still export it. Without
+// a fallback the plugin is marked failed.
+func (p *inProcessPlugin) isolate() {
+	p.isolateMu.Lock()
+	defer p.isolateMu.Unlock()
+
+	inProcess, isolated := p.current()
+	if isolated {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.CallTimeout)
+	defer cancel()
+
+	var state []byte
+	_, exportErr := p.supervise(ctx, "export_state", func(ctx context.Context) error {
+		var err error
+		state, err = inProcess.ExportState()
+		return err
+	})
+	p.supervise(ctx, "stop", func(ctx context.Context) error {
+		return inProcess.Stop(ctx)
+	})
+
+	fallback, err := p.startFallback(ctx)
+	if err != nil {
+		p.logger.Error("Plugin keeps panicking and can't be isolated", zap.Error(err))
+		p.mu.Lock()
+		p.failed = true
+		p.mu.Unlock()
+		return
+	}
+	if exportErr == nil {
+		if err := fallback.ImportState(state); err != nil && !errors.Is(err, plugins.ErrStateNotSupported) {
+			p.logger.Warn("Failed to carry state to the isolated plugin", zap.Error(err))
+		}
+	}
+
+	p.mu.Lock()
+	p.plugin = fallback
+	p.isolated = true
+	p.failed = false
+	p.mu.Unlock()
+	p.logger.Warn("Plugin keeps panicking, moved it to process isolation")
+}
+
+// startFallback creates and starts the process-isolated instance
+func (p *inProcessPlugin) startFallback(ctx context.Context) (plugins.Plugin, error) {
+	if p.config.Fallback == nil {
+		return nil, errors.New("no process-isolated build of the plugin")
+	}
+	fallback, err := p.config.Fallback()
+	if err != nil {
+		return nil, err
+	}
+	if err := fallback.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start isolated plugin: %w", err)
+	}
+	return fallback, nil
+}
+
+// allocatedBytes returns the bytes allocated by the process so far
+func allocatedBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
@@ -34,6 +34,10 @@ func (f *ProcessIsolationFactory) CreateIsolation(level plugins.IsolationLevel,
 	case plugins.IsolationVM:
 		// VM isolation - run in VM
 		return nil, fmt.Errorf("VM isolation not yet implemented")
+
+	case plugins.IsolationWASM:
+		// WebAssembly isolation - each plugin is bounded by its own runtime
+		return nil, fmt.Errorf("WebAssembly plugins are isolated by their runtime, see NewWASMPlugin")
 		
 	default:
 		return nil, fmt.Errorf("unknown isolation level: %s", level)
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
@@ -14,10 +15,16 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 	"go.uber.org/zap"
 
 	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	lifecyclev1 "github.com/blackhole-pro/blackhole/core/pkg/plugins/lifecycle/proto/v1"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
 )
 
 // meshIsolation implements mesh-based plugin isolation
@@ -30,6 +37,8 @@ type meshIsolation struct {
 	logger         *zap.Logger
 	mu             sync.Mutex
 	started        bool
+	// exited is closed once the plugin process has exited
+	exited chan struct{}
 }
 
 // meshPlugin implements the Plugin interface for mesh-connected plugins
@@ -40,16 +49,37 @@ type meshPlugin struct {
 	info         plugins.PluginInfo
 	status       plugins.PluginStatus
 	meshEndpoint mesh.ServiceEndpoint
+	ingress      string
+	meshToken    string
+	dataDir      string
+	timeout      time.Duration
+	peer         protocol.Handshake
+	unsandboxed  bool
 	logger       *zap.Logger
 	mu           sync.RWMutex
 }
 
+// meshHostFeatures are the protocol features the host offers to plugins it
+// calls over gRPC, where cancellation is carried by the call itself
+var meshHostFeatures = []protocol.Feature{protocol.FeatureState, protocol.FeatureCancellation}
+
 // MeshIsolationConfig configures mesh-based plugin isolation
 type MeshIsolationConfig struct {
 	// MeshClient     mesh.Client // TODO: implement mesh client
 	SocketDir      string
 	Logger         *zap.Logger
 	DefaultTimeout time.Duration
+
+	// DataDir holds the plugin data directories, defaults to DefaultDataDir
+	DataDir string
+
+	// MeshEndpoint is the ingress socket the plugin calls other services
+	// through, defaults to the ingress socket in SocketDir
+	MeshEndpoint string
+
+	// AllowUnsandboxed runs plugins without their sandbox on platforms
+	// that don't support it, rather than refuse to start them
+	AllowUnsandboxed bool
 }
 
 // NewMeshPlugin creates a new mesh-connected plugin
@@ -63,18 +93,34 @@ func NewMeshPlugin(spec plugins.PluginSpec, binaryPath string, config MeshIsolat
 	if config.DefaultTimeout == 0 {
 		config.DefaultTimeout = 30 * time.Second
 	}
+	if config.DataDir == "" {
+		config.DataDir = DefaultDataDir
+	}
+	if config.MeshEndpoint == "" {
+		config.MeshEndpoint = filepath.Join(config.SocketDir, routing.IngressSocketName)
+	}
+	logger := config.Logger.With(zap.String("plugin", spec.Name))
 
 	return &meshPlugin{
 		spec:       spec,
 		binaryPath: binaryPath,
+		isolation: &meshIsolation{
+			socketPath:     filepath.Join(config.SocketDir, fmt.Sprintf("%s.sock", spec.Name)),
+			resourceLimits: spec.Resources,
+			logger:         logger,
+		},
 		info: plugins.PluginInfo{
 			Name:        spec.Name,
 			Version:     spec.Version,
 			Description: "Mesh-connected plugin",
 			Status:      plugins.PluginStatusStopped,
 		},
-		status: plugins.PluginStatusStopped,
-		logger: config.Logger.With(zap.String("plugin", spec.Name)),
+		status:  plugins.PluginStatusStopped,
+		ingress: config.MeshEndpoint,
+		dataDir: filepath.Join(config.DataDir, spec.Name),
+		timeout:     config.DefaultTimeout,
+		unsandboxed: config.AllowUnsandboxed,
+		logger:      logger,
 	}
 }
 
@@ -105,10 +151,17 @@ func (p *meshPlugin) Start(ctx context.Context) error {
 
 	// Prepare environment variables for the plugin
 	env := os.Environ()
-	env = append(env, fmt.Sprintf("PLUGIN_NAME=%s", p.spec.Name))
-	env = append(env, fmt.Sprintf("PLUGIN_VERSION=%s", p.spec.Version))
-	env = append(env, fmt.Sprintf("PLUGIN_SOCKET=%s", p.isolation.socketPath))
-	env = append(env, fmt.Sprintf("PLUGIN_MESH_ENDPOINT=%s", p.meshEndpoint.Socket))
+	env = append(env, fmt.Sprintf("%s=%s", protocol.EnvName, p.spec.Name))
+	env = append(env, fmt.Sprintf("%s=%s", protocol.EnvVersion, p.spec.Version))
+	env = append(env, fmt.Sprintf("%s=%s", protocol.EnvSocket, p.isolation.socketPath))
+	env = append(env, fmt.Sprintf("%s=%d", protocol.EnvProtocolVersion, protocol.Version))
+	env = append(env, fmt.Sprintf("%s=%s", protocol.EnvTransport, protocol.TransportGRPC))
+	env = append(env, fmt.Sprintf("%s=%s", protocol.EnvDataDir, p.dataDir))
+	env = append(env, fmt.Sprintf("%s=%s", protocol.EnvMeshEndpoint, p.ingress))
+	env = append(env, fmt.Sprintf("%s=%d", protocol.EnvHostPID, os.Getpid()))
+	if p.meshToken != "" {
+		env = append(env, fmt.Sprintf("%s=%s", protocol.EnvMeshToken, p.meshToken))
+	}
 
 	// Create the command
 	p.isolation.cmd = exec.CommandContext(ctx, p.binaryPath)
@@ -119,6 +172,24 @@ func (p *meshPlugin) Start(ctx context.Context) error {
 		p.logger.Warn("Failed to set resource limits", zap.Error(err))
 	}
 
+	// Restrict the process to the permissions it was granted. The socket
+	// directory stays writable so the plugin can serve on its mesh socket.
+	policy := PolicyForSpec(p.spec, p.dataDir, socketDir)
+	if sandboxErr := Sandbox(p.isolation.cmd, policy); sandboxErr != nil {
+		err := sandboxErr
+		if errors.Is(err, ErrSandboxUnsupported) {
+			err = allowUnsandboxed(policy, p.unsandboxed, err)
+		}
+		if err != nil {
+			p.status = plugins.PluginStatusFailed
+			p.info.Status = p.status
+			return fmt.Errorf("failed to sandbox plugin: %w", err)
+		}
+		p.logger.Warn("Running plugin without sandbox", zap.Stringer("policy", policy), zap.Error(sandboxErr))
+	} else if policy.Restricted() {
+		p.logger.Info("Sandboxing plugin", zap.Stringer("policy", policy))
+	}
+
 	// Start the plugin process
 	if err := p.isolation.cmd.Start(); err != nil {
 		p.status = plugins.PluginStatusFailed
@@ -127,14 +198,28 @@ func (p *meshPlugin) Start(ctx context.Context) error {
 	}
 
 	p.isolation.started = true
+	p.isolation.exited = make(chan struct{})
 	p.logger.Info("Plugin process started", zap.Int("pid", p.isolation.cmd.Process.Pid))
 
+	// Monitor process health
+	go p.monitorProcess(p.isolation.cmd, p.isolation.exited)
+
 	// Wait for plugin to be ready on mesh
 	if err := p.waitForMeshConnection(ctx); err != nil {
 		p.stop()
 		return fmt.Errorf("failed to establish mesh connection: %w", err)
 	}
 
+	peer, err := p.handshake(ctx)
+	if err != nil {
+		p.stop()
+		return fmt.Errorf("plugin handshake failed: %w", err)
+	}
+	p.peer = peer
+	p.logger.Debug("Negotiated plugin protocol",
+		zap.Int("protocol_version", peer.ProtocolVersion),
+		zap.Any("features", peer.Features))
+
 	// Register plugin with mesh network
 	if err := p.registerWithMesh(ctx); err != nil {
 		p.stop()
@@ -145,9 +230,6 @@ func (p *meshPlugin) Start(ctx context.Context) error {
 	p.info.Status = p.status
 	p.logger.Info("Plugin started successfully")
 
-	// Monitor process health
-	go p.monitorProcess()
-
 	return nil
 }
 
@@ -185,48 +267,112 @@ func (p *meshPlugin) Stop(ctx context.Context) error {
 	return nil
 }
 
-// Handle sends a request to the plugin via mesh
+// Handle sends a request to the plugin over its lifecycle service
 func (p *meshPlugin) Handle(ctx context.Context, request plugins.PluginRequest) (plugins.PluginResponse, error) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	client, err := p.lifecycleClient()
+	if err != nil {
+		return plugins.PluginResponse{}, err
+	}
 
-	if p.status != plugins.PluginStatusRunning {
-		return plugins.PluginResponse{}, errors.New("plugin not running")
+	in, err := handleRequest(request)
+	if err != nil {
+		return plugins.PluginResponse{}, err
 	}
 
-	// Route request through mesh
-	// The actual implementation depends on the plugin's specific gRPC interface
-	// This is where the mesh network shines - we don't need to know the details
-	
-	return plugins.PluginResponse{
-		Success: false,
-		Error:   "mesh routing not yet implemented",
-	}, nil
+	resp, err := client.Handle(ctx, in)
+	if err != nil {
+		err = callError(err)
+		return plugins.PluginResponse{
+			ID:      request.ID,
+			Success: false,
+			Error:   err.Error(),
+		}, plugins.CheckTimeout(ctx, p.spec.Name, request, err)
+	}
+
+	return pluginResponse(resp), nil
 }
 
-// HealthCheck checks plugin health via mesh
+// HealthCheck checks that the plugin process is running and asks the plugin
+// for its health. Plugins that don't serve the lifecycle service are asked
+// through the standard gRPC health service.
 func (p *meshPlugin) HealthCheck() error {
 	p.mu.RLock()
-	defer p.mu.RUnlock()
-
 	if p.status != plugins.PluginStatusRunning {
+		p.mu.RUnlock()
 		return errors.New("plugin not running")
 	}
 
 	// Check process is alive
 	if p.isolation.cmd.Process == nil {
+		p.mu.RUnlock()
 		return errors.New("plugin process not found")
 	}
 
 	// Check mesh connectivity
-	if p.isolation.grpcConn == nil {
+	conn := p.isolation.grpcConn
+	p.mu.RUnlock()
+	if conn == nil {
 		return errors.New("mesh connection lost")
 	}
 
-	// TODO: Make actual health check call via mesh
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	resp, err := lifecyclev1.NewPluginLifecycleClient(conn).HealthCheck(ctx, &lifecyclev1.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return fmt.Errorf("health check failed: %w", callError(err))
+		}
+		if health.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("plugin is %s", health.GetStatus())
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", callError(err))
+	}
+	if !resp.GetHealthy() {
+		return errors.New(resp.GetMessage())
+	}
 	return nil
 }
 
+// SetMeshToken sets the token the plugin identifies itself to the mesh
+// ingress with. It takes effect at the next start.
+func (p *meshPlugin) SetMeshToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.meshToken = token
+}
+
+// SetSocketPath moves the socket the plugin serves on, such as to run two
+// versions of it side by side. It takes effect at the next start.
+func (p *meshPlugin) SetSocketPath(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.isolation.socketPath = path
+}
+
+// PID returns the pid of the plugin process, 0 if it isn't running
+func (p *meshPlugin) PID() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.isolation.started || p.isolation.cmd.Process == nil {
+		return 0
+	}
+	return p.isolation.cmd.Process.Pid
+}
+
+// ResourceUsage reports the CPU and memory the plugin process uses
+func (p *meshPlugin) ResourceUsage() (plugins.PluginResourceUsage, error) {
+	pid := p.PID()
+	if pid == 0 {
+		return plugins.PluginResourceUsage{}, errors.New("plugin not running")
+	}
+	return processUsage(pid)
+}
+
 // GetStatus returns the plugin status
 func (p *meshPlugin) GetStatus() plugins.PluginStatus {
 	p.mu.RLock()
@@ -234,22 +380,134 @@ func (p *meshPlugin) GetStatus() plugins.PluginStatus {
 	return p.status
 }
 
-// PrepareShutdown prepares the plugin for shutdown
+// PrepareShutdown asks the plugin to finish pending work before it is stopped
 func (p *meshPlugin) PrepareShutdown() error {
-	// TODO: Send shutdown preparation signal via mesh
+	client, err := p.lifecycleClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	if _, err := client.PrepareShutdown(ctx, &lifecyclev1.PrepareShutdownRequest{}); err != nil {
+		return fmt.Errorf("failed to prepare plugin shutdown: %w", callError(err))
+	}
 	return nil
 }
 
-// ExportState exports plugin state via mesh
+// ExportState streams the plugin's state from it
 func (p *meshPlugin) ExportState() ([]byte, error) {
-	// TODO: Call plugin's ExportState method via mesh
-	return nil, errors.New("not implemented")
+	client, err := p.lifecycleClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	stream, err := client.ExportState(ctx, &lifecyclev1.ExportStateRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export plugin state: %w", stateCallError(err))
+	}
+
+	var state []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return state, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to export plugin state: %w", stateCallError(err))
+		}
+		state = append(state, chunk.GetData()...)
+	}
 }
 
-// ImportState imports plugin state via mesh
+// ImportState streams state to the plugin, replacing its own
 func (p *meshPlugin) ImportState(state []byte) error {
-	// TODO: Call plugin's ImportState method via mesh
-	return errors.New("not implemented")
+	client, err := p.lifecycleClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	stream, err := client.ImportState(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to import plugin state: %w", stateCallError(err))
+	}
+	for len(state) > 0 {
+		n := min(len(state), stateChunkSize)
+		// A failed send ends the stream; its cause is returned by
+		// CloseAndRecv
+		if err := stream.Send(&lifecyclev1.StateChunk{Data: state[:n]}); err != nil {
+			break
+		}
+		state = state[n:]
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return fmt.Errorf("failed to import plugin state: %w", stateCallError(err))
+	}
+	return nil
+}
+
+// Protocol returns the handshake negotiated with the plugin
+func (p *meshPlugin) Protocol() protocol.Handshake {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.peer
+}
+
+// handshake negotiates the protocol with the plugin over its lifecycle
+// service. Plugins that predate the Handshake call are legacy peers.
+func (p *meshPlugin) handshake(ctx context.Context) (protocol.Handshake, error) {
+	offer := protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            "blackhole",
+		Version:         p.spec.Version,
+		Transport:       protocol.TransportGRPC,
+		Features:        meshHostFeatures,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	client := lifecyclev1.NewPluginLifecycleClient(p.isolation.grpcConn)
+	resp, err := client.Handshake(ctx, lifecyclev1.NewHandshakeMessage(offer))
+	if status.Code(err) == codes.Unimplemented {
+		legacy := protocol.LegacyHandshake(p.spec.Name, p.spec.Version)
+		legacy.Transport = protocol.TransportGRPC
+		return legacy, nil
+	}
+	if err != nil {
+		return protocol.Handshake{}, callError(err)
+	}
+
+	reply := resp.AsHandshake()
+	version, features, err := protocol.Negotiate(offer, reply)
+	if err != nil {
+		return protocol.Handshake{}, err
+	}
+	reply.ProtocolVersion = version
+	reply.Features = features
+	return reply, nil
+}
+
+// lifecycleClient returns a client for the lifecycle service of the running
+// plugin
+func (p *meshPlugin) lifecycleClient() (lifecyclev1.PluginLifecycleClient, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.status != plugins.PluginStatusRunning {
+		return nil, errors.New("plugin not running")
+	}
+	if p.isolation.grpcConn == nil {
+		return nil, errors.New("mesh connection lost")
+	}
+	return lifecyclev1.NewPluginLifecycleClient(p.isolation.grpcConn), nil
 }
 
 // Private methods
@@ -343,22 +601,14 @@ func (p *meshPlugin) stop() error {
 		p.logger.Warn("Failed to send SIGTERM", zap.Error(err))
 	}
 
-	// Wait for graceful shutdown
-	done := make(chan error, 1)
-	go func() {
-		done <- p.isolation.cmd.Wait()
-	}()
-
+	// Wait for graceful shutdown; monitorProcess reaps the process
 	select {
 	case <-time.After(5 * time.Second):
 		// Force kill if not stopped gracefully
 		p.logger.Warn("Plugin did not stop gracefully, forcing kill")
 		p.isolation.cmd.Process.Kill()
-		<-done
-	case err := <-done:
-		if err != nil {
-			p.logger.Debug("Plugin process exited", zap.Error(err))
-		}
+		<-p.isolation.exited
+	case <-p.isolation.exited:
 	}
 
 	// Clean up socket
@@ -368,10 +618,14 @@ func (p *meshPlugin) stop() error {
 	return nil
 }
 
-func (p *meshPlugin) monitorProcess() {
+func (p *meshPlugin) monitorProcess(cmd *exec.Cmd, exited chan struct{}) {
 	// Monitor the plugin process
-	err := p.isolation.cmd.Wait()
-	
+	err := cmd.Wait()
+	close(exited)
+	if err != nil {
+		p.logger.Debug("Plugin process exited", zap.Error(err))
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	lifecyclev1 "github.com/blackhole-pro/blackhole/core/pkg/plugins/lifecycle/proto/v1"
+)
+
+// stateChunkSize is the most state sent in one ImportState message
+const stateChunkSize = 32 << 10
+
+// handleRequest converts a request for the plugin's lifecycle service
+func handleRequest(request plugins.PluginRequest) (*lifecyclev1.HandleRequest, error) {
+	params, err := toStruct(request.Params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	in := &lifecyclev1.HandleRequest{
+		Id:     request.ID,
+		Method: request.Method,
+		Params: params,
+		Data:   request.Data,
+		Context: &lifecyclev1.RequestContext{
+			UserId:    request.Context.UserID,
+			SessionId: request.Context.SessionID,
+			Headers:   request.Context.Headers,
+		},
+	}
+	if !request.Context.Timestamp.IsZero() {
+		in.Context.TimestampUnixNano = request.Context.Timestamp.UnixNano()
+	}
+	return in, nil
+}
+
+// pluginResponse converts a response from the plugin's lifecycle service
+func pluginResponse(resp *lifecyclev1.HandleResponse) plugins.PluginResponse {
+	var result map[string]interface{}
+	if resp.GetResult() != nil {
+		result = resp.GetResult().AsMap()
+	}
+	return plugins.PluginResponse{
+		ID:      resp.GetId(),
+		Success: resp.GetSuccess(),
+		Result:  result,
+		Data:    resp.GetData(),
+		Error:   resp.GetError(),
+		Metadata: plugins.ResponseMetadata{
+			ProcessingTime: resp.GetProcessingTime().AsDuration(),
+			CacheHit:       resp.GetCacheHit(),
+		},
+	}
+}
+
+// toStruct converts params to a Struct through JSON, so any value that
+// encodes as a JSON object is accepted
+func toStruct(m map[string]interface{}) (*structpb.Struct, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stateCallError reduces an error returned by a state call, reporting
+// plugins that don't keep state as plugins.ErrStateNotSupported
+func stateCallError(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return fmt.Errorf("%w: %s", plugins.ErrStateNotSupported, status.Convert(err).Message())
+	}
+	return callError(err)
+}
+
+// callError reduces an error returned by the plugin to its message
+func callError(err error) error {
+	if s, ok := status.FromError(err); ok {
+		return errors.New(s.Message())
+	}
+	return err
+}
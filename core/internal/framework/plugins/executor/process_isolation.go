@@ -10,24 +10,42 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
 )
 
+// DefaultMaxInFlight is the number of requests sent to a plugin process
+// before further callers wait, unless its resources say otherwise
+const DefaultMaxInFlight = 64
+
 // processIsolation implements process-level isolation for plugins
 type processIsolation struct {
 	cmd            *exec.Cmd
 	stdin          io.WriteCloser
 	stdout         io.ReadCloser
 	stderr         io.ReadCloser
-	encoder        *json.Encoder
-	decoder        *json.Decoder
+	conn           *protocol.Conn
 	resourceLimits plugins.PluginResources
 	mu             sync.Mutex
 	started        bool
+
+	// Requests are multiplexed by ID: callers wait on pending while a
+	// single reader dispatches responses
+	nextID  uint64
+	pending map[string]chan rpcResponse
+	slots   chan struct{}
+	closed  chan struct{}
+	readErr error
+	streams *protocol.Streams
+
+	// cancellable is set when the plugin accepts $/cancel
+	cancellable bool
 }
 
 // processPlugin implements the Plugin interface for process-isolated plugins
@@ -37,27 +55,43 @@ type processPlugin struct {
 	isolation  *processIsolation
 	info       plugins.PluginInfo
 	status     plugins.PluginStatus
+	peer       protocol.Handshake
+	config     ProcessConfig
 	mu         sync.RWMutex
 }
 
-// RPC message types
-type rpcMessage struct {
-	ID     string          `json:"id"`
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params,omitempty"`
+// ProcessConfig configures a process-isolated plugin
+type ProcessConfig struct {
+	// AllowUnsandboxed runs the plugin without its sandbox on platforms
+	// that don't support it, rather than refuse to start it
+	AllowUnsandboxed bool
+	// DataDir holds the plugin data directories, defaults to DefaultDataDir
+	DataDir string
 }
 
-type rpcResponse struct {
-	ID     string          `json:"id"`
-	Result json.RawMessage `json:"result,omitempty"`
-	Error  string          `json:"error,omitempty"`
-}
+// RPC message types
+type rpcMessage = protocol.Message
+
+type rpcResponse = protocol.Message
+
+// hostFeatures are the protocol features the process executor offers to plugins
+var hostFeatures = []protocol.Feature{protocol.FeatureState, protocol.FeatureCancellation, protocol.FeatureStreaming}
 
 // NewProcessPlugin creates a new process-isolated plugin
 func NewProcessPlugin(spec plugins.PluginSpec, binaryPath string) plugins.Plugin {
+	return NewProcessPluginWithConfig(spec, binaryPath, ProcessConfig{})
+}
+
+// NewProcessPluginWithConfig creates a process-isolated plugin with the
+// given configuration
+func NewProcessPluginWithConfig(spec plugins.PluginSpec, binaryPath string, config ProcessConfig) plugins.Plugin {
+	if config.DataDir == "" {
+		config.DataDir = DefaultDataDir
+	}
 	return &processPlugin{
 		spec:       spec,
 		binaryPath: binaryPath,
+		config:     config,
 		info: plugins.PluginInfo{
 			Name:        spec.Name,
 			Version:     spec.Version,
@@ -88,8 +122,15 @@ func (p *processPlugin) Start(ctx context.Context) error {
 	p.info.Status = p.status
 
 	// Create process isolation
+	maxInFlight := p.spec.Resources.Requests
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlight
+	}
 	isolation := &processIsolation{
 		resourceLimits: p.spec.Resources,
+		pending:        make(map[string]chan rpcResponse),
+		slots:          make(chan struct{}, maxInFlight),
+		closed:         make(chan struct{}),
 	}
 
 	// Create the command
@@ -114,9 +155,9 @@ func (p *processPlugin) Start(ctx context.Context) error {
 	}
 	isolation.stderr = stderr
 
-	// Set up JSON encoding/decoding
-	isolation.encoder = json.NewEncoder(stdin)
-	isolation.decoder = json.NewDecoder(stdout)
+	// Set up protocol connection
+	isolation.conn = protocol.NewConn(stdout, stdin)
+	isolation.streams = protocol.NewStreams(isolation.conn)
 
 	// Set process attributes for resource limits
 	isolation.cmd.SysProcAttr = &syscall.SysProcAttr{
@@ -124,12 +165,31 @@ func (p *processPlugin) Start(ctx context.Context) error {
 	}
 
 	// Set environment variables
+	dataDir := filepath.Join(p.config.DataDir, p.spec.Name)
 	isolation.cmd.Env = append(os.Environ(),
-		fmt.Sprintf("PLUGIN_NAME=%s", p.spec.Name),
-		fmt.Sprintf("PLUGIN_VERSION=%s", p.spec.Version),
+		fmt.Sprintf("%s=%s", protocol.EnvName, p.spec.Name),
+		fmt.Sprintf("%s=%s", protocol.EnvVersion, p.spec.Version),
+		fmt.Sprintf("%s=%d", protocol.EnvProtocolVersion, protocol.Version),
+		fmt.Sprintf("%s=%s", protocol.EnvTransport, protocol.TransportStdio),
+		fmt.Sprintf("%s=%s", protocol.EnvDataDir, dataDir),
 		"PLUGIN_MODE=subprocess",
 	)
 
+	// Restrict the process to the permissions it was granted
+	policy := PolicyForSpec(p.spec, dataDir)
+	if sandboxErr := Sandbox(isolation.cmd, policy); sandboxErr != nil {
+		err := sandboxErr
+		if errors.Is(err, ErrSandboxUnsupported) {
+			err = allowUnsandboxed(policy, p.config.AllowUnsandboxed, err)
+		}
+		if err != nil {
+			p.status = plugins.PluginStatusFailed
+			p.info.Status = p.status
+			return fmt.Errorf("failed to sandbox plugin %s: %w", p.spec.Name, err)
+		}
+		fmt.Printf("Warning: running plugin %s without sandbox (%s): %v\n", p.spec.Name, policy, sandboxErr)
+	}
+
 	// Start the process
 	if err := isolation.cmd.Start(); err != nil {
 		p.status = plugins.PluginStatusFailed
@@ -140,8 +200,20 @@ func (p *processPlugin) Start(ctx context.Context) error {
 	isolation.started = true
 	p.isolation = isolation
 
-	// Start error monitoring
+	// Start error monitoring and response dispatch
 	go p.monitorStderr()
+	go isolation.readResponses(p.spec.Name)
+
+	// Negotiate protocol version and features
+	peer, err := p.handshake(ctx)
+	if err != nil {
+		p.stop()
+		p.status = plugins.PluginStatusFailed
+		p.info.Status = p.status
+		return fmt.Errorf("plugin handshake failed: %w", err)
+	}
+	p.peer = peer
+	isolation.cancellable = peer.Supports(protocol.FeatureCancellation)
 
 	// Initialize the plugin
 	initReq := rpcMessage{
@@ -150,7 +222,7 @@ func (p *processPlugin) Start(ctx context.Context) error {
 		Params: json.RawMessage(fmt.Sprintf(`{"name":"%s","version":"%s"}`, p.spec.Name, p.spec.Version)),
 	}
 
-	resp, err := p.sendRequest(initReq)
+	resp, err := p.sendRequest(ctx, initReq)
 	if err != nil {
 		p.stop()
 		p.status = plugins.PluginStatusFailed
@@ -158,11 +230,11 @@ func (p *processPlugin) Start(ctx context.Context) error {
 		return fmt.Errorf("plugin initialization failed: %w", err)
 	}
 
-	if resp.Error != "" {
+	if resp.Error != nil {
 		p.stop()
 		p.status = plugins.PluginStatusFailed
 		p.info.Status = p.status
-		return fmt.Errorf("plugin initialization error: %s", resp.Error)
+		return fmt.Errorf("plugin initialization error: %w", resp.Error)
 	}
 
 	// Update status
@@ -192,11 +264,13 @@ func (p *processPlugin) Stop(ctx context.Context) error {
 	}
 
 	// Try graceful shutdown first
-	if _, err := p.sendRequest(shutdownReq); err == nil {
-		// Wait for process to exit
+	if _, err := p.sendRequest(ctx, shutdownReq); err == nil {
+		// Wait for process to exit once its output is drained
+		isolation := p.isolation
 		done := make(chan error, 1)
 		go func() {
-			done <- p.isolation.cmd.Wait()
+			<-isolation.closed
+			done <- isolation.cmd.Wait()
 		}()
 
 		select {
@@ -241,17 +315,22 @@ func (p *processPlugin) Handle(ctx context.Context, request plugins.PluginReques
 	}
 
 	// Send request
-	resp, err := p.sendRequest(req)
+	resp, err := p.request(ctx, req)
 	if err != nil {
-		return plugins.PluginResponse{}, err
+		return plugins.PluginResponse{}, plugins.CheckTimeout(ctx, p.spec.Name, request, err)
 	}
 
-	if resp.Error != "" {
+	return p.pluginResponse(ctx, request, resp)
+}
+
+// pluginResponse decodes the response to a handle request
+func (p *processPlugin) pluginResponse(ctx context.Context, request plugins.PluginRequest, resp *rpcResponse) (plugins.PluginResponse, error) {
+	if resp.Error != nil {
 		return plugins.PluginResponse{
 			ID:      request.ID,
 			Success: false,
-			Error:   resp.Error,
-		}, errors.New(resp.Error)
+			Error:   resp.Error.Message,
+		}, plugins.CheckTimeout(ctx, p.spec.Name, request, resp.Error)
 	}
 
 	// Parse response
@@ -277,13 +356,13 @@ func (p *processPlugin) HealthCheck() error {
 		Method: "healthcheck",
 	}
 
-	resp, err := p.sendRequest(req)
+	resp, err := p.request(context.Background(), req)
 	if err != nil {
 		return err
 	}
 
-	if resp.Error != "" {
-		return errors.New(resp.Error)
+	if resp.Error != nil {
+		return resp.Error
 	}
 
 	return nil
@@ -296,6 +375,21 @@ func (p *processPlugin) GetStatus() plugins.PluginStatus {
 	return p.status
 }
 
+// ResourceUsage reports the CPU and memory the plugin process uses
+func (p *processPlugin) ResourceUsage() (plugins.PluginResourceUsage, error) {
+	p.mu.RLock()
+	pid := 0
+	if p.isolation != nil && p.isolation.started && p.isolation.cmd.Process != nil {
+		pid = p.isolation.cmd.Process.Pid
+	}
+	p.mu.RUnlock()
+
+	if pid == 0 {
+		return plugins.PluginResourceUsage{}, errors.New("plugin not running")
+	}
+	return processUsage(pid)
+}
+
 // PrepareShutdown prepares the plugin for shutdown
 func (p *processPlugin) PrepareShutdown() error {
 	req := rpcMessage{
@@ -303,13 +397,13 @@ func (p *processPlugin) PrepareShutdown() error {
 		Method: "prepare_shutdown",
 	}
 
-	resp, err := p.sendRequest(req)
+	resp, err := p.request(context.Background(), req)
 	if err != nil {
 		return err
 	}
 
-	if resp.Error != "" {
-		return errors.New(resp.Error)
+	if resp.Error != nil {
+		return resp.Error
 	}
 
 	return nil
@@ -322,29 +416,36 @@ func (p *processPlugin) ExportState() ([]byte, error) {
 		Method: "export_state",
 	}
 
-	resp, err := p.sendRequest(req)
+	resp, err := p.request(context.Background(), req)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.Error != "" {
-		return nil, errors.New(resp.Error)
+	if resp.Error != nil {
+		return nil, stateResponseError(resp.Error)
 	}
 
-	// Result should be base64 encoded state
-	var state string
-	if err := json.Unmarshal(resp.Result, &state); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal state: %w", err)
-	}
+	return protocol.DecodeState(resp.Result)
+}
 
-	return []byte(state), nil
+// stateResponseError reports plugins that don't handle state calls as
+// plugins.ErrStateNotSupported
+func stateResponseError(err *protocol.Error) error {
+	if protocol.IsMethodNotFound(err) {
+		return fmt.Errorf("%w: %s", plugins.ErrStateNotSupported, err.Message)
+	}
+	return err
 }
 
 // ImportState imports plugin state
 func (p *processPlugin) ImportState(state []byte) error {
-	params, err := json.Marshal(string(state))
+	p.mu.RLock()
+	peer := p.peer
+	p.mu.RUnlock()
+
+	params, err := protocol.EncodeState(peer, state)
 	if err != nil {
-		return fmt.Errorf("failed to marshal state: %w", err)
+		return err
 	}
 
 	req := rpcMessage{
@@ -353,40 +454,238 @@ func (p *processPlugin) ImportState(state []byte) error {
 		Params: params,
 	}
 
-	resp, err := p.sendRequest(req)
+	resp, err := p.request(context.Background(), req)
 	if err != nil {
 		return err
 	}
 
-	if resp.Error != "" {
-		return errors.New(resp.Error)
+	if resp.Error != nil {
+		return stateResponseError(resp.Error)
 	}
 
 	return nil
 }
 
-// sendRequest sends an RPC request to the plugin process
-func (p *processPlugin) sendRequest(req rpcMessage) (*rpcResponse, error) {
-	p.isolation.mu.Lock()
-	defer p.isolation.mu.Unlock()
+// Protocol returns the handshake negotiated with the plugin process
+func (p *processPlugin) Protocol() protocol.Handshake {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.peer
+}
+
+// handshake negotiates the protocol with the plugin process, falling back to
+// the legacy protocol for plugins that do not implement $/handshake
+func (p *processPlugin) handshake(ctx context.Context) (protocol.Handshake, error) {
+	offer := protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            "blackhole",
+		Version:         p.spec.Version,
+		Transport:       protocol.TransportStdio,
+		Features:        hostFeatures,
+	}
+
+	req, err := protocol.NewRequest("handshake", protocol.MethodHandshake, offer)
+	if err != nil {
+		return protocol.Handshake{}, err
+	}
+
+	resp, err := p.sendRequest(ctx, req)
+	if err != nil {
+		return protocol.Handshake{}, err
+	}
+
+	if resp.Error != nil {
+		if protocol.IsMethodNotFound(resp.Error) {
+			return protocol.LegacyHandshake(p.spec.Name, p.spec.Version), nil
+		}
+		return protocol.Handshake{}, resp.Error
+	}
+
+	var reply protocol.Handshake
+	if err := json.Unmarshal(resp.Result, &reply); err != nil {
+		return protocol.Handshake{}, fmt.Errorf("failed to unmarshal handshake: %w", err)
+	}
+
+	version, features, err := protocol.Negotiate(offer, reply)
+	if err != nil {
+		return protocol.Handshake{}, err
+	}
+	reply.ProtocolVersion = version
+	reply.Features = features
+
+	return reply, nil
+}
+
+// sendRequest sends an RPC request to the plugin process. Callers hold the
+// plugin's lock.
+func (p *processPlugin) sendRequest(ctx context.Context, req rpcMessage) (*rpcResponse, error) {
+	return p.isolation.call(ctx, req)
+}
+
+// request sends an RPC request to the running plugin process
+func (p *processPlugin) request(ctx context.Context, req rpcMessage) (*rpcResponse, error) {
+	p.mu.RLock()
+	isolation := p.isolation
+	p.mu.RUnlock()
+
+	if isolation == nil {
+		return nil, fmt.Errorf("plugin not running")
+	}
+	return isolation.call(ctx, req)
+}
+
+// call sends a request under a fresh ID and waits for the response with that
+// ID, so any number of callers can share the connection. The request carries
+// ctx's deadline, and the plugin is told to cancel it when ctx ends first.
+func (iso *processIsolation) call(ctx context.Context, req rpcMessage) (*rpcResponse, error) {
+	id, reply, err := iso.send(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer iso.release()
+	return iso.wait(ctx, id, reply)
+}
+
+// send takes an in-flight slot and writes req under a fresh ID, calling
+// open with the ID first if set. The caller waits for the reply and then
+// releases the slot.
+func (iso *processIsolation) send(ctx context.Context, req rpcMessage, open func(id string)) (string, chan rpcResponse, error) {
+	select {
+	case iso.slots <- struct{}{}:
+	case <-iso.closed:
+		return "", nil, fmt.Errorf("failed to read response: %w", iso.readErr)
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Deadline = &deadline
+	}
+
+	reply := make(chan rpcResponse, 1)
+	iso.mu.Lock()
+	iso.nextID++
+	req.ID = strconv.FormatUint(iso.nextID, 10)
+	iso.pending[req.ID] = reply
+	iso.mu.Unlock()
+
+	if open != nil {
+		open(req.ID)
+	}
 
 	// Send request
-	if err := p.isolation.encoder.Encode(req); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if err := iso.conn.Write(req); err != nil {
+		iso.forget(req.ID)
+		iso.release()
+		return "", nil, fmt.Errorf("failed to send request: %w", err)
 	}
+	return req.ID, reply, nil
+}
+
+// release frees the in-flight slot of an answered request
+func (iso *processIsolation) release() {
+	<-iso.slots
+}
+
+// wait waits for the reader to hand over the response to request id
+func (iso *processIsolation) wait(ctx context.Context, id string, reply chan rpcResponse) (*rpcResponse, error) {
+	select {
+	case resp := <-reply:
+		return &resp, nil
+	case <-iso.closed:
+		select {
+		case resp := <-reply:
+			return &resp, nil
+		default:
+		}
+		iso.forget(id)
+		return nil, fmt.Errorf("failed to read response: %w", iso.readErr)
+	case <-ctx.Done():
+		select {
+		case resp := <-reply:
+			return &resp, nil
+		default:
+		}
+		iso.abandon(id)
+		return nil, ctx.Err()
+	}
+}
+
+// abandonedTTL is how long a late response to an abandoned request is
+// expected. Plugins that never answer don't leave their requests behind.
+const abandonedTTL = time.Minute
+
+// abandon stops waiting for a request and asks the plugin to cancel it. A
+// late response is dropped.
+func (iso *processIsolation) abandon(id string) {
+	iso.mu.Lock()
+	if _, ok := iso.pending[id]; ok {
+		iso.pending[id] = nil
+		time.AfterFunc(abandonedTTL, func() { iso.forget(id) })
+	}
+	iso.mu.Unlock()
 
-	// Read response
-	var resp rpcResponse
-	if err := p.isolation.decoder.Decode(&resp); err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	if iso.cancellable {
+		if err := iso.conn.Write(protocol.NewCancel(id)); err != nil {
+			fmt.Printf("Warning: failed to cancel plugin request %s: %v\n", id, err)
+		}
 	}
+}
+
+// forget stops waiting for the response to a request
+func (iso *processIsolation) forget(id string) {
+	iso.mu.Lock()
+	defer iso.mu.Unlock()
+	delete(iso.pending, id)
+}
 
-	// Verify response ID matches request
-	if resp.ID != req.ID {
-		return nil, fmt.Errorf("response ID mismatch: expected %s, got %s", req.ID, resp.ID)
+// readResponses dispatches responses from the plugin process to the callers
+// waiting for them until its output is closed
+func (iso *processIsolation) readResponses(name string) {
+	var err error
+	for {
+		var resp rpcResponse
+		resp, err = iso.conn.Read()
+		if err != nil {
+			var perr *protocol.Error
+			if errors.As(err, &perr) {
+				fmt.Printf("Warning: plugin %s sent an invalid message: %v\n", name, err)
+				continue
+			}
+			break
+		}
+
+		// Plugins don't make requests of the host over stdio, but they do
+		// send stream notifications
+		if resp.IsRequest() {
+			iso.streams.Dispatch(resp)
+			continue
+		}
+
+		iso.mu.Lock()
+		reply, ok := iso.pending[resp.ID]
+		delete(iso.pending, resp.ID)
+		iso.mu.Unlock()
+
+		if !ok {
+			fmt.Printf("Warning: plugin %s answered unknown request %q\n", name, resp.ID)
+			continue
+		}
+		// The response ends any stream the request had
+		var streamErr error
+		if resp.Error != nil {
+			streamErr = resp.Error
+		}
+		iso.streams.Finish(resp.ID, streamErr)
+
+		if reply != nil {
+			reply <- resp
+		}
 	}
 
-	return &resp, nil
+	iso.readErr = err
+	iso.streams.AbortAll(fmt.Errorf("failed to read stream: %w", err))
+	close(iso.closed)
 }
 
 // monitorStderr monitors the plugin's stderr for logging
@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// processStream is a streamed request to a process-isolated plugin
+type processStream struct {
+	stream  *protocol.Stream
+	mode    plugins.StreamMode
+	ctx     context.Context
+	plugin  *processPlugin
+	iso     *processIsolation
+	request plugins.PluginRequest
+	reply   chan rpcResponse
+	stop    func() bool
+
+	once     sync.Once
+	response plugins.PluginResponse
+	err      error
+}
+
+// OpenStream sends a streamed request to the plugin process. The request
+// body and response body are chunked over the plugin's connection with
+// credit-based flow control.
+func (p *processPlugin) OpenStream(ctx context.Context, request plugins.PluginRequest, mode plugins.StreamMode) (plugins.PluginStream, error) {
+	p.mu.RLock()
+	isolation := p.isolation
+	peer := p.peer
+	status := p.status
+	p.mu.RUnlock()
+
+	if status != plugins.PluginStatusRunning || isolation == nil {
+		return nil, fmt.Errorf("plugin not running: status=%s", status)
+	}
+	if !peer.Supports(protocol.FeatureStreaming) {
+		return nil, plugins.ErrStreamingUnsupported
+	}
+
+	params, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	s := &processStream{
+		mode:    mode,
+		ctx:     ctx,
+		plugin:  p,
+		iso:     isolation,
+		request: request,
+	}
+	req := rpcMessage{Method: protocol.MethodHandle, Params: params, Stream: mode}
+	id, reply, err := isolation.send(ctx, req, func(id string) {
+		s.stream = isolation.streams.Open(id)
+	})
+	if err != nil {
+		if s.stream != nil {
+			isolation.streams.Finish(s.stream.ID(), err)
+		}
+		return nil, err
+	}
+	s.reply = reply
+
+	// Unblock readers and writers if the caller gives up
+	s.stop = context.AfterFunc(ctx, func() { isolation.streams.Finish(id, ctx.Err()) })
+	return s, nil
+}
+
+// Read reads the response body streamed by the plugin
+func (s *processStream) Read(p []byte) (int, error) {
+	if !s.mode.ServerStreams() {
+		return 0, io.EOF
+	}
+	return s.stream.Read(p)
+}
+
+// Write streams p to the plugin as part of the request body
+func (s *processStream) Write(p []byte) (int, error) {
+	if !s.mode.ClientStreams() {
+		return 0, protocol.ErrStreamClosed
+	}
+	return s.stream.Write(p)
+}
+
+// CloseSend ends the request body
+func (s *processStream) CloseSend() error {
+	if !s.mode.ClientStreams() {
+		return nil
+	}
+	return s.stream.CloseWrite()
+}
+
+// Response waits for the plugin's response. A response body larger than the
+// flow control window must be read first, or the plugin can't finish.
+func (s *processStream) Response() (plugins.PluginResponse, error) {
+	s.once.Do(func() {
+		resp, err := s.iso.wait(s.ctx, s.stream.ID(), s.reply)
+		s.stop()
+		s.iso.release()
+
+		if err != nil {
+			s.iso.streams.Finish(s.stream.ID(), err)
+			s.err = plugins.CheckTimeout(s.ctx, s.plugin.spec.Name, s.request, err)
+			return
+		}
+
+		s.response, s.err = s.plugin.pluginResponse(s.ctx, s.request, resp)
+	})
+	return s.response, s.err
+}
@@ -0,0 +1,102 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+// DefaultDataDir holds the per-plugin data directories, the only places a
+// plugin without the filesystem permission can write to
+const DefaultDataDir = "/tmp/blackhole/plugin-data"
+
+// ErrSandboxUnsupported is returned where plugin processes can't be sandboxed
+var ErrSandboxUnsupported = errors.New("plugin sandbox not supported on this platform")
+
+// sandboxInitArg is argv[0] of the sandbox helper. The host binary re-executes
+// itself under this name inside the plugin's namespaces to finish setting up
+// the sandbox before executing the plugin.
+const sandboxInitArg = "blackhole-sandbox-init"
+
+// SandboxPolicy is the set of restrictions applied to a plugin process
+type SandboxPolicy struct {
+	Plugin string `json:"plugin"`
+
+	// IsolateNetwork runs the plugin in its own network namespace with no
+	// interfaces except a downed loopback; unix sockets still work
+	IsolateNetwork bool `json:"isolate_network,omitempty"`
+
+	// ReadOnlyFilesystem remounts everything read-only except WritablePaths
+	ReadOnlyFilesystem bool     `json:"read_only_filesystem,omitempty"`
+	WritablePaths      []string `json:"writable_paths,omitempty"`
+
+	// NoNewPrivileges stops the plugin gaining privileges through setuid
+	// binaries or file capabilities
+	NoNewPrivileges bool `json:"no_new_privileges,omitempty"`
+}
+
+// PolicyForSpec derives the sandbox of a plugin from the permissions it was
+// granted. writable are the directories it needs to write to, such as its
+// data directory and socket directory.
+func PolicyForSpec(spec plugins.PluginSpec, writable ...string) SandboxPolicy {
+	policy := SandboxPolicy{
+		Plugin:             spec.Name,
+		IsolateNetwork:     !plugins.HasPermission(spec.Permissions, plugins.PermissionNetwork),
+		ReadOnlyFilesystem: !plugins.HasPermission(spec.Permissions, plugins.PermissionFileSystem),
+		NoNewPrivileges:    !plugins.HasPermission(spec.Permissions, plugins.PermissionSystem),
+	}
+	if policy.ReadOnlyFilesystem {
+		for _, dir := range writable {
+			if dir != "" {
+				policy.WritablePaths = append(policy.WritablePaths, filepath.Clean(dir))
+			}
+		}
+	}
+	return policy
+}
+
+// Restricted reports whether the policy restricts anything
+func (p SandboxPolicy) Restricted() bool {
+	return p.IsolateNetwork || p.ReadOnlyFilesystem || p.NoNewPrivileges
+}
+
+// String lists the restrictions, e.g. "no network, read-only filesystem"
+func (p SandboxPolicy) String() string {
+	var restrictions []string
+	if p.IsolateNetwork {
+		restrictions = append(restrictions, "no network")
+	}
+	if p.ReadOnlyFilesystem {
+		restrictions = append(restrictions, fmt.Sprintf("read-only filesystem except %s", strings.Join(p.WritablePaths, ", ")))
+	}
+	if p.NoNewPrivileges {
+		restrictions = append(restrictions, "no new privileges")
+	}
+	if len(restrictions) == 0 {
+		return "unrestricted"
+	}
+	return strings.Join(restrictions, ", ")
+}
+
+// allowUnsandboxed decides whether a plugin that can't be sandboxed here may
+// run anyway. Plugins that need restricting only run unrestricted if the
+// operator allowed it.
+func allowUnsandboxed(policy SandboxPolicy, allowed bool, err error) error {
+	if !allowed {
+		return fmt.Errorf("%w: plugin %s requires %s and unsandboxed plugins are not allowed", err, policy.Plugin, policy)
+	}
+	return nil
+}
+
+// Sandbox rewrites cmd so that it runs under policy. It must be called
+// before cmd is started and after its Path, Args and SysProcAttr are set.
+func Sandbox(cmd *exec.Cmd, policy SandboxPolicy) error {
+	if !policy.Restricted() {
+		return nil
+	}
+	return sandbox(cmd, policy)
+}
@@ -0,0 +1,206 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	prSetNoNewPrivs = 38
+
+	// stRdonly is ST_RDONLY in statfs flags
+	stRdonly = 0x1
+
+	// lockedMountFlags must be kept when remounting a mount inherited from a
+	// more privileged namespace. Their statfs and mount values are the same.
+	lockedMountFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[0] == sandboxInitArg {
+		if err := sandboxInit(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", sandboxInitArg, err)
+			os.Exit(126)
+		}
+	}
+}
+
+// sandbox creates the namespaces for policy and routes cmd through the
+// sandbox helper, which applies the rest of the policy and then executes the
+// original command. Unprivileged hosts get a user namespace mapping the
+// plugin to their own uid.
+func sandbox(cmd *exec.Cmd, policy SandboxPolicy) error {
+	if cmd.Process != nil {
+		return errors.New("command already started")
+	}
+
+	// The policy is the caller's; don't rewrite its paths in place
+	policy.WritablePaths = append([]string(nil), policy.WritablePaths...)
+	for i, dir := range policy.WritablePaths {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("invalid writable path %s: %w", dir, err)
+		}
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", abs, err)
+		}
+		policy.WritablePaths[i] = abs
+	}
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	attr := cmd.SysProcAttr
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+		cmd.SysProcAttr = attr
+	}
+	if policy.IsolateNetwork {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	if policy.ReadOnlyFilesystem {
+		attr.Cloneflags |= syscall.CLONE_NEWNS
+	}
+	if attr.Cloneflags != 0 && os.Geteuid() != 0 {
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+
+	target := cmd.Path
+	cmd.Args = append([]string{sandboxInitArg, string(encoded), target}, cmd.Args[1:]...)
+	cmd.Path = "/proc/self/exe"
+	return nil
+}
+
+// sandboxInit runs inside the plugin's namespaces, before the plugin
+func sandboxInit(encoded string, argv []string) error {
+	var policy SandboxPolicy
+	if err := json.Unmarshal([]byte(encoded), &policy); err != nil {
+		return fmt.Errorf("invalid sandbox policy: %w", err)
+	}
+	if len(argv) == 0 {
+		return errors.New("no command to run")
+	}
+
+	// no_new_privs is per thread and must be set on the one that execs
+	runtime.LockOSThread()
+
+	if policy.ReadOnlyFilesystem {
+		if err := remountReadOnly(policy.WritablePaths); err != nil {
+			return err
+		}
+	}
+	if policy.NoNewPrivileges {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+			return fmt.Errorf("failed to set no_new_privs: %w", errno)
+		}
+	}
+
+	return syscall.Exec(argv[0], argv, os.Environ())
+}
+
+// remountReadOnly makes every mount in the namespace read-only except the
+// writable paths, which are bind-mounted over themselves first so they keep
+// their own mount. /proc and /dev are left alone.
+func remountReadOnly(writable []string) error {
+	// Keep the changes out of the host's mount namespace
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	for _, dir := range writable {
+		if err := syscall.Mount(dir, dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to bind %s: %w", dir, err)
+		}
+	}
+
+	mountPoints, err := readMountPoints()
+	if err != nil {
+		return err
+	}
+	for _, mountPoint := range mountPoints {
+		if under(mountPoint, "/proc") || under(mountPoint, "/dev") || underAny(mountPoint, writable) {
+			continue
+		}
+
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(mountPoint, &st); err != nil {
+			// Hidden under another mount
+			continue
+		}
+		if st.Flags&stRdonly != 0 {
+			continue
+		}
+
+		flags := uintptr(st.Flags) & lockedMountFlags
+		if err := syscall.Mount("", mountPoint, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|flags, ""); err != nil {
+			return fmt.Errorf("failed to make %s read-only: %w", mountPoint, err)
+		}
+	}
+	return nil
+}
+
+// readMountPoints lists the mount points of the current mount namespace
+func readMountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mounts: %w", err)
+	}
+	defer f.Close()
+
+	var mountPoints []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoints = append(mountPoints, unescapeMountPoint(fields[4]))
+	}
+	return mountPoints, scanner.Err()
+}
+
+// unescapeMountPoint decodes the octal escapes mountinfo uses for spaces,
+// tabs, newlines and backslashes
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func under(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if under(path, dir) {
+			return true
+		}
+	}
+	return false
+}
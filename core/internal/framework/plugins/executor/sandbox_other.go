@@ -0,0 +1,10 @@
+//go:build !linux
+
+package executor
+
+import "os/exec"
+
+// sandbox is only implemented with Linux namespaces
+func sandbox(cmd *exec.Cmd, policy SandboxPolicy) error {
+	return ErrSandboxUnsupported
+}
@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc, which Linux fixes
+// at 100 for user space
+const clockTicks = 100
+
+// processUsage reads a process's resident memory and its CPU use, averaged
+// over the time it has been running, from /proc
+func processUsage(pid int) (plugins.PluginResourceUsage, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return plugins.PluginResourceUsage{}, fmt.Errorf("failed to read process stats: %w", err)
+	}
+	// The command name is in parentheses and may contain spaces
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return plugins.PluginResourceUsage{}, fmt.Errorf("malformed stats of process %d", pid)
+	}
+	// Fields from the state on, so field n of proc(5) is at n-3
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 22 {
+		return plugins.PluginResourceUsage{}, fmt.Errorf("malformed stats of process %d", pid)
+	}
+	utime, _ := strconv.ParseUint(fields[14-3], 10, 64)
+	stime, _ := strconv.ParseUint(fields[15-3], 10, 64)
+	started, _ := strconv.ParseUint(fields[22-3], 10, 64)
+	rss, _ := strconv.ParseInt(fields[24-3], 10, 64)
+
+	uptime, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return plugins.PluginResourceUsage{}, fmt.Errorf("failed to read uptime: %w", err)
+	}
+	booted, err := strconv.ParseFloat(strings.Fields(string(uptime))[0], 64)
+	if err != nil {
+		return plugins.PluginResourceUsage{}, fmt.Errorf("malformed uptime: %w", err)
+	}
+
+	usage := plugins.PluginResourceUsage{Memory: uint64(max(rss, 0)) * uint64(os.Getpagesize())}
+	if running := booted - float64(started)/clockTicks; running > 0 {
+		usage.CPU = float64(utime+stime) / clockTicks / running * 100
+	}
+	return usage, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package executor
+
+import (
+	"errors"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+// processUsage is only implemented with /proc
+func processUsage(pid int) (plugins.PluginResourceUsage, error) {
+	return plugins.PluginResourceUsage{}, errors.New("process resource usage not supported on this platform")
+}
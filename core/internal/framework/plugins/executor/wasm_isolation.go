@@ -0,0 +1,514 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/wasm"
+)
+
+const (
+	// DefaultWASMMemoryMB is the memory a WebAssembly plugin may use, unless
+	// its resources say otherwise
+	DefaultWASMMemoryMB = 128
+
+	// DefaultWASMFuel is the number of instructions a WebAssembly plugin
+	// may execute while handling one call
+	DefaultWASMFuel = 10_000_000_000
+)
+
+// ErrFuelExhausted is returned for calls a WebAssembly plugin didn't finish
+// within its fuel
+var ErrFuelExhausted = fmt.Errorf("%w: fuel exhausted", ErrResourceLimitExceeded)
+
+// wasmPageSize is the size of a WebAssembly memory page
+const wasmPageSize = 64 << 10
+
+// WASMIsolationConfig configures WebAssembly plugin isolation
+type WASMIsolationConfig struct {
+	// DataDir holds the plugin data directories, defaults to DefaultDataDir
+	DataDir string
+
+	// CacheDir keeps compiled modules across restarts, empty to compile
+	// each time a plugin starts
+	CacheDir string
+
+	MaxMemoryMB    int           // Memory limit of plugins that don't set one, defaults to DefaultWASMMemoryMB
+	Fuel           uint64        // Instructions allowed per call, defaults to DefaultWASMFuel
+	DefaultTimeout time.Duration // Deadline of calls without one
+	Logger         *zap.Logger
+}
+
+// wasmPlugin implements the Plugin interface for plugins compiled to
+// WebAssembly. Each plugin runs in its own runtime inside the node process:
+// it can reach only its data directory and the host functions, its memory
+// is bounded, and every call is metered by fuel, the instructions it may
+// execute, and a deadline.
+type wasmPlugin struct {
+	spec       plugins.PluginSpec
+	modulePath string
+	dataDir    string
+	cacheDir   string
+	memoryMB   int
+	fuel       uint64
+	timeout    time.Duration
+	logger     *zap.Logger
+
+	runtime  wazero.Runtime
+	module   api.Module
+	fuelLeft api.MutableGlobal
+	info     plugins.PluginInfo
+	status   plugins.PluginStatus
+	mu       sync.RWMutex
+
+	// callMu serializes calls, a module runs one at a time
+	callMu sync.Mutex
+
+	// memoryBytes is the size of the module's memory after its last call
+	memoryBytes atomic.Uint64
+}
+
+// wasmCall is the input and output of one call into a plugin, which the
+// host functions find in the call's context
+type wasmCall struct {
+	input  []byte
+	output []byte
+}
+
+type wasmCallKey struct{}
+
+// NewWASMPlugin creates a new WebAssembly plugin from the module at modulePath
+func NewWASMPlugin(spec plugins.PluginSpec, modulePath string, config WASMIsolationConfig) plugins.Plugin {
+	if config.Logger == nil {
+		config.Logger = zap.NewNop()
+	}
+	if config.DataDir == "" {
+		config.DataDir = DefaultDataDir
+	}
+	if config.MaxMemoryMB <= 0 {
+		config.MaxMemoryMB = DefaultWASMMemoryMB
+	}
+	if config.Fuel == 0 {
+		config.Fuel = DefaultWASMFuel
+	}
+	if config.Fuel > math.MaxInt64 {
+		config.Fuel = math.MaxInt64
+	}
+	if config.DefaultTimeout == 0 {
+		config.DefaultTimeout = 30 * time.Second
+	}
+	memoryMB := config.MaxMemoryMB
+	if spec.Resources.Memory > 0 {
+		memoryMB = spec.Resources.Memory
+	}
+
+	return &wasmPlugin{
+		spec:       spec,
+		modulePath: modulePath,
+		dataDir:    filepath.Join(config.DataDir, spec.Name),
+		cacheDir:   config.CacheDir,
+		memoryMB:   memoryMB,
+		fuel:       config.Fuel,
+		timeout:    config.DefaultTimeout,
+		logger:     config.Logger.With(zap.String("plugin", spec.Name)),
+		info: plugins.PluginInfo{
+			Name:        spec.Name,
+			Version:     spec.Version,
+			Description: "WebAssembly plugin",
+			Status:      plugins.PluginStatusStopped,
+		},
+		status: plugins.PluginStatusStopped,
+	}
+}
+
+// Info returns plugin information
+func (p *wasmPlugin) Info() plugins.PluginInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.info
+}
+
+// Start compiles and instantiates the plugin's module
+func (p *wasmPlugin) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.status == plugins.PluginStatusRunning {
+		return nil
+	}
+
+	p.status = plugins.PluginStatusStarting
+	p.info.Status = p.status
+
+	if err := p.instantiate(ctx); err != nil {
+		p.close()
+		p.status = plugins.PluginStatusFailed
+		p.info.Status = p.status
+		return err
+	}
+
+	p.status = plugins.PluginStatusRunning
+	p.info.Status = p.status
+	p.info.LoadTime = time.Now()
+	return nil
+}
+
+// instantiate creates the plugin's runtime and module. Callers must hold p.mu.
+func (p *wasmPlugin) instantiate(ctx context.Context) error {
+	binary, err := os.ReadFile(p.modulePath)
+	if err != nil {
+		return fmt.Errorf("failed to read plugin module: %w", err)
+	}
+	if err := os.MkdirAll(p.dataDir, 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(p.memoryMB) * (1 << 20 / wasmPageSize)).
+		WithCloseOnContextDone(true)
+	if p.cacheDir != "" {
+		cache, err := wazero.NewCompilationCacheWithDir(p.cacheDir)
+		if err != nil {
+			return fmt.Errorf("failed to open compilation cache: %w", err)
+		}
+		config = config.WithCompilationCache(cache)
+	}
+	p.runtime = wazero.NewRuntimeWithConfig(ctx, config)
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		return fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+	if err := p.instantiateHost(ctx); err != nil {
+		return fmt.Errorf("failed to instantiate host functions: %w", err)
+	}
+
+	metered, err := meterModule(binary)
+	if err != nil {
+		return fmt.Errorf("failed to meter plugin module: %w", err)
+	}
+	compiled, err := p.runtime.CompileModule(ctx, metered)
+	if err != nil {
+		return fmt.Errorf("failed to compile plugin module: %w", err)
+	}
+
+	moduleConfig := wazero.NewModuleConfig().
+		WithName(p.spec.Name).
+		WithStartFunctions("_initialize").
+		WithFSConfig(wazero.NewFSConfig().WithDirMount(p.dataDir, wasm.DataDir)).
+		WithEnv(protocol.EnvName, p.spec.Name).
+		WithEnv(protocol.EnvVersion, p.spec.Version).
+		WithEnv(protocol.EnvDataDir, wasm.DataDir).
+		WithStdout(&wasmLogWriter{logger: p.logger, stream: "stdout"}).
+		WithStderr(&wasmLogWriter{logger: p.logger, stream: "stderr"}).
+		WithRandSource(rand.Reader).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep()
+
+	initCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	module, err := p.runtime.InstantiateModule(initCtx, compiled, moduleConfig)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate plugin module: %w", err)
+	}
+
+	abi := module.ExportedFunction(wasm.ExportABIVersion)
+	if abi == nil || module.ExportedFunction(wasm.ExportHandle) == nil {
+		return fmt.Errorf("plugin module must export %s and %s", wasm.ExportABIVersion, wasm.ExportHandle)
+	}
+	results, err := abi.Call(initCtx)
+	if err != nil {
+		return fmt.Errorf("failed to read plugin ABI version: %w", err)
+	}
+	if version := api.DecodeI32(results[0]); version != wasm.ABIVersion {
+		return fmt.Errorf("plugin implements ABI version %d, host supports %d", version, wasm.ABIVersion)
+	}
+
+	fuel, ok := module.ExportedGlobal(fuelExport).(api.MutableGlobal)
+	if !ok {
+		return fmt.Errorf("plugin module has no fuel global")
+	}
+
+	p.module = module
+	p.fuelLeft = fuel
+	p.recordMemory(module)
+	return nil
+}
+
+// recordMemory notes the size of module's memory. The memory only grows
+// during calls, so it is read after each.
+func (p *wasmPlugin) recordMemory(module api.Module) {
+	if memory := module.Memory(); memory != nil {
+		p.memoryBytes.Store(uint64(memory.Size()))
+	}
+}
+
+// ResourceUsage reports the memory the module has grown to. Its CPU time
+// isn't measured.
+func (p *wasmPlugin) ResourceUsage() (plugins.PluginResourceUsage, error) {
+	return plugins.PluginResourceUsage{Memory: p.memoryBytes.Load()}, nil
+}
+
+// instantiateHost instantiates the host module plugins import from
+func (p *wasmPlugin) instantiateHost(ctx context.Context) error {
+	_, err := p.runtime.NewHostModuleBuilder(wasm.HostModule).
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context) uint32 {
+			if call, ok := ctx.Value(wasmCallKey{}).(*wasmCall); ok {
+				return uint32(len(call.input))
+			}
+			return 0
+		}).
+		Export(wasm.HostInputLen).
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, mod api.Module, ptr uint32) {
+			call, ok := ctx.Value(wasmCallKey{}).(*wasmCall)
+			if ok && !mod.Memory().Write(ptr, call.input) {
+				panic(fmt.Errorf("%s out of bounds", wasm.HostInputRead))
+			}
+		}).
+		Export(wasm.HostInputRead).
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, mod api.Module, ptr, size uint32) {
+			call, ok := ctx.Value(wasmCallKey{}).(*wasmCall)
+			if !ok {
+				return
+			}
+			data, ok := mod.Memory().Read(ptr, size)
+			if !ok {
+				panic(fmt.Errorf("%s out of bounds", wasm.HostOutputWrite))
+			}
+			call.output = append(call.output[:0], data...)
+		}).
+		Export(wasm.HostOutputWrite).
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, mod api.Module, level, ptr, size uint32) {
+			data, ok := mod.Memory().Read(ptr, size)
+			if !ok {
+				panic(fmt.Errorf("%s out of bounds", wasm.HostLog))
+			}
+			p.log(wasm.LogLevel(level), string(data))
+		}).
+		Export(wasm.HostLog).
+		Instantiate(ctx)
+	return err
+}
+
+// log logs a message from the plugin
+func (p *wasmPlugin) log(level wasm.LogLevel, message string) {
+	switch level {
+	case wasm.LogDebug:
+		p.logger.Debug(message)
+	case wasm.LogWarn:
+		p.logger.Warn(message)
+	case wasm.LogError:
+		p.logger.Error(message)
+	default:
+		p.logger.Info(message)
+	}
+}
+
+// Stop closes the plugin's runtime, ending any call in progress
+func (p *wasmPlugin) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.status != plugins.PluginStatusRunning && p.status != plugins.PluginStatusFailed {
+		return nil
+	}
+
+	p.status = plugins.PluginStatusStopping
+	p.info.Status = p.status
+	p.close()
+	p.status = plugins.PluginStatusStopped
+	p.info.Status = p.status
+	return nil
+}
+
+// close releases the plugin's runtime. Callers must hold p.mu.
+func (p *wasmPlugin) close() {
+	if p.runtime != nil {
+		p.runtime.Close(context.Background())
+	}
+	p.runtime = nil
+	p.module = nil
+	p.fuelLeft = nil
+}
+
+// Handle handles a plugin request
+func (p *wasmPlugin) Handle(ctx context.Context, request plugins.PluginRequest) (plugins.PluginResponse, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return plugins.PluginResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	status, output, err := p.call(ctx, wasm.ExportHandle, input)
+	if err != nil {
+		return plugins.PluginResponse{}, plugins.CheckTimeout(ctx, p.spec.Name, request, err)
+	}
+	if status != wasm.StatusOK {
+		return plugins.PluginResponse{
+			ID:      request.ID,
+			Success: false,
+			Error:   string(output),
+		}, nil
+	}
+
+	var resp plugins.PluginResponse
+	if err := json.Unmarshal(output, &resp); err != nil {
+		return plugins.PluginResponse{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return resp, nil
+}
+
+// HealthCheck checks if the plugin is healthy
+func (p *wasmPlugin) HealthCheck() error {
+	status, output, err := p.call(context.Background(), wasm.ExportHealth, nil)
+	if err != nil {
+		return err
+	}
+	if status == wasm.StatusError {
+		return errors.New(string(output))
+	}
+	return nil
+}
+
+// GetStatus returns the plugin status
+func (p *wasmPlugin) GetStatus() plugins.PluginStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.status
+}
+
+// PrepareShutdown prepares the plugin for shutdown
+func (p *wasmPlugin) PrepareShutdown() error {
+	status, output, err := p.call(context.Background(), wasm.ExportPrepareShutdown, nil)
+	if err != nil {
+		return err
+	}
+	if status == wasm.StatusError {
+		return errors.New(string(output))
+	}
+	return nil
+}
+
+// ExportState exports the plugin state
+func (p *wasmPlugin) ExportState() ([]byte, error) {
+	status, output, err := p.call(context.Background(), wasm.ExportExportState, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := wasmStateError(status, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// ImportState imports plugin state
+func (p *wasmPlugin) ImportState(state []byte) error {
+	status, output, err := p.call(context.Background(), wasm.ExportImportState, state)
+	if err != nil {
+		return err
+	}
+	return wasmStateError(status, output)
+}
+
+// wasmStateError reports plugins that don't handle state calls as
+// plugins.ErrStateNotSupported
+func wasmStateError(status wasm.Status, output []byte) error {
+	switch status {
+	case wasm.StatusOK:
+		return nil
+	case wasm.StatusUnsupported:
+		return plugins.ErrStateNotSupported
+	default:
+		return errors.New(string(output))
+	}
+}
+
+// call calls an export of the plugin with input, returning the status and
+// output. Exports the plugin doesn't have report wasm.StatusUnsupported.
+// A call that traps, runs out of fuel or passes its deadline leaves the
+// module unusable, so the plugin is marked failed.
+func (p *wasmPlugin) call(ctx context.Context, export string, input []byte) (wasm.Status, []byte, error) {
+	p.callMu.Lock()
+	defer p.callMu.Unlock()
+
+	p.mu.RLock()
+	module, fuel, status := p.module, p.fuelLeft, p.status
+	p.mu.RUnlock()
+	if status != plugins.PluginStatusRunning || module == nil {
+		return 0, nil, fmt.Errorf("plugin not running: status=%s", status)
+	}
+
+	fn := module.ExportedFunction(export)
+	if fn == nil {
+		return wasm.StatusUnsupported, nil, nil
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	call := &wasmCall{input: input}
+	fuel.Set(p.fuel)
+	results, err := fn.Call(context.WithValue(ctx, wasmCallKey{}, call))
+	p.recordMemory(module)
+	if err != nil {
+		exhausted := int64(fuel.Get()) < 0
+		p.fail(module, err)
+		if ctx.Err() != nil {
+			return 0, nil, fmt.Errorf("plugin %s call %s interrupted: %w", p.spec.Name, export, ctx.Err())
+		}
+		if exhausted {
+			return 0, nil, fmt.Errorf("plugin %s call %s stopped: %w", p.spec.Name, export, ErrFuelExhausted)
+		}
+		return 0, nil, fmt.Errorf("plugin %s call %s failed: %w", p.spec.Name, export, err)
+	}
+	return wasm.Status(api.DecodeI32(results[0])), call.output, nil
+}
+
+// fail marks the plugin failed after a call into module failed
+func (p *wasmPlugin) fail(module api.Module, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.module != module || p.status != plugins.PluginStatusRunning {
+		return
+	}
+	p.logger.Error("WebAssembly plugin failed", zap.Error(err))
+	p.close()
+	p.status = plugins.PluginStatusFailed
+	p.info.Status = p.status
+}
+
+// wasmLogWriter logs what a plugin writes to stdout or stderr
+type wasmLogWriter struct {
+	logger *zap.Logger
+	stream string
+}
+
+func (w *wasmLogWriter) Write(data []byte) (int, error) {
+	if line := bytes.TrimRight(data, "\n"); len(line) > 0 {
+		w.logger.Info(string(line), zap.String("stream", w.stream))
+	}
+	return len(data), nil
+}
@@ -0,0 +1,556 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Fuel is metered by rewriting the module before it's compiled, as wazero
+// has no hook for instructions. The module gets a mutable i64 global,
+// exported as fuelExport, holding the fuel left. Each region of straight-line
+// code is charged its number of instructions when it's entered, and the
+// module traps once the fuel is spent. Regions start where code can be
+// jumped to: at function entry, at the start of loop bodies, at the start of
+// if and else arms and after the end of blocks. A region left early by a
+// branch is charged in full, so fuel is an upper bound on the instructions
+// executed.
+//
+// Fuel is checked at function entry and at loop starts, the only places
+// code repeats, so a call may run a little past its fuel before it traps.
+
+// fuelExport is the name the fuel global is exported under
+const fuelExport = "blackhole.fuel"
+
+// errMeter is returned for modules that can't be metered
+var errMeter = errors.New("cannot meter module")
+
+// WebAssembly section IDs
+const (
+	sectionCustom    = 0
+	sectionType      = 1
+	sectionImport    = 2
+	sectionFunction  = 3
+	sectionTable     = 4
+	sectionMemory    = 5
+	sectionGlobal    = 6
+	sectionExport    = 7
+	sectionStart     = 8
+	sectionElement   = 9
+	sectionCode      = 10
+	sectionData      = 11
+	sectionDataCount = 12
+)
+
+// sectionOrder ranks the sections the binary format orders, the data count
+// section coming before the code section
+var sectionOrder = map[byte]int{
+	sectionType:      1,
+	sectionImport:    2,
+	sectionFunction:  3,
+	sectionTable:     4,
+	sectionMemory:    5,
+	sectionGlobal:    6,
+	sectionExport:    7,
+	sectionStart:     8,
+	sectionElement:   9,
+	sectionDataCount: 10,
+	sectionCode:      11,
+	sectionData:      12,
+}
+
+// wasmSection is a section of a module
+type wasmSection struct {
+	id      byte
+	name    string // of custom sections
+	content []byte
+}
+
+// meterModule returns the module in binary with fuel metering added
+func meterModule(binary []byte) ([]byte, error) {
+	header := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	if !bytes.HasPrefix(binary, header) {
+		return nil, fmt.Errorf("%w: not a WebAssembly module", errMeter)
+	}
+
+	var sections []wasmSection
+	r := &wasmReader{data: binary, pos: len(header)}
+	for !r.done() {
+		id := r.byte()
+		content := r.bytes(int(r.u32()))
+		if r.err != nil {
+			return nil, fmt.Errorf("%w: %v", errMeter, r.err)
+		}
+		section := wasmSection{id: id, content: content}
+		if id == sectionCustom {
+			cr := &wasmReader{data: content}
+			section.name = cr.name()
+			// Debug information points into the code, which moves
+			if strings.HasPrefix(section.name, ".debug_") {
+				continue
+			}
+		}
+		sections = append(sections, section)
+	}
+
+	importedGlobals, err := countImportedGlobals(sections)
+	if err != nil {
+		return nil, err
+	}
+
+	// The fuel global is added after the module's globals, so no index moves.
+	// It starts full, leaving module initialization unmetered.
+	global := []byte{0x7E, 0x01, 0x42} // mutable i64, i64.const
+	global = appendS64(global, math.MaxInt64)
+	global = append(global, 0x0B)
+	globals := findSection(sections, sectionGlobal)
+	if globals == nil {
+		sections = insertSection(sections, wasmSection{id: sectionGlobal, content: []byte{0}})
+		globals = findSection(sections, sectionGlobal)
+	}
+	count, err := vectorLength(globals.content)
+	if err != nil {
+		return nil, err
+	}
+	fuelGlobal := importedGlobals + count
+	globals.content = appendToVector(globals.content, global)
+
+	exports := findSection(sections, sectionExport)
+	if exports == nil {
+		sections = insertSection(sections, wasmSection{id: sectionExport, content: []byte{0}})
+		exports = findSection(sections, sectionExport)
+	}
+	if err := checkExportName(exports.content, fuelExport); err != nil {
+		return nil, err
+	}
+	export := appendU32(nil, uint32(len(fuelExport)))
+	export = append(export, fuelExport...)
+	export = append(export, 0x03) // global
+	export = appendU32(export, fuelGlobal)
+	exports.content = appendToVector(exports.content, export)
+
+	if code := findSection(sections, sectionCode); code != nil {
+		if code.content, err = meterCode(code.content, fuelGlobal); err != nil {
+			return nil, err
+		}
+	}
+
+	out := append([]byte(nil), header...)
+	for _, section := range sections {
+		out = append(out, section.id)
+		out = appendU32(out, uint32(len(section.content)))
+		out = append(out, section.content...)
+	}
+	return out, nil
+}
+
+// findSection returns the first section with id
+func findSection(sections []wasmSection, id byte) *wasmSection {
+	for i := range sections {
+		if sections[i].id == id {
+			return &sections[i]
+		}
+	}
+	return nil
+}
+
+// insertSection inserts a section where the binary format orders it
+func insertSection(sections []wasmSection, section wasmSection) []wasmSection {
+	at := len(sections)
+	for i, s := range sections {
+		if s.id != sectionCustom && sectionOrder[s.id] > sectionOrder[section.id] {
+			at = i
+			break
+		}
+	}
+	return append(sections[:at], append([]wasmSection{section}, sections[at:]...)...)
+}
+
+// vectorLength returns the length of the vector a section holds
+func vectorLength(content []byte) (uint32, error) {
+	r := &wasmReader{data: content}
+	count := r.u32()
+	if r.err != nil {
+		return 0, fmt.Errorf("%w: %v", errMeter, r.err)
+	}
+	return count, nil
+}
+
+// appendToVector returns the vector a section holds with element appended.
+// Callers have checked the vector's length reads.
+func appendToVector(content []byte, element []byte) []byte {
+	r := &wasmReader{data: content}
+	count := r.u32()
+	out := appendU32(nil, count+1)
+	out = append(out, content[r.pos:]...)
+	return append(out, element...)
+}
+
+// countImportedGlobals returns the number of globals the module imports,
+// which come before its own in the global index space
+func countImportedGlobals(sections []wasmSection) (uint32, error) {
+	imports := findSection(sections, sectionImport)
+	if imports == nil {
+		return 0, nil
+	}
+	r := &wasmReader{data: imports.content}
+	var globals uint32
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		r.name() // module
+		r.name() // field
+		switch kind := r.byte(); kind {
+		case 0x00: // function
+			r.u32()
+		case 0x01: // table
+			r.byte()
+			r.limits()
+		case 0x02: // memory
+			r.limits()
+		case 0x03: // global
+			r.byte()
+			r.byte()
+			globals++
+		default:
+			r.fail("unknown import kind 0x%02x", kind)
+		}
+	}
+	if r.err != nil {
+		return 0, fmt.Errorf("%w: %v", errMeter, r.err)
+	}
+	return globals, nil
+}
+
+// checkExportName fails if the module already exports name
+func checkExportName(content []byte, name string) error {
+	r := &wasmReader{data: content}
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		if r.name() == name {
+			return fmt.Errorf("%w: module exports %s", errMeter, name)
+		}
+		r.byte()
+		r.u32()
+	}
+	if r.err != nil {
+		return fmt.Errorf("%w: %v", errMeter, r.err)
+	}
+	return nil
+}
+
+// meterCode adds fuel metering to every function body of a code section
+func meterCode(content []byte, fuelGlobal uint32) ([]byte, error) {
+	r := &wasmReader{data: content}
+	count := r.u32()
+	out := appendU32(nil, count)
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		body := r.bytes(int(r.u32()))
+		if r.err != nil {
+			break
+		}
+		metered, err := meterFunction(body, fuelGlobal)
+		if err != nil {
+			return nil, fmt.Errorf("%w: function %d: %v", errMeter, i, err)
+		}
+		out = appendU32(out, uint32(len(metered)))
+		out = append(out, metered...)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %v", errMeter, r.err)
+	}
+	return out, nil
+}
+
+// fuelRegion is a region of straight-line code, charged when it's entered
+type fuelRegion struct {
+	start int // offset of its first instruction
+	cost  int64
+	check bool // whether the fuel left is checked on entry
+}
+
+// meterFunction adds fuel metering to a function body
+func meterFunction(body []byte, fuelGlobal uint32) ([]byte, error) {
+	r := &wasmReader{data: body}
+	for n := r.u32(); n > 0 && r.err == nil; n-- {
+		r.u32()  // count
+		r.byte() // type
+	}
+
+	regions := []fuelRegion{{start: r.pos, check: true}}
+	depth := 0
+	for ended := false; !ended; {
+		if r.done() {
+			r.fail("function body doesn't end")
+			return nil, r.err
+		}
+		opcode := r.byte()
+		regions[len(regions)-1].cost++
+		if err := r.immediates(opcode); err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case 0x02: // block
+			depth++
+		case 0x03: // loop
+			depth++
+			regions = append(regions, fuelRegion{start: r.pos, check: true})
+		case 0x04: // if
+			depth++
+			regions = append(regions, fuelRegion{start: r.pos})
+		case 0x05: // else
+			regions = append(regions, fuelRegion{start: r.pos})
+		case 0x0B: // end
+			if depth == 0 {
+				ended = true
+				break
+			}
+			depth--
+			regions = append(regions, fuelRegion{start: r.pos})
+		}
+	}
+	if !r.done() {
+		return nil, fmt.Errorf("code after the end of the function")
+	}
+
+	out := make([]byte, 0, len(body)+len(regions)*24)
+	from := 0
+	for _, region := range regions {
+		if region.cost == 0 {
+			continue
+		}
+		out = append(out, body[from:region.start]...)
+		out = appendCharge(out, fuelGlobal, region.cost, region.check)
+		from = region.start
+	}
+	return append(out, body[from:]...), nil
+}
+
+// appendCharge appends code taking cost from the fuel global, and if check
+// is set, trapping when the fuel is spent
+func appendCharge(out []byte, fuelGlobal uint32, cost int64, check bool) []byte {
+	out = append(out, 0x23) // global.get
+	out = appendU32(out, fuelGlobal)
+	out = append(out, 0x42) // i64.const
+	out = appendS64(out, cost)
+	out = append(out, 0x7D, 0x24) // i64.sub, global.set
+	out = appendU32(out, fuelGlobal)
+	if check {
+		out = append(out, 0x23) // global.get
+		out = appendU32(out, fuelGlobal)
+		out = append(out,
+			0x42, 0x00, // i64.const 0
+			0x53,       // i64.lt_s
+			0x04, 0x40, // if
+			0x00, // unreachable
+			0x0B, // end
+		)
+	}
+	return out
+}
+
+// wasmReader reads the WebAssembly binary format, keeping the first error
+type wasmReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *wasmReader) done() bool {
+	return r.err != nil || r.pos >= len(r.data)
+}
+
+func (r *wasmReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (r *wasmReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail("unexpected end at offset %d", r.pos)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *wasmReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.fail("unexpected end at offset %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// leb reads a LEB128 number of at most maxBits bits, returning its value
+// and the last byte read
+func (r *wasmReader) leb(maxBits uint) (uint64, byte) {
+	var value uint64
+	var shift uint
+	for {
+		b := r.byte()
+		if r.err != nil {
+			return 0, 0
+		}
+		value |= uint64(b&0x7F) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return value, b
+		}
+		if shift >= maxBits {
+			r.fail("integer too long at offset %d", r.pos)
+			return 0, 0
+		}
+	}
+}
+
+func (r *wasmReader) u32() uint32 {
+	value, _ := r.leb(32)
+	return uint32(value)
+}
+
+func (r *wasmReader) name() string {
+	return string(r.bytes(int(r.u32())))
+}
+
+func (r *wasmReader) limits() {
+	flags := r.byte()
+	r.u32()
+	if flags&0x01 != 0 {
+		r.u32()
+	}
+}
+
+// blockType skips a block type: empty, a value type or a type index
+func (r *wasmReader) blockType() {
+	if r.done() {
+		r.fail("unexpected end at offset %d", r.pos)
+		return
+	}
+	switch r.data[r.pos] {
+	case 0x40, 0x7F, 0x7E, 0x7D, 0x7C, 0x7B, 0x70, 0x6F:
+		r.pos++
+	default:
+		r.leb(33)
+	}
+}
+
+func (r *wasmReader) memarg() {
+	r.u32() // align
+	r.u32() // offset
+}
+
+// immediates skips the immediates of an instruction
+func (r *wasmReader) immediates(opcode byte) error {
+	switch {
+	case opcode == 0x00, opcode == 0x01, opcode == 0x05, opcode == 0x0B, opcode == 0x0F,
+		opcode == 0x1A, opcode == 0x1B, opcode == 0xD1,
+		opcode >= 0x45 && opcode <= 0xC4:
+		// unreachable, nop, else, end, return, drop, select, ref.is_null
+		// and the numeric instructions have none
+	case opcode >= 0x02 && opcode <= 0x04: // block, loop, if
+		r.blockType()
+	case opcode == 0x0C, opcode == 0x0D: // br, br_if
+		r.u32()
+	case opcode == 0x0E: // br_table
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			r.u32()
+		}
+		r.u32()
+	case opcode == 0x10, opcode == 0x12, opcode == 0xD2: // call, return_call, ref.func
+		r.u32()
+	case opcode == 0x11, opcode == 0x13: // call_indirect, return_call_indirect
+		r.u32()
+		r.u32()
+	case opcode == 0x1C: // select with types
+		r.bytes(int(r.u32()))
+	case opcode >= 0x20 && opcode <= 0x26: // locals, globals, table.get and table.set
+		r.u32()
+	case opcode >= 0x28 && opcode <= 0x3E: // loads and stores
+		r.memarg()
+	case opcode == 0x3F, opcode == 0x40: // memory.size, memory.grow
+		r.u32()
+	case opcode == 0x41: // i32.const
+		r.leb(32)
+	case opcode == 0x42: // i64.const
+		r.leb(64)
+	case opcode == 0x43: // f32.const
+		r.bytes(4)
+	case opcode == 0x44: // f64.const
+		r.bytes(8)
+	case opcode == 0xD0: // ref.null
+		r.byte()
+	case opcode == 0xFC:
+		r.miscImmediates(r.u32())
+	case opcode == 0xFD:
+		r.vectorImmediates(r.u32())
+	default:
+		r.fail("unsupported instruction 0x%02x at offset %d", opcode, r.pos-1)
+	}
+	return r.err
+}
+
+// miscImmediates skips the immediates of a 0xFC instruction
+func (r *wasmReader) miscImmediates(opcode uint32) {
+	switch {
+	case opcode <= 7: // saturating truncations
+	case opcode == 8, opcode == 10, opcode == 12, opcode == 14:
+		// memory.init, memory.copy, table.init, table.copy
+		r.u32()
+		r.u32()
+	case opcode == 9, opcode == 11, opcode == 13, opcode >= 15 && opcode <= 17:
+		// data.drop, memory.fill, elem.drop, table.grow, table.size, table.fill
+		r.u32()
+	default:
+		r.fail("unsupported instruction 0xfc %d at offset %d", opcode, r.pos)
+	}
+}
+
+// vectorImmediates skips the immediates of a 0xFD instruction
+func (r *wasmReader) vectorImmediates(opcode uint32) {
+	switch {
+	case opcode <= 11, opcode == 92, opcode == 93: // loads and stores
+		r.memarg()
+	case opcode == 12, opcode == 13: // v128.const, i8x16.shuffle
+		r.bytes(16)
+	case opcode >= 21 && opcode <= 34: // lane extracts and replaces
+		r.byte()
+	case opcode >= 84 && opcode <= 91: // lane loads and stores
+		r.memarg()
+		r.byte()
+	case opcode <= 275: // none
+	default:
+		r.fail("unsupported instruction 0xfd %d at offset %d", opcode, r.pos)
+	}
+}
+
+// appendU32 appends an unsigned LEB128 number
+func appendU32(out []byte, value uint32) []byte {
+	for value >= 0x80 {
+		out = append(out, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(out, byte(value))
+}
+
+// appendS64 appends a signed LEB128 number
+func appendS64(out []byte, value int64) []byte {
+	for {
+		b := byte(value & 0x7F)
+		value >>= 7
+		if (value == 0 && b&0x40 == 0) || (value == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
@@ -2,6 +2,9 @@
 package factory
 
 import (
+	"context"
+	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
@@ -10,20 +13,38 @@ import (
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/loader"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/trust"
 )
 
 // Config holds configuration for creating a plugin manager
 type Config struct {
 	// Registry configuration
 	MarketplaceURL string
+	RegistryPath   string
 	
 	// Loader configuration
 	CachePath      string
 	TempPath       string
+	TrustPath      string
+	SignaturePolicy string // require, warn or allow
+	
+	// Install configuration. PermissionApprover is asked which permissions
+	// to grant a new plugin version; if nil, the ones AllowedPermissions
+	// lists are granted and the rest denied.
+	PermissionApprover plugins.PermissionApprover
+	AllowedPermissions plugins.PermissionAllowList
 	
 	// Executor configuration
 	MaxConcurrentPlugins int
 	ResourceUpdateInterval time.Duration
+	// AllowUnsandboxed runs plugins without their sandbox on platforms that
+	// don't support it, rather than refuse to start them
+	AllowUnsandboxed bool
+	// DataDir holds the per-plugin data directories, writable inside the sandbox
+	DataDir string
+	// AllocBudget is the number of bytes a call to an in-process plugin may
+	// allocate, for plugins whose resources don't set one; 0 for no budget
+	AllocBudget uint64
 	
 	// State configuration
 	StatePath      string
@@ -35,28 +56,53 @@ type Config struct {
 func DefaultConfig() *Config {
 	return &Config{
 		MarketplaceURL: "https://marketplace.blackhole.io",
+		RegistryPath:   "/tmp/blackhole/plugin-registry",
 		CachePath:      "/tmp/blackhole/plugin-cache",
 		TempPath:       "/tmp/blackhole/plugin-temp",
+		TrustPath:      "/etc/blackhole/trust",
+		SignaturePolicy: "warn",
 		MaxConcurrentPlugins: 10,
 		ResourceUpdateInterval: 5 * time.Second,
+		DataDir:        executor.DefaultDataDir,
 		StatePath:      "/tmp/blackhole/plugin-state",
 		EnableAutoSave: true,
 		AutoSaveInterval: 5 * time.Minute,
 	}
 }
 
-// NewPluginManager creates a new plugin manager with all required components
-func NewPluginManager(config *Config) plugins.PluginManager {
+// NewPluginManager creates a new plugin manager with all required components.
+// It fails if the plugin registry on disk can't be opened, rather than lose
+// track of the installed plugin versions.
+func NewPluginManager(config *Config) (plugins.PluginManager, error) {
 	if config == nil {
 		config = DefaultConfig()
 	}
 	
 	// Create registry
-	marketplaceClient := registry.NewMockMarketplaceClient() // TODO: Replace with real client
-	pluginRegistry := registry.New(marketplaceClient)
+	marketplaceClient := registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: config.MarketplaceURL,
+		CacheDir:   filepath.Join(config.CachePath, "marketplace"),
+	})
+	pluginRegistry, err := registry.Open(config.RegistryPath, marketplaceClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin registry: %w", err)
+	}
 	
-	// Create loader
-	pluginLoader := loader.New()
+	// Create loader. An unreadable trust store or policy falls back to an
+	// empty store that requires signatures, so nothing untrusted loads.
+	mode, err := trust.ParseMode(config.SignaturePolicy)
+	trustStore, storeErr := trust.LoadStore(config.TrustPath)
+	if err != nil || storeErr != nil {
+		mode, trustStore = trust.ModeRequire, trust.NewStore()
+	}
+	verifier := trust.NewVerifier(trustStore, trust.Policy{Mode: mode}, nil)
+	pluginLoader := loader.NewWithConfig(loader.Config{
+		Verifier:         verifier,
+		CacheDir:         filepath.Join(config.CachePath, "plugins"),
+		AllowUnsandboxed: config.AllowUnsandboxed,
+		DataDir:          config.DataDir,
+		AllocBudget:      config.AllocBudget,
+	})
 	
 	// Create executor
 	pluginExecutor := executor.NewExecutor(
@@ -79,13 +125,22 @@ func NewPluginManager(config *Config) plugins.PluginManager {
 	lifecycleManager := lifecycle.NewLifecycleManager()
 	
 	// Create plugin manager
-	return plugins.NewManager(
+	return plugins.NewManagerWithApprover(
 		pluginRegistry,
 		pluginLoader,
 		pluginExecutor,
 		stateManager,
 		lifecycleManager,
-	)
+		permissionApprover(config.PermissionApprover, config.AllowedPermissions),
+	), nil
+}
+
+// permissionApprover returns approver, or the allow-list if there is none
+func permissionApprover(approver plugins.PermissionApprover, allowed plugins.PermissionAllowList) plugins.PermissionApprover {
+	if approver != nil {
+		return approver
+	}
+	return allowed
 }
 
 // NewMockPluginManager creates a plugin manager with mock components for testing
@@ -112,6 +167,15 @@ type mockRegistry struct{}
 
 func (m *mockRegistry) DiscoverPlugins(path string) ([]plugins.PluginSpec, error) { return nil, nil }
 func (m *mockRegistry) SearchPlugins(criteria plugins.SearchCriteria) ([]plugins.PluginInfo, error) { return nil, nil }
+func (m *mockRegistry) QueryPlugins(criteria plugins.SearchCriteria) (plugins.SearchResult, error) {
+	return plugins.SearchResult{}, nil
+}
+func (m *mockRegistry) RecordInstall(version plugins.InstalledVersion) error { return nil }
+func (m *mockRegistry) RemoveInstall(name, version string) error { return nil }
+func (m *mockRegistry) SetPinned(name, version string, pinned bool) error { return nil }
+func (m *mockRegistry) InstalledVersions(name string) ([]plugins.InstalledVersion, error) {
+	return nil, nil
+}
 func (m *mockRegistry) RegisterPlugin(info plugins.PluginInfo) error { return nil }
 func (m *mockRegistry) UnregisterPlugin(name string) error { return nil }
 func (m *mockRegistry) FetchFromMarketplace(id string) (plugins.PluginSpec, error) {
@@ -133,6 +197,9 @@ func (m *mockExecutor) StopPlugin(plugin plugins.Plugin) error { return nil }
 func (m *mockExecutor) ExecutePlugin(plugin plugins.Plugin, request plugins.PluginRequest) (plugins.PluginResponse, error) {
 	return plugins.PluginResponse{}, nil
 }
+func (m *mockExecutor) ExecutePluginContext(ctx context.Context, plugin plugins.Plugin, request plugins.PluginRequest) (plugins.PluginResponse, error) {
+	return plugins.PluginResponse{}, nil
+}
 func (m *mockExecutor) GetResourceUsage(plugin plugins.Plugin) plugins.PluginResourceUsage {
 	return plugins.PluginResourceUsage{}
 }
@@ -3,6 +3,8 @@ package factory
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"go.uber.org/zap"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/loader"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/trust"
 )
 
 // MeshPluginManagerFactory creates mesh-based plugin managers
@@ -29,9 +32,33 @@ type MeshPluginConfig struct {
 	PluginDir  string // Where plugins are installed
 	CacheDir   string // Where downloaded plugins are cached
 	StateDir   string // Where plugin state is stored
+	StateKeyFile string // Node master key plugin state is encrypted with, empty to store state unencrypted
+	StateAllowPlaintext bool // Load state stored before StateKeyFile was set, encrypting it as it is loaded
+	StateBackend string // How plugin state is stored: file (one file per version) or log (segmented log)
+	CheckpointPolicy state.CheckpointPolicy // When plugin state is checkpointed and which checkpoints are kept
+	CheckpointOverrides map[string]state.CheckpointPolicy // Checkpoint policies of individual plugins
+	RegistryDir string // Where the plugin registry index is stored
 	SocketDir  string // Where plugin sockets are created
+	DataDir    string // Per-plugin data directories, writable inside the sandbox
 	TempDir    string // Temporary directory for operations
+	SeedDir    string // Pre-downloaded plugin artifacts for air-gapped nodes
+	TrustDir   string // Trusted publisher keys and revocations
 	
+	// Signature policy for plugin packages: require, warn or allow
+	SignaturePolicy string
+	
+	// Download cache size limit in bytes, 0 for unbounded
+	MaxCacheSize int64
+	
+	// Marketplace catalog, empty to disable marketplace installs
+	MarketplaceURL string
+	
+	// Asked which permissions to grant when a plugin version is first
+	// installed; if nil, the ones AllowedPermissions lists are granted and
+	// the rest denied
+	PermissionApprover plugins.PermissionApprover
+	AllowedPermissions plugins.PermissionAllowList
+
 	// Networking
 	EnableDiscovery bool   // Enable automatic plugin discovery
 	MeshEndpoint   string // Endpoint for mesh network
@@ -39,6 +66,7 @@ type MeshPluginConfig struct {
 	// Defaults
 	DefaultIsolation plugins.IsolationLevel
 	DefaultTimeout   int // seconds
+	WASMFuel         uint64 // Instructions a WebAssembly plugin may execute per call, 0 for the default
 }
 
 // DefaultMeshPluginConfig returns default configuration
@@ -47,8 +75,16 @@ func DefaultMeshPluginConfig() MeshPluginConfig {
 		PluginDir:        "/usr/local/lib/blackhole/plugins",
 		CacheDir:         "/var/cache/blackhole/plugins",
 		StateDir:         "/var/lib/blackhole/plugins",
+		StateBackend:     "file",
+		CheckpointPolicy: state.DefaultCheckpointPolicy(),
+		RegistryDir:      "/var/lib/blackhole/registry",
 		SocketDir:        "/var/run/blackhole/plugins",
+		DataDir:          "/var/lib/blackhole/plugin-data",
 		TempDir:          "/tmp/blackhole/plugins",
+		MaxCacheSize:     2 << 30,
+		TrustDir:         "/etc/blackhole/trust",
+		SignaturePolicy:  "warn",
+		MarketplaceURL:   "https://marketplace.blackhole.io",
 		EnableDiscovery:  true,
 		DefaultIsolation: plugins.IsolationProcess,
 		DefaultTimeout:   30,
@@ -76,9 +112,33 @@ func NewMeshPluginManagerFactory(
 
 // CreatePluginManager creates a new mesh-based plugin manager
 func (f *MeshPluginManagerFactory) CreatePluginManager() (plugins.PluginManager, error) {
+	// Create marketplace client
+	var marketplaceClient *registry.HTTPMarketplaceClient
+	var marketplace registry.MarketplaceClient
+	if f.config.MarketplaceURL != "" {
+		marketplaceClient = registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+			CatalogURL: f.config.MarketplaceURL,
+			CacheDir:   filepath.Join(f.config.CacheDir, "marketplace"),
+		})
+		marketplace = marketplaceClient
+	}
+
 	// Create registry
-	// TODO: Create marketplace client when available
-	pluginRegistry := registry.New(nil)
+	pluginRegistry, err := registry.Open(f.config.RegistryDir, marketplace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin registry: %w", err)
+	}
+
+	// Create signature verifier
+	mode, err := trust.ParseMode(f.config.SignaturePolicy)
+	if err != nil {
+		return nil, err
+	}
+	trustStore, err := trust.LoadStore(f.config.TrustDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trust store: %w", err)
+	}
+	verifier := trust.NewVerifier(trustStore, trust.Policy{Mode: mode}, f.logger.With(zap.String("component", "trust")))
 
 	// Create mesh-aware loader
 	loaderConfig := loader.MeshLoaderConfig{
@@ -86,16 +146,46 @@ func (f *MeshPluginManagerFactory) CreatePluginManager() (plugins.PluginManager,
 		CacheDir:   f.config.CacheDir,
 		TempDir:    f.config.TempDir,
 		SocketDir:  f.config.SocketDir,
+		DataDir:    f.config.DataDir,
+		MeshEndpoint: f.ingressSocket(),
 		// MeshClient: nil, // TODO: Create mesh client
+		Marketplace: marketplaceClient,
 		Logger:     f.logger.With(zap.String("component", "loader")),
+		MaxCacheSize: f.config.MaxCacheSize,
+		SeedDir:    f.config.SeedDir,
+		Verifier:   verifier,
+		WASMFuel:   f.config.WASMFuel,
 	}
 	pluginLoader := loader.NewMeshPluginLoader(loaderConfig)
 
 	// Create state manager
-	stateStorage, err := state.NewFileStateStorage(f.config.StateDir)
+	var backendStorage state.StateStorage
+	switch f.config.StateBackend {
+	case "", "file":
+		backendStorage, err = state.NewFileStateStorage(f.config.StateDir)
+	case "log":
+		backendStorage, err = state.NewLogStateStorage(filepath.Join(f.config.StateDir, "log"), state.LogStorageConfig{
+			Logger: f.logger.With(zap.String("component", "state")),
+		})
+	default:
+		err = fmt.Errorf("unknown state backend %q", f.config.StateBackend)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create state storage: %w", err)
 	}
+	stateStorage := backendStorage
+	var masterKey []byte
+	if f.config.StateKeyFile != "" {
+		if masterKey, err = state.LoadOrCreateMasterKey(f.config.StateKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load state key: %w", err)
+		}
+		if stateStorage, err = state.NewEncryptedStateStorageWithConfig(backendStorage, state.EncryptionConfig{
+			MasterKey:      masterKey,
+			AllowPlaintext: f.config.StateAllowPlaintext,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create state storage: %w", err)
+		}
+	}
 	stateManager := state.NewStateManagerWrapper(stateStorage, state.NewJSONStateSerializer())
 
 	// Create lifecycle manager
@@ -111,10 +201,53 @@ func (f *MeshPluginManagerFactory) CreatePluginManager() (plugins.PluginManager,
 		ProtocolRouter: f.protocolRouter,
 		SocketDir:      f.config.SocketDir,
 		Logger:         f.logger.With(zap.String("component", "manager")),
+		PermissionApprover: permissionApprover(f.config.PermissionApprover, f.config.AllowedPermissions),
 	}
 
 	manager := plugins.NewMeshPluginManager(managerConfig)
 
+	// Hot-swap plugins through the state package's coordinator, keeping
+	// rollback checkpoints with the plugin state. Checkpoints copy the state
+	// as stored, so encrypted state stays encrypted in them.
+	rollbackManager, err := state.NewFileRollbackManager(filepath.Join(f.config.StateDir, "checkpoints"), backendStorage)
+	if err != nil {
+		return nil, err
+	}
+	manager.SetHotSwapper(state.NewHotSwapCoordinator(
+		manager.SwapManager(),
+		state.NewStateManager(stateStorage, state.NewJSONStateSerializer()),
+		rollbackManager,
+	))
+
+	// Checkpoint plugin state in the background as well, so plugins can be
+	// restored without having been hot-swapped. Scheduled checkpoints hold
+	// state as exported, so they are encrypted on their own.
+	var checkpointStore state.CheckpointStore = rollbackManager
+	if masterKey != nil {
+		if checkpointStore, err = state.NewEncryptedCheckpointStoreWithConfig(rollbackManager, state.EncryptionConfig{
+			MasterKey:      masterKey,
+			AllowPlaintext: f.config.StateAllowPlaintext,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to create checkpoint store: %w", err)
+		}
+	}
+	scheduler := state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source:    manager,
+		Store:     checkpointStore,
+		Policy:    f.config.CheckpointPolicy,
+		Overrides: f.config.CheckpointOverrides,
+		Logger:    f.logger.With(zap.String("component", "checkpoints")),
+	})
+	manager.SetRequestObserver(scheduler)
+	scheduler.Start()
+
+	// Serve the ingress plugins call each other through
+	if f.protocolRouter != nil {
+		if err := f.startIngress(); err != nil {
+			return nil, err
+		}
+	}
+
 	f.logger.Info("Created mesh-based plugin manager",
 		zap.String("plugin_dir", f.config.PluginDir),
 		zap.String("socket_dir", f.config.SocketDir),
@@ -123,6 +256,36 @@ func (f *MeshPluginManagerFactory) CreatePluginManager() (plugins.PluginManager,
 	return manager, nil
 }
 
+// ingressSocket returns the socket plugins reach the mesh on
+func (f *MeshPluginManagerFactory) ingressSocket() string {
+	if f.config.MeshEndpoint != "" {
+		return f.config.MeshEndpoint
+	}
+	return filepath.Join(f.config.SocketDir, routing.IngressSocketName)
+}
+
+// startIngress listens on the ingress socket and serves it in the background
+func (f *MeshPluginManagerFactory) startIngress() error {
+	socketPath := f.ingressSocket()
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		return fmt.Errorf("failed to create ingress socket directory: %w", err)
+	}
+
+	ingress := routing.NewIngress(f.protocolRouter, f.logger.With(zap.String("component", "ingress")))
+	listener, err := ingress.Listen(socketPath)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := ingress.Serve(listener); err != nil {
+			f.logger.Error("Mesh ingress stopped", zap.Error(err))
+		}
+	}()
+
+	f.logger.Info("Serving mesh ingress", zap.String("socket", socketPath))
+	return nil
+}
+
 // CreateMockPluginManager creates a mock plugin manager for testing
 func (f *MeshPluginManagerFactory) CreateMockPluginManager() plugins.PluginManager {
 	return NewMockPluginManager()
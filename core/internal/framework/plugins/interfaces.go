@@ -14,8 +14,14 @@ type PluginManager interface {
 	UnloadPlugin(name string) error
 	ReloadPlugin(name string) error
 	
+	// Dependency-aware lifecycle management
+	LoadPlugins(specs []PluginSpec) error
+	UnloadPluginCascade(name string) error
+	
 	// Plugin execution
 	ExecutePlugin(name string, request PluginRequest) (PluginResponse, error)
+	ExecutePluginContext(ctx context.Context, name string, request PluginRequest) (PluginResponse, error)
+	OpenPluginStream(ctx context.Context, name string, request PluginRequest, mode StreamMode) (PluginStream, error)
 	
 	// Plugin information
 	ListPlugins() []PluginInfo
@@ -60,6 +66,13 @@ type PluginSpec struct {
 	Dependencies []PluginDependency     `json:"dependencies"`
 	Resources    PluginResources        `json:"resources"`
 	Isolation    IsolationLevel         `json:"isolation"`
+	
+	// Permissions the plugin requests; once approved, the permissions it
+	// is granted. Anything not listed is denied at runtime.
+	Permissions  []PluginPermission     `json:"permissions,omitempty"`
+	
+	// Grants lets the plugin call plugins it doesn't depend on
+	Grants       []PluginGrant          `json:"grants,omitempty"`
 }
 
 // PluginSource defines where to load the plugin from.
@@ -85,12 +98,22 @@ type PluginDependency struct {
 	Optional bool  `json:"optional"`
 }
 
+// PluginGrant allows a plugin to call methods of another plugin through the
+// mesh. Methods are full gRPC method names or patterns such as
+// "/storage.v1.Storage/*"; no methods allows every method.
+type PluginGrant struct {
+	Plugin  string   `json:"plugin"`
+	Methods []string `json:"methods,omitempty"`
+}
+
 // PluginResources defines resource requirements for a plugin.
 type PluginResources struct {
 	CPU    int    `json:"cpu"`     // CPU percentage
 	Memory int    `json:"memory"`  // Memory in MB
 	Disk   int    `json:"disk"`    // Disk space in MB
 	Network int   `json:"network"` // Network bandwidth in Mbps
+	Requests int  `json:"requests,omitempty"` // Requests in flight at once, 0 for the default
+	Allocation int `json:"allocation,omitempty"` // Memory in MB an in-process call may allocate, 0 for the default
 }
 
 // IsolationLevel defines the level of isolation for a plugin.
@@ -102,6 +125,7 @@ const (
 	IsolationProcess    IsolationLevel = "process"    // Separate process
 	IsolationContainer  IsolationLevel = "container"  // Container isolation
 	IsolationVM         IsolationLevel = "vm"         // VM isolation
+	IsolationWASM       IsolationLevel = "wasm"       // WebAssembly sandbox in the node process
 )
 
 // PluginInfo provides information about a plugin.
@@ -113,6 +137,8 @@ type PluginInfo struct {
 	License     string         `json:"license"`
 	Homepage    string         `json:"homepage"`
 	Repository  string         `json:"repository"`
+	Category    string         `json:"category,omitempty"`
+	Keywords    []string       `json:"keywords,omitempty"`
 	
 	// Runtime information
 	Status      PluginStatus   `json:"status"`
@@ -123,6 +149,9 @@ type PluginInfo struct {
 	// Resource usage
 	ResourceUsage PluginResourceUsage `json:"resource_usage"`
 	
+	// Requests served since the plugin was loaded, if the manager records them
+	Metrics     *PluginMetrics  `json:"metrics,omitempty"`
+	
 	// Capabilities
 	Capabilities []PluginCapability `json:"capabilities"`
 	Permissions  []PluginPermission `json:"permissions"`
@@ -218,16 +247,38 @@ type PluginRegistry interface {
 	// Plugin discovery
 	DiscoverPlugins(path string) ([]PluginSpec, error)
 	SearchPlugins(criteria SearchCriteria) ([]PluginInfo, error)
+	QueryPlugins(criteria SearchCriteria) (SearchResult, error)
 	
 	// Plugin registration
 	RegisterPlugin(info PluginInfo) error
 	UnregisterPlugin(name string) error
 	
+	// Locally installed versions
+	RecordInstall(version InstalledVersion) error
+	RemoveInstall(name, version string) error
+	SetPinned(name, version string, pinned bool) error
+	InstalledVersions(name string) ([]InstalledVersion, error)
+	
 	// Plugin marketplace integration
 	FetchFromMarketplace(id string) (PluginSpec, error)
 	PublishToMarketplace(spec PluginSpec) error
 }
 
+// InstalledVersion records a plugin version that is installed locally.
+// Pinned versions are kept when upgrading and cannot be removed until unpinned.
+type InstalledVersion struct {
+	Name        string       `json:"name"`
+	Version     string       `json:"version"`
+	Source      PluginSource `json:"source"`
+	Hash        string       `json:"hash,omitempty"`
+	InstalledAt time.Time    `json:"installed_at"`
+	Pinned      bool         `json:"pinned,omitempty"`
+
+	// Permissions approved when the version was installed
+	Permissions []PluginPermission `json:"permissions,omitempty"`
+	ApprovedAt  time.Time          `json:"approved_at,omitempty"`
+}
+
 // SearchCriteria defines search criteria for plugins.
 type SearchCriteria struct {
 	Name         string               `json:"name,omitempty"`
@@ -237,6 +288,39 @@ type SearchCriteria struct {
 	License      string               `json:"license,omitempty"`
 	MinVersion   string               `json:"min_version,omitempty"`
 	MaxVersion   string               `json:"max_version,omitempty"`
+	Keywords     []string             `json:"keywords,omitempty"`
+	
+	// Query is a free-text search over name, description, category and keywords.
+	// When set, results are ranked by relevance unless a sort field is given.
+	Query        string               `json:"query,omitempty"`
+	
+	Pagination   PaginationOptions    `json:"pagination,omitempty"`
+}
+
+// PaginationOptions controls paging and ordering of search results.
+// It mirrors common.v1.PaginationOptions.
+type PaginationOptions struct {
+	Limit         int    `json:"limit,omitempty"`          // 0 means no limit
+	Offset        int    `json:"offset,omitempty"`
+	PageToken     string `json:"page_token,omitempty"`     // Takes precedence over Offset
+	SortBy        string `json:"sort_by,omitempty"`        // relevance, name, version
+	SortDirection string `json:"sort_direction,omitempty"` // asc or desc
+}
+
+// PaginationInfo describes the page returned by a search.
+// It mirrors common.v1.PaginationInfo.
+type PaginationInfo struct {
+	TotalCount    int    `json:"total_count"`
+	ReturnedCount int    `json:"returned_count"`
+	Offset        int    `json:"offset"`
+	NextPageToken string `json:"next_page_token,omitempty"`
+	HasMore       bool   `json:"has_more"`
+}
+
+// SearchResult is a page of plugins matching a search.
+type SearchResult struct {
+	Plugins    []PluginInfo   `json:"plugins"`
+	Pagination PaginationInfo `json:"pagination"`
 }
 
 // PluginLoader handles loading and unloading of plugins.
@@ -249,6 +333,7 @@ type PluginLoader interface {
 // PluginExecutor handles plugin execution and isolation.
 type PluginExecutor interface {
 	ExecutePlugin(plugin Plugin, request PluginRequest) (PluginResponse, error)
+	ExecutePluginContext(ctx context.Context, plugin Plugin, request PluginRequest) (PluginResponse, error)
 	GetExecutionEnvironment(plugin Plugin) (ExecutionEnvironment, error)
 	CreateIsolationBoundary(level IsolationLevel) (IsolationBoundary, error)
 }
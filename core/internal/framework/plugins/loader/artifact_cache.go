@@ -0,0 +1,406 @@
+package loader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache errors
+var (
+	ErrArtifactNotCached = errors.New("artifact not cached")
+	ErrInvalidDigest     = errors.New("invalid sha256 digest")
+	ErrDigestMismatch    = errors.New("artifact digest mismatch")
+	ErrArtifactInUse     = errors.New("artifact in use")
+)
+
+// ArtifactCacheConfig configures an ArtifactCache
+type ArtifactCacheConfig struct {
+	// Dir is where artifacts are stored
+	Dir string
+	// MaxBytes bounds the total size of cached artifacts, 0 means unbounded
+	MaxBytes int64
+	// SeedDir is imported into the cache when it is opened, so air-gapped
+	// nodes can be provisioned without network access
+	SeedDir string
+}
+
+// ArtifactCache is a content-addressed store of plugin binaries keyed by
+// their sha256 digest. Least recently used artifacts are evicted once the
+// cache grows beyond its size limit, except those acquired by a loaded
+// plugin. Access times are kept in the file modification times so the order
+// survives restarts.
+type ArtifactCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheArtifact
+	size    int64
+}
+
+type cacheArtifact struct {
+	size     int64
+	lastUsed time.Time
+	pins     int // Acquires not yet released
+}
+
+// NewArtifactCache opens the cache at config.Dir, creating it if needed,
+// and imports the seed directory if one is configured
+func NewArtifactCache(config ArtifactCacheConfig) (*ArtifactCache, error) {
+	if config.Dir == "" {
+		return nil, errors.New("cache directory is required")
+	}
+
+	c := &ArtifactCache{
+		dir:      config.Dir,
+		maxBytes: config.MaxBytes,
+		entries:  make(map[string]*cacheArtifact),
+	}
+	for _, dir := range []string{c.blobDir(), c.refDir(), c.partialDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+
+	files, err := os.ReadDir(c.blobDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, ".") {
+			// Interrupted import
+			os.Remove(filepath.Join(c.blobDir(), name))
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		c.entries[name] = &cacheArtifact{size: info.Size(), lastUsed: info.ModTime()}
+		c.size += info.Size()
+	}
+
+	if config.SeedDir != "" {
+		if _, err := c.Seed(config.SeedDir); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	c.evictLocked("")
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Path returns the path of a cached artifact and marks it as recently used
+func (c *ArtifactCache) Path(digest string) (string, error) {
+	digest, err := NormalizeDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pathLocked(digest)
+}
+
+// Acquire returns the path of a cached artifact like Path, and keeps the
+// artifact from being evicted or removed until it is released
+func (c *ArtifactCache) Acquire(digest string) (string, error) {
+	digest, err := NormalizeDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path, err := c.pathLocked(digest)
+	if err != nil {
+		return "", err
+	}
+	c.entries[digest].pins++
+	return path, nil
+}
+
+// Release undoes an Acquire of the artifact
+func (c *ArtifactCache) Release(digest string) {
+	digest, err := NormalizeDigest(digest)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[digest]; ok && entry.pins > 0 {
+		entry.pins--
+		c.evictLocked("")
+	}
+}
+
+// pathLocked returns the path of a cached artifact and marks it as recently
+// used. Callers must hold the lock.
+func (c *ArtifactCache) pathLocked(digest string) (string, error) {
+	entry, ok := c.entries[digest]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrArtifactNotCached, digest)
+	}
+	path := c.blobPath(digest)
+	if _, err := os.Stat(path); err != nil {
+		// Removed behind our back
+		c.size -= entry.size
+		delete(c.entries, digest)
+		return "", fmt.Errorf("%w: %s", ErrArtifactNotCached, digest)
+	}
+
+	entry.lastUsed = time.Now()
+	os.Chtimes(path, entry.lastUsed, entry.lastUsed)
+	return path, nil
+}
+
+// Import moves the file at path into the cache. If digest is not empty the
+// file must match it. The digest of the stored artifact is returned.
+func (c *ArtifactCache) Import(path, digest string) (string, error) {
+	if digest != "" {
+		var err error
+		if digest, err = NormalizeDigest(digest); err != nil {
+			return "", err
+		}
+	}
+
+	actual, size, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+	if digest != "" && actual != digest {
+		return "", fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, digest, actual)
+	}
+
+	if err := os.Chmod(path, 0755); err != nil {
+		return "", fmt.Errorf("failed to make plugin executable: %w", err)
+	}
+	if err := os.Rename(path, c.blobPath(actual)); err != nil {
+		return "", fmt.Errorf("failed to cache plugin: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pins int
+	if entry, ok := c.entries[actual]; ok {
+		c.size -= entry.size
+		pins = entry.pins
+	}
+	c.entries[actual] = &cacheArtifact{size: size, lastUsed: time.Now(), pins: pins}
+	c.size += size
+	c.evictLocked(actual)
+
+	return actual, nil
+}
+
+// Seed copies every regular file in dir into the cache and returns the
+// digests that were added
+func (c *ArtifactCache) Seed(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed directory: %w", err)
+	}
+
+	var digests []string
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		digest, err := c.copyIn(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return digests, fmt.Errorf("failed to seed %s: %w", file.Name(), err)
+		}
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+// Remove deletes an artifact from the cache, unless it has been acquired
+func (c *ArtifactCache) Remove(digest string) error {
+	digest, err := NormalizeDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[digest]; ok {
+		if entry.pins > 0 {
+			return fmt.Errorf("%w: %s", ErrArtifactInUse, digest)
+		}
+		c.size -= entry.size
+		delete(c.entries, digest)
+	}
+	if err := os.Remove(c.blobPath(digest)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cached plugin: %w", err)
+	}
+	return nil
+}
+
+// Size returns the total size of the cached artifacts
+func (c *ArtifactCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Link records that key, such as a download URL, resolved to digest
+func (c *ArtifactCache) Link(key, digest string) error {
+	digest, err := NormalizeDigest(digest)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.refDir(), ".ref-*")
+	if err != nil {
+		return fmt.Errorf("failed to record cache reference: %w", err)
+	}
+	_, err = tmp.WriteString(digest)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.refPath(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to record cache reference: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the path of the artifact previously linked to key
+func (c *ArtifactCache) Lookup(key string) (string, string, error) {
+	data, err := os.ReadFile(c.refPath(key))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrArtifactNotCached, key)
+	}
+	digest := strings.TrimSpace(string(data))
+	path, err := c.Path(digest)
+	if err != nil {
+		return "", "", err
+	}
+	return path, digest, nil
+}
+
+// partialPath returns where an in-progress download of key is kept
+func (c *ArtifactCache) partialPath(key string) string {
+	return filepath.Join(c.partialDir(), keyHash(key)+".part")
+}
+
+// copyIn copies a file into the cache without modifying the original
+func (c *ArtifactCache) copyIn(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(c.blobDir(), ".import-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	digest, err := c.Import(tmp.Name(), "")
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return digest, nil
+}
+
+// evictLocked removes least recently used artifacts until the cache fits
+// its size limit. Acquired artifacts and the one named by keep are never
+// evicted. Callers must hold the lock.
+func (c *ArtifactCache) evictLocked(keep string) {
+	if c.maxBytes <= 0 || c.size <= c.maxBytes {
+		return
+	}
+
+	digests := make([]string, 0, len(c.entries))
+	for digest, entry := range c.entries {
+		if digest != keep && entry.pins == 0 {
+			digests = append(digests, digest)
+		}
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return c.entries[digests[i]].lastUsed.Before(c.entries[digests[j]].lastUsed)
+	})
+
+	for _, digest := range digests {
+		if c.size <= c.maxBytes {
+			break
+		}
+		os.Remove(c.blobPath(digest))
+		c.size -= c.entries[digest].size
+		delete(c.entries, digest)
+	}
+}
+
+func (c *ArtifactCache) blobDir() string    { return filepath.Join(c.dir, "sha256") }
+func (c *ArtifactCache) refDir() string     { return filepath.Join(c.dir, "refs") }
+func (c *ArtifactCache) partialDir() string { return filepath.Join(c.dir, "partial") }
+
+func (c *ArtifactCache) blobPath(digest string) string {
+	return filepath.Join(c.blobDir(), digest)
+}
+
+func (c *ArtifactCache) refPath(key string) string {
+	return filepath.Join(c.refDir(), keyHash(key))
+}
+
+// NormalizeDigest converts a PluginSource.Hash value, either bare hex or
+// prefixed with "sha256:", into lowercase hex
+func NormalizeDigest(digest string) (string, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) != sha256.Size*2 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	return digest, nil
+}
+
+func fileDigest(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open plugin binary: %w", err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to calculate hash: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
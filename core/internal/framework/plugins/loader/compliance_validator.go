@@ -4,6 +4,7 @@ import (
 	"fmt"
 	
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/validator"
 )
 
@@ -22,7 +23,8 @@ func newComplianceValidator(strictMode bool) *complianceValidator {
 // Validate checks if the plugin complies with development guidelines
 func (v *complianceValidator) Validate(spec plugins.PluginSpec, binaryPath string) error {
 	// For .plugin packages, validate the package
-	if spec.Source.Type == plugins.SourceTypeRemote || spec.Source.Type == plugins.SourceTypeMarketplace {
+	if (spec.Source.Type == plugins.SourceTypeRemote || spec.Source.Type == plugins.SourceTypeMarketplace) &&
+		archive.IsPackage(binaryPath) {
 		result, err := v.validator.ValidatePluginPackage(binaryPath)
 		if err != nil {
 			return fmt.Errorf("compliance validation error: %w", err)
@@ -42,9 +44,8 @@ func (v *complianceValidator) Validate(spec plugins.PluginSpec, binaryPath strin
 	if spec.Source.Type == plugins.SourceTypeLocal {
 		// Convert PluginSpec to manifest for validation
 		manifest := &validator.PluginManifest{
-			Name:        spec.Name,
-			Version:     spec.Version,
-			Description: spec.Description,
+			Name:    spec.Name,
+			Version: spec.Version,
 		}
 		
 		result, err := v.validator.ValidateLoadedPlugin(manifest, binaryPath)
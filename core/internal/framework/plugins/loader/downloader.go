@@ -0,0 +1,257 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Download errors
+var (
+	ErrDownloadTooLarge  = errors.New("plugin download exceeds size limit")
+	ErrUnsupportedScheme = errors.New("unsupported download scheme")
+)
+
+// Default download limits
+const (
+	DefaultDownloadTimeout = 10 * time.Minute
+	DefaultMaxDownloadSize = 512 << 20
+)
+
+// DownloaderConfig configures a Downloader
+type DownloaderConfig struct {
+	Cache      *ArtifactCache
+	HTTPClient *http.Client
+	// Timeout bounds a single download attempt
+	Timeout time.Duration
+	// MaxSize is the largest artifact that will be downloaded
+	MaxSize int64
+}
+
+// Downloader fetches plugin binaries over HTTP(S) into an ArtifactCache.
+// Interrupted downloads are kept and resumed with a Range request. Fetches
+// of the same URL run one at a time, since they share the partial file.
+type Downloader struct {
+	cache   *ArtifactCache
+	client  *http.Client
+	timeout time.Duration
+	maxSize int64
+
+	mu       sync.Mutex
+	fetching map[string]*urlLock
+}
+
+// urlLock is held while a URL is fetched
+type urlLock struct {
+	held    chan struct{}
+	waiters int
+}
+
+// NewDownloader creates a downloader for the given cache
+func NewDownloader(config DownloaderConfig) *Downloader {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultDownloadTimeout
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultMaxDownloadSize
+	}
+
+	return &Downloader{
+		cache:    config.Cache,
+		client:   config.HTTPClient,
+		timeout:  config.Timeout,
+		maxSize:  config.MaxSize,
+		fetching: make(map[string]*urlLock),
+	}
+}
+
+// Fetch returns the cached path and digest of the artifact at rawURL. When
+// digest is set the cache is consulted first and the download must match
+// it. The artifact is acquired from the cache, so it isn't evicted while in
+// use; callers release it with Release once they no longer need it.
+func (d *Downloader) Fetch(ctx context.Context, rawURL, digest string) (string, string, error) {
+	if digest != "" {
+		var err error
+		if digest, err = NormalizeDigest(digest); err != nil {
+			return "", "", err
+		}
+	}
+
+	unlock, err := d.lock(ctx, rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer unlock()
+
+	// A concurrent fetch of the URL may have finished while we waited
+	cached := digest
+	if cached == "" {
+		_, cached, _ = d.cache.Lookup(rawURL)
+	}
+	if cached != "" {
+		if path, err := d.cache.Acquire(cached); err == nil {
+			return path, cached, nil
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid plugin URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("%w: %q", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	partial := d.cache.partialPath(rawURL)
+	if err := d.download(ctx, rawURL, partial); err != nil {
+		return "", "", err
+	}
+
+	stored, err := d.cache.Import(partial, digest)
+	if err != nil {
+		// The partial file is corrupt or stale, start over next time
+		os.Remove(partial)
+		return "", "", err
+	}
+	if err := d.cache.Link(rawURL, stored); err != nil {
+		return "", "", err
+	}
+
+	path, err := d.cache.Acquire(stored)
+	if err != nil {
+		return "", "", err
+	}
+	return path, stored, nil
+}
+
+// Release releases an artifact returned by Fetch
+func (d *Downloader) Release(digest string) {
+	d.cache.Release(digest)
+}
+
+// lock waits until no other fetch of key is running and returns the
+// function that lets the next one run
+func (d *Downloader) lock(ctx context.Context, key string) (func(), error) {
+	d.mu.Lock()
+	l, ok := d.fetching[key]
+	if !ok {
+		l = &urlLock{held: make(chan struct{}, 1)}
+		d.fetching[key] = l
+	}
+	l.waiters++
+	d.mu.Unlock()
+
+	done := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if l.waiters--; l.waiters == 0 {
+			delete(d.fetching, key)
+		}
+	}
+
+	select {
+	case l.held <- struct{}{}:
+		return func() {
+			<-l.held
+			done()
+		}, nil
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+}
+
+// download writes the artifact at rawURL to partial, resuming from any data
+// already present
+func (d *Downloader) download(ctx context.Context, rawURL, partial string) error {
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download plugin: %w", err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// Server ignored the range, start over
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete or longer than the artifact;
+		// let the digest check decide
+		if offset > 0 {
+			return nil
+		}
+		return fmt.Errorf("failed to download plugin: HTTP %d", resp.StatusCode)
+	default:
+		return fmt.Errorf("failed to download plugin: HTTP %d", resp.StatusCode)
+	}
+
+	if total := expectedSize(resp, offset); total > d.maxSize {
+		return fmt.Errorf("%w: %d bytes", ErrDownloadTooLarge, total)
+	}
+
+	file, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create download file: %w", err)
+	}
+
+	remaining := d.maxSize - offset
+	n, err := io.Copy(file, io.LimitReader(resp.Body, remaining+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Keep what we have so the next attempt can resume
+		return fmt.Errorf("failed to save plugin: %w", err)
+	}
+	if n > remaining {
+		os.Remove(partial)
+		return fmt.Errorf("%w: more than %d bytes", ErrDownloadTooLarge, d.maxSize)
+	}
+
+	return nil
+}
+
+// expectedSize returns the full artifact size announced by the server, or
+// -1 if it is unknown
+func expectedSize(resp *http.Response, offset int64) int64 {
+	if resp.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes 100-199/200
+		var start, end, total int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err == nil {
+			return total
+		}
+	}
+	if resp.ContentLength < 0 {
+		return -1
+	}
+	return offset + resp.ContentLength
+}
@@ -2,6 +2,7 @@
 package loader
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -11,12 +12,14 @@ import (
 	"os"
 	"path/filepath"
 	"plugin"
+	"strings"
 	"sync"
 	"time"
-	"context"
 
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
-	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/validator"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/executor"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/semver"
 )
 
 // Common errors
@@ -27,6 +30,7 @@ var (
 	ErrVerificationFailed  = errors.New("plugin verification failed")
 	ErrDependencyMissing   = errors.New("plugin dependency missing")
 	ErrIncompatibleVersion = errors.New("incompatible plugin version")
+	ErrUntrusted           = errors.New("plugin rejected by signature policy")
 )
 
 // pluginLoader implements the PluginLoader interface
@@ -34,9 +38,33 @@ type pluginLoader struct {
 	validators []PluginValidator
 	loaders    map[plugins.SourceType]SourceLoader
 	cache      *PluginCache
+	verifier   archive.SignatureVerifier
+	unpackRoot string
+	process    executor.ProcessConfig
+	inProcess  executor.InProcessConfig
 	mu         sync.RWMutex
 }
 
+// Config configures a plugin loader
+type Config struct {
+	StrictCompliance bool
+	// Verifier enforces the signature policy, nil accepts unsigned plugins
+	Verifier archive.SignatureVerifier
+	// CacheDir holds downloaded artifacts and unpacked packages. Anyone who
+	// can write to it can change what plugins run, so it must belong to the
+	// node. Defaults to a directory in the user's cache directory.
+	CacheDir string
+	// AllowUnsandboxed runs process plugins without their sandbox on
+	// platforms that don't support it, rather than refuse to start them
+	AllowUnsandboxed bool
+	// DataDir holds the data directories of process plugins, defaults to
+	// executor.DefaultDataDir
+	DataDir string
+	// AllocBudget is the number of bytes a call to an in-process plugin may
+	// allocate, for plugins whose resources don't set one; 0 for no budget
+	AllocBudget uint64
+}
+
 // PluginValidator validates a plugin before loading
 type PluginValidator interface {
 	Validate(spec plugins.PluginSpec, binaryPath string) error
@@ -67,11 +95,35 @@ func New() plugins.PluginLoader {
 
 // NewWithOptions creates a new plugin loader with options
 func NewWithOptions(strictCompliance bool) plugins.PluginLoader {
+	return NewWithVerifier(strictCompliance, nil)
+}
+
+// NewWithVerifier creates a plugin loader that enforces a signature policy
+// on the plugins it loads
+func NewWithVerifier(strictCompliance bool, verifier archive.SignatureVerifier) plugins.PluginLoader {
+	return NewWithConfig(Config{StrictCompliance: strictCompliance, Verifier: verifier})
+}
+
+// NewWithConfig creates a plugin loader from its configuration
+func NewWithConfig(config Config) plugins.PluginLoader {
+	if config.CacheDir == "" {
+		config.CacheDir = defaultCacheDir()
+	}
+
 	loader := &pluginLoader{
+		verifier:   config.Verifier,
+		unpackRoot: filepath.Join(config.CacheDir, "unpacked"),
+		process: executor.ProcessConfig{
+			AllowUnsandboxed: config.AllowUnsandboxed,
+			DataDir:          config.DataDir,
+		},
+		inProcess: executor.InProcessConfig{
+			AllocBudget: config.AllocBudget,
+		},
 		validators: []PluginValidator{
 			&hashValidator{},
 			&dependencyValidator{},
-			newComplianceValidator(strictCompliance),
+			newComplianceValidator(config.StrictCompliance),
 		},
 		loaders: make(map[plugins.SourceType]SourceLoader),
 		cache:   &PluginCache{cache: make(map[string]CacheEntry)},
@@ -81,12 +133,22 @@ func NewWithOptions(strictCompliance bool) plugins.PluginLoader {
 	loader.loaders[plugins.SourceTypeLocal] = &localSourceLoader{}
 	loader.loaders[plugins.SourceTypeRemote] = &remoteSourceLoader{
 		httpClient: &http.Client{},
-		cacheDir:   filepath.Join(os.TempDir(), "blackhole-plugins"),
+		cacheDir:   filepath.Join(config.CacheDir, "artifacts"),
 	}
 
 	return loader
 }
 
+// defaultCacheDir returns the user's plugin cache directory, which unlike
+// the shared temporary directory other users can't write to
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("blackhole-%d", os.Getuid()))
+	}
+	return filepath.Join(dir, "blackhole", "plugins")
+}
+
 // LoadPlugin loads a plugin according to its specification
 func (l *pluginLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin, error) {
 	l.mu.Lock()
@@ -116,10 +178,17 @@ func (l *pluginLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin, erro
 		}
 	}
 
+	// Packages are validated as a whole and checked against the signature
+	// policy, then the binary for this platform is run
+	binaryPath, err = resolvePackage(spec, binaryPath, l.unpackRoot, l.verifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin package: %w", err)
+	}
+
 	// Create the plugin instance based on isolation level
 	var p plugins.Plugin
 	switch spec.Isolation {
-	case plugins.IsolationNone:
+	case plugins.IsolationNone, plugins.IsolationThread:
 		p, err = l.loadInProcessPlugin(spec, binaryPath)
 	case plugins.IsolationProcess:
 		p, err = l.loadProcessPlugin(spec, binaryPath)
@@ -137,7 +206,10 @@ func (l *pluginLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin, erro
 	return p, nil
 }
 
-// loadInProcessPlugin loads a plugin in the same process (Go plugin)
+// loadInProcessPlugin loads a plugin in the same process (Go plugin), whose
+// calls are supervised. If an executable of the plugin sits next to the Go
+// plugin, named like it without the .so extension, a plugin that keeps
+// panicking is moved to its own process.
 func (l *pluginLoader) loadInProcessPlugin(spec plugins.PluginSpec, binaryPath string) (plugins.Plugin, error) {
 	// Load the Go plugin
 	p, err := plugin.Open(binaryPath)
@@ -158,75 +230,41 @@ func (l *pluginLoader) loadInProcessPlugin(spec plugins.PluginSpec, binaryPath s
 	}
 
 	// Create plugin instance
-	return newPlugin(), nil
-}
-
-// loadProcessPlugin loads a plugin as a separate process
-func (l *pluginLoader) loadProcessPlugin(spec plugins.PluginSpec, binaryPath string) (plugins.Plugin, error) {
-	// Import the executor package for process plugin
-	// Note: This creates a circular dependency that needs to be resolved
-	// For now, we'll create a simple process plugin inline
-	return &processPlugin{
-		spec:       spec,
-		binaryPath: binaryPath,
-		info: plugins.PluginInfo{
-			Name:        spec.Name,
-			Version:     spec.Version,
-			Description: "Process-isolated plugin",
-			Status:      plugins.PluginStatusStopped,
-		},
-	}, nil
-}
-
-// processPlugin is a minimal implementation for process-isolated plugins
-// The full implementation is in the executor package
-type processPlugin struct {
-	spec       plugins.PluginSpec
-	binaryPath string
-	info       plugins.PluginInfo
-}
-
-func (p *processPlugin) Info() plugins.PluginInfo {
-	return p.info
-}
-
-func (p *processPlugin) Start(ctx context.Context) error {
-	// Minimal implementation - full version in executor package
-	p.info.Status = plugins.PluginStatusRunning
-	return nil
-}
-
-func (p *processPlugin) Stop(ctx context.Context) error {
-	p.info.Status = plugins.PluginStatusStopped
-	return nil
-}
-
-func (p *processPlugin) Handle(ctx context.Context, request plugins.PluginRequest) (plugins.PluginResponse, error) {
-	return plugins.PluginResponse{
-		ID:      request.ID,
-		Success: false,
-		Error:   "process plugin execution requires executor package",
-	}, errors.New("not implemented in loader")
-}
-
-func (p *processPlugin) HealthCheck() error {
-	return nil
-}
+	instance, err := newInstance(newPlugin)
+	if err != nil {
+		return nil, err
+	}
 
-func (p *processPlugin) GetStatus() plugins.PluginStatus {
-	return p.info.Status
+	config := l.inProcess
+	if executable := strings.TrimSuffix(binaryPath, ".so"); executable != binaryPath && isExecutable(executable) {
+		isolated := spec
+		isolated.Isolation = plugins.IsolationProcess
+		config.Fallback = func() (plugins.Plugin, error) {
+			return executor.NewProcessPluginWithConfig(isolated, executable, l.process), nil
+		}
+	}
+	return executor.NewInProcessPlugin(spec, instance, config), nil
 }
 
-func (p *processPlugin) PrepareShutdown() error {
-	return nil
+// newInstance calls a Go plugin's NewPlugin, which may panic
+func newInstance(newPlugin func() plugins.Plugin) (instance plugins.Plugin, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("NewPlugin panicked: %v", r)
+		}
+	}()
+	return newPlugin(), nil
 }
 
-func (p *processPlugin) ExportState() ([]byte, error) {
-	return nil, nil
+// isExecutable reports whether path is an executable file
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0
 }
 
-func (p *processPlugin) ImportState(state []byte) error {
-	return nil
+// loadProcessPlugin loads a plugin as a separate process
+func (l *pluginLoader) loadProcessPlugin(spec plugins.PluginSpec, binaryPath string) (plugins.Plugin, error) {
+	return executor.NewProcessPluginWithConfig(spec, binaryPath, l.process), nil
 }
 
 // UnloadPlugin unloads a plugin
@@ -285,8 +323,12 @@ func (v *hashValidator) Validate(spec plugins.PluginSpec, binaryPath string) err
 		return fmt.Errorf("failed to calculate hash: %w", err)
 	}
 
+	expectedHash, err := NormalizeDigest(spec.Source.Hash)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
 	actualHash := hex.EncodeToString(hasher.Sum(nil))
-	if actualHash != spec.Source.Hash {
+	if actualHash != expectedHash {
 		return fmt.Errorf("%w: expected %s, got %s", ErrVerificationFailed, spec.Source.Hash, actualHash)
 	}
 
@@ -297,11 +339,17 @@ func (v *hashValidator) Validate(spec plugins.PluginSpec, binaryPath string) err
 type dependencyValidator struct{}
 
 func (v *dependencyValidator) Validate(spec plugins.PluginSpec, binaryPath string) error {
-	// TODO: Implement dependency checking
-	// For now, just check that required dependencies are specified
+	// Whether dependencies are loaded is checked by the plugin manager, which
+	// knows the running plugins. Here we only check that they are well-formed.
 	for _, dep := range spec.Dependencies {
-		if !dep.Optional && dep.Name == "" {
-			return fmt.Errorf("%w: %s", ErrDependencyMissing, dep.Name)
+		if dep.Name == "" {
+			return fmt.Errorf("%w: dependency of %s has no name", ErrDependencyMissing, spec.Name)
+		}
+		if dep.Name == spec.Name {
+			return fmt.Errorf("%w: %s depends on itself", ErrDependencyMissing, spec.Name)
+		}
+		if _, err := semver.ParseConstraint(dep.Version); err != nil {
+			return fmt.Errorf("dependency %s of %s: %w", dep.Name, spec.Name, err)
 		}
 	}
 	return nil
@@ -327,63 +375,32 @@ func (l *localSourceLoader) Load(source plugins.PluginSource) (string, error) {
 type remoteSourceLoader struct {
 	httpClient *http.Client
 	cacheDir   string
+
+	once       sync.Once
+	downloader *Downloader
+	err        error
 }
 
 func (l *remoteSourceLoader) Load(source plugins.PluginSource) (string, error) {
-	// Create cache directory if it doesn't exist
-	if err := os.MkdirAll(l.cacheDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create cache directory: %w", err)
-	}
-
-	// Generate cache filename based on URL
-	hasher := sha256.New()
-	hasher.Write([]byte(source.Path))
-	cacheFile := filepath.Join(l.cacheDir, hex.EncodeToString(hasher.Sum(nil)))
-
-	// Check if already cached
-	if _, err := os.Stat(cacheFile); err == nil {
-		return cacheFile, nil
+	l.once.Do(func() {
+		cache, err := NewArtifactCache(ArtifactCacheConfig{Dir: l.cacheDir})
+		if err != nil {
+			l.err = err
+			return
+		}
+		l.downloader = NewDownloader(DownloaderConfig{Cache: cache, HTTPClient: l.httpClient})
+	})
+	if l.err != nil {
+		return "", l.err
 	}
 
-	// Download the plugin
-	resp, err := l.httpClient.Get(source.Path)
+	path, digest, err := l.downloader.Fetch(context.Background(), source.Path, source.Hash)
 	if err != nil {
 		return "", fmt.Errorf("failed to download plugin: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download plugin: HTTP %d", resp.StatusCode)
-	}
-
-	// Create temporary file
-	tmpFile, err := os.CreateTemp(l.cacheDir, "plugin-*.tmp")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temporary file: %w", err)
-	}
-	tmpPath := tmpFile.Name()
-
-	// Copy content
-	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("failed to save plugin: %w", err)
-	}
-	tmpFile.Close()
-
-	// Make executable
-	if err := os.Chmod(tmpPath, 0755); err != nil {
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("failed to make plugin executable: %w", err)
-	}
-
-	// Move to final location
-	if err := os.Rename(tmpPath, cacheFile); err != nil {
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("failed to cache plugin: %w", err)
-	}
-
-	return cacheFile, nil
+	// The cache is unbounded, so nothing is evicted from under the plugin
+	l.downloader.Release(digest)
+	return path, nil
 }
 
 // PluginCache methods
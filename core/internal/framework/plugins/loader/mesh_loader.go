@@ -2,17 +2,30 @@
 package loader
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
 	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/executor"
 )
 
+// MarketplaceDownloader downloads and verifies marketplace plugin artifacts
+type MarketplaceDownloader interface {
+	DownloadPlugin(ctx context.Context, spec plugins.PluginSpec, targetPath string) error
+}
+
 // MeshPluginLoader loads plugins that communicate via mesh network
 type MeshPluginLoader struct {
 	localPath    string
@@ -20,7 +33,19 @@ type MeshPluginLoader struct {
 	tempDir      string
 	// meshClient   mesh.Client // TODO: implement mesh client
 	socketDir    string
+	dataDir      string
+	meshEndpoint string
+	marketplace  MarketplaceDownloader
+	verifier     archive.SignatureVerifier
+	artifacts    *ArtifactCache
+	downloader   *Downloader
+	retries      int
+	wasmFuel     uint64
+	unsandboxed  bool
 	logger       *zap.Logger
+
+	mu       sync.Mutex
+	acquired map[plugins.Plugin]string // Cached artifact each loaded plugin runs from
 }
 
 // MeshLoaderConfig configures the mesh plugin loader
@@ -29,8 +54,29 @@ type MeshLoaderConfig struct {
 	CacheDir   string
 	TempDir    string
 	SocketDir  string
+	DataDir    string // Per-plugin data directories, writable inside the sandbox
+	MeshEndpoint string // Ingress socket plugins call other services through
 	// MeshClient mesh.Client // TODO: implement mesh client
+	Marketplace MarketplaceDownloader
 	Logger     *zap.Logger
+
+	// Verifier enforces the signature policy, nil accepts unsigned plugins
+	Verifier archive.SignatureVerifier
+
+	// Remote downloads
+	HTTPClient      *http.Client
+	MaxCacheSize    int64         // Bytes kept in the artifact cache, 0 for unbounded
+	SeedDir         string        // Pre-downloaded artifacts imported at startup
+	DownloadTimeout time.Duration // Per attempt
+	MaxDownloadSize int64
+	DownloadRetries int
+
+	// Instructions a WebAssembly plugin may execute per call, 0 for the default
+	WASMFuel uint64
+
+	// AllowUnsandboxed runs plugins without their sandbox on platforms that
+	// don't support it, rather than refuse to start them
+	AllowUnsandboxed bool
 }
 
 // NewMeshPluginLoader creates a new mesh-aware plugin loader
@@ -51,14 +97,47 @@ func NewMeshPluginLoader(config MeshLoaderConfig) *MeshPluginLoader {
 		config.TempDir = "/tmp/blackhole/plugin-staging"
 	}
 
-	return &MeshPluginLoader{
+	if config.DownloadRetries <= 0 {
+		config.DownloadRetries = 3
+	}
+
+	l := &MeshPluginLoader{
 		localPath:  config.LocalPath,
 		cacheDir:   config.CacheDir,
 		tempDir:    config.TempDir,
 		socketDir:  config.SocketDir,
+		dataDir:    config.DataDir,
+		meshEndpoint: config.MeshEndpoint,
+		marketplace: config.Marketplace,
+		verifier:   config.Verifier,
+		retries:    config.DownloadRetries,
+		wasmFuel:   config.WASMFuel,
+		unsandboxed: config.AllowUnsandboxed,
+		acquired:   make(map[plugins.Plugin]string),
 		// meshClient: config.MeshClient, // TODO: add when mesh client available
 		logger:     config.Logger,
 	}
+
+	// Remote sources are unavailable if the cache can't be opened, but
+	// local and marketplace plugins still load
+	artifacts, err := NewArtifactCache(ArtifactCacheConfig{
+		Dir:      filepath.Join(config.CacheDir, "artifacts"),
+		MaxBytes: config.MaxCacheSize,
+		SeedDir:  config.SeedDir,
+	})
+	if err != nil {
+		config.Logger.Warn("Plugin artifact cache unavailable", zap.Error(err))
+		return l
+	}
+	l.artifacts = artifacts
+	l.downloader = NewDownloader(DownloaderConfig{
+		Cache:      artifacts,
+		HTTPClient: config.HTTPClient,
+		Timeout:    config.DownloadTimeout,
+		MaxSize:    config.MaxDownloadSize,
+	})
+
+	return l
 }
 
 // LoadPlugin loads a plugin that will communicate via mesh
@@ -69,16 +148,34 @@ func (l *MeshPluginLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin,
 		zap.String("source", string(spec.Source.Type)))
 
 	// Determine binary path based on source
-	binaryPath, err := l.resolveBinaryPath(spec)
+	binaryPath, digest, err := l.resolveBinaryPath(spec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve binary path: %w", err)
 	}
 
 	// Verify the binary exists and is executable
-	if err := l.verifyBinary(binaryPath); err != nil {
+	if err := l.verifyPlugin(spec, binaryPath); err != nil {
+		l.release(digest)
 		return nil, fmt.Errorf("binary verification failed: %w", err)
 	}
 
+	// WebAssembly plugins run inside the node rather than as processes
+	if spec.Isolation == plugins.IsolationWASM {
+		plugin := executor.NewWASMPlugin(spec, binaryPath, executor.WASMIsolationConfig{
+			DataDir:  l.dataDir,
+			CacheDir: filepath.Join(l.cacheDir, "wasm"),
+			Fuel:     l.wasmFuel,
+			Logger:   l.logger,
+		})
+		l.hold(plugin, digest)
+
+		l.logger.Info("WebAssembly plugin loaded",
+			zap.String("name", spec.Name),
+			zap.String("module", binaryPath))
+
+		return plugin, nil
+	}
+
 	// Create socket path for this plugin
 	socketPath := filepath.Join(l.socketDir, fmt.Sprintf("%s.sock", spec.Name))
 
@@ -86,12 +183,16 @@ func (l *MeshPluginLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin,
 	isolationConfig := executor.MeshIsolationConfig{
 		// MeshClient:     l.meshClient, // TODO: add when mesh client available
 		SocketDir:      l.socketDir,
+		DataDir:        l.dataDir,
+		MeshEndpoint:   l.meshEndpoint,
+		AllowUnsandboxed: l.unsandboxed,
 		Logger:         l.logger,
 		// DefaultTimeout: spec.Timeout, // TODO: add timeout field to spec
 	}
 
 	// Create the mesh plugin
 	plugin := executor.NewMeshPlugin(spec, binaryPath, isolationConfig)
+	l.hold(plugin, digest)
 
 	l.logger.Info("Mesh plugin loaded",
 		zap.String("name", spec.Name),
@@ -143,8 +244,10 @@ func (l *MeshPluginLoader) ValidatePlugin(spec plugins.PluginSpec) error {
 		// This is the recommended level for mesh plugins
 	case plugins.IsolationContainer, plugins.IsolationVM:
 		// These are also supported
+	case plugins.IsolationWASM:
+		// Runs in the node's WebAssembly sandbox rather than on the mesh
 	case plugins.IsolationNone, plugins.IsolationThread:
-		return fmt.Errorf("mesh plugins require process, container, or VM isolation")
+		return fmt.Errorf("mesh plugins require process, container, VM, or WebAssembly isolation")
 	default:
 		return fmt.Errorf("invalid isolation level: %s", spec.Isolation)
 	}
@@ -152,7 +255,9 @@ func (l *MeshPluginLoader) ValidatePlugin(spec plugins.PluginSpec) error {
 	return nil
 }
 
-// UnloadPlugin is called when a plugin is being unloaded
+// UnloadPlugin is called when a plugin is being unloaded. The plugin
+// removes its own socket when it stops; another version of it may already
+// be serving on the shared one.
 func (l *MeshPluginLoader) UnloadPlugin(plugin plugins.Plugin) error {
 	// Clean up any cached resources
 	// The actual process stopping is handled by the plugin itself
@@ -162,9 +267,14 @@ func (l *MeshPluginLoader) UnloadPlugin(plugin plugins.Plugin) error {
 		zap.String("name", info.Name),
 		zap.String("version", info.Version))
 
-	// Remove socket file if it exists
-	socketPath := filepath.Join(l.socketDir, fmt.Sprintf("%s.sock", info.Name))
-	os.Remove(socketPath)
+	// Let the cache evict the plugin's artifact again
+	l.mu.Lock()
+	digest, ok := l.acquired[plugin]
+	delete(l.acquired, plugin)
+	l.mu.Unlock()
+	if ok {
+		l.release(digest)
+	}
 
 	return nil
 }
@@ -176,44 +286,88 @@ func (l *MeshPluginLoader) GetPluginPath(spec plugins.PluginSpec) string {
 
 // Private helper methods
 
-func (l *MeshPluginLoader) resolveBinaryPath(spec plugins.PluginSpec) (string, error) {
+// resolveBinaryPath returns the binary to run and, for remote plugins, the
+// digest of the cached artifact it was acquired from
+func (l *MeshPluginLoader) resolveBinaryPath(spec plugins.PluginSpec) (string, string, error) {
 	switch spec.Source.Type {
 	case plugins.SourceTypeLocal:
-		// Use the provided path directly
-		return spec.Source.Path, nil
+		// Use the provided path directly, unpacking it if it's a package
+		path, err := resolvePackage(spec, spec.Source.Path, filepath.Join(l.cacheDir, "unpacked"), l.verifier)
+		return path, "", err
 
 	case plugins.SourceTypeRemote:
-		// Download and cache the plugin
-		cachedPath := filepath.Join(l.cacheDir, spec.Name, spec.Version, "plugin")
-		if _, err := os.Stat(cachedPath); err == nil {
-			// Already cached
-			return cachedPath, nil
-		}
-
-		// Download the plugin
-		if err := l.downloadPlugin(spec, cachedPath); err != nil {
-			return "", fmt.Errorf("failed to download plugin: %w", err)
+		// Download into the content-addressed cache
+		cachedPath, digest, err := l.downloadPlugin(spec)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to download plugin: %w", err)
 		}
-		return cachedPath, nil
+		return cachedPath, digest, nil
 
 	case plugins.SourceTypeMarketplace:
 		// Look in the standard plugin directory
 		standardPath := l.GetPluginPath(spec)
+		unpackRoot := filepath.Join(filepath.Dir(standardPath), "unpacked")
 		if _, err := os.Stat(standardPath); err == nil {
-			return standardPath, nil
+			path, err := resolvePackage(spec, standardPath, unpackRoot, l.verifier)
+			return path, "", err
 		}
 
 		// Try to download from marketplace
 		if err := l.downloadFromMarketplace(spec, standardPath); err != nil {
-			return "", fmt.Errorf("failed to download from marketplace: %w", err)
+			return "", "", fmt.Errorf("failed to download from marketplace: %w", err)
 		}
-		return standardPath, nil
+		path, err := resolvePackage(spec, standardPath, unpackRoot, l.verifier)
+		return path, "", err
 
 	default:
-		return "", fmt.Errorf("unsupported source type: %s", spec.Source.Type)
+		return "", "", fmt.Errorf("unsupported source type: %s", spec.Source.Type)
 	}
 }
 
+// hold records the cached artifact a plugin runs from, so it stays in the
+// cache until the plugin is unloaded
+func (l *MeshPluginLoader) hold(plugin plugins.Plugin, digest string) {
+	if digest == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acquired[plugin] = digest
+}
+
+// release releases a cached artifact acquired by downloadPlugin
+func (l *MeshPluginLoader) release(digest string) {
+	if digest != "" && l.downloader != nil {
+		l.downloader.Release(digest)
+	}
+}
+
+// verifyPlugin checks the plugin's binary, or its module for WebAssembly plugins
+func (l *MeshPluginLoader) verifyPlugin(spec plugins.PluginSpec, path string) error {
+	if spec.Isolation == plugins.IsolationWASM {
+		return verifyModule(path)
+	}
+	return l.verifyBinary(path)
+}
+
+// verifyModule checks that path is a WebAssembly module
+func verifyModule(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("module not found: %w", err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(wasmMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, wasmMagic) {
+		return fmt.Errorf("not a WebAssembly module: %s", path)
+	}
+	return nil
+}
+
+// wasmMagic starts every binary WebAssembly module
+var wasmMagic = []byte("\x00asm")
+
 func (l *MeshPluginLoader) verifyBinary(path string) error {
 	// Check if file exists
 	info, err := os.Stat(path)
@@ -244,14 +398,75 @@ func (l *MeshPluginLoader) verifyBinary(path string) error {
 	return nil
 }
 
-func (l *MeshPluginLoader) downloadPlugin(spec plugins.PluginSpec, targetPath string) error {
-	// This would implement actual plugin downloading
-	// For now, return an error
-	return fmt.Errorf("remote plugin download not yet implemented")
+// downloadPlugin fetches a remote plugin into the artifact cache, retrying
+// when the download fails or the result doesn't run. A rejection by the
+// signature policy is returned at once, as downloading again won't change
+// it. The artifact is acquired from the cache and its digest returned with
+// the binary's path.
+func (l *MeshPluginLoader) downloadPlugin(spec plugins.PluginSpec) (string, string, error) {
+	if l.downloader == nil {
+		return "", "", fmt.Errorf("artifact cache not available")
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= l.retries; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+
+		path, digest, err := l.downloader.Fetch(context.Background(), spec.Source.Path, spec.Source.Hash)
+		if err != nil {
+			lastErr = err
+			if errors.Is(err, ErrDownloadTooLarge) || errors.Is(err, ErrUnsupportedScheme) || errors.Is(err, ErrInvalidDigest) {
+				break
+			}
+			l.logger.Warn("Plugin download failed",
+				zap.String("name", spec.Name),
+				zap.String("url", spec.Source.Path),
+				zap.Int("attempt", attempt),
+				zap.Error(err))
+			continue
+		}
+
+		if path, err = resolvePackage(spec, path, filepath.Join(l.cacheDir, "unpacked"), l.verifier); err == nil {
+			err = l.verifyPlugin(spec, path)
+		}
+		if errors.Is(err, ErrUntrusted) {
+			l.downloader.Release(digest)
+			return "", "", err
+		}
+		if err != nil {
+			// Drop the artifact so the next attempt downloads it again,
+			// unless another plugin is running from it
+			lastErr = err
+			l.downloader.Release(digest)
+			l.artifacts.Remove(digest)
+			l.logger.Warn("Downloaded plugin failed verification",
+				zap.String("name", spec.Name),
+				zap.String("sha256", digest),
+				zap.Int("attempt", attempt),
+				zap.Error(err))
+			continue
+		}
+
+		return path, digest, nil
+	}
+
+	return "", "", lastErr
 }
 
 func (l *MeshPluginLoader) downloadFromMarketplace(spec plugins.PluginSpec, targetPath string) error {
-	// This would implement marketplace integration
-	// For now, return an error
-	return fmt.Errorf("marketplace download not yet implemented")
-}
\ No newline at end of file
+	if l.marketplace == nil {
+		return fmt.Errorf("marketplace client not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	l.logger.Info("Downloading plugin from marketplace",
+		zap.String("name", spec.Name),
+		zap.String("version", spec.Version),
+		zap.String("id", spec.Source.Path))
+
+	return l.marketplace.DownloadPlugin(ctx, spec, targetPath)
+}
@@ -15,6 +15,7 @@ var (
 	ErrPluginNotLoaded   = errors.New("plugin not loaded")
 	ErrPluginAlreadyLoaded = errors.New("plugin already loaded")
 	ErrInvalidState      = errors.New("invalid plugin state")
+	ErrStateNotSupported = errors.New("plugin does not support state transfer")
 )
 
 // managedPlugin wraps a plugin with management metadata
@@ -24,9 +25,17 @@ type managedPlugin struct {
 	startTime   time.Time
 	restartCount int
 	lastError   error
+	metrics     *metricsRecorder
 	mu          sync.RWMutex
 }
 
+// recorder returns the metrics of the plugin's current version
+func (mp *managedPlugin) recorder() *metricsRecorder {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.metrics
+}
+
 // pluginManager implements the PluginManager interface
 type pluginManager struct {
 	registry  PluginRegistry
@@ -34,6 +43,7 @@ type pluginManager struct {
 	executor  PluginExecutor
 	state     StateManager
 	lifecycle PluginLifecycle
+	approver  PermissionApprover
 	
 	plugins   map[string]*managedPlugin
 	mu        sync.RWMutex
@@ -46,6 +56,20 @@ func NewManager(
 	executor PluginExecutor,
 	state StateManager,
 	lifecycle PluginLifecycle,
+) PluginManager {
+	return NewManagerWithApprover(registry, loader, executor, state, lifecycle, nil)
+}
+
+// NewManagerWithApprover creates a plugin manager that asks approver which
+// permissions to grant when a plugin version is first installed. A nil
+// approver denies every permission.
+func NewManagerWithApprover(
+	registry PluginRegistry,
+	loader PluginLoader,
+	executor PluginExecutor,
+	state StateManager,
+	lifecycle PluginLifecycle,
+	approver PermissionApprover,
 ) PluginManager {
 	return &pluginManager{
 		registry:  registry,
@@ -53,6 +77,7 @@ func NewManager(
 		executor:  executor,
 		state:     state,
 		lifecycle: lifecycle,
+		approver:  approver,
 		plugins:   make(map[string]*managedPlugin),
 	}
 }
@@ -72,6 +97,20 @@ func (m *pluginManager) LoadPlugin(spec PluginSpec) error {
 		return fmt.Errorf("plugin validation failed: %w", err)
 	}
 
+	// Check dependencies against loaded plugins and the registry
+	if _, err := ResolveDependencies([]PluginSpec{spec}, m.loadedSpecs(), m.registry); err != nil {
+		return err
+	}
+
+	// Replace the requested permissions with the approved ones
+	spec, denied, err := grantPermissions(spec, m.registry, m.approver)
+	if err != nil {
+		return err
+	}
+	if len(denied) > 0 {
+		fmt.Printf("Warning: plugin %s was denied permissions %v\n", spec.Name, denied)
+	}
+
 	// Load the plugin
 	plugin, err := m.loader.LoadPlugin(spec)
 	if err != nil {
@@ -80,8 +119,9 @@ func (m *pluginManager) LoadPlugin(spec PluginSpec) error {
 
 	// Create managed plugin
 	mp := &managedPlugin{
-		plugin: plugin,
-		spec:   spec,
+		plugin:  plugin,
+		spec:    spec,
+		metrics: newMetricsRecorder(spec),
 	}
 
 	// Notify lifecycle
@@ -118,6 +158,11 @@ func (m *pluginManager) LoadPlugin(spec PluginSpec) error {
 		fmt.Printf("Warning: failed to register plugin %s: %v\n", spec.Name, err)
 	}
 
+	// Record the installed version so hot-swap and rollback can find it
+	if err := m.registry.RecordInstall(installedVersion(spec)); err != nil {
+		fmt.Printf("Warning: failed to record install of plugin %s: %v\n", spec.Name, err)
+	}
+
 	// Notify lifecycle
 	if m.lifecycle != nil {
 		if err := m.lifecycle.OnPluginStart(plugin); err != nil {
@@ -129,7 +174,36 @@ func (m *pluginManager) LoadPlugin(spec PluginSpec) error {
 	return nil
 }
 
-// UnloadPlugin unloads a plugin
+// LoadPlugins loads several plugins, ordering them so that dependencies are
+// loaded first. Plugins already loaded at the same version are skipped. If
+// any plugin fails to load, plugins loaded by this call are unloaded again.
+func (m *pluginManager) LoadPlugins(specs []PluginSpec) error {
+	m.mu.RLock()
+	loaded := m.loadedSpecs()
+	ordered, err := ResolveDependencies(unloadedSpecs(specs, loaded), loaded, m.registry)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for i, spec := range ordered {
+		if err := m.LoadPlugin(spec); err != nil {
+			m.mu.Lock()
+			for j := i - 1; j >= 0; j-- {
+				if mp, exists := m.plugins[ordered[j].Name]; exists {
+					m.unloadPlugin(ordered[j].Name, mp)
+				}
+			}
+			m.mu.Unlock()
+			return fmt.Errorf("failed to load plugin %s: %w", spec.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// UnloadPlugin unloads a plugin. It refuses to unload plugins that other
+// loaded plugins require; use UnloadPluginCascade to unload those as well.
 func (m *pluginManager) UnloadPlugin(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -139,6 +213,46 @@ func (m *pluginManager) UnloadPlugin(name string) error {
 		return ErrPluginNotFound
 	}
 
+	if dependents := findDependents(name, m.loadedSpecs(), false); len(dependents) > 0 {
+		return &DependentsError{Plugin: name, Dependents: dependents}
+	}
+
+	m.unloadPlugin(name, mp)
+	return nil
+}
+
+// UnloadPluginCascade unloads a plugin after unloading every plugin that
+// depends on it
+func (m *pluginManager) UnloadPluginCascade(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp, exists := m.plugins[name]
+	if !exists {
+		return ErrPluginNotFound
+	}
+
+	for _, dependent := range findDependents(name, m.loadedSpecs(), true) {
+		if dmp, exists := m.plugins[dependent]; exists {
+			m.unloadPlugin(dependent, dmp)
+		}
+	}
+
+	m.unloadPlugin(name, mp)
+	return nil
+}
+
+// loadedSpecs returns the specs of all loaded plugins. Callers must hold m.mu.
+func (m *pluginManager) loadedSpecs() []PluginSpec {
+	specs := make([]PluginSpec, 0, len(m.plugins))
+	for _, mp := range m.plugins {
+		specs = append(specs, mp.spec)
+	}
+	return specs
+}
+
+// unloadPlugin stops and unloads a plugin. Callers must hold m.mu.
+func (m *pluginManager) unloadPlugin(name string, mp *managedPlugin) {
 	// Notify lifecycle
 	if m.lifecycle != nil {
 		if err := m.lifecycle.OnPluginStop(mp.plugin); err != nil {
@@ -178,8 +292,6 @@ func (m *pluginManager) UnloadPlugin(name string) error {
 
 	// Remove from managed plugins
 	delete(m.plugins, name)
-
-	return nil
 }
 
 // ReloadPlugin reloads a plugin
@@ -193,10 +305,12 @@ func (m *pluginManager) ReloadPlugin(name string) error {
 	spec := mp.spec
 	m.mu.RUnlock()
 
-	// Unload the current plugin
-	if err := m.UnloadPlugin(name); err != nil {
-		return fmt.Errorf("failed to unload plugin: %w", err)
+	// Unload the current plugin, keeping its dependents loaded
+	m.mu.Lock()
+	if mp, exists := m.plugins[name]; exists {
+		m.unloadPlugin(name, mp)
 	}
+	m.mu.Unlock()
 
 	// Load the plugin again
 	if err := m.LoadPlugin(spec); err != nil {
@@ -208,6 +322,12 @@ func (m *pluginManager) ReloadPlugin(name string) error {
 
 // ExecutePlugin executes a plugin request
 func (m *pluginManager) ExecutePlugin(name string, request PluginRequest) (PluginResponse, error) {
+	return m.ExecutePluginContext(context.Background(), name, request)
+}
+
+// ExecutePluginContext executes a plugin request, giving up when ctx ends.
+// A request that runs past ctx's deadline fails with a *TimeoutError.
+func (m *pluginManager) ExecutePluginContext(ctx context.Context, name string, request PluginRequest) (PluginResponse, error) {
 	m.mu.RLock()
 	mp, exists := m.plugins[name]
 	m.mu.RUnlock()
@@ -222,19 +342,24 @@ func (m *pluginManager) ExecutePlugin(name string, request PluginRequest) (Plugi
 		return PluginResponse{}, fmt.Errorf("%w: plugin status is %s", ErrInvalidState, status)
 	}
 
+	done := mp.recorder().begin(request.Method)
+
 	// Execute through the executor if available
 	if m.executor != nil {
-		return m.executor.ExecutePlugin(mp.plugin, request)
+		response, err := m.executor.ExecutePluginContext(ctx, mp.plugin, request)
+		done(err)
+		return response, err
 	}
 
 	// Direct execution
-	ctx := context.Background()
 	if request.Context.Timestamp.IsZero() {
 		request.Context.Timestamp = time.Now()
 	}
 
 	startTime := time.Now()
 	response, err := mp.plugin.Handle(ctx, request)
+	err = CheckTimeout(ctx, name, request, err)
+	done(err)
 	
 	// Set response metadata
 	response.Metadata.ProcessingTime = time.Since(startTime)
@@ -255,6 +380,34 @@ func (m *pluginManager) ExecutePlugin(name string, request PluginRequest) (Plugi
 	return response, nil
 }
 
+// OpenPluginStream opens a request to a plugin with a streamed request body,
+// response body or both
+func (m *pluginManager) OpenPluginStream(ctx context.Context, name string, request PluginRequest, mode StreamMode) (PluginStream, error) {
+	m.mu.RLock()
+	mp, exists := m.plugins[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrPluginNotFound
+	}
+
+	status := mp.plugin.GetStatus()
+	if status != PluginStatusRunning {
+		return nil, fmt.Errorf("%w: plugin status is %s", ErrInvalidState, status)
+	}
+
+	if request.Context.Timestamp.IsZero() {
+		request.Context.Timestamp = time.Now()
+	}
+	done := mp.recorder().begin(request.Method)
+	stream, err := openStream(ctx, mp.plugin, request, mode)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	return &trackedStream{PluginStream: stream, finish: done}, nil
+}
+
 // ListPlugins returns a list of all loaded plugins
 func (m *pluginManager) ListPlugins() []PluginInfo {
 	m.mu.RLock()
@@ -265,6 +418,7 @@ func (m *pluginManager) ListPlugins() []PluginInfo {
 		info := mp.plugin.Info()
 		info.Status = mp.plugin.GetStatus()
 		info.Uptime = time.Since(mp.startTime)
+		info.ResourceUsage = resourceUsage(mp.plugin)
 		
 		mp.mu.RLock()
 		if mp.lastError != nil {
@@ -272,6 +426,8 @@ func (m *pluginManager) ListPlugins() []PluginInfo {
 		}
 		mp.mu.RUnlock()
 
+		metrics := mp.recorder().snapshot()
+		info.Metrics = &metrics
 		infos = append(infos, info)
 	}
 
@@ -291,6 +447,7 @@ func (m *pluginManager) GetPlugin(name string) (PluginInfo, error) {
 	info := mp.plugin.Info()
 	info.Status = mp.plugin.GetStatus()
 	info.Uptime = time.Since(mp.startTime)
+	info.ResourceUsage = resourceUsage(mp.plugin)
 	
 	mp.mu.RLock()
 	if mp.lastError != nil {
@@ -298,6 +455,8 @@ func (m *pluginManager) GetPlugin(name string) (PluginInfo, error) {
 	}
 	mp.mu.RUnlock()
 
+	metrics := mp.recorder().snapshot()
+	info.Metrics = &metrics
 	return info, nil
 }
 
@@ -357,6 +516,9 @@ func (m *pluginManager) HotSwapPlugin(name string, newVersion string) error {
 	mp.spec = newSpec
 	mp.startTime = time.Now()
 	mp.restartCount++
+	mp.mu.Lock()
+	mp.metrics = newMetricsRecorder(newSpec)
+	mp.mu.Unlock()
 	m.mu.Unlock()
 
 	// Stop and unload the old plugin
@@ -411,4 +573,17 @@ func (m *pluginManager) ImportPluginState(name string, state []byte) error {
 
 	// Direct import
 	return mp.plugin.ImportState(state)
-}
\ No newline at end of file
+}
+
+// installedVersion describes a loaded plugin spec as an installed version,
+// recording the permissions it was granted as approved
+func installedVersion(spec PluginSpec) InstalledVersion {
+	return InstalledVersion{
+		Name:        spec.Name,
+		Version:     spec.Version,
+		Source:      spec.Source,
+		Hash:        spec.Source.Hash,
+		Permissions: spec.Permissions,
+		ApprovedAt:  time.Now(),
+	}
+}
@@ -0,0 +1,454 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
+)
+
+var (
+	// ErrHotSwapUnavailable is returned when no hot-swapper is configured
+	ErrHotSwapUnavailable = errors.New("hot swap not configured")
+	// ErrHotSwapInProgress is returned when loading a version of a plugin
+	// that is already being swapped
+	ErrHotSwapInProgress = errors.New("hot swap already in progress")
+)
+
+// HotSwapper swaps a loaded plugin for another version of it, such as the
+// state package's hot-swap coordinator
+type HotSwapper interface {
+	HotSwap(ctx context.Context, pluginID string, newSpec PluginSpec) error
+}
+
+// SetHotSwapper sets what HotSwapPlugin swaps plugins with. It is usually a
+// coordinator built on the manager's SwapManager.
+func (m *MeshPluginManager) SetHotSwapper(hotSwapper HotSwapper) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hotSwapper = hotSwapper
+}
+
+// SwapManager returns the view of the manager hot-swaps are coordinated
+// through
+func (m *MeshPluginManager) SwapManager() *MeshSwapManager {
+	return &MeshSwapManager{manager: m}
+}
+
+// trackRequest counts a request to a plugin in the router, so the plugin can
+// be drained, and waits while it is
+func (m *MeshPluginManager) trackRequest(ctx context.Context, name string) (func(), error) {
+	if m.protocolRouter == nil {
+		return func() {}, nil
+	}
+	return m.protocolRouter.TrackRequest(ctx, fmt.Sprintf("plugin.%s", name))
+}
+
+// trackedStream counts a stream as in flight until its response is read
+type trackedStream struct {
+	PluginStream
+	finish func(error)
+}
+
+func (s *trackedStream) Response() (PluginResponse, error) {
+	resp, err := s.PluginStream.Response()
+	s.finish(err)
+	return resp, err
+}
+
+// MeshSwapManager implements state.PluginManager for a MeshPluginManager.
+// Loading a plugin that is already loaded loads the version as a standby
+// under the same name. Starting the plugin once it is stopped starts the
+// standby, checks its health and switches the plugin's mesh endpoint to it,
+// keeping the stopped version as the standby so that starting the plugin
+// again rolls back to it. Unloading the plugin discards the standby.
+type MeshSwapManager struct {
+	manager *MeshPluginManager
+}
+
+// GetPlugin returns information about the active version of a plugin
+func (s *MeshSwapManager) GetPlugin(pluginID string) (*PluginInfo, error) {
+	info, err := s.manager.GetPlugin(pluginID)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// LoadPlugin loads a plugin, or a standby version of a loaded plugin
+func (s *MeshSwapManager) LoadPlugin(ctx context.Context, spec PluginSpec) error {
+	m := s.manager
+	m.mu.RLock()
+	active, loaded := m.plugins[spec.Name]
+	var err error
+	if loaded {
+		err = m.swappable(spec.Name, active)
+	}
+	m.mu.RUnlock()
+	if !loaded {
+		return m.LoadPlugin(spec)
+	}
+	if err != nil {
+		return err
+	}
+
+	standby, err := m.loadVersion(spec, active)
+	if err != nil {
+		return err
+	}
+
+	// Another swap or rollout may have started while the version loaded
+	m.mu.Lock()
+	if err = m.swappable(spec.Name, active); err == nil {
+		standby.stopped = true
+		m.standby[spec.Name] = standby
+	}
+	m.mu.Unlock()
+	if err != nil {
+		m.loader.UnloadPlugin(standby.plugin)
+		return err
+	}
+
+	m.logger.Info("Loaded standby plugin version",
+		zap.String("name", spec.Name),
+		zap.String("version", spec.Version),
+		zap.String("active", active.spec.Version))
+	return nil
+}
+
+// swappable checks that active is still the loaded version of a plugin and
+// that no other version of it is being swapped in or rolled out. Callers
+// must hold m.mu.
+func (m *MeshPluginManager) swappable(name string, active *ManagedMeshPlugin) error {
+	if m.plugins[name] != active {
+		return ErrPluginNotFound
+	}
+	if _, swapping := m.standby[name]; swapping {
+		return ErrHotSwapInProgress
+	}
+	if r, exists := m.rollouts[name]; exists && r.active() {
+		return ErrRolloutInProgress
+	}
+	return nil
+}
+
+// loadVersion validates and loads another version of an active plugin
+// without starting it. Loading may download the plugin, so callers must not
+// hold m.mu, and must check the plugin is still swappable once they take it.
+func (m *MeshPluginManager) loadVersion(spec PluginSpec, active *ManagedMeshPlugin) (*ManagedMeshPlugin, error) {
+	if err := m.loader.ValidatePlugin(spec); err != nil {
+		return nil, fmt.Errorf("plugin validation failed: %w", err)
+	}
+	m.mu.RLock()
+	_, err := ResolveDependencies([]PluginSpec{spec}, m.loadedSpecs(), m.registry)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	spec, _, err = grantPermissions(spec, m.registry, m.approver)
+	if err != nil {
+		return nil, err
+	}
+
+	plugin, err := m.loader.LoadPlugin(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin: %w", err)
+	}
+	return &ManagedMeshPlugin{
+		spec:        spec,
+		plugin:      plugin,
+		serviceName: active.serviceName,
+		metrics:     newMetricsRecorder(spec),
+	}, nil
+}
+
+// DrainRequests holds new requests to a plugin and waits up to timeout for
+// those in flight to finish. Requests are held until the plugin is started.
+func (s *MeshSwapManager) DrainRequests(ctx context.Context, pluginID string, timeout time.Duration) error {
+	m := s.manager
+	if m.protocolRouter == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return m.protocolRouter.Drain(ctx, fmt.Sprintf("plugin.%s", pluginID))
+}
+
+// StopPlugin stops the active version of a plugin, keeping its state so it
+// can be restarted as it was. The plugin is stopped without holding the
+// manager's lock, so other plugins are served meanwhile.
+func (s *MeshSwapManager) StopPlugin(ctx context.Context, pluginID string) error {
+	m := s.manager
+	m.mu.Lock()
+	mp, exists := m.plugins[pluginID]
+	if !exists {
+		m.mu.Unlock()
+		return ErrPluginNotFound
+	}
+	if mp.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	if mp.switching {
+		m.mu.Unlock()
+		return ErrHotSwapInProgress
+	}
+	mp.switching = true
+	m.mu.Unlock()
+
+	err := m.stopVersion(ctx, mp)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mp.switching = false
+	return err
+}
+
+// stopVersion exports the state of a running version of a plugin and stops
+// it. Callers must have marked mp as switching and not hold m.mu.
+func (m *MeshPluginManager) stopVersion(ctx context.Context, mp *ManagedMeshPlugin) error {
+	// Stopping a plugin whose state can't be saved would lose it, so it
+	// keeps serving instead
+	state, err := mp.plugin.ExportState()
+	if err != nil && !errors.Is(err, ErrStateNotSupported) {
+		if m.protocolRouter != nil {
+			m.protocolRouter.Resume(mp.serviceName)
+		}
+		return fmt.Errorf("failed to export plugin state: %w", err)
+	}
+
+	m.mu.Lock()
+	conn := mp.grpcConn
+	mp.grpcConn = nil
+	m.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	if err := mp.plugin.Stop(ctx); err != nil {
+		return fmt.Errorf("failed to stop plugin: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mp.checkpoint = state
+	mp.stopped = true
+	return nil
+}
+
+// StartPlugin starts a stopped plugin: its standby version if there is one
+// that hasn't failed, otherwise the version that was stopped. A standby that
+// fails to start or its health check is marked failed and stopped again.
+// The version is started without holding the manager's lock; the lock is
+// only taken to switch requests over to it.
+func (s *MeshSwapManager) StartPlugin(ctx context.Context, pluginID string) error {
+	m := s.manager
+	m.mu.Lock()
+	active, exists := m.plugins[pluginID]
+	if !exists {
+		m.mu.Unlock()
+		return ErrPluginNotFound
+	}
+	if !active.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	if active.switching {
+		m.mu.Unlock()
+		return ErrHotSwapInProgress
+	}
+	next := active
+	if standby, ok := m.standby[pluginID]; ok && !standby.failed {
+		next = standby
+	}
+	active.switching = true
+	m.mu.Unlock()
+
+	conn, endpoint, err := m.startVersion(ctx, next)
+
+	m.mu.Lock()
+	active.switching = false
+	started := err == nil
+	if started && m.plugins[pluginID] != active {
+		// Unloaded while it started
+		err = ErrPluginNotFound
+	} else if started {
+		err = m.routeVersion(next, conn, endpoint)
+	}
+	if err != nil {
+		if next != active {
+			next.failed = true
+		}
+		m.mu.Unlock()
+		if started {
+			if conn != nil {
+				conn.Close()
+			}
+			next.plugin.Stop(context.Background())
+		}
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if next != active {
+		m.plugins[pluginID] = next
+		m.standby[pluginID] = active
+
+		if m.lifecycle != nil {
+			if err := m.lifecycle.OnPluginLoad(next.plugin); err != nil {
+				m.logger.Warn("Lifecycle onload failed", zap.Error(err))
+			}
+		}
+		if m.registry != nil {
+			if err := m.registry.RecordInstall(installedVersion(next.spec)); err != nil {
+				m.logger.Warn("Failed to record plugin install",
+					zap.String("name", pluginID),
+					zap.Error(err))
+			}
+		}
+	}
+
+	m.logger.Info("Switched plugin version",
+		zap.String("name", pluginID),
+		zap.String("version", next.spec.Version))
+	return nil
+}
+
+// StagePluginState gives a stopped plugin the state to start with: its
+// standby version if there is one that hasn't failed, otherwise the version
+// that was stopped. StartPlugin imports it before routing requests to the
+// version, so requests held during a swap never see it without its state.
+func (s *MeshSwapManager) StagePluginState(pluginID string, state []byte) error {
+	m := s.manager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active, exists := m.plugins[pluginID]
+	if !exists {
+		return ErrPluginNotFound
+	}
+	if !active.stopped || active.switching {
+		return ErrHotSwapInProgress
+	}
+	next := active
+	if standby, ok := m.standby[pluginID]; ok && !standby.failed {
+		next = standby
+	}
+	next.checkpoint = state
+	return nil
+}
+
+// UnloadPlugin discards a plugin's standby version, or unloads the plugin
+// if it has none
+func (s *MeshSwapManager) UnloadPlugin(ctx context.Context, pluginID string) error {
+	m := s.manager
+	m.mu.Lock()
+	if active, ok := m.plugins[pluginID]; ok && active.switching {
+		m.mu.Unlock()
+		return ErrHotSwapInProgress
+	}
+	standby, exists := m.standby[pluginID]
+	delete(m.standby, pluginID)
+	m.mu.Unlock()
+
+	if !exists {
+		return m.UnloadPlugin(pluginID)
+	}
+
+	if !standby.stopped {
+		if standby.grpcConn != nil {
+			standby.grpcConn.Close()
+		}
+		if err := standby.plugin.Stop(ctx); err != nil {
+			m.logger.Warn("Error stopping plugin", zap.Error(err))
+		}
+	}
+	if !standby.startTime.IsZero() && m.lifecycle != nil {
+		if err := m.lifecycle.OnPluginUnload(standby.plugin); err != nil {
+			m.logger.Warn("Lifecycle onunload failed", zap.Error(err))
+		}
+	}
+	if err := m.loader.UnloadPlugin(standby.plugin); err != nil {
+		m.logger.Warn("Error unloading plugin", zap.Error(err))
+	}
+
+	m.logger.Info("Discarded plugin version",
+		zap.String("name", pluginID),
+		zap.String("version", standby.spec.Version))
+	return nil
+}
+
+// ExportPluginState exports state from the active version of a plugin
+func (s *MeshSwapManager) ExportPluginState(pluginID string) ([]byte, error) {
+	return s.manager.ExportPluginState(pluginID)
+}
+
+// ImportPluginState imports state into the active version of a plugin
+func (s *MeshSwapManager) ImportPluginState(pluginID string, state []byte) error {
+	return s.manager.ImportPluginState(pluginID, state)
+}
+
+// startVersion starts a version of a plugin, restores the state it was
+// stopped with, checks its health and connects to it. Requests aren't
+// routed to it until routeVersion is called. Callers must not hold m.mu,
+// and must keep anything else from starting or stopping mp meanwhile.
+func (m *MeshPluginManager) startVersion(ctx context.Context, mp *ManagedMeshPlugin) (*grpc.ClientConn, mesh.ServiceEndpoint, error) {
+	m.mu.Lock()
+	err := m.authorizeCaller(mp)
+	checkpoint := mp.checkpoint
+	m.mu.Unlock()
+	if err != nil {
+		return nil, mesh.ServiceEndpoint{}, err
+	}
+
+	if err := mp.plugin.Start(ctx); err != nil {
+		return nil, mesh.ServiceEndpoint{}, fmt.Errorf("failed to start plugin: %w", err)
+	}
+	if caller, ok := mp.plugin.(meshCaller); ok && m.protocolRouter != nil && caller.PID() > 0 {
+		m.protocolRouter.RegisterCallerPID(mp.spec.Name, caller.PID())
+	}
+
+	fail := func(err error) (*grpc.ClientConn, mesh.ServiceEndpoint, error) {
+		mp.plugin.Stop(context.Background())
+		return nil, mesh.ServiceEndpoint{}, err
+	}
+
+	if checkpoint != nil {
+		if err := mp.plugin.ImportState(checkpoint); err != nil {
+			return fail(fmt.Errorf("failed to restore plugin state: %w", err))
+		}
+	}
+	if err := mp.plugin.HealthCheck(); err != nil {
+		return fail(fmt.Errorf("plugin %s %s failed its health check: %w", mp.spec.Name, mp.spec.Version, err))
+	}
+	conn, endpoint, err := m.dial(ctx, mp)
+	if err != nil {
+		return fail(err)
+	}
+	return conn, endpoint, nil
+}
+
+// routeVersion switches a plugin's endpoint to a version started by
+// startVersion, letting the requests held while it was swapped proceed.
+// Callers must hold m.mu, so the held requests see the version as active.
+func (m *MeshPluginManager) routeVersion(mp *ManagedMeshPlugin, conn *grpc.ClientConn, endpoint mesh.ServiceEndpoint) error {
+	if m.protocolRouter != nil && servesMesh(mp) {
+		if err := m.protocolRouter.SwitchEndpoint(mp.serviceName, endpoint); err != nil {
+			return err
+		}
+	} else if m.protocolRouter != nil {
+		m.protocolRouter.Resume(mp.serviceName)
+	}
+
+	mp.grpcConn = conn
+	mp.endpoint = endpoint
+	mp.stopped = false
+	mp.checkpoint = nil
+	mp.startTime = time.Now()
+	return nil
+}
@@ -4,6 +4,7 @@ package plugins
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -28,10 +29,21 @@ type MeshPluginManager struct {
 	
 	// Plugin tracking
 	plugins   map[string]*ManagedMeshPlugin
+	standby   map[string]*ManagedMeshPlugin // other version of a plugin being hot-swapped
 	mu        sync.RWMutex
+
+	// Hot-swap
+	hotSwapper HotSwapper
+
+	// Canary rollouts, the latest per plugin
+	rollouts map[string]*rollout
+
+	// Told about every request served, such as by the checkpoint scheduler
+	observer RequestObserver
 	
 	// Configuration
 	socketDir string
+	approver  PermissionApprover
 	logger    *zap.Logger
 }
 
@@ -45,14 +57,23 @@ type ManagedMeshPlugin struct {
 	endpoint    mesh.ServiceEndpoint
 	grpcConn    *grpc.ClientConn
 	serviceName string
+	socket      string // socket the plugin serves on, if not the default
+	token       string // token the plugin identifies itself to the ingress with
 	
 	// Management metadata
 	startTime    time.Time
 	restartCount int
 	lastError    error
+	metrics      *metricsRecorder
 	
 	// Process management
 	process     *PluginProcess
+
+	// Hot-swap
+	stopped    bool   // stopped while being swapped
+	failed     bool   // a standby version that failed to start
+	switching  bool   // being stopped or started by a swap
+	checkpoint []byte // state exported when stopped, restored if swapped back
 	
 	mu          sync.RWMutex
 }
@@ -75,6 +96,10 @@ type MeshPluginManagerConfig struct {
 	ProtocolRouter *routing.ProtocolRouter
 	SocketDir      string
 	Logger         *zap.Logger
+	
+	// PermissionApprover is asked which permissions to grant when a plugin
+	// version is first installed; nil denies every permission
+	PermissionApprover PermissionApprover
 }
 
 // NewMeshPluginManager creates a new mesh-based plugin manager
@@ -86,7 +111,7 @@ func NewMeshPluginManager(config MeshPluginManagerConfig) *MeshPluginManager {
 		config.SocketDir = "/tmp/blackhole/plugins"
 	}
 
-	return &MeshPluginManager{
+	m := &MeshPluginManager{
 		registry:       config.Registry,
 		loader:         config.Loader,
 		state:          config.StateManager,
@@ -94,9 +119,18 @@ func NewMeshPluginManager(config MeshPluginManagerConfig) *MeshPluginManager {
 		meshNetwork:    config.MeshNetwork,
 		protocolRouter: config.ProtocolRouter,
 		plugins:        make(map[string]*ManagedMeshPlugin),
+		standby:        make(map[string]*ManagedMeshPlugin),
+		rollouts:       make(map[string]*rollout),
 		socketDir:      config.SocketDir,
+		approver:       config.PermissionApprover,
 		logger:         config.Logger,
 	}
+
+	// Requests plugins make to each other through the mesh count too
+	if m.protocolRouter != nil {
+		m.protocolRouter.SetRouteObserver(routeMetrics{manager: m})
+	}
+	return m
 }
 
 // LoadPlugin loads a plugin and connects it to the mesh
@@ -118,6 +152,25 @@ func (m *MeshPluginManager) LoadPlugin(spec PluginSpec) error {
 		return fmt.Errorf("plugin validation failed: %w", err)
 	}
 
+	// Check dependencies against loaded plugins and the registry
+	if _, err := ResolveDependencies([]PluginSpec{spec}, m.loadedSpecs(), m.registry); err != nil {
+		return err
+	}
+
+	// Replace the requested permissions with the approved ones
+	spec, denied, err := grantPermissions(spec, m.registry, m.approver)
+	if err != nil {
+		return err
+	}
+	if len(denied) > 0 {
+		m.logger.Warn("Plugin permissions denied",
+			zap.String("name", spec.Name),
+			zap.Any("denied", denied))
+	}
+	m.logger.Info("Granting plugin permissions",
+		zap.String("name", spec.Name),
+		zap.Any("permissions", spec.Permissions))
+
 	// Load the plugin binary/configuration
 	plugin, err := m.loader.LoadPlugin(spec)
 	if err != nil {
@@ -129,6 +182,13 @@ func (m *MeshPluginManager) LoadPlugin(spec PluginSpec) error {
 		spec:        spec,
 		plugin:      plugin,
 		serviceName: fmt.Sprintf("plugin.%s", spec.Name),
+		metrics:     newMetricsRecorder(spec),
+	}
+
+	// Authorize the plugin's calls before it can make any
+	if err := m.authorizeCaller(mp); err != nil {
+		m.loader.UnloadPlugin(plugin)
+		return err
 	}
 
 	// Start the plugin process
@@ -136,20 +196,29 @@ func (m *MeshPluginManager) LoadPlugin(spec PluginSpec) error {
 	defer cancel()
 
 	if err := plugin.Start(ctx); err != nil {
+		m.releaseCaller(spec.Name)
+		m.loader.UnloadPlugin(plugin)
 		return fmt.Errorf("failed to start plugin: %w", err)
 	}
 
 	mp.startTime = time.Now()
+	if caller, ok := plugin.(meshCaller); ok && m.protocolRouter != nil && caller.PID() > 0 {
+		m.protocolRouter.RegisterCallerPID(spec.Name, caller.PID())
+	}
 
 	// Wait for mesh registration
 	if err := m.waitForPluginRegistration(ctx, mp); err != nil {
 		plugin.Stop(context.Background())
+		m.releaseCaller(spec.Name)
+		m.loader.UnloadPlugin(plugin)
 		return fmt.Errorf("plugin failed to register with mesh: %w", err)
 	}
 
 	// Connect to plugin via mesh
 	if err := m.connectToPlugin(ctx, mp); err != nil {
 		plugin.Stop(context.Background())
+		m.releaseCaller(spec.Name)
+		m.loader.UnloadPlugin(plugin)
 		return fmt.Errorf("failed to connect to plugin: %w", err)
 	}
 
@@ -163,6 +232,15 @@ func (m *MeshPluginManager) LoadPlugin(spec PluginSpec) error {
 	// Store the managed plugin
 	m.plugins[spec.Name] = mp
 
+	// Record the installed version so hot-swap and rollback can find it
+	if m.registry != nil {
+		if err := m.registry.RecordInstall(installedVersion(spec)); err != nil {
+			m.logger.Warn("Failed to record plugin install",
+				zap.String("name", spec.Name),
+				zap.Error(err))
+		}
+	}
+
 	m.logger.Info("Plugin loaded successfully",
 		zap.String("name", spec.Name),
 		zap.String("service", mp.serviceName))
@@ -170,7 +248,36 @@ func (m *MeshPluginManager) LoadPlugin(spec PluginSpec) error {
 	return nil
 }
 
-// UnloadPlugin unloads a plugin and removes it from mesh
+// LoadPlugins loads several plugins, ordering them so that dependencies are
+// loaded first. Plugins already loaded at the same version are skipped. If
+// any plugin fails to load, plugins loaded by this call are unloaded again.
+func (m *MeshPluginManager) LoadPlugins(specs []PluginSpec) error {
+	m.mu.RLock()
+	loaded := m.loadedSpecs()
+	ordered, err := ResolveDependencies(unloadedSpecs(specs, loaded), loaded, m.registry)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for i, spec := range ordered {
+		if err := m.LoadPlugin(spec); err != nil {
+			m.mu.Lock()
+			for j := i - 1; j >= 0; j-- {
+				if mp, exists := m.plugins[ordered[j].Name]; exists {
+					m.unloadPlugin(ordered[j].Name, mp)
+				}
+			}
+			m.mu.Unlock()
+			return fmt.Errorf("failed to load plugin %s: %w", spec.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// UnloadPlugin unloads a plugin and removes it from mesh. It refuses to
+// unload plugins that other loaded plugins require.
 func (m *MeshPluginManager) UnloadPlugin(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -180,8 +287,90 @@ func (m *MeshPluginManager) UnloadPlugin(name string) error {
 		return ErrPluginNotFound
 	}
 
+	if dependents := findDependents(name, m.loadedSpecs(), false); len(dependents) > 0 {
+		return &DependentsError{Plugin: name, Dependents: dependents}
+	}
+
+	m.unloadPlugin(name, mp)
+	return nil
+}
+
+// UnloadPluginCascade unloads a plugin after unloading every plugin that
+// depends on it
+func (m *MeshPluginManager) UnloadPluginCascade(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp, exists := m.plugins[name]
+	if !exists {
+		return ErrPluginNotFound
+	}
+
+	for _, dependent := range findDependents(name, m.loadedSpecs(), true) {
+		if dmp, exists := m.plugins[dependent]; exists {
+			m.logger.Info("Unloading dependent plugin",
+				zap.String("name", dependent),
+				zap.String("dependency", name))
+			m.unloadPlugin(dependent, dmp)
+		}
+	}
+
+	m.unloadPlugin(name, mp)
+	return nil
+}
+
+// Shutdown stops the request observer's background work and unloads every
+// plugin, each after the plugins that depend on it
+func (m *MeshPluginManager) Shutdown() {
+	// The observer may be waiting for the lock to checkpoint a plugin, so
+	// it is stopped without holding it
+	m.mu.RLock()
+	observer, ok := m.observer.(BackgroundObserver)
+	m.mu.RUnlock()
+	if ok {
+		observer.Stop()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.plugins))
+	for name := range m.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, exists := m.plugins[name]; !exists {
+			continue
+		}
+		for _, dependent := range findDependents(name, m.loadedSpecs(), true) {
+			if dmp, exists := m.plugins[dependent]; exists {
+				m.unloadPlugin(dependent, dmp)
+			}
+		}
+		m.unloadPlugin(name, m.plugins[name])
+	}
+}
+
+// loadedSpecs returns the specs of all loaded plugins. Callers must hold m.mu.
+func (m *MeshPluginManager) loadedSpecs() []PluginSpec {
+	specs := make([]PluginSpec, 0, len(m.plugins))
+	for _, mp := range m.plugins {
+		specs = append(specs, mp.spec)
+	}
+	return specs
+}
+
+// unloadPlugin stops a plugin and disconnects it from the mesh. Callers must hold m.mu.
+func (m *MeshPluginManager) unloadPlugin(name string, mp *ManagedMeshPlugin) {
 	m.logger.Info("Unloading plugin", zap.String("name", name))
 
+	// Stop a version it was being rolled out to
+	if r, exists := m.rollouts[name]; exists && r.active() {
+		m.abortRollout(name, r, "plugin unloaded")
+		m.retireVersion(r.canary)
+	}
+
 	// Notify lifecycle
 	if m.lifecycle != nil {
 		if err := m.lifecycle.OnPluginUnload(mp.plugin); err != nil {
@@ -193,6 +382,7 @@ func (m *MeshPluginManager) UnloadPlugin(name string) error {
 	if mp.grpcConn != nil {
 		mp.grpcConn.Close()
 	}
+	m.releaseCaller(name)
 
 	// Stop the plugin
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -201,18 +391,70 @@ func (m *MeshPluginManager) UnloadPlugin(name string) error {
 	if err := mp.plugin.Stop(ctx); err != nil {
 		m.logger.Warn("Error stopping plugin", zap.Error(err))
 	}
+	if err := m.loader.UnloadPlugin(mp.plugin); err != nil {
+		m.logger.Warn("Error unloading plugin", zap.Error(err))
+	}
+
+	// Stop a version it was being swapped with
+	if standby, exists := m.standby[name]; exists {
+		if !standby.stopped {
+			standby.plugin.Stop(ctx)
+		}
+		m.loader.UnloadPlugin(standby.plugin)
+		delete(m.standby, name)
+	}
 
 	// Remove from registry
 	delete(m.plugins, name)
+	delete(m.rollouts, name)
+	if observer, ok := m.observer.(BackgroundObserver); ok {
+		observer.ForgetPlugin(name)
+	}
 
 	m.logger.Info("Plugin unloaded", zap.String("name", name))
-	return nil
+}
+
+// RequestObserver is told about every request a plugin has served. It is
+// called on the request's goroutine, so it must not block.
+type RequestObserver interface {
+	ObserveRequest(plugin string, request PluginRequest, err error)
+}
+
+// BackgroundObserver is a RequestObserver with work of its own, such as the
+// checkpoint scheduler. It is told when a plugin is unloaded, so it stops
+// working on it, and stopped when the manager shuts down.
+type BackgroundObserver interface {
+	RequestObserver
+	ForgetPlugin(name string)
+	Stop()
+}
+
+// SetRequestObserver sets what is told about requests plugins served
+func (m *MeshPluginManager) SetRequestObserver(observer RequestObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = observer
 }
 
 // ExecutePlugin executes a plugin request via mesh
 func (m *MeshPluginManager) ExecutePlugin(name string, request PluginRequest) (PluginResponse, error) {
+	return m.ExecutePluginContext(context.Background(), name, request)
+}
+
+// ExecutePluginContext executes a plugin request via mesh, giving up when ctx
+// ends. Requests without a deadline get the default of 30 seconds.
+func (m *MeshPluginManager) ExecutePluginContext(ctx context.Context, name string, request PluginRequest) (PluginResponse, error) {
+	// Count the request so a hot-swap can drain it, waiting while one is
+	finish, err := m.trackRequest(ctx, name)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+	defer finish()
+
 	m.mu.RLock()
 	mp, exists := m.plugins[name]
+	mp = m.routeRollout(name, mp, request)
+	observer := m.observer
 	m.mu.RUnlock()
 
 	if !exists {
@@ -221,12 +463,55 @@ func (m *MeshPluginManager) ExecutePlugin(name string, request PluginRequest) (P
 
 	// Route through mesh network
 	// The specific method depends on the plugin's gRPC interface
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+	}
 
 	// For now, we use the plugin's Handle method
 	// In reality, each plugin type would have its own gRPC interface
-	return mp.plugin.Handle(ctx, request)
+	done := mp.metrics.begin(request.Method)
+	response, err := mp.plugin.Handle(ctx, request)
+	err = CheckTimeout(ctx, name, request, err)
+	done(err)
+	if observer != nil {
+		observer.ObserveRequest(name, request, err)
+	}
+	return response, err
+}
+
+// OpenPluginStream opens a streamed request to a plugin
+func (m *MeshPluginManager) OpenPluginStream(ctx context.Context, name string, request PluginRequest, mode StreamMode) (PluginStream, error) {
+	finish, err := m.trackRequest(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	mp, exists := m.plugins[name]
+	mp = m.routeRollout(name, mp, request)
+	observer := m.observer
+	m.mu.RUnlock()
+
+	if !exists {
+		finish()
+		return nil, ErrPluginNotFound
+	}
+	done := mp.metrics.begin(request.Method)
+	stream, err := openStream(ctx, mp.plugin, request, mode)
+	if err != nil {
+		done(err)
+		finish()
+		return nil, err
+	}
+	return &trackedStream{PluginStream: stream, finish: func(err error) {
+		done(err)
+		if observer != nil {
+			observer.ObserveRequest(name, request, err)
+		}
+		finish()
+	}}, nil
 }
 
 // ListPlugins returns information about all loaded plugins
@@ -240,6 +525,9 @@ func (m *MeshPluginManager) ListPlugins() []PluginInfo {
 		// Add mesh-specific information
 		info.LoadTime = mp.startTime
 		info.Uptime = time.Since(mp.startTime)
+		info.ResourceUsage = resourceUsage(mp.plugin)
+		metrics := mp.metrics.snapshot()
+		info.Metrics = &metrics
 		infos = append(infos, info)
 	}
 	return infos
@@ -258,6 +546,9 @@ func (m *MeshPluginManager) GetPlugin(name string) (PluginInfo, error) {
 	info := mp.plugin.Info()
 	info.LoadTime = mp.startTime
 	info.Uptime = time.Since(mp.startTime)
+	info.ResourceUsage = resourceUsage(mp.plugin)
+	metrics := mp.metrics.snapshot()
+	info.Metrics = &metrics
 	return info, nil
 }
 
@@ -291,10 +582,12 @@ func (m *MeshPluginManager) ReloadPlugin(name string) error {
 	// Save the spec for reloading
 	spec := mp.spec
 
-	// Unload the plugin
-	if err := m.UnloadPlugin(name); err != nil {
-		return fmt.Errorf("failed to unload plugin: %w", err)
+	// Unload the plugin, keeping its dependents loaded
+	m.mu.Lock()
+	if mp, exists := m.plugins[name]; exists {
+		m.unloadPlugin(name, mp)
 	}
+	m.mu.Unlock()
 
 	// Reload the plugin
 	if err := m.LoadPlugin(spec); err != nil {
@@ -304,21 +597,114 @@ func (m *MeshPluginManager) ReloadPlugin(name string) error {
 	return nil
 }
 
-// HotSwapPlugin performs a hot swap of a plugin to a new version
+// HotSwapPlugin swaps a plugin for a new version without unloading it.
+// Requests are held while the old version drains and resume on the new one;
+// if the new version fails to start or its health check, the old version is
+// restarted with the state it had.
 func (m *MeshPluginManager) HotSwapPlugin(name string, newVersion string) error {
-	// This would involve:
-	// 1. Loading the new version
-	// 2. Exporting state from old version
-	// 3. Importing state to new version
-	// 4. Switching mesh routing
-	// 5. Stopping old version
-	
-	// For now, return not implemented
-	return fmt.Errorf("hot swap not yet implemented for mesh plugins")
+	m.mu.RLock()
+	mp, exists := m.plugins[name]
+	hotSwapper := m.hotSwapper
+	m.mu.RUnlock()
+
+	if !exists {
+		return ErrPluginNotFound
+	}
+	if hotSwapper == nil {
+		return ErrHotSwapUnavailable
+	}
+
+	newSpec := mp.spec
+	newSpec.Version = newVersion
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Requests held by the swap must not wait on a swap that gave up
+	if m.protocolRouter != nil {
+		defer m.protocolRouter.Resume(mp.serviceName)
+	}
+
+	m.logger.Info("Hot-swapping plugin",
+		zap.String("name", name),
+		zap.String("from", mp.spec.Version),
+		zap.String("to", newVersion))
+
+	if err := hotSwapper.HotSwap(ctx, name, newSpec); err != nil {
+		return err
+	}
+
+	m.logger.Info("Plugin hot-swapped",
+		zap.String("name", name),
+		zap.String("version", newVersion))
+	return nil
 }
 
 // Private helper methods
 
+// meshCaller is implemented by plugins that call other services through the
+// mesh ingress, which identifies them by process or token
+type meshCaller interface {
+	SetMeshToken(token string)
+	PID() int
+}
+
+// authorizeCaller sets what a plugin may call through the mesh and issues
+// the token it identifies itself with
+func (m *MeshPluginManager) authorizeCaller(mp *ManagedMeshPlugin) error {
+	if m.protocolRouter == nil {
+		return nil
+	}
+
+	grants := callerGrants(mp.spec, mp.serviceName)
+	m.protocolRouter.SetCallerGrants(mp.spec.Name, grants)
+
+	if caller, ok := mp.plugin.(meshCaller); ok {
+		token, err := m.protocolRouter.IssueCallerToken(mp.spec.Name)
+		if err != nil {
+			m.protocolRouter.ReleaseCaller(mp.spec.Name)
+			return err
+		}
+		caller.SetMeshToken(token)
+		mp.token = token
+	}
+
+	services := make([]string, len(grants))
+	for i, grant := range grants {
+		services[i] = grant.Service
+	}
+	m.logger.Info("Authorized plugin calls",
+		zap.String("name", mp.spec.Name),
+		zap.Strings("services", services))
+	return nil
+}
+
+func (m *MeshPluginManager) releaseCaller(name string) {
+	if m.protocolRouter != nil {
+		m.protocolRouter.ReleaseCaller(name)
+	}
+}
+
+// callerGrants derives the services a plugin may call: its own, and with
+// the other_plugins permission, the plugins it depends on and the ones it
+// was explicitly granted
+func callerGrants(spec PluginSpec, ownService string) []routing.Grant {
+	grants := []routing.Grant{{Service: ownService}}
+	if !HasPermission(spec.Permissions, PermissionOtherPlugins) {
+		return grants
+	}
+	for _, dep := range spec.Dependencies {
+		grants = append(grants, routing.Grant{Service: fmt.Sprintf("plugin.%s", dep.Name)})
+	}
+	for _, grant := range spec.Grants {
+		grants = append(grants, routing.Grant{
+			Service: fmt.Sprintf("plugin.%s", grant.Plugin),
+			Methods: grant.Methods,
+		})
+	}
+	return grants
+}
+
 func (m *MeshPluginManager) waitForPluginRegistration(ctx context.Context, mp *ManagedMeshPlugin) error {
 	// Wait for the plugin to register itself with the mesh network
 	ticker := time.NewTicker(100 * time.Millisecond)
@@ -340,6 +726,47 @@ func (m *MeshPluginManager) waitForPluginRegistration(ctx context.Context, mp *M
 }
 
 func (m *MeshPluginManager) connectToPlugin(ctx context.Context, mp *ManagedMeshPlugin) error {
+	if !servesMesh(mp) {
+		return nil
+	}
+	if err := m.dialPlugin(ctx, mp); err != nil {
+		return err
+	}
+
+	// Register the plugin's endpoint with protocol router
+	if m.protocolRouter != nil {
+		err := m.protocolRouter.RegisterService(mp.serviceName, mp.endpoint)
+		if err != nil {
+			mp.grpcConn.Close()
+			return fmt.Errorf("failed to register with protocol router: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// servesMesh reports whether a plugin serves on a mesh socket. WebAssembly
+// plugins run inside the node and are only called through the manager.
+func servesMesh(mp *ManagedMeshPlugin) bool {
+	return mp.spec.Isolation != IsolationWASM
+}
+
+// dialPlugin connects to the plugin's socket
+func (m *MeshPluginManager) dialPlugin(ctx context.Context, mp *ManagedMeshPlugin) error {
+	conn, endpoint, err := m.dial(ctx, mp)
+	if err != nil {
+		return err
+	}
+	mp.grpcConn = conn
+	mp.endpoint = endpoint
+	return nil
+}
+
+// dial connects to the socket a plugin serves on, if it serves the mesh
+func (m *MeshPluginManager) dial(ctx context.Context, mp *ManagedMeshPlugin) (*grpc.ClientConn, mesh.ServiceEndpoint, error) {
+	if !servesMesh(mp) {
+		return nil, mesh.ServiceEndpoint{}, nil
+	}
 	// Connect to the plugin via mesh network
 	
 	// In a real implementation, this would:
@@ -348,7 +775,10 @@ func (m *MeshPluginManager) connectToPlugin(ctx context.Context, mp *ManagedMesh
 	// 3. Verify plugin is responsive
 	
 	// For now, we'll simulate this
-	socketPath := fmt.Sprintf("%s/%s.sock", m.socketDir, mp.spec.Name)
+	socketPath := mp.socket
+	if socketPath == "" {
+		socketPath = fmt.Sprintf("%s/%s.sock", m.socketDir, mp.spec.Name)
+	}
 	
 	conn, err := grpc.DialContext(ctx,
 		fmt.Sprintf("unix://%s", socketPath),
@@ -356,25 +786,13 @@ func (m *MeshPluginManager) connectToPlugin(ctx context.Context, mp *ManagedMesh
 		grpc.WithBlock(),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to connect to plugin socket: %w", err)
+		return nil, mesh.ServiceEndpoint{}, fmt.Errorf("failed to connect to plugin socket: %w", err)
 	}
 
-	mp.grpcConn = conn
-	mp.endpoint = mesh.ServiceEndpoint{
+	return conn, mesh.ServiceEndpoint{
 		Socket:  socketPath,
 		IsLocal: true,
-	}
-
-	// Register the plugin's endpoint with protocol router
-	if m.protocolRouter != nil {
-		err = m.protocolRouter.RegisterService(mp.serviceName, mp.endpoint)
-		if err != nil {
-			conn.Close()
-			return fmt.Errorf("failed to register with protocol router: %w", err)
-		}
-	}
-
-	return nil
+	}, nil
 }
 
 // ExportPluginState exports state from a plugin
@@ -0,0 +1,88 @@
+package plugins
+
+import "sort"
+
+// PluginMetrics returns the request metrics of a loaded plugin
+func (m *MeshPluginManager) PluginMetrics(name string) (PluginMetrics, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mp, exists := m.plugins[name]
+	if !exists {
+		return PluginMetrics{}, ErrPluginNotFound
+	}
+	return mp.metrics.snapshot(), nil
+}
+
+// AllPluginMetrics returns the request metrics of every loaded plugin,
+// sorted by name
+func (m *MeshPluginManager) AllPluginMetrics() []PluginMetrics {
+	m.mu.RLock()
+	all := make([]PluginMetrics, 0, len(m.plugins))
+	for _, mp := range m.plugins {
+		all = append(all, mp.metrics.snapshot())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i].Plugin < all[j].Plugin })
+	return all
+}
+
+// routeMetrics records the requests the router proxies to a plugin in the
+// metrics of the version serving them
+type routeMetrics struct {
+	manager *MeshPluginManager
+}
+
+// BeginRequest implements routing.RouteObserver
+func (r routeMetrics) BeginRequest(serviceName, version, fullMethod string) func(error) {
+	recorder := r.manager.routedMetrics(serviceName, version)
+	if recorder == nil {
+		return func(error) {}
+	}
+	return recorder.begin(fullMethod)
+}
+
+// routedMetrics returns the metrics of the plugin version serving requests
+// the router sends to version of serviceName, nil if no plugin serves it
+func (m *MeshPluginManager) routedMetrics(serviceName, version string) *metricsRecorder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for name, mp := range m.plugins {
+		if mp.serviceName != serviceName {
+			continue
+		}
+		if r, exists := m.rollouts[name]; exists && r.active() && version == r.split.Canary() {
+			return r.canary.metrics
+		}
+		return mp.metrics
+	}
+	return nil
+}
+
+// PluginMetrics returns the request metrics of a loaded plugin
+func (m *pluginManager) PluginMetrics(name string) (PluginMetrics, error) {
+	m.mu.RLock()
+	mp, exists := m.plugins[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return PluginMetrics{}, ErrPluginNotFound
+	}
+	return mp.recorder().snapshot(), nil
+}
+
+// AllPluginMetrics returns the request metrics of every loaded plugin,
+// sorted by name
+func (m *pluginManager) AllPluginMetrics() []PluginMetrics {
+	m.mu.RLock()
+	all := make([]PluginMetrics, 0, len(m.plugins))
+	for _, mp := range m.plugins {
+		all = append(all, mp.recorder().snapshot())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i].Plugin < all[j].Plugin })
+	return all
+}
@@ -0,0 +1,629 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+var (
+	// ErrRolloutInProgress is returned when a plugin is already being
+	// rolled out to another version
+	ErrRolloutInProgress = errors.New("rollout already in progress")
+	// ErrNoRollout is returned when a plugin has no rollout in progress
+	ErrNoRollout = errors.New("no rollout in progress")
+)
+
+// RolloutPolicy describes how traffic is shifted to a new plugin version and
+// when the rollout is aborted. Each step sends a percentage of requests to
+// the new version for at least StepInterval, after which the new version's
+// error rate and p99 latency are compared with the old version's. Requests
+// pinned to a version with the x-plugin-version header don't count towards
+// the weights.
+type RolloutPolicy struct {
+	// Steps are the percentages of traffic sent to the new version, ending
+	// at 100; {0, 100} is a blue/green rollout
+	Steps []int
+	// StepInterval is how long each step is observed
+	StepInterval time.Duration
+	// MinRequests is how many requests each version needs to serve in a
+	// step for it to be judged. Steps are held for further intervals until
+	// each version they send traffic to has served as many; the new version
+	// is judged against the last step the old version did.
+	MinRequests int
+	// MaxErrorRateIncrease is how much higher the new version's error rate
+	// may be than the old version's, as a fraction of requests
+	MaxErrorRateIncrease float64
+	// MaxLatencyRatio is how many times the old version's p99 latency the
+	// new version's may be
+	MaxLatencyRatio float64
+	// LatencySlack is how far the new version's p99 latency may go past
+	// MaxLatencyRatio, so that differences too small to matter, such as
+	// between two versions answering in microseconds, don't abort it
+	LatencySlack time.Duration
+}
+
+// DefaultRolloutPolicy returns the policy used for zero fields
+func DefaultRolloutPolicy() RolloutPolicy {
+	return RolloutPolicy{
+		Steps:                []int{5, 25, 100},
+		StepInterval:         time.Minute,
+		MinRequests:          20,
+		MaxErrorRateIncrease: 0.05,
+		MaxLatencyRatio:      1.5,
+		LatencySlack:         time.Millisecond,
+	}
+}
+
+// withDefaults fills zero fields from DefaultRolloutPolicy and checks the
+// steps
+func (p RolloutPolicy) withDefaults() (RolloutPolicy, error) {
+	defaults := DefaultRolloutPolicy()
+	if len(p.Steps) == 0 {
+		p.Steps = defaults.Steps
+	}
+	if p.StepInterval <= 0 {
+		p.StepInterval = defaults.StepInterval
+	}
+	if p.MinRequests <= 0 {
+		p.MinRequests = defaults.MinRequests
+	}
+	if p.MaxErrorRateIncrease <= 0 {
+		p.MaxErrorRateIncrease = defaults.MaxErrorRateIncrease
+	}
+	if p.MaxLatencyRatio <= 0 {
+		p.MaxLatencyRatio = defaults.MaxLatencyRatio
+	}
+	if p.LatencySlack <= 0 {
+		p.LatencySlack = defaults.LatencySlack
+	}
+
+	last := 0
+	for _, weight := range p.Steps {
+		if weight < last || weight > 100 {
+			return p, fmt.Errorf("invalid rollout steps %v: weights must rise from 0 to 100", p.Steps)
+		}
+		last = weight
+	}
+	if last != 100 {
+		return p, fmt.Errorf("invalid rollout steps %v: the last step must be 100", p.Steps)
+	}
+	return p, nil
+}
+
+// judge compares what the new version served in a step with the old
+// version's baseline, returning why the rollout should be aborted
+func (p RolloutPolicy) judge(baseline, canary RequestMetrics) error {
+	if canary.Requests < uint64(p.MinRequests) {
+		return nil
+	}
+	if canary.ErrorRate()-baseline.ErrorRate() > p.MaxErrorRateIncrease {
+		return fmt.Errorf("error rate %.1f%% against %.1f%%",
+			canary.ErrorRate()*100, baseline.ErrorRate()*100)
+	}
+	allowed := time.Duration(float64(baseline.Latency.P99)*p.MaxLatencyRatio) + p.LatencySlack
+	if baseline.Requests > 0 && canary.Latency.P99 > allowed {
+		return fmt.Errorf("p99 latency %s against %s", canary.Latency.P99, baseline.Latency.P99)
+	}
+	return nil
+}
+
+// RolloutPhase is where a rollout is
+type RolloutPhase string
+
+const (
+	RolloutProgressing RolloutPhase = "progressing"
+	RolloutPromoted    RolloutPhase = "promoted"
+	RolloutAborted     RolloutPhase = "aborted"
+)
+
+// RolloutStatus reports a plugin's latest rollout
+type RolloutStatus struct {
+	Plugin        string
+	StableVersion string
+	CanaryVersion string
+	Phase         RolloutPhase
+	// Weight is the percentage of traffic sent to the new version
+	Weight int
+	// Reason says why the rollout was aborted
+	Reason string
+	// Stable and Canary are what each version served in the current step
+	Stable RequestMetrics
+	Canary RequestMetrics
+}
+
+// rollout is a new version of a plugin running alongside the active one
+type rollout struct {
+	canary *ManagedMeshPlugin
+	split  *routing.Split
+	policy RolloutPolicy
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Guarded by the manager's mu
+	phase     RolloutPhase
+	reason    string
+	finishing bool
+	// What each version had served when the current step started
+	stableFrom requestCounter
+	canaryFrom requestCounter
+}
+
+// active reports whether the rollout still splits traffic
+func (r *rollout) active() bool {
+	return r.phase == RolloutProgressing
+}
+
+// startStep moves a rollout to the next weight and starts counting what
+// each version serves in it. Callers must hold m.mu.
+func (r *rollout) startStep(stable *ManagedMeshPlugin, weight int) {
+	r.split.SetWeight(weight)
+	r.stableFrom = stable.metrics.counts()
+	r.canaryFrom = r.canary.metrics.counts()
+}
+
+// step returns what each version has served in the current step. Callers
+// must hold m.mu.
+func (r *rollout) step(stable *ManagedMeshPlugin) (RequestMetrics, RequestMetrics) {
+	stableCounts := stable.metrics.counts().sub(r.stableFrom)
+	canaryCounts := r.canary.metrics.counts().sub(r.canaryFrom)
+	return stableCounts.metrics(), canaryCounts.metrics()
+}
+
+// socketBinder is implemented by plugins whose socket can be moved, so two
+// versions of a plugin can serve side by side
+type socketBinder interface {
+	SetSocketPath(path string)
+}
+
+// StartRollout starts version of a plugin alongside the active version and
+// shifts traffic to it as policy describes, promoting it once it takes all
+// traffic or aborting if it does worse than the active version. The active
+// version's state is handed to the new version when it is promoted.
+func (m *MeshPluginManager) StartRollout(name, version string, policy RolloutPolicy) error {
+	policy, err := policy.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	active, exists := m.plugins[name]
+	if exists {
+		err = m.swappable(name, active)
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return ErrPluginNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version == active.spec.Version {
+		return fmt.Errorf("plugin %s is already at version %s", name, version)
+	}
+
+	spec := active.spec
+	spec.Version = version
+	canary, err := m.loadVersion(spec, active)
+	if err != nil {
+		return err
+	}
+	canary.socket = filepath.Join(m.socketDir, fmt.Sprintf("%s-%s.sock", name, version))
+	if binder, ok := canary.plugin.(socketBinder); ok {
+		binder.SetSocketPath(canary.socket)
+	}
+
+	// Keep swaps and other rollouts off the plugin while the new version
+	// starts without the lock
+	m.mu.Lock()
+	if err = m.swappable(name, active); err == nil {
+		active.switching = true
+	}
+	m.mu.Unlock()
+	if err != nil {
+		m.loader.UnloadPlugin(canary.plugin)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = m.startCanary(ctx, active, canary)
+
+	m.mu.Lock()
+	active.switching = false
+	if err != nil {
+		// startCanary has stopped it
+		m.mu.Unlock()
+		return err
+	}
+	split := routing.NewSplit(active.spec.Version, version)
+	if m.plugins[name] != active {
+		// Unloaded while the new version started
+		err = ErrPluginNotFound
+	} else if m.protocolRouter != nil {
+		err = m.protocolRouter.StartCanary(active.serviceName, split, canary.endpoint)
+	}
+	if err != nil {
+		m.mu.Unlock()
+		m.stopCanary(active, canary)
+		return err
+	}
+	defer m.mu.Unlock()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	r := &rollout{
+		canary: canary,
+		split:  split,
+		policy: policy,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		phase:  RolloutProgressing,
+	}
+	r.startStep(active, 0)
+	m.rollouts[name] = r
+	go m.runRollout(ctx, name, r)
+
+	m.logger.Info("Started plugin rollout",
+		zap.String("name", name),
+		zap.String("from", active.spec.Version),
+		zap.String("to", version),
+		zap.Ints("steps", policy.Steps))
+	return nil
+}
+
+// RolloutStatus returns the status of a plugin's latest rollout
+func (m *MeshPluginManager) RolloutStatus(name string) (RolloutStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, exists := m.rollouts[name]
+	if !exists {
+		return RolloutStatus{}, ErrNoRollout
+	}
+	var stable, canary RequestMetrics
+	if mp, exists := m.plugins[name]; exists && r.active() {
+		stable, canary = r.step(mp)
+	}
+	return RolloutStatus{
+		Plugin:        name,
+		StableVersion: r.split.Stable(),
+		CanaryVersion: r.split.Canary(),
+		Phase:         r.phase,
+		Weight:        r.split.Weight(),
+		Reason:        r.reason,
+		Stable:        stable,
+		Canary:        canary,
+	}, nil
+}
+
+// PromoteRollout promotes a plugin's new version without waiting for the
+// remaining steps
+func (m *MeshPluginManager) PromoteRollout(name string) error {
+	r, err := m.stopRollout(name)
+	if err != nil {
+		return err
+	}
+	return m.finishRollout(name, r, true, "")
+}
+
+// AbortRollout stops a plugin's new version and sends all traffic back to
+// the active version
+func (m *MeshPluginManager) AbortRollout(name string) error {
+	r, err := m.stopRollout(name)
+	if err != nil {
+		return err
+	}
+	return m.finishRollout(name, r, false, "aborted by operator")
+}
+
+// stopRollout stops stepping a plugin's rollout
+func (m *MeshPluginManager) stopRollout(name string) (*rollout, error) {
+	m.mu.RLock()
+	r, exists := m.rollouts[name]
+	m.mu.RUnlock()
+	if !exists || !r.active() {
+		return nil, ErrNoRollout
+	}
+	r.cancel()
+	<-r.done
+	return r, nil
+}
+
+// runRollout steps a rollout through its policy until it is promoted,
+// aborted or ctx ends
+func (m *MeshPluginManager) runRollout(ctx context.Context, name string, r *rollout) {
+	defer close(r.done)
+
+	// The active version's metrics from the last step it served enough
+	// requests in; once the new version takes all traffic it is judged
+	// against these
+	var baseline RequestMetrics
+	for _, weight := range r.policy.Steps {
+		m.mu.Lock()
+		stable, exists := m.plugins[name]
+		if !exists || !r.active() {
+			m.mu.Unlock()
+			return
+		}
+		r.startStep(stable, weight)
+		m.mu.Unlock()
+		m.logger.Info("Shifting plugin traffic",
+			zap.String("name", name),
+			zap.String("version", r.split.Canary()),
+			zap.Int("weight", weight))
+
+		// Hold the step until the versions it sends traffic to have served
+		// enough requests to be judged
+		var canary RequestMetrics
+		for {
+			timer := time.NewTimer(r.policy.StepInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			m.mu.RLock()
+			var stableStep RequestMetrics
+			if stable, exists := m.plugins[name]; exists {
+				stableStep, canary = r.step(stable)
+			}
+			m.mu.RUnlock()
+			if stableStep.Requests >= uint64(r.policy.MinRequests) {
+				baseline = stableStep
+			}
+			stableJudged := weight == 100 || stableStep.Requests >= uint64(r.policy.MinRequests)
+			canaryJudged := weight == 0 || canary.Requests >= uint64(r.policy.MinRequests)
+			if stableJudged && canaryJudged {
+				break
+			}
+			m.logger.Info("Waiting for requests to judge plugin rollout step",
+				zap.String("name", name),
+				zap.Int("weight", weight),
+				zap.Uint64("stable_requests", stableStep.Requests),
+				zap.Uint64("canary_requests", canary.Requests),
+				zap.Int("needed", r.policy.MinRequests))
+		}
+
+		if err := r.policy.judge(baseline, canary); err != nil {
+			m.finishRollout(name, r, false, err.Error())
+			return
+		}
+	}
+	m.finishRollout(name, r, true, "")
+}
+
+// finishRollout promotes or aborts a rollout. Requests to the plugin are
+// held while it finishes, so none reach a version being stopped. The
+// versions are only talked to without holding m.mu.
+func (m *MeshPluginManager) finishRollout(name string, r *rollout, promote bool, reason string) error {
+	m.mu.Lock()
+	stable, exists := m.plugins[name]
+	if !exists || m.rollouts[name] != r || !r.active() || r.finishing {
+		m.mu.Unlock()
+		return ErrNoRollout
+	}
+	r.finishing = true
+	serviceName := r.canary.serviceName
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if m.protocolRouter != nil {
+		defer m.protocolRouter.Resume(serviceName)
+		if err := m.protocolRouter.Drain(ctx, serviceName); err != nil && promote {
+			promote, reason = false, err.Error()
+		}
+	}
+	var promoteErr error
+	if promote {
+		if promoteErr = m.handOffState(stable, r.canary); promoteErr != nil {
+			promote, reason = false, promoteErr.Error()
+		}
+	}
+
+	m.mu.Lock()
+	// The plugin may have been unloaded meanwhile
+	if m.plugins[name] != stable || m.rollouts[name] != r || !r.active() {
+		m.mu.Unlock()
+		return ErrNoRollout
+	}
+	retired := r.canary
+	if promote {
+		if promoteErr = m.promoteRollout(name, r); promoteErr == nil {
+			retired = stable
+		} else {
+			reason = promoteErr.Error()
+		}
+	}
+	if retired == r.canary {
+		m.abortRollout(name, r, reason)
+	}
+	m.mu.Unlock()
+
+	m.retireVersion(retired)
+	return promoteErr
+}
+
+// handOffState moves the active version's state to the new version
+func (m *MeshPluginManager) handOffState(stable, canary *ManagedMeshPlugin) error {
+	state, err := stable.plugin.ExportState()
+	if errors.Is(err, ErrStateNotSupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export plugin state: %w", err)
+	}
+	if state != nil {
+		if err := canary.plugin.ImportState(state); err != nil {
+			return fmt.Errorf("failed to hand off plugin state: %w", err)
+		}
+	}
+	return nil
+}
+
+// promoteRollout makes a rollout's new version the active version, once
+// handOffState has given it the active version's state. The old version is
+// left for the caller to stop with retireVersion. Callers must hold m.mu.
+func (m *MeshPluginManager) promoteRollout(name string, r *rollout) error {
+	stable := m.plugins[name]
+	canary := r.canary
+
+	if m.protocolRouter != nil {
+		if err := m.protocolRouter.PromoteCanary(canary.serviceName); err != nil {
+			return err
+		}
+		m.revokeCaller(stable)
+		m.protocolRouter.SetCallerGrants(name, callerGrants(canary.spec, canary.serviceName))
+	}
+
+	m.plugins[name] = canary
+	r.phase = RolloutPromoted
+
+	if m.lifecycle != nil {
+		if err := m.lifecycle.OnPluginUnload(stable.plugin); err != nil {
+			m.logger.Warn("Lifecycle onunload failed", zap.Error(err))
+		}
+		if err := m.lifecycle.OnPluginLoad(canary.plugin); err != nil {
+			m.logger.Warn("Lifecycle onload failed", zap.Error(err))
+		}
+	}
+	if m.registry != nil {
+		if err := m.registry.RecordInstall(installedVersion(canary.spec)); err != nil {
+			m.logger.Warn("Failed to record plugin install",
+				zap.String("name", name),
+				zap.Error(err))
+		}
+	}
+
+	m.logger.Info("Promoted plugin version",
+		zap.String("name", name),
+		zap.String("version", canary.spec.Version),
+		zap.String("previous", stable.spec.Version))
+	return nil
+}
+
+// abortRollout sends all traffic back to the active version and withdraws
+// the new version's mesh identity. The new version is left for the caller
+// to stop with retireVersion. Callers must hold m.mu.
+func (m *MeshPluginManager) abortRollout(name string, r *rollout, reason string) {
+	r.cancel()
+	r.phase = RolloutAborted
+	r.reason = reason
+
+	active := m.plugins[name]
+	if m.protocolRouter != nil {
+		m.protocolRouter.AbortCanary(r.canary.serviceName)
+	}
+	m.withdrawCanary(active, r.canary)
+
+	m.logger.Warn("Aborted plugin rollout",
+		zap.String("name", name),
+		zap.String("version", r.canary.spec.Version),
+		zap.String("reason", reason))
+}
+
+// routeRollout picks the version of a plugin a request goes to while the
+// plugin is rolled out. Callers must hold m.mu.
+func (m *MeshPluginManager) routeRollout(name string, mp *ManagedMeshPlugin, request PluginRequest) *ManagedMeshPlugin {
+	r, exists := m.rollouts[name]
+	if !exists || !r.active() {
+		return mp
+	}
+	if r.split.Pick(request.Context.Headers[protocol.MetadataPluginVersion]) == r.split.Canary() {
+		return r.canary
+	}
+	return mp
+}
+
+// startCanary starts a new version of a plugin next to the active one,
+// identifying it to the mesh as the same plugin. The new version isn't
+// reachable until it is added to the plugin's rollout, so callers must not
+// hold m.mu.
+func (m *MeshPluginManager) startCanary(ctx context.Context, active, canary *ManagedMeshPlugin) error {
+	name := canary.spec.Name
+	if m.protocolRouter != nil {
+		// While both versions run, the plugin may call what either may
+		grants := append(callerGrants(active.spec, active.serviceName), callerGrants(canary.spec, canary.serviceName)...)
+		m.protocolRouter.SetCallerGrants(name, grants)
+		if caller, ok := canary.plugin.(meshCaller); ok {
+			token, err := m.protocolRouter.AddCallerToken(name)
+			if err != nil {
+				m.protocolRouter.SetCallerGrants(name, callerGrants(active.spec, active.serviceName))
+				m.loader.UnloadPlugin(canary.plugin)
+				return err
+			}
+			caller.SetMeshToken(token)
+			canary.token = token
+		}
+	}
+
+	if err := canary.plugin.Start(ctx); err != nil {
+		m.stopCanary(active, canary)
+		return fmt.Errorf("failed to start plugin: %w", err)
+	}
+	if caller, ok := canary.plugin.(meshCaller); ok && m.protocolRouter != nil && caller.PID() > 0 {
+		m.protocolRouter.AddCallerPID(name, caller.PID())
+	}
+
+	if err := canary.plugin.HealthCheck(); err != nil {
+		m.stopCanary(active, canary)
+		return fmt.Errorf("plugin %s %s failed its health check: %w", name, canary.spec.Version, err)
+	}
+	if err := m.dialPlugin(ctx, canary); err != nil {
+		m.stopCanary(active, canary)
+		return err
+	}
+	canary.startTime = time.Now()
+	return nil
+}
+
+// stopCanary withdraws a new version of a plugin from the mesh and stops and
+// unloads it, leaving the active version's identity. Callers must not hold
+// m.mu.
+func (m *MeshPluginManager) stopCanary(active, canary *ManagedMeshPlugin) {
+	m.withdrawCanary(active, canary)
+	m.retireVersion(canary)
+}
+
+// withdrawCanary withdraws the process and token a new version of a plugin
+// is identified to the mesh by, leaving the active version's
+func (m *MeshPluginManager) withdrawCanary(active, canary *ManagedMeshPlugin) {
+	if m.protocolRouter != nil {
+		m.revokeCaller(canary)
+		m.protocolRouter.SetCallerGrants(active.spec.Name, callerGrants(active.spec, active.serviceName))
+	}
+}
+
+// retireVersion stops and unloads a version of a plugin that no longer
+// serves requests
+func (m *MeshPluginManager) retireVersion(mp *ManagedMeshPlugin) {
+	if mp.grpcConn != nil {
+		mp.grpcConn.Close()
+	}
+	if err := mp.plugin.Stop(context.Background()); err != nil {
+		m.logger.Warn("Error stopping plugin", zap.Error(err))
+	}
+	if err := m.loader.UnloadPlugin(mp.plugin); err != nil {
+		m.logger.Warn("Error unloading plugin", zap.Error(err))
+	}
+}
+
+// revokeCaller withdraws the process and token one version of a plugin is
+// identified to the mesh by
+func (m *MeshPluginManager) revokeCaller(mp *ManagedMeshPlugin) {
+	pid := 0
+	if caller, ok := mp.plugin.(meshCaller); ok {
+		pid = caller.PID()
+	}
+	m.protocolRouter.RevokeCallerIdentity(pid, mp.token)
+}
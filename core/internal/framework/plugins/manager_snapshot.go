@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// PluginSpecs returns the specs of the loaded plugins, each after the
+// plugins it depends on
+func (m *MeshPluginManager) PluginSpecs() []PluginSpec {
+	m.mu.RLock()
+	specs := m.loadedSpecs()
+	m.mu.RUnlock()
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	batch := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		batch[spec.Name] = i
+	}
+	ordered, err := sortByDependencies(specs, batch)
+	if err != nil {
+		// Loaded plugins were resolved without cycles
+		return specs
+	}
+	return ordered
+}
+
+// Quiesce holds new requests to every plugin and waits for those in flight
+// to finish, draining plugins before the plugins they depend on so calls
+// between them can complete. Calling the returned function lets the held
+// requests proceed. It fails while a plugin is being hot-swapped, which
+// drains and resumes the plugin itself.
+func (m *MeshPluginManager) Quiesce(ctx context.Context) (func(), error) {
+	if m.protocolRouter == nil {
+		return func() {}, nil
+	}
+
+	m.mu.RLock()
+	swapping := len(m.standby) > 0
+	m.mu.RUnlock()
+	if swapping {
+		return nil, ErrHotSwapInProgress
+	}
+
+	specs := m.PluginSpecs()
+	resume := func() {
+		for _, spec := range specs {
+			m.protocolRouter.Resume(fmt.Sprintf("plugin.%s", spec.Name))
+		}
+	}
+	for i := len(specs) - 1; i >= 0; i-- {
+		if err := m.protocolRouter.Drain(ctx, fmt.Sprintf("plugin.%s", specs[i].Name)); err != nil {
+			resume()
+			return nil, err
+		}
+	}
+	return resume, nil
+}
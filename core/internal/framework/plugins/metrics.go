@@ -0,0 +1,340 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/base"
+)
+
+// Latency histograms count requests in buckets whose upper bounds double
+// from latencyBase, with a last bucket for anything slower
+const (
+	latencyBase    = 50 * time.Microsecond
+	latencyBuckets = 24 // up to about 7 minutes
+)
+
+// maxTrackedMethods bounds the methods counted separately per plugin;
+// requests for further methods are counted under OtherMethods
+const maxTrackedMethods = 64
+
+// OtherMethods is the method requests are counted under once a plugin has
+// served maxTrackedMethods other methods
+const OtherMethods = "_other"
+
+// LatencySummary summarizes the latency of requests
+type LatencySummary struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// RequestMetrics counts requests and how long they took
+type RequestMetrics struct {
+	Requests  uint64         `json:"requests"`
+	Successes uint64         `json:"successes"`
+	Failures  uint64         `json:"failures"`
+	Latency   LatencySummary `json:"latency"`
+}
+
+// ErrorRate returns the fraction of requests that failed
+func (m RequestMetrics) ErrorRate() float64 {
+	if m.Requests == 0 {
+		return 0
+	}
+	return float64(m.Failures) / float64(m.Requests)
+}
+
+// PluginMetrics are the request metrics of a plugin version since it was
+// loaded. Reloading or swapping the plugin starts them over.
+type PluginMetrics struct {
+	Plugin  string    `json:"plugin"`
+	Version string    `json:"version"`
+	Since   time.Time `json:"since"`
+
+	RequestMetrics
+	Methods map[string]RequestMetrics `json:"methods"`
+
+	InFlight      int64     `json:"in_flight"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// Base describes the metrics as the plugin SDK does, together with the
+// resources the plugin uses
+func (m PluginMetrics) Base(usage PluginResourceUsage) base.PluginMetrics {
+	return base.PluginMetrics{
+		StartTime:        m.Since,
+		RequestsHandled:  int64(m.Requests),
+		RequestsFailed:   int64(m.Failures),
+		AverageLatencyMs: float64(m.Latency.Mean) / float64(time.Millisecond),
+		MemoryUsageMB:    float64(usage.Memory) / (1 << 20),
+		CPUUsagePercent:  usage.CPU,
+	}
+}
+
+// ResourceReporter is implemented by plugins that can tell what resources
+// they use, such as those running in a process of their own
+type ResourceReporter interface {
+	ResourceUsage() (PluginResourceUsage, error)
+}
+
+// resourceUsage returns the resources plugin reports using, none if it
+// can't tell
+func resourceUsage(plugin Plugin) PluginResourceUsage {
+	reporter, ok := plugin.(ResourceReporter)
+	if !ok {
+		return PluginResourceUsage{}
+	}
+	usage, err := reporter.ResourceUsage()
+	if err != nil {
+		return PluginResourceUsage{}
+	}
+	return usage
+}
+
+// MetricsSource provides the request metrics of loaded plugins. Both plugin
+// managers are one.
+type MetricsSource interface {
+	PluginMetrics(name string) (PluginMetrics, error)
+	AllPluginMetrics() []PluginMetrics
+}
+
+// MetricsHandler serves the metrics of every plugin as JSON, or of one
+// plugin with ?plugin=<name>
+func MetricsHandler(source MetricsSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body interface{}
+		if name := r.URL.Query().Get("plugin"); name != "" {
+			metrics, err := source.PluginMetrics(name)
+			if errors.Is(err, ErrPluginNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			body = metrics
+		} else {
+			body = source.AllPluginMetrics()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// metricsRecorder records the requests a plugin version serves
+type metricsRecorder struct {
+	plugin   string
+	version  string
+	since    time.Time
+	inFlight atomic.Int64
+
+	mu            sync.Mutex
+	total         requestCounter
+	methods       map[string]*requestCounter
+	lastErrorTime time.Time
+	lastError     string
+}
+
+func newMetricsRecorder(spec PluginSpec) *metricsRecorder {
+	return &metricsRecorder{
+		plugin:  spec.Name,
+		version: spec.Version,
+		since:   time.Now(),
+		methods: make(map[string]*requestCounter),
+	}
+}
+
+// begin counts a request as in flight. Calling the returned function
+// records its outcome.
+func (r *metricsRecorder) begin(method string) func(err error) {
+	start := time.Now()
+	r.inFlight.Add(1)
+	return func(err error) {
+		r.inFlight.Add(-1)
+		r.record(method, time.Since(start), err)
+	}
+}
+
+// record counts a finished request
+func (r *metricsRecorder) record(method string, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counter, exists := r.methods[method]
+	if !exists {
+		if len(r.methods) >= maxTrackedMethods {
+			method = OtherMethods
+			counter = r.methods[method]
+		}
+		if counter == nil {
+			counter = &requestCounter{}
+			r.methods[method] = counter
+		}
+	}
+	r.total.add(latency, err)
+	counter.add(latency, err)
+
+	if err != nil {
+		r.lastErrorTime = time.Now()
+		r.lastError = err.Error()
+	}
+}
+
+// snapshot returns the metrics recorded so far
+func (r *metricsRecorder) snapshot() PluginMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics := PluginMetrics{
+		Plugin:         r.plugin,
+		Version:        r.version,
+		Since:          r.since,
+		RequestMetrics: r.total.metrics(),
+		Methods:        make(map[string]RequestMetrics, len(r.methods)),
+		InFlight:       r.inFlight.Load(),
+		LastErrorTime:  r.lastErrorTime,
+		LastError:      r.lastError,
+	}
+	for method, counter := range r.methods {
+		metrics.Methods[method] = counter.metrics()
+	}
+	return metrics
+}
+
+// counts returns a copy of what has been counted over every method, which
+// sub can later take from a newer copy to get the requests in between
+func (r *metricsRecorder) counts() requestCounter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+// requestCounter counts requests by outcome with a latency histogram
+type requestCounter struct {
+	successes uint64
+	failures  uint64
+	latency   latencyHistogram
+}
+
+func (c *requestCounter) add(latency time.Duration, err error) {
+	if err != nil {
+		c.failures++
+	} else {
+		c.successes++
+	}
+	c.latency.add(latency)
+}
+
+// sub returns the requests counted in c but not in earlier, an older copy
+// of the same counter
+func (c requestCounter) sub(earlier requestCounter) requestCounter {
+	c.successes -= earlier.successes
+	c.failures -= earlier.failures
+	c.latency = c.latency.sub(earlier.latency)
+	return c
+}
+
+func (c *requestCounter) metrics() RequestMetrics {
+	return RequestMetrics{
+		Requests:  c.successes + c.failures,
+		Successes: c.successes,
+		Failures:  c.failures,
+		Latency:   c.latency.summary(),
+	}
+}
+
+// latencyHistogram counts latencies in exponential buckets
+type latencyHistogram struct {
+	counts [latencyBuckets + 1]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// latencyBound returns the upper bound of bucket i
+func latencyBound(i int) time.Duration {
+	return latencyBase << i
+}
+
+func (h *latencyHistogram) add(latency time.Duration) {
+	i := sort.Search(latencyBuckets, func(i int) bool { return latency <= latencyBound(i) })
+	h.counts[i]++
+	h.count++
+	h.sum += latency
+	if latency > h.max {
+		h.max = latency
+	}
+}
+
+// sub returns the latencies counted in h but not in earlier, an older copy
+// of the same histogram. The maximum can't be taken apart, so h's is kept
+// as a bound on the others.
+func (h latencyHistogram) sub(earlier latencyHistogram) latencyHistogram {
+	for i := range h.counts {
+		h.counts[i] -= earlier.counts[i]
+	}
+	h.count -= earlier.count
+	h.sum -= earlier.sum
+	if h.count == 0 {
+		h.max = 0
+	}
+	return h
+}
+
+// quantile estimates the latency below which a fraction q of requests
+// fell, interpolating within the bucket it falls in
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := q * float64(h.count)
+	var seen uint64
+	for i, n := range h.counts {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lower, upper := time.Duration(0), h.max
+		if i > 0 {
+			lower = latencyBound(i - 1)
+		}
+		if i < latencyBuckets && latencyBound(i) < upper {
+			upper = latencyBound(i)
+		}
+		estimate := lower + time.Duration((rank-float64(seen))/float64(n)*float64(upper-lower))
+		if estimate > h.max {
+			estimate = h.max
+		}
+		return estimate
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) summary() LatencySummary {
+	if h.count == 0 {
+		return LatencySummary{}
+	}
+	return LatencySummary{
+		Mean: h.sum / time.Duration(h.count),
+		P50:  h.quantile(0.50),
+		P90:  h.quantile(0.90),
+		P99:  h.quantile(0.99),
+		Max:  h.max,
+	}
+}
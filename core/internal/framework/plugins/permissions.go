@@ -0,0 +1,201 @@
+package plugins
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrPermissionsRejected is returned when a plugin's permissions are not
+// approved at install time
+var ErrPermissionsRejected = errors.New("plugin permissions rejected")
+
+// PermissionApprover decides which of the permissions a plugin requests are
+// granted. It is asked once per installed version; the answer is recorded in
+// the registry. Returning an error refuses the install.
+type PermissionApprover interface {
+	ApprovePermissions(spec PluginSpec, requested []PluginPermission) ([]PluginPermission, error)
+}
+
+// PermissionApproverFunc adapts a function to a PermissionApprover
+type PermissionApproverFunc func(spec PluginSpec, requested []PluginPermission) ([]PluginPermission, error)
+
+// ApprovePermissions calls f
+func (f PermissionApproverFunc) ApprovePermissions(spec PluginSpec, requested []PluginPermission) ([]PluginPermission, error) {
+	return f(spec, requested)
+}
+
+// AllPlugins is the PermissionAllowList key whose permissions every plugin
+// may be granted
+const AllPlugins = "*"
+
+// PermissionAllowList is a PermissionApprover that grants a plugin the
+// requested permissions listed under its name or AllPlugins, and denies the
+// rest
+type PermissionAllowList map[string][]PluginPermission
+
+// ApprovePermissions grants the requested permissions on the list
+func (l PermissionAllowList) ApprovePermissions(spec PluginSpec, requested []PluginPermission) ([]PluginPermission, error) {
+	var granted []PluginPermission
+	for _, p := range requested {
+		if HasPermission(l[spec.Name], p) || HasPermission(l[AllPlugins], p) {
+			granted = append(granted, p)
+		}
+	}
+	return granted, nil
+}
+
+// permissionDescriptions say what each permission lets a plugin do
+var permissionDescriptions = map[PluginPermission]string{
+	PermissionFileSystem:   "write outside its data directory",
+	PermissionNetwork:      "use the network",
+	PermissionSystem:       "gain privileges and manage processes",
+	PermissionOtherPlugins: "call other plugins through the mesh",
+	PermissionUserData:     "access user data",
+}
+
+// PromptApprover is a PermissionApprover that shows the permissions a plugin
+// requests and asks whether to grant each one, such as on a terminal.
+// Anything but yes denies the permission.
+type PromptApprover struct {
+	mu  sync.Mutex
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewPromptApprover creates a PromptApprover that asks on out and reads the
+// answers from in
+func NewPromptApprover(in io.Reader, out io.Writer) *PromptApprover {
+	return &PromptApprover{in: bufio.NewReader(in), out: out}
+}
+
+// ApprovePermissions asks about each requested permission in turn. It
+// refuses the install if no answer can be read.
+func (a *PromptApprover) ApprovePermissions(spec PluginSpec, requested []PluginPermission) ([]PluginPermission, error) {
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fmt.Fprintf(a.out, "Plugin %s %s requests %d permission(s):\n", spec.Name, spec.Version, len(requested))
+	var granted []PluginPermission
+	for _, p := range requested {
+		description := permissionDescriptions[p]
+		if description == "" {
+			description = "unknown permission"
+		}
+		fmt.Fprintf(a.out, "  %s: %s. Grant? [y/N] ", p, description)
+
+		answer, err := a.in.ReadString('\n')
+		if err != nil && answer == "" {
+			fmt.Fprintln(a.out)
+			return nil, fmt.Errorf("failed to read answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			granted = append(granted, p)
+		}
+	}
+	return granted, nil
+}
+
+// HasPermission reports whether perms contains p
+func HasPermission(perms []PluginPermission, p PluginPermission) bool {
+	for _, granted := range perms {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionsFromCapabilities maps the capabilities declared in plugin
+// manifests and catalog entries, such as "network", "filesystem:write",
+// "process:spawn" or "mesh.routing", to the permissions they need.
+// Capabilities that need no permission are ignored.
+func PermissionsFromCapabilities(capabilities []string) []PluginPermission {
+	var perms []PluginPermission
+	add := func(p PluginPermission) {
+		if !HasPermission(perms, p) {
+			perms = append(perms, p)
+		}
+	}
+
+	for _, capability := range capabilities {
+		resource := strings.ToLower(strings.TrimSpace(capability))
+		if i := strings.IndexAny(resource, ":."); i >= 0 {
+			resource = resource[:i]
+		}
+		switch resource {
+		case "network":
+			add(PermissionNetwork)
+		case "filesystem":
+			add(PermissionFileSystem)
+		case "system", "process":
+			add(PermissionSystem)
+		case "other_plugins", "plugins", "mesh", "events":
+			add(PermissionOtherPlugins)
+		case "user_data":
+			add(PermissionUserData)
+		}
+	}
+	return perms
+}
+
+// grantPermissions replaces the permissions requested in spec with the ones
+// approved for its version, asking approver the first time the version is
+// installed. Without an approver no permission is granted. It also returns
+// the requested permissions that were denied.
+func grantPermissions(spec PluginSpec, registry PluginRegistry, approver PermissionApprover) (PluginSpec, []PluginPermission, error) {
+	requested := spec.Permissions
+
+	granted, approved := approvedPermissions(spec, registry)
+	if !approved {
+		granted = nil
+		if approver != nil {
+			answer, err := approver.ApprovePermissions(spec, requested)
+			if err != nil {
+				return spec, nil, fmt.Errorf("%w for %s %s: %v", ErrPermissionsRejected, spec.Name, spec.Version, err)
+			}
+			// An approver can only narrow what was requested
+			granted = nil
+			for _, p := range answer {
+				if HasPermission(requested, p) {
+					granted = append(granted, p)
+				}
+			}
+		}
+	}
+
+	var denied []PluginPermission
+	for _, p := range requested {
+		if !HasPermission(granted, p) {
+			denied = append(denied, p)
+		}
+	}
+
+	spec.Permissions = granted
+	return spec, denied, nil
+}
+
+// approvedPermissions returns the permissions recorded for spec's version
+func approvedPermissions(spec PluginSpec, registry PluginRegistry) ([]PluginPermission, bool) {
+	if registry == nil {
+		return nil, false
+	}
+	versions, err := registry.InstalledVersions(spec.Name)
+	if err != nil {
+		return nil, false
+	}
+	for _, v := range versions {
+		if v.Version == spec.Version && !v.ApprovedAt.IsZero() {
+			return v.Permissions, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,289 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+// Catalog is the marketplace catalog served at api/v1/catalog.json
+type Catalog struct {
+	Version string         `json:"version"`
+	Updated time.Time      `json:"updated"`
+	BaseURL string         `json:"baseUrl,omitempty"`
+	Plugins []CatalogEntry `json:"plugins"`
+}
+
+// CatalogEntry describes one plugin in the catalog. It accepts both the
+// published catalog format, where details are nested under "metadata", and
+// the per-plugin manifests in catalog/official.
+type CatalogEntry struct {
+	ID           string                     `json:"id"`
+	Name         string                     `json:"name"`
+	Description  string                     `json:"description"`
+	Version      string                     `json:"version"`
+	Latest       string                     `json:"latest,omitempty"`
+	Category     string                     `json:"category,omitempty"`
+	Categories   []string                   `json:"categories,omitempty"`
+	Keywords     []string                   `json:"keywords,omitempty"`
+	Author       string                     `json:"author,omitempty"`
+	License      string                     `json:"license,omitempty"`
+	Homepage     string                     `json:"homepage,omitempty"`
+	Repository   string                     `json:"repository,omitempty"`
+	Official     bool                       `json:"official,omitempty"`
+	Capabilities []string                   `json:"capabilities,omitempty"`
+	Dependencies []CatalogDependency        `json:"dependencies,omitempty"`
+	Resources    CatalogResources           `json:"resources,omitempty"`
+	Downloads    map[string]CatalogDownload `json:"downloads,omitempty"`
+	Checksums    map[string]string          `json:"checksums,omitempty"`
+	Versions     map[string]CatalogVersion  `json:"versions,omitempty"`
+	Metadata     *CatalogEntry              `json:"metadata,omitempty"`
+}
+
+// CatalogDownload is a downloadable artifact for one platform
+type CatalogDownload struct {
+	URL         string `json:"url"`
+	ChecksumURL string `json:"checksumUrl,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// CatalogVersion holds the artifacts of a specific release when the catalog
+// lists several versions of a plugin
+type CatalogVersion struct {
+	Platforms map[string]CatalogDownload `json:"platforms"`
+	Signature string                     `json:"signature,omitempty"`
+}
+
+// CatalogDependency is a dependency declared in the catalog. It may be written
+// as an object or as a string of the form "name" or "name@constraint".
+type CatalogDependency struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// UnmarshalJSON accepts both the object and the string form
+func (d *CatalogDependency) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		name, version, _ := strings.Cut(s, "@")
+		*d = CatalogDependency{Name: name, Version: version}
+		return nil
+	}
+
+	type plain CatalogDependency
+	var raw struct {
+		plain
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = CatalogDependency(raw.plain)
+	if d.Name == "" {
+		d.Name = raw.ID
+	}
+	return nil
+}
+
+// CatalogResources are resource requests in Kubernetes-style notation
+// such as "500m" CPU and "512Mi" memory
+type CatalogResources struct {
+	CPU     string `json:"cpu,omitempty"`
+	Memory  string `json:"memory,omitempty"`
+	Storage string `json:"storage,omitempty"`
+	Network string `json:"network,omitempty"`
+}
+
+// merged returns the entry with empty fields filled from its metadata
+func (e CatalogEntry) merged() CatalogEntry {
+	if e.Metadata == nil {
+		return e
+	}
+	m := e.Metadata.merged()
+
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&e.Name, m.Name)
+	fill(&e.Description, m.Description)
+	fill(&e.Version, m.Version)
+	fill(&e.Latest, m.Latest)
+	fill(&e.Author, m.Author)
+	fill(&e.License, m.License)
+	fill(&e.Homepage, m.Homepage)
+	fill(&e.Repository, m.Repository)
+	if e.Category == "" && len(m.Categories) > 0 {
+		e.Category = m.Categories[0]
+	}
+	if len(e.Categories) == 0 {
+		e.Categories = m.Categories
+	}
+	if len(e.Keywords) == 0 {
+		e.Keywords = m.Keywords
+	}
+	if len(e.Capabilities) == 0 {
+		e.Capabilities = m.Capabilities
+	}
+	if len(e.Dependencies) == 0 {
+		e.Dependencies = m.Dependencies
+	}
+	if e.Resources == (CatalogResources{}) {
+		e.Resources = m.Resources
+	}
+	if len(e.Versions) == 0 {
+		e.Versions = m.Versions
+	}
+
+	// Artifacts from the top level win, but keep any checksum only the
+	// metadata knows about
+	downloads := make(map[string]CatalogDownload)
+	for platform, d := range m.Downloads {
+		downloads[platform] = d
+	}
+	for platform, d := range e.Downloads {
+		if d.SHA256 == "" {
+			d.SHA256 = downloads[platform].SHA256
+		}
+		downloads[platform] = d
+	}
+	e.Downloads = downloads
+
+	checksums := make(map[string]string)
+	for platform, sum := range m.Checksums {
+		checksums[platform] = sum
+	}
+	for platform, sum := range e.Checksums {
+		checksums[platform] = sum
+	}
+	e.Checksums = checksums
+
+	e.Metadata = nil
+	return e
+}
+
+// release returns the version and artifacts for the requested version, or
+// the current version if version is empty
+func (e CatalogEntry) release(version string) (string, map[string]CatalogDownload, error) {
+	current := e.Version
+	if current == "" {
+		current = e.Latest
+	}
+	if version == "" || version == "latest" {
+		version = current
+	}
+
+	if v, ok := e.Versions[version]; ok && len(v.Platforms) > 0 {
+		return version, v.Platforms, nil
+	}
+	if version == current && len(e.Downloads) > 0 {
+		return version, e.Downloads, nil
+	}
+	return "", nil, fmt.Errorf("%w: %s@%s", ErrArtifactNotFound, e.ID, version)
+}
+
+// toSpec converts a catalog entry into a plugin specification
+func (e CatalogEntry) toSpec(version, hash string) plugins.PluginSpec {
+	spec := plugins.PluginSpec{
+		Name:    e.ID,
+		Version: version,
+		Source: plugins.PluginSource{
+			Type: plugins.SourceTypeMarketplace,
+			Path: e.ID,
+			Hash: hash,
+		},
+		Isolation: plugins.IsolationProcess,
+		Resources: plugins.PluginResources{
+			CPU:     parseCPU(e.Resources.CPU),
+			Memory:  parseMegabytes(e.Resources.Memory),
+			Disk:    parseMegabytes(e.Resources.Storage),
+			Network: parseMegabytes(e.Resources.Network),
+		},
+		Permissions: plugins.PermissionsFromCapabilities(e.Capabilities),
+	}
+	for _, dep := range e.Dependencies {
+		spec.Dependencies = append(spec.Dependencies, plugins.PluginDependency{
+			Name:     dep.Name,
+			Version:  dep.Version,
+			Optional: dep.Optional,
+		})
+	}
+	return spec
+}
+
+// toInfo converts a catalog entry into registry plugin information
+func (e CatalogEntry) toInfo() plugins.PluginInfo {
+	info := plugins.PluginInfo{
+		Name:        e.ID,
+		Version:     e.Version,
+		Description: e.Description,
+		Author:      e.Author,
+		License:     e.License,
+		Homepage:    e.Homepage,
+		Repository:  e.Repository,
+		Category:    e.Category,
+		Keywords:    e.Keywords,
+		Status:      plugins.PluginStatusUnknown,
+	}
+	if info.Version == "" {
+		info.Version = e.Latest
+	}
+	for _, capability := range e.Capabilities {
+		info.Capabilities = append(info.Capabilities, plugins.PluginCapability(capability))
+	}
+	return info
+}
+
+// parseCPU converts "500m" or "2" CPU notation into a percentage of one core
+func parseCPU(s string) int {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	if millis, ok := strings.CutSuffix(s, "m"); ok {
+		n, err := strconv.Atoi(millis)
+		if err != nil {
+			return 0
+		}
+		return n / 10
+	}
+	cores, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int(cores * 100)
+}
+
+// parseMegabytes converts quantities such as "512Mi", "1Gi" or "100M" into
+// megabytes. Values that are not quantities, such as "unlimited", become 0.
+func parseMegabytes(s string) int {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"Ki", 1.0 / 1024}, {"Mi", 1}, {"Gi", 1024}, {"Ti", 1024 * 1024},
+		{"K", 1.0 / 1000}, {"M", 1}, {"G", 1000}, {"T", 1000 * 1000},
+	}
+	for _, unit := range units {
+		if n, ok := strings.CutSuffix(s, unit.suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0
+			}
+			return int(v * unit.factor)
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/semver"
+)
+
+// RecordInstall records that a plugin version is installed locally. Recording
+// an already installed version updates its source and hash but keeps the
+// original install time and pinned status.
+func (r *pluginRegistry) RecordInstall(version plugins.InstalledVersion) error {
+	if version.Name == "" || version.Version == "" {
+		return errors.New("plugin name and version are required")
+	}
+	if version.Hash == "" {
+		version.Hash = version.Source.Hash
+	}
+	if version.InstalledAt.IsZero() {
+		version.InstalledAt = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.installed[version.Name]
+	versions := make([]plugins.InstalledVersion, 0, len(previous)+1)
+	replaced := false
+	for _, v := range previous {
+		if v.Version == version.Version {
+			version.InstalledAt = v.InstalledAt
+			version.Pinned = v.Pinned
+			if !v.ApprovedAt.IsZero() {
+				version.ApprovedAt = v.ApprovedAt
+			}
+			versions = append(versions, version)
+			replaced = true
+			continue
+		}
+		versions = append(versions, v)
+	}
+	if !replaced {
+		versions = append(versions, version)
+	}
+
+	return r.updateInstalled(version.Name, previous, versions)
+}
+
+// RemoveInstall forgets an installed version. Pinned versions must be
+// unpinned first.
+func (r *pluginRegistry) RemoveInstall(name, version string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.installed[name]
+	versions := make([]plugins.InstalledVersion, 0, len(previous))
+	found := false
+	for _, v := range previous {
+		if v.Version != version {
+			versions = append(versions, v)
+			continue
+		}
+		if v.Pinned {
+			return fmt.Errorf("%w: %s %s", ErrVersionPinned, name, version)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("%w: %s %s", ErrVersionNotInstalled, name, version)
+	}
+
+	return r.updateInstalled(name, previous, versions)
+}
+
+// SetPinned pins or unpins an installed version
+func (r *pluginRegistry) SetPinned(name, version string, pinned bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.installed[name]
+	versions := make([]plugins.InstalledVersion, len(previous))
+	copy(versions, previous)
+	found := false
+	for i := range versions {
+		if versions[i].Version == version {
+			versions[i].Pinned = pinned
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %s %s", ErrVersionNotInstalled, name, version)
+	}
+
+	return r.updateInstalled(name, previous, versions)
+}
+
+// InstalledVersions returns the locally installed versions of a plugin,
+// newest first
+func (r *pluginRegistry) InstalledVersions(name string) ([]plugins.InstalledVersion, error) {
+	r.mu.RLock()
+	versions := make([]plugins.InstalledVersion, len(r.installed[name]))
+	copy(versions, r.installed[name])
+	r.mu.RUnlock()
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		c, err := semver.Compare(versions[i].Version, versions[j].Version)
+		if err != nil {
+			return versions[i].Version > versions[j].Version
+		}
+		return c > 0
+	})
+
+	return versions, nil
+}
+
+// updateInstalled replaces the installed versions of a plugin and persists
+// the change, restoring the previous versions if that fails. Callers must
+// hold the write lock.
+func (r *pluginRegistry) updateInstalled(name string, previous, versions []plugins.InstalledVersion) error {
+	if len(versions) == 0 {
+		delete(r.installed, name)
+	} else {
+		r.installed[name] = versions
+	}
+
+	if err := r.persist(); err != nil {
+		if len(previous) == 0 {
+			delete(r.installed, name)
+		} else {
+			r.installed[name] = previous
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,414 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+// Marketplace errors
+var (
+	ErrPluginNotInCatalog  = errors.New("plugin not found in marketplace catalog")
+	ErrArtifactNotFound    = errors.New("no marketplace artifact for platform")
+	ErrChecksumMismatch    = errors.New("artifact checksum mismatch")
+	ErrChecksumUnavailable = errors.New("artifact checksum unavailable")
+	ErrPublishNotSupported = errors.New("publishing is not supported by the marketplace catalog")
+)
+
+const (
+	catalogCacheFile = "catalog.json"
+	catalogETagFile  = "catalog.etag"
+
+	// catalogPath is where the catalog lives relative to the marketplace URL
+	catalogPath = "/api/v1/catalog.json"
+
+	// apiTimeout bounds catalog and checksum requests. Artifact downloads
+	// are bounded only by their context, since large plugins take a while.
+	apiTimeout = 30 * time.Second
+)
+
+// MarketplaceConfig configures the HTTP marketplace client
+type MarketplaceConfig struct {
+	CatalogURL string        // Marketplace URL or the full URL of api/v1/catalog.json
+	CacheDir   string        // Where the catalog and its ETag are cached, optional
+	Platform   string        // Artifact platform such as linux-amd64, defaults to the host
+	CacheTTL   time.Duration // How long the catalog is used before revalidating
+	HTTPClient *http.Client  // Defaults to a client without a timeout of its own
+}
+
+// HTTPMarketplaceClient reads plugins from the marketplace catalog over HTTP.
+// The catalog is cached in memory and on disk and revalidated with ETags.
+type HTTPMarketplaceClient struct {
+	config MarketplaceConfig
+
+	mu        sync.Mutex
+	catalog   *Catalog
+	etag      string
+	fetchedAt time.Time
+}
+
+// NewHTTPMarketplaceClient creates a marketplace client for the given catalog
+func NewHTTPMarketplaceClient(config MarketplaceConfig) *HTTPMarketplaceClient {
+	if !strings.HasSuffix(config.CatalogURL, ".json") {
+		config.CatalogURL = strings.TrimSuffix(config.CatalogURL, "/") + catalogPath
+	}
+	if config.Platform == "" {
+		config.Platform = runtime.GOOS + "-" + runtime.GOARCH
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = 5 * time.Minute
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+
+	c := &HTTPMarketplaceClient{config: config}
+	c.loadCachedCatalog()
+	return c
+}
+
+// FetchPlugin resolves a marketplace ID, optionally written as "id@version",
+// into a plugin specification for the configured platform
+func (c *HTTPMarketplaceClient) FetchPlugin(id string) (plugins.PluginSpec, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	spec, _, err := c.resolve(ctx, id)
+	return spec, err
+}
+
+// PublishPlugin is not supported; plugins are published by adding them to the catalog
+func (c *HTTPMarketplaceClient) PublishPlugin(spec plugins.PluginSpec) error {
+	return ErrPublishNotSupported
+}
+
+// ListPlugins returns information about every plugin in the catalog
+func (c *HTTPMarketplaceClient) ListPlugins(ctx context.Context) ([]plugins.PluginInfo, error) {
+	catalog, err := c.Catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]plugins.PluginInfo, 0, len(catalog.Plugins))
+	for _, entry := range catalog.Plugins {
+		infos = append(infos, entry.merged().toInfo())
+	}
+	return infos, nil
+}
+
+// DownloadPlugin downloads the artifact for spec to targetPath and verifies
+// its checksum. The file only appears at targetPath once it is verified.
+func (c *HTTPMarketplaceClient) DownloadPlugin(ctx context.Context, spec plugins.PluginSpec, targetPath string) error {
+	id := spec.Source.Path
+	if id == "" {
+		id = spec.Name
+	}
+	if spec.Version != "" && !strings.Contains(id, "@") {
+		id += "@" + spec.Version
+	}
+
+	resolved, artifact, err := c.resolve(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// A hash pinned in the spec takes precedence over the catalog
+	expected := normalizeChecksum(spec.Source.Hash)
+	if expected == "" {
+		expected = resolved.Source.Hash
+	}
+
+	return c.download(ctx, artifact.URL, expected, targetPath)
+}
+
+// Catalog returns the marketplace catalog, revalidating the cached copy
+// once it is older than the cache TTL. If the marketplace cannot be reached
+// a previously fetched catalog is used.
+func (c *HTTPMarketplaceClient) Catalog(ctx context.Context) (*Catalog, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.catalog != nil && time.Since(c.fetchedAt) < c.config.CacheTTL {
+		return c.catalog, nil
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		if c.catalog != nil {
+			return c.catalog, nil
+		}
+		return nil, err
+	}
+	return c.catalog, nil
+}
+
+// refresh fetches the catalog, sending the cached ETag. Callers must hold mu.
+func (c *HTTPMarketplaceClient) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.CatalogURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create catalog request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.catalog != nil && c.etag != "" {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch catalog: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		c.fetchedAt = time.Now()
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("failed to fetch catalog: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("failed to parse catalog: %w", err)
+	}
+
+	c.catalog = &catalog
+	c.etag = resp.Header.Get("ETag")
+	c.fetchedAt = time.Now()
+	c.saveCachedCatalog(data)
+
+	return nil
+}
+
+// loadCachedCatalog restores the catalog and ETag saved by a previous run.
+// The restored catalog is considered stale and revalidated on first use.
+func (c *HTTPMarketplaceClient) loadCachedCatalog() {
+	if c.config.CacheDir == "" {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.config.CacheDir, catalogCacheFile))
+	if err != nil {
+		return
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return
+	}
+	etag, _ := os.ReadFile(filepath.Join(c.config.CacheDir, catalogETagFile))
+
+	c.catalog = &catalog
+	c.etag = strings.TrimSpace(string(etag))
+}
+
+// saveCachedCatalog writes the catalog and ETag to the cache directory
+func (c *HTTPMarketplaceClient) saveCachedCatalog(data []byte) {
+	if c.config.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.config.CacheDir, 0755); err != nil {
+		return
+	}
+
+	if err := writeFileAtomic(filepath.Join(c.config.CacheDir, catalogCacheFile), data); err != nil {
+		return
+	}
+	writeFileAtomic(filepath.Join(c.config.CacheDir, catalogETagFile), []byte(c.etag))
+}
+
+// resolve finds the catalog entry and platform artifact for id
+func (c *HTTPMarketplaceClient) resolve(ctx context.Context, id string) (plugins.PluginSpec, CatalogDownload, error) {
+	name, version, _ := strings.Cut(id, "@")
+
+	catalog, err := c.Catalog(ctx)
+	if err != nil {
+		return plugins.PluginSpec{}, CatalogDownload{}, err
+	}
+
+	var entry *CatalogEntry
+	for i := range catalog.Plugins {
+		if catalog.Plugins[i].ID == name {
+			merged := catalog.Plugins[i].merged()
+			entry = &merged
+			break
+		}
+	}
+	if entry == nil {
+		return plugins.PluginSpec{}, CatalogDownload{}, fmt.Errorf("%w: %s", ErrPluginNotInCatalog, name)
+	}
+
+	version, artifacts, err := entry.release(version)
+	if err != nil {
+		return plugins.PluginSpec{}, CatalogDownload{}, err
+	}
+	artifact, ok := artifacts[c.config.Platform]
+	if !ok || artifact.URL == "" {
+		return plugins.PluginSpec{}, CatalogDownload{}, fmt.Errorf("%w: %s@%s on %s",
+			ErrArtifactNotFound, name, version, c.config.Platform)
+	}
+
+	hash, err := c.checksum(ctx, *entry, version, artifact)
+	if err != nil {
+		return plugins.PluginSpec{}, CatalogDownload{}, err
+	}
+
+	return entry.toSpec(version, hash), artifact, nil
+}
+
+// checksum finds the expected SHA-256 of an artifact, from the artifact
+// itself, the entry's checksum table, or the artifact's checksum URL
+func (c *HTTPMarketplaceClient) checksum(ctx context.Context, entry CatalogEntry, version string, artifact CatalogDownload) (string, error) {
+	if sum := normalizeChecksum(artifact.SHA256); sum != "" {
+		return sum, nil
+	}
+	current := entry.Version
+	if current == "" {
+		current = entry.Latest
+	}
+	if version == current {
+		if sum := normalizeChecksum(entry.Checksums[c.config.Platform]); sum != "" {
+			return sum, nil
+		}
+	}
+	if artifact.ChecksumURL == "" {
+		return "", fmt.Errorf("%w: %s@%s on %s", ErrChecksumUnavailable, entry.ID, version, c.config.Platform)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, artifact.ChecksumURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checksum request: %w", err)
+	}
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch checksum: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum: %w", err)
+	}
+
+	// sha256sum format: "<hex>  <filename>"
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%w: empty checksum file", ErrChecksumUnavailable)
+	}
+	sum := normalizeChecksum(fields[0])
+	if sum == "" {
+		return "", fmt.Errorf("%w: malformed checksum %q", ErrChecksumUnavailable, fields[0])
+	}
+	return sum, nil
+}
+
+// download fetches url into targetPath, verifying it hashes to expected
+func (c *HTTPMarketplaceClient) download(ctx context.Context, url, expected, targetPath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download plugin: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download plugin: %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(targetPath), ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hasher), resp.Body); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save plugin: %w", err)
+	}
+	tmpFile.Close()
+
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if actual != expected {
+		os.Remove(tmpPath)
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expected, actual)
+	}
+
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to make plugin executable: %w", err)
+	}
+	if err := os.Rename(tmpPath, targetPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to install plugin: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeChecksum strips an optional "sha256:" prefix and lowercases the
+// digest, returning "" if it is not a SHA-256 hex digest
+func normalizeChecksum(sum string) string {
+	sum = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(sum), "sha256:")))
+	if len(sum) != sha256.Size*2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return ""
+	}
+	return sum
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -20,6 +21,8 @@ var (
 	ErrPluginAlreadyExists = errors.New("plugin already exists")
 	ErrInvalidPluginSpec   = errors.New("invalid plugin specification")
 	ErrInvalidSearchCriteria = errors.New("invalid search criteria")
+	ErrVersionNotInstalled   = errors.New("plugin version not installed")
+	ErrVersionPinned         = errors.New("plugin version is pinned")
 )
 
 // pluginRegistry implements the PluginRegistry interface
@@ -27,7 +30,18 @@ type pluginRegistry struct {
 	mu          sync.RWMutex
 	plugins     map[string]*plugins.PluginInfo
 	searchIndex map[string][]string // capability -> plugin names
+	textIndex   *textIndex          // token -> plugin names, for free-text search
 	marketplace MarketplaceClient
+
+	// installed tracks locally installed versions per plugin name
+	installed map[string][]plugins.InstalledVersion
+
+	// restored marks registrations loaded from disk that no running plugin
+	// has claimed yet; registering the same name again replaces them
+	restored map[string]bool
+
+	// store persists the registry, nil for an in-memory registry
+	store *diskStore
 }
 
 // MarketplaceClient interface for marketplace integration
@@ -36,13 +50,73 @@ type MarketplaceClient interface {
 	PublishPlugin(spec plugins.PluginSpec) error
 }
 
-// New creates a new plugin registry
+// New creates a new in-memory plugin registry
 func New(marketplace MarketplaceClient) plugins.PluginRegistry {
+	return newRegistry(marketplace)
+}
+
+func newRegistry(marketplace MarketplaceClient) *pluginRegistry {
 	return &pluginRegistry{
 		plugins:     make(map[string]*plugins.PluginInfo),
 		searchIndex: make(map[string][]string),
+		textIndex:   newTextIndex(),
 		marketplace: marketplace,
+		installed:   make(map[string][]plugins.InstalledVersion),
+		restored:    make(map[string]bool),
+	}
+}
+
+// Open creates a plugin registry persisted in dataDir. The registry index is
+// loaded from disk and the search indexes are rebuilt from it. Registrations
+// restored from disk are marked stopped until their plugin is loaded again.
+func Open(dataDir string, marketplace MarketplaceClient) (plugins.PluginRegistry, error) {
+	store, err := newDiskStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRegistry(marketplace)
+	r.store = store
+	for i := range snapshot.Plugins {
+		info := snapshot.Plugins[i]
+		if info.Status == plugins.PluginStatusRunning {
+			info.Status = plugins.PluginStatusStopped
+		}
+		r.index(&info)
+		r.restored[info.Name] = true
 	}
+	for name, versions := range snapshot.Installed {
+		if len(versions) > 0 {
+			r.installed[name] = versions
+		}
+	}
+
+	return r, nil
+}
+
+// persist writes the registry to disk. Callers must hold the write lock.
+func (r *pluginRegistry) persist() error {
+	if r.store == nil {
+		return nil
+	}
+
+	snapshot := indexSnapshot{
+		Plugins:   make([]plugins.PluginInfo, 0, len(r.plugins)),
+		Installed: r.installed,
+	}
+	for _, info := range r.plugins {
+		snapshot.Plugins = append(snapshot.Plugins, *info)
+	}
+	sort.Slice(snapshot.Plugins, func(i, j int) bool {
+		return snapshot.Plugins[i].Name < snapshot.Plugins[j].Name
+	})
+
+	return r.store.save(snapshot)
 }
 
 // DiscoverPlugins scans a directory for plugin specifications
@@ -127,7 +201,7 @@ func (r *pluginRegistry) validatePluginSpec(spec plugins.PluginSpec) error {
 	// Validate isolation level
 	switch spec.Isolation {
 	case plugins.IsolationNone, plugins.IsolationThread, plugins.IsolationProcess,
-		plugins.IsolationContainer, plugins.IsolationVM:
+		plugins.IsolationContainer, plugins.IsolationVM, plugins.IsolationWASM:
 		// Valid isolation levels
 	default:
 		return fmt.Errorf("invalid isolation level: %s", spec.Isolation)
@@ -136,43 +210,77 @@ func (r *pluginRegistry) validatePluginSpec(spec plugins.PluginSpec) error {
 	return nil
 }
 
-// SearchPlugins searches for plugins matching the given criteria
+// SearchPlugins searches for plugins matching the given criteria and returns
+// the requested page of results
 func (r *pluginRegistry) SearchPlugins(criteria plugins.SearchCriteria) ([]plugins.PluginInfo, error) {
+	result, err := r.QueryPlugins(criteria)
+	if err != nil {
+		return nil, err
+	}
+	return result.Plugins, nil
+}
+
+// QueryPlugins searches for plugins matching the given criteria and returns
+// the requested page of results along with pagination details
+func (r *pluginRegistry) QueryPlugins(criteria plugins.SearchCriteria) (plugins.SearchResult, error) {
+	versions, err := parseVersionRange(criteria)
+	if err != nil {
+		return plugins.SearchResult{}, err
+	}
+	terms := tokenize(criteria.Query)
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	var results []plugins.PluginInfo
-
-	// If searching by capability, use the index
+	// Narrow the candidates using the capability and text indexes
+	var candidates map[string]struct{}
 	if len(criteria.Capabilities) > 0 {
-		pluginNames := make(map[string]bool)
-		for _, capability := range criteria.Capabilities {
-			for _, name := range r.searchIndex[string(capability)] {
-				pluginNames[name] = true
-			}
+		candidates = make(map[string]struct{})
+		for _, name := range r.searchIndex[string(criteria.Capabilities[0])] {
+			candidates[name] = struct{}{}
 		}
-
-		for name := range pluginNames {
-			if info, exists := r.plugins[name]; exists {
-				if r.matchesCriteria(info, criteria) {
-					results = append(results, *info)
+	}
+	if len(terms) > 0 {
+		matches := r.textIndex.candidates(terms)
+		if candidates == nil {
+			candidates = matches
+		} else {
+			for name := range candidates {
+				if _, ok := matches[name]; !ok {
+					delete(candidates, name)
 				}
 			}
 		}
-	} else {
-		// Search all plugins
-		for _, info := range r.plugins {
-			if r.matchesCriteria(info, criteria) {
-				results = append(results, *info)
-			}
+	}
+	if candidates == nil {
+		candidates = make(map[string]struct{}, len(r.plugins))
+		for name := range r.plugins {
+			candidates[name] = struct{}{}
+		}
+	}
+
+	var hits []scoredPlugin
+	for name := range candidates {
+		info, exists := r.plugins[name]
+		if !exists || !r.matchesCriteria(info, criteria, versions) {
+			continue
 		}
+		hit := scoredPlugin{info: *info}
+		if len(terms) > 0 {
+			hit.score = r.textIndex.score(name, criteria.Query, terms)
+		}
+		hits = append(hits, hit)
+	}
+
+	if err := sortResults(hits, criteria.Pagination, len(terms) > 0); err != nil {
+		return plugins.SearchResult{}, err
 	}
 
-	return results, nil
+	return paginate(hits, criteria.Pagination)
 }
 
 // matchesCriteria checks if a plugin matches the search criteria
-func (r *pluginRegistry) matchesCriteria(info *plugins.PluginInfo, criteria plugins.SearchCriteria) bool {
+func (r *pluginRegistry) matchesCriteria(info *plugins.PluginInfo, criteria plugins.SearchCriteria, versions versionRange) bool {
 	// Check name
 	if criteria.Name != "" && !strings.Contains(strings.ToLower(info.Name), strings.ToLower(criteria.Name)) {
 		return false
@@ -184,39 +292,46 @@ func (r *pluginRegistry) matchesCriteria(info *plugins.PluginInfo, criteria plug
 	}
 
 	// Check license
-	if criteria.License != "" && info.License != criteria.License {
+	if criteria.License != "" && !strings.EqualFold(info.License, criteria.License) {
+		return false
+	}
+
+	// Check category
+	if criteria.Category != "" && !strings.EqualFold(info.Category, criteria.Category) {
 		return false
 	}
 
 	// Check version range
-	if criteria.MinVersion != "" {
-		// TODO: Implement proper version comparison
-		if info.Version < criteria.MinVersion {
-			return false
-		}
+	if !versions.contains(info.Version) {
+		return false
 	}
 
-	if criteria.MaxVersion != "" {
-		// TODO: Implement proper version comparison
-		if info.Version > criteria.MaxVersion {
+	// Check capabilities, all of which are required
+	for _, requiredCap := range criteria.Capabilities {
+		hasCapability := false
+		for _, pluginCap := range info.Capabilities {
+			if pluginCap == requiredCap {
+				hasCapability = true
+				break
+			}
+		}
+		if !hasCapability {
 			return false
 		}
 	}
 
-	// Check capabilities
-	if len(criteria.Capabilities) > 0 {
-		hasCapability := false
-		for _, requiredCap := range criteria.Capabilities {
-			for _, pluginCap := range info.Capabilities {
-				if pluginCap == requiredCap {
-					hasCapability = true
-					break
-				}
-			}
-			if !hasCapability {
-				return false
+	// Check keywords, all of which are required
+	for _, keyword := range criteria.Keywords {
+		hasKeyword := false
+		for _, pluginKeyword := range info.Keywords {
+			if strings.EqualFold(pluginKeyword, keyword) {
+				hasKeyword = true
+				break
 			}
 		}
+		if !hasKeyword {
+			return false
+		}
 	}
 
 	return true
@@ -227,16 +342,25 @@ func (r *pluginRegistry) RegisterPlugin(info plugins.PluginInfo) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.plugins[info.Name]; exists {
+	previous, exists := r.plugins[info.Name]
+	if exists && !r.restored[info.Name] {
 		return ErrPluginAlreadyExists
 	}
 
-	// Add to main registry
-	r.plugins[info.Name] = &info
-
-	// Update search index
-	for _, capability := range info.Capabilities {
-		r.searchIndex[string(capability)] = append(r.searchIndex[string(capability)], info.Name)
+	if exists {
+		r.unindex(previous)
+	}
+	r.index(&info)
+	wasRestored := r.restored[info.Name]
+	delete(r.restored, info.Name)
+
+	if err := r.persist(); err != nil {
+		r.unindex(&info)
+		if exists {
+			r.index(previous)
+			r.restored[info.Name] = wasRestored
+		}
+		return err
 	}
 
 	return nil
@@ -252,17 +376,37 @@ func (r *pluginRegistry) UnregisterPlugin(name string) error {
 		return ErrPluginNotFound
 	}
 
-	// Remove from main registry
-	delete(r.plugins, name)
+	r.unindex(info)
+	wasRestored := r.restored[name]
+	delete(r.restored, name)
 
-	// Update search index
-	for _, capability := range info.Capabilities {
-		r.removeFromIndex(string(capability), name)
+	if err := r.persist(); err != nil {
+		r.index(info)
+		r.restored[name] = wasRestored
+		return err
 	}
 
 	return nil
 }
 
+// index adds a plugin to the main registry and the search indexes
+func (r *pluginRegistry) index(info *plugins.PluginInfo) {
+	r.plugins[info.Name] = info
+	for _, capability := range info.Capabilities {
+		r.searchIndex[string(capability)] = append(r.searchIndex[string(capability)], info.Name)
+	}
+	r.textIndex.add(info)
+}
+
+// unindex removes a plugin from the main registry and the search indexes
+func (r *pluginRegistry) unindex(info *plugins.PluginInfo) {
+	delete(r.plugins, info.Name)
+	for _, capability := range info.Capabilities {
+		r.removeFromIndex(string(capability), info.Name)
+	}
+	r.textIndex.remove(info.Name)
+}
+
 // removeFromIndex removes a plugin name from a capability index
 func (r *pluginRegistry) removeFromIndex(capability, name string) {
 	names := r.searchIndex[capability]
@@ -0,0 +1,322 @@
+package registry
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/semver"
+)
+
+// Sort fields accepted in PaginationOptions.SortBy
+const (
+	SortByRelevance = "relevance"
+	SortByName      = "name"
+	SortByVersion   = "version"
+)
+
+// Field weights used when ranking free-text matches
+const (
+	weightNameExact     = 10
+	weightNamePrefix    = 6
+	weightKeywordExact  = 8
+	weightKeywordPrefix = 4
+	weightCategory      = 5
+	weightDescription   = 2
+	weightFullName      = 50
+)
+
+// document holds the tokenized searchable fields of a plugin
+type document struct {
+	name        []string
+	keywords    []string
+	category    []string
+	description []string
+}
+
+// textIndex is an inverted index from tokens to plugin names
+type textIndex struct {
+	docs     map[string]document
+	postings map[string]map[string]struct{}
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		docs:     make(map[string]document),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+// add indexes the searchable fields of a plugin
+func (idx *textIndex) add(info *plugins.PluginInfo) {
+	doc := document{
+		name:        tokenize(info.Name),
+		category:    tokenize(info.Category),
+		description: tokenize(info.Description),
+	}
+	for _, keyword := range info.Keywords {
+		doc.keywords = append(doc.keywords, tokenize(keyword)...)
+	}
+	idx.docs[info.Name] = doc
+
+	for _, field := range [][]string{doc.name, doc.keywords, doc.category, doc.description} {
+		for _, token := range field {
+			names, ok := idx.postings[token]
+			if !ok {
+				names = make(map[string]struct{})
+				idx.postings[token] = names
+			}
+			names[info.Name] = struct{}{}
+		}
+	}
+}
+
+// remove drops a plugin from the index
+func (idx *textIndex) remove(name string) {
+	doc, ok := idx.docs[name]
+	if !ok {
+		return
+	}
+	for _, field := range [][]string{doc.name, doc.keywords, doc.category, doc.description} {
+		for _, token := range field {
+			delete(idx.postings[token], name)
+			if len(idx.postings[token]) == 0 {
+				delete(idx.postings, token)
+			}
+		}
+	}
+	delete(idx.docs, name)
+}
+
+// candidates returns the plugins with a token starting with every term
+func (idx *textIndex) candidates(terms []string) map[string]struct{} {
+	var result map[string]struct{}
+	for _, term := range terms {
+		matches := make(map[string]struct{})
+		for token, names := range idx.postings {
+			if !strings.HasPrefix(token, term) {
+				continue
+			}
+			for name := range names {
+				matches[name] = struct{}{}
+			}
+		}
+
+		if result == nil {
+			result = matches
+			continue
+		}
+		for name := range result {
+			if _, ok := matches[name]; !ok {
+				delete(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// score ranks how well a plugin matches the query terms
+func (idx *textIndex) score(name, query string, terms []string) int {
+	doc := idx.docs[name]
+	score := 0
+	for _, term := range terms {
+		score += fieldScore(doc.name, term, weightNameExact, weightNamePrefix)
+		score += fieldScore(doc.keywords, term, weightKeywordExact, weightKeywordPrefix)
+		score += fieldScore(doc.category, term, weightCategory, weightCategory/2)
+		score += fieldScore(doc.description, term, weightDescription, weightDescription/2)
+	}
+	if strings.EqualFold(name, strings.TrimSpace(query)) {
+		score += weightFullName
+	}
+	return score
+}
+
+// fieldScore returns the best score of term against the tokens of one field
+func fieldScore(tokens []string, term string, exact, prefix int) int {
+	best := 0
+	for _, token := range tokens {
+		switch {
+		case token == term:
+			return exact
+		case strings.HasPrefix(token, term) && prefix > best:
+			best = prefix
+		}
+	}
+	return best
+}
+
+// tokenize lowercases s and splits it on anything that is not a letter or digit
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// versionRange holds the parsed MinVersion and MaxVersion of a search
+type versionRange struct {
+	min, max *semver.Version
+}
+
+func parseVersionRange(criteria plugins.SearchCriteria) (versionRange, error) {
+	var vr versionRange
+	if criteria.MinVersion != "" {
+		v, err := semver.Parse(criteria.MinVersion)
+		if err != nil {
+			return vr, fmt.Errorf("%w: min version: %v", ErrInvalidSearchCriteria, err)
+		}
+		vr.min = &v
+	}
+	if criteria.MaxVersion != "" {
+		v, err := semver.Parse(criteria.MaxVersion)
+		if err != nil {
+			return vr, fmt.Errorf("%w: max version: %v", ErrInvalidSearchCriteria, err)
+		}
+		vr.max = &v
+	}
+	if vr.min != nil && vr.max != nil && vr.max.LessThan(*vr.min) {
+		return vr, fmt.Errorf("%w: max version %s is lower than min version %s",
+			ErrInvalidSearchCriteria, criteria.MaxVersion, criteria.MinVersion)
+	}
+	return vr, nil
+}
+
+// contains reports whether version lies in the inclusive range. Plugins with
+// unparseable versions never match a bounded range.
+func (vr versionRange) contains(version string) bool {
+	if vr.min == nil && vr.max == nil {
+		return true
+	}
+	v, err := semver.Parse(version)
+	if err != nil {
+		return false
+	}
+	if vr.min != nil && v.LessThan(*vr.min) {
+		return false
+	}
+	if vr.max != nil && vr.max.LessThan(v) {
+		return false
+	}
+	return true
+}
+
+// scoredPlugin is a search hit with its relevance
+type scoredPlugin struct {
+	info  plugins.PluginInfo
+	score int
+}
+
+// sortResults orders hits by the requested field. Without a sort field,
+// free-text searches are ordered by relevance and others by name.
+func sortResults(hits []scoredPlugin, opts plugins.PaginationOptions, hasQuery bool) error {
+	sortBy := strings.ToLower(opts.SortBy)
+	if sortBy == "" {
+		sortBy = SortByName
+		if hasQuery {
+			sortBy = SortByRelevance
+		}
+	}
+
+	desc := false
+	switch strings.ToLower(opts.SortDirection) {
+	case "":
+		desc = sortBy == SortByRelevance
+	case "asc":
+	case "desc":
+		desc = true
+	default:
+		return fmt.Errorf("%w: sort direction %q", ErrInvalidSearchCriteria, opts.SortDirection)
+	}
+
+	var compare func(a, b scoredPlugin) int
+	switch sortBy {
+	case SortByRelevance:
+		compare = func(a, b scoredPlugin) int { return a.score - b.score }
+	case SortByName:
+		compare = func(a, b scoredPlugin) int { return strings.Compare(a.info.Name, b.info.Name) }
+	case SortByVersion:
+		compare = func(a, b scoredPlugin) int {
+			c, err := semver.Compare(a.info.Version, b.info.Version)
+			if err != nil {
+				return strings.Compare(a.info.Version, b.info.Version)
+			}
+			return c
+		}
+	default:
+		return fmt.Errorf("%w: sort field %q", ErrInvalidSearchCriteria, opts.SortBy)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		c := compare(hits[i], hits[j])
+		if c == 0 {
+			// Ties are always broken by name so pages are stable
+			return hits[i].info.Name < hits[j].info.Name
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return nil
+}
+
+// paginate returns the requested page of hits
+func paginate(hits []scoredPlugin, opts plugins.PaginationOptions) (plugins.SearchResult, error) {
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return plugins.SearchResult{}, fmt.Errorf("%w: negative limit or offset", ErrInvalidSearchCriteria)
+	}
+
+	offset := opts.Offset
+	if opts.PageToken != "" {
+		var err error
+		if offset, err = decodePageToken(opts.PageToken); err != nil {
+			return plugins.SearchResult{}, err
+		}
+	}
+	if offset > len(hits) {
+		offset = len(hits)
+	}
+
+	end := len(hits)
+	if opts.Limit > 0 && offset+opts.Limit < end {
+		end = offset + opts.Limit
+	}
+
+	result := plugins.SearchResult{
+		Plugins: make([]plugins.PluginInfo, 0, end-offset),
+		Pagination: plugins.PaginationInfo{
+			TotalCount: len(hits),
+			Offset:     offset,
+			HasMore:    end < len(hits),
+		},
+	}
+	for _, hit := range hits[offset:end] {
+		result.Plugins = append(result.Plugins, hit.info)
+	}
+	result.Pagination.ReturnedCount = len(result.Plugins)
+	if result.Pagination.HasMore {
+		result.Pagination.NextPageToken = encodePageToken(end)
+	}
+
+	return result, nil
+}
+
+// Page tokens are opaque to callers; they encode the offset of the next page
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid page token", ErrInvalidSearchCriteria)
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(data), "offset:"))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(data), "offset:") {
+		return 0, fmt.Errorf("%w: invalid page token", ErrInvalidSearchCriteria)
+	}
+	return offset, nil
+}
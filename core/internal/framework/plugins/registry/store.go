@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+const (
+	// indexFileName is the registry index inside the data directory
+	indexFileName = "registry.json"
+
+	// indexFormatVersion is bumped whenever the on-disk layout changes
+	indexFormatVersion = 1
+
+	tempFilePattern = ".registry-*.tmp"
+)
+
+// ErrUnsupportedIndex is returned when the on-disk index was written by a newer version
+var ErrUnsupportedIndex = errors.New("unsupported registry index format")
+
+// indexSnapshot is the on-disk form of the registry
+type indexSnapshot struct {
+	FormatVersion int                                   `json:"format_version"`
+	Plugins       []plugins.PluginInfo                  `json:"plugins"`
+	Installed     map[string][]plugins.InstalledVersion `json:"installed"`
+}
+
+// diskStore persists registry snapshots to a single index file. Writes go to
+// a temporary file that is synced and renamed over the index, so a crash
+// leaves either the old or the new index in place, never a partial one.
+type diskStore struct {
+	dir string
+}
+
+func newDiskStore(dir string) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory: %w", err)
+	}
+
+	// Remove temporary files left behind by an interrupted write
+	leftovers, err := filepath.Glob(filepath.Join(dir, tempFilePattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan registry directory: %w", err)
+	}
+	for _, path := range leftovers {
+		os.Remove(path)
+	}
+
+	return &diskStore{dir: dir}, nil
+}
+
+func (s *diskStore) path() string {
+	return filepath.Join(s.dir, indexFileName)
+}
+
+// load reads the index. A missing index yields an empty snapshot.
+func (s *diskStore) load() (indexSnapshot, error) {
+	snapshot := indexSnapshot{
+		FormatVersion: indexFormatVersion,
+		Installed:     make(map[string][]plugins.InstalledVersion),
+	}
+
+	data, err := os.ReadFile(s.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to read registry index: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("failed to parse registry index %s: %w", s.path(), err)
+	}
+	if snapshot.FormatVersion > indexFormatVersion {
+		return snapshot, fmt.Errorf("%w: version %d", ErrUnsupportedIndex, snapshot.FormatVersion)
+	}
+	if snapshot.Installed == nil {
+		snapshot.Installed = make(map[string][]plugins.InstalledVersion)
+	}
+
+	return snapshot, nil
+}
+
+// save atomically replaces the index with snapshot
+func (s *diskStore) save(snapshot indexSnapshot) error {
+	snapshot.FormatVersion = indexFormatVersion
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode registry index: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(s.dir, tempFilePattern)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write registry index: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync registry index: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close registry index: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path()); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace registry index: %w", err)
+	}
+
+	// Sync the directory so the rename itself survives a crash
+	if dir, err := os.Open(s.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
@@ -2,101 +2,222 @@
 package plugins
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
 )
 
-// RPCRequest represents a JSON-RPC request from the host
-type RPCRequest struct {
-	ID     string          `json:"id"`
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params,omitempty"`
-}
+// RPCRequest represents a request from the host
+type RPCRequest = protocol.Message
 
-// RPCResponse represents a JSON-RPC response to the host
-type RPCResponse struct {
-	ID     string          `json:"id"`
-	Result json.RawMessage `json:"result,omitempty"`
-	Error  *RPCError       `json:"error,omitempty"`
-}
+// RPCResponse represents a response to the host
+type RPCResponse = protocol.Message
 
 // RPCError represents an error in JSON-RPC format
-type RPCError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-}
+type RPCError = protocol.Error
 
-// Run starts the plugin RPC server using stdin/stdout
+// runnerFeatures are the protocol features supported by Run
+var runnerFeatures = []protocol.Feature{protocol.FeatureState, protocol.FeatureCancellation}
+
+// Run starts the plugin RPC server using stdin/stdout. It speaks the unified
+// plugin protocol and still answers hosts that skip the handshake.
 func Run(plugin Plugin) error {
+	return RunWithWorkers(plugin, protocol.DefaultWorkers)
+}
+
+// RunWithWorkers is like Run but handles up to workers requests at once.
+// Lifecycle and state calls still run one at a time.
+func RunWithWorkers(plugin Plugin, workers int) error {
 	log.SetPrefix(fmt.Sprintf("[%s] ", plugin.Info().Name))
 	log.Printf("Plugin starting...")
 	
-	scanner := bufio.NewScanner(os.Stdin)
-	encoder := json.NewEncoder(os.Stdout)
+	conn := protocol.NewConn(os.Stdin, os.Stdout)
+	pool := protocol.NewWorkerPool(workers)
+	defer pool.Wait()
+	cancels := protocol.NewCancellations()
+	streams := protocol.NewStreams(conn)
+	defer streams.AbortAll(io.ErrClosedPipe)
+	
+	// Requests run on their own goroutines, so reading carries on while a
+	// shutdown waits for the requests before it
+	messages := make(chan readResult)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		for {
+			request, err := conn.Read()
+			select {
+			case messages <- readResult{request: request, err: err}:
+			case <-stopped:
+				return
+			}
+			var perr *protocol.Error
+			if err != nil && !errors.As(err, &perr) {
+				return
+			}
+		}
+	}()
 	
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	var shutdown <-chan struct{}
+	for {
+		var read readResult
+		select {
+		case <-shutdown:
+			return nil
+		case read = <-messages:
+		}
+		
+		request, err := read.request, read.err
+		if err != nil {
+			var perr *protocol.Error
+			if errors.As(err, &perr) {
+				log.Printf("Failed to unmarshal request: %v", err)
+				continue
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+		
+		if request.IsNotification() {
+			if request.Method == protocol.MethodCancel {
+				cancels.Cancel(request)
+			} else {
+				streams.Dispatch(request)
+			}
+			continue
+		}
 		
-		var request RPCRequest
-		if err := json.Unmarshal(line, &request); err != nil {
-			log.Printf("Failed to unmarshal request: %v", err)
+		if request.Stream != protocol.StreamNone && request.Method == protocol.MethodHandle {
+			ctx, done := cancels.Track(context.Background(), request)
+			stream := streams.Open(request.ID)
+			pool.Go(func() {
+				defer done()
+				stop := context.AfterFunc(ctx, func() { streams.Finish(request.ID, ctx.Err()) })
+				response := handleStreamRequest(ctx, plugin, request, stream)
+				stop()
+				streams.Finish(request.ID, nil)
+				if err := conn.Write(response); err != nil {
+					log.Printf("Failed to encode response: %v", err)
+				}
+			})
 			continue
 		}
 		
-		response := handleRequest(plugin, request)
+		if protocol.Concurrent(request.Method) {
+			ctx, done := cancels.Track(context.Background(), request)
+			pool.Go(func() {
+				defer done()
+				if err := conn.Write(handleRequest(ctx, plugin, request)); err != nil {
+					log.Printf("Failed to encode response: %v", err)
+				}
+			})
+			continue
+		}
 		
-		if err := encoder.Encode(response); err != nil {
-			log.Printf("Failed to encode response: %v", err)
-			return err
+		done := pool.Exclusive(func() {
+			if err := conn.Write(handleRequest(context.Background(), plugin, request)); err != nil {
+				log.Printf("Failed to encode response: %v", err)
+			}
+		})
+		if request.Method == protocol.MethodShutdown {
+			shutdown = done
 		}
 	}
-	
-	if err := scanner.Err(); err != nil && err != io.EOF {
-		return fmt.Errorf("scanner error: %w", err)
-	}
-	
-	return nil
 }
 
-func handleRequest(plugin Plugin, request RPCRequest) RPCResponse {
+// readResult is a request or error read from the host
+type readResult struct {
+	request RPCRequest
+	err     error
+}
+
+// handleRequest answers a request. ctx ends when the host cancels the
+// request or its deadline passes.
+func handleRequest(ctx context.Context, plugin Plugin, request RPCRequest) RPCResponse {
 	switch request.Method {
-	case "initialize":
+	case protocol.MethodHandshake:
+		return handleHandshake(plugin, request)
+	case protocol.MethodInitialize:
 		return handleInitialize(plugin, request)
-	case "start":
+	case protocol.MethodStart:
 		return handleStart(plugin, request)
-	case "stop":
+	case protocol.MethodStop:
 		return handleStop(plugin, request)
-	case "handle":
-		return handlePluginRequest(plugin, request)
-	case "healthcheck":
+	case protocol.MethodHandle:
+		return handlePluginRequest(ctx, plugin, request)
+	case protocol.MethodHealthCheck:
 		return handleHealthCheck(plugin, request)
-	case "getinfo":
+	case protocol.MethodGetInfo:
 		return handleGetInfo(plugin, request)
-	case "getstatus":
+	case protocol.MethodGetStatus:
 		return handleGetStatus(plugin, request)
-	case "shutdown":
+	case protocol.MethodPrepareShutdown:
+		return handlePrepareShutdown(plugin, request)
+	case protocol.MethodShutdown:
 		return handleShutdown(plugin, request)
-	case "export_state":
+	case protocol.MethodExportState:
 		return handleExportState(plugin, request)
-	case "import_state":
+	case protocol.MethodImportState:
 		return handleImportState(plugin, request)
 	default:
 		return RPCResponse{
 			ID: request.ID,
 			Error: &RPCError{
-				Code:    -32601,
+				Code:    protocol.CodeMethodNotFound,
 				Message: "Method not found",
 			},
 		}
 	}
 }
 
+func handleHandshake(plugin Plugin, request RPCRequest) RPCResponse {
+	var offer protocol.Handshake
+	if err := json.Unmarshal(request.Params, &offer); err != nil {
+		return RPCResponse{
+			ID: request.ID,
+			Error: &RPCError{
+				Code:    protocol.CodeInvalidParams,
+				Message: "Invalid params",
+			},
+		}
+	}
+	
+	features := runnerFeatures
+	if _, ok := plugin.(StreamHandler); ok {
+		features = append(features[:len(features):len(features)], protocol.FeatureStreaming)
+	}
+	
+	info := plugin.Info()
+	reply, err := protocol.Accept(protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            info.Name,
+		Version:         info.Version,
+		Transport:       protocol.TransportStdio,
+		Features:        features,
+	}, offer)
+	if err != nil {
+		return RPCResponse{
+			ID: request.ID,
+			Error: &RPCError{
+				Code:    protocol.CodeIncompatibleVersion,
+				Message: err.Error(),
+			},
+		}
+	}
+	
+	return protocol.NewResult(request.ID, reply)
+}
+
 func handleInitialize(plugin Plugin, request RPCRequest) RPCResponse {
 	// Plugin is already initialized when created
 	result, _ := json.Marshal(map[string]interface{}{
@@ -160,7 +281,7 @@ func handleStop(plugin Plugin, request RPCRequest) RPCResponse {
 	}
 }
 
-func handlePluginRequest(plugin Plugin, request RPCRequest) RPCResponse {
+func handlePluginRequest(ctx context.Context, plugin Plugin, request RPCRequest) RPCResponse {
 	var pluginReq PluginRequest
 	if err := json.Unmarshal(request.Params, &pluginReq); err != nil {
 		return RPCResponse{
@@ -172,8 +293,11 @@ func handlePluginRequest(plugin Plugin, request RPCRequest) RPCResponse {
 		}
 	}
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+	}
 	
 	response, err := plugin.Handle(ctx, pluginReq)
 	if err != nil {
@@ -194,6 +318,67 @@ func handlePluginRequest(plugin Plugin, request RPCRequest) RPCResponse {
 	}
 }
 
+// handleStreamRequest runs a streamed request, ending the response body
+// before the response is sent
+func handleStreamRequest(ctx context.Context, plugin Plugin, request RPCRequest, stream *protocol.Stream) RPCResponse {
+	handler, ok := plugin.(StreamHandler)
+	if !ok {
+		return RPCResponse{
+			ID: request.ID,
+			Error: &RPCError{
+				Code:    protocol.CodeMethodNotFound,
+				Message: "Plugin does not handle streams",
+			},
+		}
+	}
+	
+	var pluginReq PluginRequest
+	if err := json.Unmarshal(request.Params, &pluginReq); err != nil {
+		return RPCResponse{
+			ID: request.ID,
+			Error: &RPCError{
+				Code:    -32602,
+				Message: "Invalid params",
+			},
+		}
+	}
+	
+	var in io.Reader = stream
+	if !request.Stream.ClientStreams() {
+		in = strings.NewReader("")
+	}
+	var out io.Writer = stream
+	if !request.Stream.ServerStreams() {
+		out = closedWriter{}
+	}
+	
+	response, err := handler.HandleStream(ctx, pluginReq, in, out)
+	if request.Stream.ServerStreams() {
+		stream.CloseWriteWithError(err)
+	}
+	if err != nil {
+		return RPCResponse{
+			ID: request.ID,
+			Error: &RPCError{
+				Code:    -32000,
+				Message: err.Error(),
+			},
+		}
+	}
+	
+	result, _ := json.Marshal(response)
+	
+	return RPCResponse{
+		ID:     request.ID,
+		Result: result,
+	}
+}
+
+// closedWriter is the response body of requests the host doesn't stream
+type closedWriter struct{}
+
+func (closedWriter) Write([]byte) (int, error) { return 0, protocol.ErrStreamClosed }
+
 func handleHealthCheck(plugin Plugin, request RPCRequest) RPCResponse {
 	if err := plugin.HealthCheck(); err != nil {
 		return RPCResponse{
@@ -238,6 +423,28 @@ func handleGetStatus(plugin Plugin, request RPCRequest) RPCResponse {
 	}
 }
 
+func handlePrepareShutdown(plugin Plugin, request RPCRequest) RPCResponse {
+	if err := plugin.PrepareShutdown(); err != nil {
+		return RPCResponse{
+			ID: request.ID,
+			Error: &RPCError{
+				Code:    -32000,
+				Message: err.Error(),
+			},
+		}
+	}
+	
+	result, _ := json.Marshal(map[string]interface{}{
+		"success": true,
+		"message": "Plugin prepared for shutdown",
+	})
+	
+	return RPCResponse{
+		ID:     request.ID,
+		Result: result,
+	}
+}
+
 func handleShutdown(plugin Plugin, request RPCRequest) RPCResponse {
 	if err := plugin.PrepareShutdown(); err != nil {
 		log.Printf("Error preparing shutdown: %v", err)
@@ -255,22 +462,11 @@ func handleShutdown(plugin Plugin, request RPCRequest) RPCResponse {
 		"message": "Plugin shutting down",
 	})
 	
-	response := RPCResponse{
+	// Run returns after the response has been written
+	return RPCResponse{
 		ID:     request.ID,
 		Result: result,
 	}
-	
-	// Send response before exiting
-	encoder := json.NewEncoder(os.Stdout)
-	encoder.Encode(response)
-	
-	// Exit after a small delay to ensure response is sent
-	go func() {
-		time.Sleep(100 * time.Millisecond)
-		os.Exit(0)
-	}()
-	
-	return response
 }
 
 func handleExportState(plugin Plugin, request RPCRequest) RPCResponse {
@@ -296,11 +492,8 @@ func handleExportState(plugin Plugin, request RPCRequest) RPCResponse {
 }
 
 func handleImportState(plugin Plugin, request RPCRequest) RPCResponse {
-	var params struct {
-		State []byte `json:"state"`
-	}
-	
-	if err := json.Unmarshal(request.Params, &params); err != nil {
+	state, err := protocol.DecodeState(request.Params)
+	if err != nil {
 		return RPCResponse{
 			ID: request.ID,
 			Error: &RPCError{
@@ -310,7 +503,7 @@ func handleImportState(plugin Plugin, request RPCRequest) RPCResponse {
 		}
 	}
 	
-	if err := plugin.ImportState(params.State); err != nil {
+	if err := plugin.ImportState(state); err != nil {
 		return RPCResponse{
 			ID: request.ID,
 			Error: &RPCError{
@@ -0,0 +1,316 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidConstraint is returned when a constraint string cannot be parsed
+var ErrInvalidConstraint = errors.New("invalid version constraint")
+
+// comparator is a single primitive comparison such as ">=1.2.0"
+type comparator struct {
+	op      string
+	version Version
+}
+
+func (c comparator) matches(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Constraint is a set of version ranges. A version satisfies the constraint
+// if it satisfies every comparator of at least one range.
+//
+// Supported syntax: exact versions ("1.2.3", "=1.2.3"), comparisons (">=1.0",
+// "<2"), caret and tilde ranges ("^1.2", "~1.2.3"), wildcards ("1.x", "*"),
+// hyphen ranges ("1.0 - 2.0"), AND by whitespace or comma and OR by "||".
+type Constraint struct {
+	raw  string
+	sets [][]comparator
+}
+
+// ParseConstraint parses a version constraint. The empty string, "*" and
+// "latest" match any release version.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: strings.TrimSpace(s)}
+	if c.raw == "" || c.raw == "latest" {
+		c.sets = [][]comparator{{}}
+		return c, nil
+	}
+
+	for _, part := range strings.Split(c.raw, "||") {
+		set, err := parseRange(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidConstraint, s, err)
+		}
+		c.sets = append(c.sets, set)
+	}
+
+	return c, nil
+}
+
+// MustParseConstraint parses a constraint and panics on error
+func MustParseConstraint(s string) *Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// String returns the constraint as it was written
+func (c *Constraint) String() string {
+	if c.raw == "" {
+		return "*"
+	}
+	return c.raw
+}
+
+// Check reports whether v satisfies the constraint. Prerelease versions only
+// match ranges that explicitly mention a prerelease of the same version.
+func (c *Constraint) Check(v Version) bool {
+	for _, set := range c.sets {
+		if matchesSet(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSet(set []comparator, v Version) bool {
+	for _, cmp := range set {
+		if !cmp.matches(v) {
+			return false
+		}
+	}
+
+	if v.Prerelease == "" {
+		return true
+	}
+
+	for _, cmp := range set {
+		cv := cmp.version
+		if cv.Prerelease != "" && cv.Major == v.Major && cv.Minor == v.Minor && cv.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
+
+// Satisfies reports whether the version string satisfies the constraint string
+func Satisfies(version, constraint string) (bool, error) {
+	v, err := Parse(version)
+	if err != nil {
+		return false, err
+	}
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+	return c.Check(v), nil
+}
+
+// parseRange parses one "||"-separated range into comparators
+func parseRange(s string) ([]comparator, error) {
+	if s == "" {
+		return nil, errors.New("empty range")
+	}
+
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+
+	// Hyphen range: "1.0 - 2.0"
+	if len(fields) == 3 && fields[1] == "-" {
+		return hyphenRange(fields[0], fields[2])
+	}
+
+	// Join operators written apart from their version, as in ">= 1.0"
+	var tokens []string
+	for i := 0; i < len(fields); i++ {
+		token := fields[i]
+		if isOperator(token) {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("operator %q without version", token)
+			}
+			token += fields[i+1]
+			i++
+		}
+		tokens = append(tokens, token)
+	}
+
+	var set []comparator
+	for _, token := range tokens {
+		cmps, err := parseComparator(token)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, cmps...)
+	}
+	return set, nil
+}
+
+func isOperator(s string) bool {
+	switch s {
+	case "=", "==", "!=", ">", ">=", "<", "<=", "^", "~":
+		return true
+	}
+	return false
+}
+
+// parseComparator expands a single token into primitive comparators
+func parseComparator(token string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", "==", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(token, candidate) {
+			op = candidate
+			token = strings.TrimSpace(token[len(candidate):])
+			break
+		}
+	}
+	if op == "==" {
+		op = "="
+	}
+
+	v, parts, err := parsePartial(token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "", "=":
+		return exactRange(v, parts), nil
+	case "!=":
+		return []comparator{{op: "!=", version: v}}, nil
+	case ">":
+		if parts == 0 {
+			return []comparator{{op: "<", version: Version{}}}, nil
+		}
+		if parts < 3 {
+			return []comparator{{op: ">=", version: bump(v, parts)}}, nil
+		}
+		return []comparator{{op: ">", version: v}}, nil
+	case ">=":
+		return []comparator{{op: ">=", version: v}}, nil
+	case "<":
+		return []comparator{{op: "<", version: v}}, nil
+	case "<=":
+		if parts == 0 {
+			return nil, nil
+		}
+		if parts < 3 {
+			return []comparator{{op: "<", version: bump(v, parts)}}, nil
+		}
+		return []comparator{{op: "<=", version: v}}, nil
+	case "^":
+		return caretRange(v, parts), nil
+	case "~":
+		return tildeRange(v, parts), nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// exactRange handles bare versions, where missing components act as wildcards
+func exactRange(v Version, parts int) []comparator {
+	switch parts {
+	case 0:
+		return nil
+	case 3:
+		return []comparator{{op: "=", version: v}}
+	default:
+		return []comparator{
+			{op: ">=", version: v},
+			{op: "<", version: bump(v, parts)},
+		}
+	}
+}
+
+// caretRange allows changes that do not modify the left-most non-zero component
+func caretRange(v Version, parts int) []comparator {
+	if parts == 0 {
+		return nil
+	}
+
+	var upper Version
+	switch {
+	case v.Major > 0 || parts == 1:
+		upper = Version{Major: v.Major + 1}
+	case v.Minor > 0 || parts == 2:
+		upper = Version{Minor: v.Minor + 1}
+	default:
+		upper = Version{Patch: v.Patch + 1}
+	}
+
+	return []comparator{
+		{op: ">=", version: v},
+		{op: "<", version: upper},
+	}
+}
+
+// tildeRange allows patch-level changes, or minor-level changes if only the major version is given
+func tildeRange(v Version, parts int) []comparator {
+	if parts == 0 {
+		return nil
+	}
+
+	upper := Version{Major: v.Major, Minor: v.Minor + 1}
+	if parts == 1 {
+		upper = Version{Major: v.Major + 1}
+	}
+
+	return []comparator{
+		{op: ">=", version: v},
+		{op: "<", version: upper},
+	}
+}
+
+func hyphenRange(from, to string) ([]comparator, error) {
+	lower, lowerParts, err := parsePartial(from)
+	if err != nil {
+		return nil, err
+	}
+	upper, upperParts, err := parsePartial(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var set []comparator
+	if lowerParts > 0 {
+		set = append(set, comparator{op: ">=", version: lower})
+	}
+	switch {
+	case upperParts == 3:
+		set = append(set, comparator{op: "<=", version: upper})
+	case upperParts > 0:
+		set = append(set, comparator{op: "<", version: bump(upper, upperParts)})
+	}
+	return set, nil
+}
+
+// bump returns the smallest version above every version matching the first
+// parts components of v
+func bump(v Version, parts int) Version {
+	switch parts {
+	case 1:
+		return Version{Major: v.Major + 1}
+	case 2:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+}
@@ -0,0 +1,204 @@
+// Package semver implements semantic version parsing, comparison and range
+// constraints for plugin versions and dependencies.
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidVersion is returned when a version string cannot be parsed
+var ErrInvalidVersion = errors.New("invalid semantic version")
+
+// Version is a parsed semantic version
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+// Parse parses a semantic version. A leading "v" is accepted, and missing
+// minor or patch components default to zero.
+func Parse(s string) (Version, error) {
+	v, parts, err := parsePartial(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if parts == 0 {
+		return Version{}, fmt.Errorf("%w: %q", ErrInvalidVersion, s)
+	}
+	return v, nil
+}
+
+// MustParse parses a version and panics on error
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// parsePartial parses a version that may have wildcard or missing
+// components and returns how many numeric components were present.
+func parsePartial(s string) (Version, int, error) {
+	var v Version
+	raw := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" {
+		return v, 0, fmt.Errorf("%w: %q", ErrInvalidVersion, raw)
+	}
+
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		v.Build = s[i+1:]
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+		if v.Prerelease == "" {
+			return v, 0, fmt.Errorf("%w: %q", ErrInvalidVersion, raw)
+		}
+	}
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return v, 0, fmt.Errorf("%w: %q", ErrInvalidVersion, raw)
+	}
+
+	parts := 0
+	for i, field := range fields {
+		if isWildcard(field) {
+			if v.Prerelease != "" {
+				return v, 0, fmt.Errorf("%w: %q", ErrInvalidVersion, raw)
+			}
+			break
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return v, 0, fmt.Errorf("%w: %q", ErrInvalidVersion, raw)
+		}
+		switch i {
+		case 0:
+			v.Major = n
+		case 1:
+			v.Minor = n
+		case 2:
+			v.Patch = n
+		}
+		parts++
+	}
+
+	return v, parts, nil
+}
+
+func isWildcard(s string) bool {
+	return s == "x" || s == "X" || s == "*"
+}
+
+// String returns the canonical form of the version
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is lower than, equal to
+// or greater than o. Build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	if c := compareInt(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// LessThan reports whether v is lower than o
+func (v Version) LessThan(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+// Equal reports whether v and o have the same precedence
+func (v Version) Equal(o Version) bool {
+	return v.Compare(o) == 0
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// comparePrerelease orders prerelease identifiers as described in semver 2.0
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
+
+// Compare parses and compares two version strings
+func Compare(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// Sort sorts versions in ascending order
+func Sort(versions []Version) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].LessThan(versions[j])
+	})
+}
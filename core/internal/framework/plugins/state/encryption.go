@@ -0,0 +1,333 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MasterKeySize is the size of the node master key state keys are derived from
+const MasterKeySize = 32
+
+var (
+	// ErrStateCorrupted is returned, wrapped in an IntegrityError, when
+	// stored state was corrupted or tampered with
+	ErrStateCorrupted = errors.New("state failed integrity check")
+
+	// ErrInvalidMasterKey is returned for master keys of the wrong size
+	ErrInvalidMasterKey = fmt.Errorf("master key must be %d bytes", MasterKeySize)
+)
+
+// IntegrityError reports stored state that can't be trusted. It matches
+// ErrStateCorrupted with errors.Is.
+type IntegrityError struct {
+	PluginID string
+	Version  string
+	Reason   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("state of plugin %s version %s: %v: %s", e.PluginID, e.Version, ErrStateCorrupted, e.Reason)
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return ErrStateCorrupted
+}
+
+// stateEnvelopeMagic starts every encrypted state, followed by the nonce and
+// the sealed state
+var stateEnvelopeMagic = []byte("BHS\x01")
+
+// stateKeyInfo is the HKDF info plugin data keys are derived with
+const stateKeyInfo = "blackhole plugin state v1\x00"
+
+// EncryptionConfig configures encrypted state storage
+type EncryptionConfig struct {
+	// MasterKey is the node master key state keys are derived from
+	MasterKey []byte
+	// AllowPlaintext loads state stored before encryption was enabled
+	// instead of failing, encrypting it in place as it is loaded. Such state
+	// isn't authenticated, so this is meant to be set only while a node's
+	// existing state is migrated.
+	AllowPlaintext bool
+}
+
+// EncryptedStateStorage wraps a StateStorage so state is stored encrypted
+// with AES-256-GCM. Each plugin's state is encrypted with its own data key,
+// derived from the node master key with HKDF-SHA256. The GCM tag
+// authenticates each state together with its plugin and version, so state
+// that was modified, truncated or moved to another plugin or version fails
+// to load with an IntegrityError instead of reaching the plugin.
+type EncryptedStateStorage struct {
+	backend        StateStorage
+	masterKey      []byte
+	allowPlaintext bool
+}
+
+// NewEncryptedStateStorage creates storage encrypting state saved in backend
+// with keys derived from masterKey
+func NewEncryptedStateStorage(backend StateStorage, masterKey []byte) (*EncryptedStateStorage, error) {
+	return NewEncryptedStateStorageWithConfig(backend, EncryptionConfig{MasterKey: masterKey})
+}
+
+// NewEncryptedStateStorageWithConfig creates storage encrypting state saved
+// in backend as config describes
+func NewEncryptedStateStorageWithConfig(backend StateStorage, config EncryptionConfig) (*EncryptedStateStorage, error) {
+	if len(config.MasterKey) != MasterKeySize {
+		return nil, ErrInvalidMasterKey
+	}
+	return &EncryptedStateStorage{
+		backend:        backend,
+		masterKey:      append([]byte(nil), config.MasterKey...),
+		allowPlaintext: config.AllowPlaintext,
+	}, nil
+}
+
+// Save encrypts state and saves it in the backend
+func (s *EncryptedStateStorage) Save(ctx context.Context, pluginID string, version string, state []byte) error {
+	envelope, err := seal(s.masterKey, pluginID, version, state)
+	if err != nil {
+		return err
+	}
+	return s.backend.Save(ctx, pluginID, version, envelope)
+}
+
+// Load loads state from the backend and decrypts it, returning an
+// IntegrityError if it fails authentication
+func (s *EncryptedStateStorage) Load(ctx context.Context, pluginID string, version string) ([]byte, error) {
+	envelope, err := s.backend.Load(ctx, pluginID, version)
+	if err != nil {
+		return nil, err
+	}
+	if s.allowPlaintext && !sealed(envelope) {
+		// Saved before encryption was enabled. If it can't be encrypted
+		// now it is tried again on the next load.
+		s.Save(ctx, pluginID, version, envelope)
+		return envelope, nil
+	}
+	return open(s.masterKey, pluginID, version, envelope)
+}
+
+// List returns the state versions saved in the backend. Sizes and checksums
+// are those of the encrypted state.
+func (s *EncryptedStateStorage) List(ctx context.Context, pluginID string) ([]StateVersion, error) {
+	return s.backend.List(ctx, pluginID)
+}
+
+// Delete removes a state version from the backend
+func (s *EncryptedStateStorage) Delete(ctx context.Context, pluginID string, version string) error {
+	return s.backend.Delete(ctx, pluginID, version)
+}
+
+// EncryptedCheckpointStore wraps a CheckpointStore so checkpoint state is
+// stored encrypted like EncryptedStateStorage stores state, bound to the
+// plugin and checkpoint
+type EncryptedCheckpointStore struct {
+	CheckpointStore
+	masterKey      []byte
+	allowPlaintext bool
+}
+
+// NewEncryptedCheckpointStore creates a store encrypting the state of
+// checkpoints saved in store with keys derived from masterKey
+func NewEncryptedCheckpointStore(store CheckpointStore, masterKey []byte) (*EncryptedCheckpointStore, error) {
+	return NewEncryptedCheckpointStoreWithConfig(store, EncryptionConfig{MasterKey: masterKey})
+}
+
+// NewEncryptedCheckpointStoreWithConfig creates a store encrypting the state
+// of checkpoints saved in store as config describes. Checkpoints taken
+// before encryption was enabled are left as they are.
+func NewEncryptedCheckpointStoreWithConfig(store CheckpointStore, config EncryptionConfig) (*EncryptedCheckpointStore, error) {
+	if len(config.MasterKey) != MasterKeySize {
+		return nil, ErrInvalidMasterKey
+	}
+	return &EncryptedCheckpointStore{
+		CheckpointStore: store,
+		masterKey:       append([]byte(nil), config.MasterKey...),
+		allowPlaintext:  config.AllowPlaintext,
+	}, nil
+}
+
+// SaveCheckpoint encrypts the checkpoint's state and saves it
+func (s *EncryptedCheckpointStore) SaveCheckpoint(ctx context.Context, checkpoint Checkpoint) error {
+	envelope, err := seal(s.masterKey, checkpoint.PluginID, checkpointVersion(checkpoint.ID), checkpoint.State)
+	if err != nil {
+		return err
+	}
+	checkpoint.State = envelope
+	return s.CheckpointStore.SaveCheckpoint(ctx, checkpoint)
+}
+
+// LoadCheckpoint loads a checkpoint and decrypts its state, returning an
+// IntegrityError if it fails authentication
+func (s *EncryptedCheckpointStore) LoadCheckpoint(ctx context.Context, checkpointID string) (Checkpoint, error) {
+	checkpoint, err := s.CheckpointStore.LoadCheckpoint(ctx, checkpointID)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if s.allowPlaintext && !sealed(checkpoint.State) {
+		return checkpoint, nil
+	}
+	if checkpoint.State, err = open(s.masterKey, checkpoint.PluginID, checkpointVersion(checkpoint.ID), checkpoint.State); err != nil {
+		return Checkpoint{}, err
+	}
+	return checkpoint, nil
+}
+
+// checkpointVersion is what checkpoint state is bound to in place of a
+// state version
+func checkpointVersion(checkpointID string) string {
+	return "checkpoint/" + checkpointID
+}
+
+// seal encrypts state for a plugin and version into an envelope
+func seal(masterKey []byte, pluginID, version string, state []byte) ([]byte, error) {
+	aead, err := pluginCipher(masterKey, pluginID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	envelope := make([]byte, 0, len(stateEnvelopeMagic)+len(nonce)+len(state)+aead.Overhead())
+	envelope = append(envelope, stateEnvelopeMagic...)
+	envelope = append(envelope, nonce...)
+	return aead.Seal(envelope, nonce, state, additionalData(pluginID, version)), nil
+}
+
+// sealed reports whether stored state is an encrypted envelope
+func sealed(envelope []byte) bool {
+	return bytes.HasPrefix(envelope, stateEnvelopeMagic)
+}
+
+// open decrypts an envelope sealed for a plugin and version
+func open(masterKey []byte, pluginID, version string, envelope []byte) ([]byte, error) {
+	aead, err := pluginCipher(masterKey, pluginID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sealed(envelope) {
+		return nil, &IntegrityError{PluginID: pluginID, Version: version, Reason: "state is not encrypted"}
+	}
+	sealed := envelope[len(stateEnvelopeMagic):]
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, &IntegrityError{PluginID: pluginID, Version: version, Reason: "state is truncated"}
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	state, err := aead.Open(nil, nonce, ciphertext, additionalData(pluginID, version))
+	if err != nil {
+		return nil, &IntegrityError{PluginID: pluginID, Version: version, Reason: "authentication failed"}
+	}
+	return state, nil
+}
+
+// pluginCipher returns the AEAD for a plugin's data key
+func pluginCipher(masterKey []byte, pluginID string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(masterKey, stateKeyInfo+pluginID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// additionalData binds encrypted state to the plugin and version it was
+// saved as
+func additionalData(pluginID, version string) []byte {
+	data := append([]byte(nil), stateEnvelopeMagic...)
+	data = append(data, pluginID...)
+	data = append(data, 0)
+	return append(data, version...)
+}
+
+// deriveKey derives a 32-byte key from secret with HKDF-SHA256 (RFC 5869)
+// and no salt. One block of output is all that's needed.
+func deriveKey(secret []byte, info string) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// LoadOrCreateMasterKey reads a hex-encoded master key from path, creating
+// the file with a new random key if it doesn't exist. Losing the key makes
+// all state encrypted with it unreadable, so a new key is synced to disk
+// before it is used.
+func LoadOrCreateMasterKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode master key %s: %w", path, err)
+		}
+		if len(key) != MasterKeySize {
+			return nil, fmt.Errorf("master key %s: %w", path, ErrInvalidMasterKey)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read master key: %w", err)
+	}
+
+	key := make([]byte, MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate master key: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create master key directory: %w", err)
+	}
+
+	// Written in full to a temporary file first, so a crash never leaves
+	// a partial key behind
+	tmp, err := os.CreateTemp(dir, ".master-key-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create master key: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(hex.EncodeToString(key) + "\n")
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write master key: %w", err)
+	}
+
+	// Linked rather than renamed, so a key created meanwhile is never
+	// overwritten
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return LoadOrCreateMasterKey(path)
+		}
+		return nil, fmt.Errorf("failed to create master key: %w", err)
+	}
+	if err := syncDir(dir); err != nil {
+		return nil, fmt.Errorf("failed to sync master key directory: %w", err)
+	}
+	return key, nil
+}
@@ -42,6 +42,20 @@ type PluginManager interface {
 	DrainRequests(ctx context.Context, pluginID string, timeout time.Duration) error
 }
 
+// StateTransfer is implemented by plugin managers that can export state from
+// and import state into their running plugins
+type StateTransfer interface {
+	ExportPluginState(pluginID string) ([]byte, error)
+	ImportPluginState(pluginID string, state []byte) error
+}
+
+// StateStager is implemented by plugin managers that can give a stopped
+// plugin state to import when it is next started, before any request
+// reaches it
+type StateStager interface {
+	StagePluginState(pluginID string, state []byte) error
+}
+
 // HotSwapStatus represents the status of a hot-swap operation
 type HotSwapStatus struct {
 	PluginID      string
@@ -140,7 +154,15 @@ func (c *hotSwapCoordinator) performHotSwap(ctx context.Context, status *HotSwap
 		return fmt.Errorf("failed to load new plugin version: %w", err)
 	}
 	
-	// Step 2: Export state from old plugin
+	// Step 2: Drain requests from old plugin, so the state exported next
+	// includes their effects
+	status.Status = "draining_requests"
+	drainTimeout := 30 * time.Second
+	if err := c.manager.DrainRequests(ctx, oldPlugin.Name, drainTimeout); err != nil {
+		// Continue anyway - requests may have timed out
+	}
+	
+	// Step 3: Export state from old plugin
 	status.Status = "exporting_state"
 	stateData, err := c.exportState(ctx, oldPlugin)
 	if err != nil {
@@ -149,10 +171,11 @@ func (c *hotSwapCoordinator) performHotSwap(ctx context.Context, status *HotSwap
 		return fmt.Errorf("failed to export state: %w", err)
 	}
 	
-	// Step 3: Migrate state if needed
-	if oldPlugin.Version != newSpec.Version {
+	// Step 4: Migrate state if needed, through every version between the
+	// two. Plugins without migrators get their state unchanged.
+	if oldPlugin.Version != newSpec.Version && c.state.hasMigrator(oldPlugin.Name) {
 		status.Status = "migrating_state"
-		migratedState, err := c.state.MigrateState(ctx, oldPlugin.Name, oldPlugin.Version, newSpec.Version)
+		migratedState, err := c.migrateState(ctx, oldPlugin, newSpec.Version, stateData)
 		if err != nil {
 			// Unload new plugin
 			_ = c.manager.UnloadPlugin(ctx, newSpec.Name)
@@ -161,13 +184,6 @@ func (c *hotSwapCoordinator) performHotSwap(ctx context.Context, status *HotSwap
 		stateData = migratedState
 	}
 	
-	// Step 4: Drain requests from old plugin
-	status.Status = "draining_requests"
-	drainTimeout := 30 * time.Second
-	if err := c.manager.DrainRequests(ctx, oldPlugin.Name, drainTimeout); err != nil {
-		// Continue anyway - requests may have timed out
-	}
-	
 	// Step 5: Stop old plugin
 	status.Status = "stopping_old_version"
 	if err := c.manager.StopPlugin(ctx, oldPlugin.Name); err != nil {
@@ -176,7 +192,19 @@ func (c *hotSwapCoordinator) performHotSwap(ctx context.Context, status *HotSwap
 		return fmt.Errorf("failed to stop old plugin: %w", err)
 	}
 	
-	// Step 6: Start new plugin
+	// Step 6: Start new plugin. Managers that can stage the state import
+	// it before releasing the requests held since the drain; otherwise
+	// it is imported once the plugin is running.
+	stager, staged := c.manager.(StateStager)
+	if staged {
+		status.Status = "importing_state"
+		if err := stager.StagePluginState(newSpec.Name, stateData); err != nil {
+			// Discard the new version first, so the old one is restarted
+			_ = c.manager.UnloadPlugin(ctx, newSpec.Name)
+			_ = c.manager.StartPlugin(ctx, oldPlugin.Name)
+			return fmt.Errorf("failed to import state: %w", err)
+		}
+	}
 	status.Status = "starting_new_version"
 	if err := c.manager.StartPlugin(ctx, newSpec.Name); err != nil {
 		// Try to restart old plugin
@@ -186,15 +214,17 @@ func (c *hotSwapCoordinator) performHotSwap(ctx context.Context, status *HotSwap
 		return fmt.Errorf("failed to start new plugin: %w", err)
 	}
 	
-	// Step 7: Import state to new plugin
-	status.Status = "importing_state"
-	if err := c.importState(ctx, newSpec.Name, stateData); err != nil {
-		// Stop new plugin and restart old
-		_ = c.manager.StopPlugin(ctx, newSpec.Name)
-		_ = c.manager.StartPlugin(ctx, oldPlugin.Name)
-		// Unload new plugin
-		_ = c.manager.UnloadPlugin(ctx, newSpec.Name)
-		return fmt.Errorf("failed to import state: %w", err)
+	// Step 7: Import state to new plugin, unless it was staged
+	if !staged {
+		status.Status = "importing_state"
+		if err := c.importState(ctx, newSpec.Name, stateData); err != nil {
+			// Stop new plugin and restart old
+			_ = c.manager.StopPlugin(ctx, newSpec.Name)
+			_ = c.manager.StartPlugin(ctx, oldPlugin.Name)
+			// Unload new plugin
+			_ = c.manager.UnloadPlugin(ctx, newSpec.Name)
+			return fmt.Errorf("failed to import state: %w", err)
+		}
 	}
 	
 	// Step 8: Unload old plugin
@@ -209,18 +239,29 @@ func (c *hotSwapCoordinator) performHotSwap(ctx context.Context, status *HotSwap
 
 // exportState exports state from a plugin
 func (c *hotSwapCoordinator) exportState(ctx context.Context, plugin *plugins.PluginInfo) ([]byte, error) {
-	// This would communicate with the plugin to export its state
-	// For now, return placeholder
+	if transfer, ok := c.manager.(StateTransfer); ok {
+		return transfer.ExportPluginState(plugin.Name)
+	}
 	return c.state.exportPluginState(ctx, plugin.Name, plugin.Version)
 }
 
 // importState imports state to a plugin
 func (c *hotSwapCoordinator) importState(ctx context.Context, pluginID string, stateData []byte) error {
-	// This would communicate with the plugin to import state
-	// For now, return success
+	if transfer, ok := c.manager.(StateTransfer); ok {
+		return transfer.ImportPluginState(pluginID, stateData)
+	}
 	return c.state.importPluginState(ctx, pluginID, stateData)
 }
 
+// migrateState saves the exported state as the old version's and migrates
+// it to the new version
+func (c *hotSwapCoordinator) migrateState(ctx context.Context, plugin *plugins.PluginInfo, toVersion string, stateData []byte) ([]byte, error) {
+	if err := c.state.storage.Save(ctx, plugin.Name, plugin.Version, stateData); err != nil {
+		return nil, fmt.Errorf("failed to save state: %w", err)
+	}
+	return c.state.MigrateState(ctx, plugin.Name, plugin.Version, toVersion)
+}
+
 // GetStatus returns the status of a hot-swap operation
 func (c *hotSwapCoordinator) GetStatus(pluginID string) (*HotSwapStatus, bool) {
 	c.mu.RLock()
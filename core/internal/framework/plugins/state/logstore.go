@@ -0,0 +1,980 @@
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrStorageClosed is returned by storage used after Close
+	ErrStorageClosed = errors.New("state storage is closed")
+
+	// errTornRecord is returned for a record that was only partly written
+	// or doesn't match its checksum
+	errTornRecord = errors.New("torn or corrupted record")
+)
+
+// Every record in a segment is
+//
+//	crc32 (4) | body length (4) | body
+//
+// where the body is
+//
+//	kind (1) | unix nanos (8) | plugin ID length (2) | version length (2) | plugin ID | version | state
+//
+// and the CRC (Castagnoli) covers the body. Integers are big-endian.
+const (
+	recordHeaderSize = 8
+	recordPrefixSize = 1 + 8 + 2 + 2
+	maxRecordBody    = 1 << 30
+
+	recordPut    byte = 1
+	recordDelete byte = 2
+
+	segmentExt       = ".seg"
+	compactExt       = ".compact"
+	checkpointName   = "index.json"
+	checkpointTmpExt = ".tmp"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// LogStorageConfig configures a LogStateStorage
+type LogStorageConfig struct {
+	SegmentSize         int64         // Size at which the active segment is sealed and a new one started
+	CheckpointInterval  time.Duration // How often the index is checkpointed if anything changed
+	CompactionInterval  time.Duration // How often sealed segments are checked for compaction
+	CompactionThreshold float64       // Fraction of a segment that must be garbage before it's compacted
+	SyncWrites          bool          // Sync every save to disk, not just checkpoints
+	Logger              *zap.Logger
+}
+
+// LogStateStorage implements StateStorage as an append-only log split into
+// segment files. Every save and delete appends a record to the active
+// segment and updates an in-memory index, so frequent small saves don't
+// create a file each. The index is checkpointed periodically; on open it is
+// loaded from the checkpoint and the records appended after it are
+// replayed, and a record torn by a crash at the end of the log is dropped.
+// Sealed segments whose records are mostly overwritten or deleted are
+// compacted in the background. Besides StateStorage it has the methods of
+// StreamingStateStorage, loading streams straight from the segment.
+type LogStateStorage struct {
+	dir    string
+	config LogStorageConfig
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	index    map[string]map[string]*logEntry // pluginID -> version -> entry
+	segments map[uint64]*logSegment
+	active   *logSegment
+	dirty    bool
+	closed   bool
+
+	// checkpointMu orders checkpoints, compactMu compactions
+	checkpointMu sync.Mutex
+	compactMu    sync.Mutex
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// logEntry locates the latest record of a plugin version
+type logEntry struct {
+	segment   uint64
+	offset    int64 // of the record
+	size      int64 // of the whole record
+	dataSize  int64
+	timestamp time.Time
+	checksum  string
+}
+
+// logSegment is one file of the log
+type logSegment struct {
+	id   uint64
+	file *os.File
+	size int64
+	live int64 // bytes of records the index points at
+	// readers counts the reads of file made without s.mu
+	readers *sync.WaitGroup
+}
+
+// acquire returns the segment's file for reading once s.mu is released,
+// and the function to call when done with it. Callers must hold s.mu.
+func (segment *logSegment) acquire() (*os.File, func()) {
+	readers := segment.readers
+	readers.Add(1)
+	return segment.file, readers.Done
+}
+
+// retire replaces the segment's file with next, closing the old file once
+// the reads that acquired it are done. A file replaced by compaction keeps
+// the records those reads locate. Callers must hold s.mu for writing.
+func (segment *logSegment) retire(next *os.File) {
+	file, readers := segment.file, segment.readers
+	segment.file, segment.readers = next, &sync.WaitGroup{}
+	go func() {
+		readers.Wait()
+		file.Close()
+	}()
+}
+
+// logRecord is a decoded record
+type logRecord struct {
+	kind      byte
+	timestamp time.Time
+	pluginID  string
+	version   string
+	data      []byte
+}
+
+// logCheckpoint is the index as of a position in the log. The sealed
+// segments it was taken over are listed with their sizes, so segments that
+// were compacted or removed since invalidate it.
+type logCheckpoint struct {
+	Segments []checkpointSegment `json:"segments"`
+	Segment  uint64              `json:"segment"`
+	Offset   int64               `json:"offset"`
+	Entries  []checkpointEntry   `json:"entries"`
+}
+
+type checkpointSegment struct {
+	ID   uint64 `json:"id"`
+	Size int64  `json:"size"`
+}
+
+type checkpointEntry struct {
+	PluginID  string    `json:"plugin_id"`
+	Version   string    `json:"version"`
+	Segment   uint64    `json:"segment"`
+	Offset    int64     `json:"offset"`
+	Size      int64     `json:"size"`
+	DataSize  int64     `json:"data_size"`
+	Timestamp time.Time `json:"timestamp"`
+	Checksum  string    `json:"checksum"`
+}
+
+// NewLogStateStorage opens the log in dir, creating it if needed, and
+// recovers the index
+func NewLogStateStorage(dir string, config LogStorageConfig) (*LogStateStorage, error) {
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = 16 << 20
+	}
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = 30 * time.Second
+	}
+	if config.CompactionInterval <= 0 {
+		config.CompactionInterval = 5 * time.Minute
+	}
+	if config.CompactionThreshold <= 0 || config.CompactionThreshold > 1 {
+		config.CompactionThreshold = 0.5
+	}
+	if config.Logger == nil {
+		config.Logger = zap.NewNop()
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	s := &LogStateStorage{
+		dir:      dir,
+		config:   config,
+		logger:   config.Logger,
+		index:    make(map[string]map[string]*logEntry),
+		segments: make(map[uint64]*logSegment),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		s.closeSegments()
+		return nil, err
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Save appends state to the log
+func (s *LogStateStorage) Save(ctx context.Context, pluginID string, version string, state []byte) error {
+	timestamp := time.Now()
+	record, err := encodeRecord(recordPut, timestamp, pluginID, version, state)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(state)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStorageClosed
+	}
+
+	segment, offset, err := s.appendRecord(record)
+	if err != nil {
+		return err
+	}
+	s.setEntry(pluginID, version, &logEntry{
+		segment:   segment.id,
+		offset:    offset,
+		size:      int64(len(record)),
+		dataSize:  int64(len(state)),
+		timestamp: timestamp,
+		checksum:  hex.EncodeToString(hash[:]),
+	})
+	return nil
+}
+
+// Load reads the latest state saved for a plugin version, returning an
+// IntegrityError if its record fails its checksum
+func (s *LogStateStorage) Load(ctx context.Context, pluginID string, version string) ([]byte, error) {
+	s.mu.RLock()
+	entry, segment, err := s.locate(pluginID, version)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
+	}
+	offset := entry.offset
+	file, release := segment.acquire()
+	s.mu.RUnlock()
+	defer release()
+
+	record, _, err := readRecord(file, offset)
+	if errors.Is(err, errTornRecord) {
+		return nil, &IntegrityError{PluginID: pluginID, Version: version, Reason: err.Error()}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	return record.data, nil
+}
+
+// SaveStream saves state read from reader. Records are written whole, so
+// the state is read into memory first.
+func (s *LogStateStorage) SaveStream(ctx context.Context, pluginID string, version string, reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read state stream: %w", err)
+	}
+	return s.Save(ctx, pluginID, version, data)
+}
+
+// LoadStream copies state straight from its segment to writer. The record's
+// checksum can only be verified once it has been copied, so writer must
+// discard what it got if LoadStream returns an IntegrityError. The copy is
+// made without holding the log's lock, so a slow writer doesn't hold up
+// saves.
+func (s *LogStateStorage) LoadStream(ctx context.Context, pluginID string, version string, writer io.Writer) error {
+	s.mu.RLock()
+	entry, segment, err := s.locate(pluginID, version)
+	if err != nil {
+		s.mu.RUnlock()
+		return err
+	}
+	location := *entry
+	file, release := segment.acquire()
+	s.mu.RUnlock()
+	defer release()
+
+	header := make([]byte, recordHeaderSize)
+	if _, err := file.ReadAt(header, location.offset); err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	prefix := location.size - location.dataSize
+	meta := make([]byte, prefix-recordHeaderSize)
+	if _, err := file.ReadAt(meta, location.offset+recordHeaderSize); err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	crc := crc32.New(crcTable)
+	crc.Write(meta)
+	data := io.NewSectionReader(file, location.offset+prefix, location.dataSize)
+	if _, err := io.Copy(writer, io.TeeReader(data, crc)); err != nil {
+		return err
+	}
+	if crc.Sum32() != binary.BigEndian.Uint32(header) {
+		return &IntegrityError{PluginID: pluginID, Version: version, Reason: errTornRecord.Error()}
+	}
+	return nil
+}
+
+// List returns the versions saved for a plugin
+func (s *LogStateStorage) List(ctx context.Context, pluginID string) ([]StateVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions := make([]StateVersion, 0, len(s.index[pluginID]))
+	for version, entry := range s.index[pluginID] {
+		versions = append(versions, StateVersion{
+			PluginID:  pluginID,
+			Version:   version,
+			Timestamp: entry.timestamp,
+			Size:      entry.dataSize,
+			Checksum:  entry.checksum,
+		})
+	}
+	return versions, nil
+}
+
+// Delete appends a record deleting a plugin version's state
+func (s *LogStateStorage) Delete(ctx context.Context, pluginID string, version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStorageClosed
+	}
+	if _, exists := s.index[pluginID][version]; !exists {
+		return nil
+	}
+
+	record, err := encodeRecord(recordDelete, time.Now(), pluginID, version, nil)
+	if err != nil {
+		return err
+	}
+	if _, _, err := s.appendRecord(record); err != nil {
+		return err
+	}
+	s.setEntry(pluginID, version, nil)
+	return nil
+}
+
+// Close stops background compaction, checkpoints the index and closes the
+// segment files
+func (s *LogStateStorage) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		<-s.stopped
+
+		err = s.Checkpoint()
+
+		s.compactMu.Lock()
+		defer s.compactMu.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		s.closeSegments()
+	})
+	return err
+}
+
+// Checkpoint writes the index to disk, so opening the log only replays the
+// records appended after it
+func (s *LogStateStorage) Checkpoint() error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrStorageClosed
+	}
+	// The checkpoint's position must be on disk before the checkpoint is
+	if err := s.active.file.Sync(); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	checkpoint := s.snapshot()
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err := s.writeCheckpoint(checkpoint); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Compact rewrites the sealed segments that are at least the configured
+// fraction garbage, keeping only the records still needed
+func (s *LogStateStorage) Compact(ctx context.Context) error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrStorageClosed
+	}
+	var candidates []uint64
+	oldest := s.active.id
+	for id, segment := range s.segments {
+		oldest = min(oldest, id)
+		if id == s.active.id || segment.size == 0 {
+			continue
+		}
+		if float64(segment.size-segment.live)/float64(segment.size) >= s.config.CompactionThreshold {
+			candidates = append(candidates, id)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+	for _, id := range candidates {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.compactSegment(id, id == oldest); err != nil {
+			return fmt.Errorf("failed to compact segment %d: %w", id, err)
+		}
+	}
+	return s.Checkpoint()
+}
+
+// run checkpoints and compacts the log until Close
+func (s *LogStateStorage) run() {
+	defer close(s.stopped)
+
+	checkpoint := time.NewTicker(s.config.CheckpointInterval)
+	defer checkpoint.Stop()
+	compact := time.NewTicker(s.config.CompactionInterval)
+	defer compact.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-checkpoint.C:
+			s.mu.RLock()
+			dirty := s.dirty
+			s.mu.RUnlock()
+			if dirty {
+				if err := s.Checkpoint(); err != nil {
+					s.logger.Warn("Failed to checkpoint state index", zap.Error(err))
+				}
+			}
+		case <-compact.C:
+			if err := s.Compact(context.Background()); err != nil {
+				s.logger.Warn("Failed to compact state log", zap.Error(err))
+			}
+		}
+	}
+}
+
+// locate finds the entry and segment of a plugin version. Callers must hold
+// s.mu.
+func (s *LogStateStorage) locate(pluginID, version string) (*logEntry, *logSegment, error) {
+	if s.closed {
+		return nil, nil, ErrStorageClosed
+	}
+	entry, exists := s.index[pluginID][version]
+	if !exists {
+		return nil, nil, fmt.Errorf("state not found for plugin %s version %s", pluginID, version)
+	}
+	return entry, s.segments[entry.segment], nil
+}
+
+// setEntry points the index at a plugin version's latest record, or removes
+// it if entry is nil, keeping each segment's live bytes up to date. Callers
+// must hold s.mu.
+func (s *LogStateStorage) setEntry(pluginID, version string, entry *logEntry) {
+	versions := s.index[pluginID]
+	if previous, exists := versions[version]; exists {
+		if segment, exists := s.segments[previous.segment]; exists {
+			segment.live -= previous.size
+		}
+	}
+
+	if entry == nil {
+		delete(versions, version)
+		if len(versions) == 0 {
+			delete(s.index, pluginID)
+		}
+		return
+	}
+
+	if versions == nil {
+		versions = make(map[string]*logEntry)
+		s.index[pluginID] = versions
+	}
+	versions[version] = entry
+	if segment, exists := s.segments[entry.segment]; exists {
+		segment.live += entry.size
+	}
+}
+
+// appendRecord writes a record at the end of the active segment, starting a
+// new segment first if the record would overflow it. Callers must hold s.mu.
+func (s *LogStateStorage) appendRecord(record []byte) (*logSegment, int64, error) {
+	if s.active.size > 0 && s.active.size+int64(len(record)) > s.config.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	segment := s.active
+	offset := segment.size
+	if _, err := segment.file.WriteAt(record, offset); err != nil {
+		// Don't leave a partial record for the next one to follow
+		_ = segment.file.Truncate(offset)
+		return nil, 0, fmt.Errorf("failed to append to segment: %w", err)
+	}
+	if s.config.SyncWrites {
+		if err := segment.file.Sync(); err != nil {
+			return nil, 0, fmt.Errorf("failed to sync segment: %w", err)
+		}
+	}
+	segment.size += int64(len(record))
+	s.dirty = true
+	return segment, offset, nil
+}
+
+// rotate seals the active segment and starts the next one. Callers must
+// hold s.mu.
+func (s *LogStateStorage) rotate() error {
+	if err := s.active.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	segment, err := s.openSegment(s.active.id + 1)
+	if err != nil {
+		return err
+	}
+	// The new segment's directory entry must be on disk before records in
+	// it are acknowledged
+	if err := syncDir(s.dir); err != nil {
+		segment.file.Close()
+		return fmt.Errorf("failed to sync state directory: %w", err)
+	}
+	s.segments[segment.id] = segment
+	s.active = segment
+	return nil
+}
+
+// compactSegment rewrites a sealed segment with only the records still
+// needed: puts the index points at, and deletes of state that may still be
+// in an older segment. The segment keeps its ID, so replaying the log
+// applies records in the same order as before.
+func (s *LogStateStorage) compactSegment(id uint64, oldest bool) error {
+	s.mu.RLock()
+	segment, exists := s.segments[id]
+	s.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	path := s.segmentPath(id)
+	out, err := os.OpenFile(path+compactExt, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + compactExt)
+
+	moved := make(map[int64]int64) // old offset -> new offset
+	var offset, written int64
+	for offset < segment.size {
+		record, size, err := readRecord(segment.file, offset)
+		if err != nil {
+			out.Close()
+			return err
+		}
+
+		s.mu.RLock()
+		entry, live := s.index[record.pluginID][record.version]
+		s.mu.RUnlock()
+		keep := false
+		switch record.kind {
+		case recordPut:
+			keep = live && entry.segment == id && entry.offset == offset
+		case recordDelete:
+			keep = !live && !oldest
+		}
+
+		if keep {
+			raw := make([]byte, size)
+			if _, err := segment.file.ReadAt(raw, offset); err != nil {
+				out.Close()
+				return err
+			}
+			if _, err := out.WriteAt(raw, written); err != nil {
+				out.Close()
+				return err
+			}
+			if record.kind == recordPut {
+				moved[offset] = written
+			}
+			written += size
+		}
+		offset += size
+	}
+
+	if written == segment.size {
+		// Nothing to drop
+		return out.Close()
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Entries saved again while the segment was copied point elsewhere now
+	// and are left alone
+	var live int64
+	for _, versions := range s.index {
+		for _, entry := range versions {
+			if entry.segment != id {
+				continue
+			}
+			if newOffset, ok := moved[entry.offset]; ok {
+				entry.offset = newOffset
+				live += entry.size
+			}
+		}
+	}
+
+	// Nothing in an empty segment is needed, so it's removed
+	if written == 0 {
+		out.Close()
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		segment.retire(nil)
+		delete(s.segments, id)
+		return syncDir(s.dir)
+	}
+
+	if err := os.Rename(path+compactExt, path); err != nil {
+		out.Close()
+		return err
+	}
+	segment.retire(out)
+	segment.size = written
+	segment.live = live
+	// Until the rename is on disk a crash brings back the old segment,
+	// which the index no longer matches
+	return syncDir(s.dir)
+}
+
+// recover opens the segments and rebuilds the index from the checkpoint and
+// the records appended after it
+func (s *LogStateStorage) recover() error {
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		ids = []uint64{1}
+	}
+	for _, id := range ids {
+		segment, err := s.openSegment(id)
+		if err != nil {
+			return err
+		}
+		s.segments[id] = segment
+	}
+	s.active = s.segments[ids[len(ids)-1]]
+
+	startSegment, startOffset := ids[0], int64(0)
+	if checkpoint, ok := s.readCheckpoint(ids); ok {
+		for _, e := range checkpoint.Entries {
+			s.setEntry(e.PluginID, e.Version, &logEntry{
+				segment:   e.Segment,
+				offset:    e.Offset,
+				size:      e.Size,
+				dataSize:  e.DataSize,
+				timestamp: e.Timestamp,
+				checksum:  e.Checksum,
+			})
+		}
+		startSegment, startOffset = checkpoint.Segment, checkpoint.Offset
+	}
+
+	replayed := 0
+	for _, id := range ids {
+		if id < startSegment {
+			continue
+		}
+		segment := s.segments[id]
+		offset := int64(0)
+		if id == startSegment {
+			offset = startOffset
+		}
+
+		for offset < segment.size {
+			record, size, err := readRecord(segment.file, offset)
+			if err != nil {
+				if segment != s.active {
+					return fmt.Errorf("segment %d is corrupted at offset %d: %w", id, offset, err)
+				}
+				// A crash while appending the last record
+				s.logger.Warn("Dropping torn record at the end of the state log",
+					zap.Uint64("segment", id),
+					zap.Int64("offset", offset),
+					zap.Int64("bytes", segment.size-offset))
+				if err := segment.file.Truncate(offset); err != nil {
+					return fmt.Errorf("failed to truncate segment: %w", err)
+				}
+				segment.size = offset
+				break
+			}
+
+			switch record.kind {
+			case recordPut:
+				hash := sha256.Sum256(record.data)
+				s.setEntry(record.pluginID, record.version, &logEntry{
+					segment:   id,
+					offset:    offset,
+					size:      size,
+					dataSize:  int64(len(record.data)),
+					timestamp: record.timestamp,
+					checksum:  hex.EncodeToString(hash[:]),
+				})
+			case recordDelete:
+				s.setEntry(record.pluginID, record.version, nil)
+			}
+			offset += size
+			replayed++
+		}
+	}
+
+	s.dirty = replayed > 0
+	return nil
+}
+
+// readCheckpoint reads the checkpoint, reporting whether it's usable with
+// the segments on disk
+func (s *LogStateStorage) readCheckpoint(ids []uint64) (*logCheckpoint, bool) {
+	data, err := os.ReadFile(filepath.Join(s.dir, checkpointName))
+	if err != nil {
+		return nil, false
+	}
+	var checkpoint logCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		s.logger.Warn("Ignoring unreadable state index checkpoint", zap.Error(err))
+		return nil, false
+	}
+
+	sealed := make(map[uint64]int64, len(checkpoint.Segments))
+	for _, segment := range checkpoint.Segments {
+		sealed[segment.ID] = segment.Size
+	}
+	for _, id := range ids {
+		if id >= checkpoint.Segment {
+			break
+		}
+		size, listed := sealed[id]
+		if !listed || size != s.segments[id].size {
+			s.logger.Info("State index checkpoint is stale, replaying the log", zap.Uint64("segment", id))
+			return nil, false
+		}
+		delete(sealed, id)
+	}
+	position, exists := s.segments[checkpoint.Segment]
+	if len(sealed) > 0 || !exists || position.size < checkpoint.Offset {
+		s.logger.Info("State index checkpoint is stale, replaying the log")
+		return nil, false
+	}
+	for _, entry := range checkpoint.Entries {
+		segment, exists := s.segments[entry.Segment]
+		if !exists || entry.Offset+entry.Size > segment.size {
+			s.logger.Warn("State index checkpoint points outside the log, replaying the log")
+			return nil, false
+		}
+	}
+	return &checkpoint, true
+}
+
+// snapshot captures the index for a checkpoint. Callers must hold s.mu.
+func (s *LogStateStorage) snapshot() *logCheckpoint {
+	checkpoint := &logCheckpoint{Segment: s.active.id, Offset: s.active.size}
+	for id, segment := range s.segments {
+		if id != s.active.id {
+			checkpoint.Segments = append(checkpoint.Segments, checkpointSegment{ID: id, Size: segment.size})
+		}
+	}
+	for pluginID, versions := range s.index {
+		for version, entry := range versions {
+			checkpoint.Entries = append(checkpoint.Entries, checkpointEntry{
+				PluginID:  pluginID,
+				Version:   version,
+				Segment:   entry.segment,
+				Offset:    entry.offset,
+				Size:      entry.size,
+				DataSize:  entry.dataSize,
+				Timestamp: entry.timestamp,
+				Checksum:  entry.checksum,
+			})
+		}
+	}
+	return checkpoint
+}
+
+// writeCheckpoint atomically replaces the checkpoint on disk
+func (s *LogStateStorage) writeCheckpoint(checkpoint *logCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state index: %w", err)
+	}
+
+	path := filepath.Join(s.dir, checkpointName)
+	file, err := os.Create(path + checkpointTmpExt)
+	if err != nil {
+		return fmt.Errorf("failed to write state index: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write state index: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync state index: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write state index: %w", err)
+	}
+	if err := os.Rename(path+checkpointTmpExt, path); err != nil {
+		return fmt.Errorf("failed to replace state index: %w", err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("failed to sync state directory: %w", err)
+	}
+	return nil
+}
+
+// segmentIDs lists the segments in dir in order, removing compactions that
+// were interrupted
+func (s *LogStateStorage) segmentIDs() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, segmentExt+compactExt) {
+			_ = os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// openSegment opens or creates a segment file
+func (s *LogStateStorage) openSegment(id uint64) (*logSegment, error) {
+	file, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment %d: %w", id, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat segment %d: %w", id, err)
+	}
+	return &logSegment{id: id, file: file, size: info.Size(), readers: &sync.WaitGroup{}}, nil
+}
+
+// segmentPath returns the path of a segment file
+func (s *LogStateStorage) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", id, segmentExt))
+}
+
+// closeSegments closes every segment file once the reads using it are
+// done. Callers must hold s.mu for writing.
+func (s *LogStateStorage) closeSegments() {
+	for _, segment := range s.segments {
+		segment.retire(nil)
+	}
+}
+
+// encodeRecord encodes a record
+func encodeRecord(kind byte, timestamp time.Time, pluginID, version string, data []byte) ([]byte, error) {
+	if len(pluginID) > 0xffff || len(version) > 0xffff {
+		return nil, fmt.Errorf("plugin ID or version too long")
+	}
+	bodySize := recordPrefixSize + len(pluginID) + len(version) + len(data)
+	if bodySize > maxRecordBody {
+		return nil, fmt.Errorf("state of %d bytes is too large for the log", len(data))
+	}
+
+	record := make([]byte, recordHeaderSize+bodySize)
+	body := record[recordHeaderSize:]
+	body[0] = kind
+	binary.BigEndian.PutUint64(body[1:], uint64(timestamp.UnixNano()))
+	binary.BigEndian.PutUint16(body[9:], uint16(len(pluginID)))
+	binary.BigEndian.PutUint16(body[11:], uint16(len(version)))
+	n := recordPrefixSize
+	n += copy(body[n:], pluginID)
+	n += copy(body[n:], version)
+	copy(body[n:], data)
+
+	binary.BigEndian.PutUint32(record[0:], crc32.Checksum(body, crcTable))
+	binary.BigEndian.PutUint32(record[4:], uint32(bodySize))
+	return record, nil
+}
+
+// readRecord reads and verifies the record at offset, returning it and its
+// size. It returns errTornRecord for a record that is cut short or fails
+// its checksum.
+func readRecord(r io.ReaderAt, offset int64) (*logRecord, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		if err == io.EOF {
+			return nil, 0, errTornRecord
+		}
+		return nil, 0, err
+	}
+	bodySize := binary.BigEndian.Uint32(header[4:])
+	if bodySize < recordPrefixSize || bodySize > maxRecordBody {
+		return nil, 0, errTornRecord
+	}
+
+	body := make([]byte, bodySize)
+	if _, err := r.ReadAt(body, offset+recordHeaderSize); err != nil {
+		if err == io.EOF {
+			return nil, 0, errTornRecord
+		}
+		return nil, 0, err
+	}
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(header) {
+		return nil, 0, errTornRecord
+	}
+
+	pluginIDLen := int(binary.BigEndian.Uint16(body[9:]))
+	versionLen := int(binary.BigEndian.Uint16(body[11:]))
+	if recordPrefixSize+pluginIDLen+versionLen > len(body) {
+		return nil, 0, errTornRecord
+	}
+	n := recordPrefixSize
+	record := &logRecord{
+		kind:      body[0],
+		timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(body[1:]))),
+		pluginID:  string(body[n : n+pluginIDLen]),
+		version:   string(body[n+pluginIDLen : n+pluginIDLen+versionLen]),
+		data:      body[n+pluginIDLen+versionLen:],
+	}
+	return record, int64(recordHeaderSize) + int64(bodySize), nil
+}
@@ -56,7 +56,8 @@ type StateVersion struct {
 type stateManager struct {
 	storage     StateStorage
 	serializer  StateSerializer
-	migrations  map[string]StateMigrator // pluginID -> migrator
+	serializers map[string]StateSerializer // pluginID -> what its exported state is encoded with
+	migrations  map[string][]migrationEdge // pluginID -> migrators by version
 	mu          sync.RWMutex
 }
 
@@ -64,18 +65,12 @@ type stateManager struct {
 func NewStateManager(storage StateStorage, serializer StateSerializer) *stateManager {
 	return &stateManager{
 		storage:    storage,
-		serializer: serializer,
-		migrations: make(map[string]StateMigrator),
+		serializer:  serializer,
+		serializers: make(map[string]StateSerializer),
+		migrations:  make(map[string][]migrationEdge),
 	}
 }
 
-// RegisterMigrator registers a state migrator for a plugin
-func (m *stateManager) RegisterMigrator(pluginID string, migrator StateMigrator) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.migrations[pluginID] = migrator
-}
-
 // SaveState saves plugin state
 func (m *stateManager) SaveState(ctx context.Context, pluginID string, version string, state interface{}) error {
 	// Serialize state
@@ -108,22 +103,9 @@ func (m *stateManager) LoadState(ctx context.Context, pluginID string, version s
 	return nil
 }
 
-// MigrateState migrates state from one version to another
+// MigrateState migrates state from one version to another, chaining the
+// registered migrators along the shortest path between the versions
 func (m *stateManager) MigrateState(ctx context.Context, pluginID string, fromVersion, toVersion string) ([]byte, error) {
-	// Get migrator
-	m.mu.RLock()
-	migrator, exists := m.migrations[pluginID]
-	m.mu.RUnlock()
-	
-	if !exists {
-		return nil, fmt.Errorf("no migrator registered for plugin %s", pluginID)
-	}
-	
-	// Check if migration is supported
-	if !migrator.CanMigrate(fromVersion, toVersion) {
-		return nil, fmt.Errorf("migration not supported from %s to %s", fromVersion, toVersion)
-	}
-	
 	// Load old state
 	oldState, err := m.storage.Load(ctx, pluginID, fromVersion)
 	if err != nil {
@@ -131,7 +113,7 @@ func (m *stateManager) MigrateState(ctx context.Context, pluginID string, fromVe
 	}
 	
 	// Perform migration
-	newState, err := migrator.Migrate(ctx, oldState, fromVersion, toVersion)
+	newState, _, err := m.migrate(ctx, pluginID, fromVersion, toVersion, oldState)
 	if err != nil {
 		return nil, fmt.Errorf("migration failed: %w", err)
 	}
@@ -0,0 +1,265 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var (
+	// ErrNoMigrationPath is returned when no chain of registered migrators
+	// leads from one version to another
+	ErrNoMigrationPath = errors.New("no migration path")
+)
+
+// StateValidator is implemented by migrators that can check the state they
+// produce. A step's result is validated before the next step runs.
+type StateValidator interface {
+	// Validate checks that state is valid in version's format
+	Validate(state []byte, version string) error
+}
+
+// migrationEdge is a migrator registered for one version to another
+type migrationEdge struct {
+	from     string
+	to       string
+	migrator StateMigrator
+}
+
+// MigrationStep describes what one migrator changed
+type MigrationStep struct {
+	FromVersion string
+	ToVersion   string
+	SizeBefore  int
+	SizeAfter   int
+
+	// Added, Removed and Changed list the top-level fields the step added,
+	// removed or changed. They are empty when the state isn't an object.
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// MigrationReport describes a migration from one version to another
+type MigrationReport struct {
+	PluginID    string
+	FromVersion string
+	ToVersion   string
+	Steps       []MigrationStep
+	DryRun      bool
+}
+
+// Path returns the versions the migration passes through, in order
+func (r *MigrationReport) Path() []string {
+	path := []string{r.FromVersion}
+	for _, step := range r.Steps {
+		path = append(path, step.ToVersion)
+	}
+	return path
+}
+
+// RegisterMigrator registers a migrator for a plugin's state from one
+// version to another. Upgrades and downgrades are separate edges; migrations
+// between versions without a direct edge are chained through the others.
+func (m *stateManager) RegisterMigrator(pluginID, fromVersion, toVersion string, migrator StateMigrator) error {
+	if fromVersion == toVersion {
+		return fmt.Errorf("migrator for %s must change version", fromVersion)
+	}
+	if !migrator.CanMigrate(fromVersion, toVersion) {
+		return fmt.Errorf("migrator does not support migration from %s to %s", fromVersion, toVersion)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The edges are replaced rather than changed, since migrationPath may
+	// be reading them
+	edges := append([]migrationEdge(nil), m.migrations[pluginID]...)
+	m.migrations[pluginID] = edges
+	for i, edge := range edges {
+		if edge.from == fromVersion && edge.to == toVersion {
+			edges[i].migrator = migrator
+			return nil
+		}
+	}
+	m.migrations[pluginID] = append(edges, migrationEdge{from: fromVersion, to: toVersion, migrator: migrator})
+	return nil
+}
+
+// RegisterSerializer registers what a plugin's exported state is encoded
+// with. State migrated for plugins with a serializer must decode with it;
+// other plugins' state may be in any format.
+func (m *stateManager) RegisterSerializer(pluginID string, serializer StateSerializer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.serializers[pluginID] = serializer
+}
+
+// pluginSerializer returns the serializer registered for a plugin, if any
+func (m *stateManager) pluginSerializer(pluginID string) (StateSerializer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	serializer, ok := m.serializers[pluginID]
+	return serializer, ok
+}
+
+// hasMigrator reports whether any migrator is registered for a plugin
+func (m *stateManager) hasMigrator(pluginID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.migrations[pluginID]) > 0
+}
+
+// migrationPath finds the shortest chain of migrators from one version to
+// another. Edges are tried in the order they were registered, so the same
+// path is chosen between paths of equal length.
+func (m *stateManager) migrationPath(pluginID, fromVersion, toVersion string) ([]migrationEdge, error) {
+	if fromVersion == toVersion {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	edges := m.migrations[pluginID]
+	m.mu.RUnlock()
+
+	// Breadth-first search, remembering the edge each version was reached by
+	via := map[string]migrationEdge{}
+	visited := map[string]bool{fromVersion: true}
+	queue := []string{fromVersion}
+	for len(queue) > 0 && !visited[toVersion] {
+		version := queue[0]
+		queue = queue[1:]
+		for _, edge := range edges {
+			if edge.from != version || visited[edge.to] {
+				continue
+			}
+			visited[edge.to] = true
+			via[edge.to] = edge
+			queue = append(queue, edge.to)
+		}
+	}
+
+	if !visited[toVersion] {
+		return nil, fmt.Errorf("%w for plugin %s from %s to %s", ErrNoMigrationPath, pluginID, fromVersion, toVersion)
+	}
+
+	var path []migrationEdge
+	for version := toVersion; version != fromVersion; version = via[version].from {
+		path = append([]migrationEdge{via[version]}, path...)
+	}
+	return path, nil
+}
+
+// migrate runs each migrator on the path from one version to another,
+// validating every step's result, and reports what each step changed
+func (m *stateManager) migrate(ctx context.Context, pluginID, fromVersion, toVersion string, state []byte) ([]byte, *MigrationReport, error) {
+	path, err := m.migrationPath(pluginID, fromVersion, toVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &MigrationReport{PluginID: pluginID, FromVersion: fromVersion, ToVersion: toVersion}
+	for _, edge := range path {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		migrated, err := edge.migrator.Migrate(ctx, state, edge.from, edge.to)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migration from %s to %s failed: %w", edge.from, edge.to, err)
+		}
+		if err := m.validate(pluginID, edge, migrated); err != nil {
+			return nil, nil, fmt.Errorf("migration from %s to %s produced invalid state: %w", edge.from, edge.to, err)
+		}
+
+		report.Steps = append(report.Steps, m.describeStep(pluginID, edge, state, migrated))
+		state = migrated
+	}
+	return state, report, nil
+}
+
+// validate checks the state a step produced can be read back, if the plugin
+// has a serializer, and, if the migrator can validate it, is valid in the
+// step's target version
+func (m *stateManager) validate(pluginID string, edge migrationEdge, state []byte) error {
+	if serializer, ok := m.pluginSerializer(pluginID); ok {
+		var decoded interface{}
+		if err := serializer.Deserialize(state, &decoded); err != nil {
+			return err
+		}
+	}
+	if validator, ok := edge.migrator.(StateValidator); ok {
+		return validator.Validate(state, edge.to)
+	}
+	return nil
+}
+
+// describeStep compares the state before and after a step. Only the sizes
+// of state that doesn't decode to fields are compared.
+func (m *stateManager) describeStep(pluginID string, edge migrationEdge, before, after []byte) MigrationStep {
+	step := MigrationStep{
+		FromVersion: edge.from,
+		ToVersion:   edge.to,
+		SizeBefore:  len(before),
+		SizeAfter:   len(after),
+	}
+
+	serializer, ok := m.pluginSerializer(pluginID)
+	if !ok {
+		serializer = m.serializer
+	}
+	var oldFields, newFields map[string]interface{}
+	if serializer.Deserialize(before, &oldFields) != nil || serializer.Deserialize(after, &newFields) != nil {
+		return step
+	}
+	for key, value := range newFields {
+		old, existed := oldFields[key]
+		switch {
+		case !existed:
+			step.Added = append(step.Added, key)
+		case !reflect.DeepEqual(old, value):
+			step.Changed = append(step.Changed, key)
+		}
+	}
+	for key := range oldFields {
+		if _, exists := newFields[key]; !exists {
+			step.Removed = append(step.Removed, key)
+		}
+	}
+	sort.Strings(step.Added)
+	sort.Strings(step.Removed)
+	sort.Strings(step.Changed)
+	return step
+}
+
+// MigrationPath returns the versions a migration from one version to another
+// would pass through
+func (m *stateManager) MigrationPath(pluginID, fromVersion, toVersion string) ([]string, error) {
+	path, err := m.migrationPath(pluginID, fromVersion, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{fromVersion}
+	for _, edge := range path {
+		versions = append(versions, edge.to)
+	}
+	return versions, nil
+}
+
+// DryRunMigration runs a migration on the stored state without saving the
+// result, and reports what it would change
+func (m *stateManager) DryRunMigration(ctx context.Context, pluginID, fromVersion, toVersion string) (*MigrationReport, error) {
+	oldState, err := m.storage.Load(ctx, pluginID, fromVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state for version %s: %w", fromVersion, err)
+	}
+
+	_, report, err := m.migrate(ctx, pluginID, fromVersion, toVersion, oldState)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = true
+	return report, nil
+}
@@ -17,6 +17,7 @@ type Checkpoint struct {
 	ID        string                 `json:"id"`
 	PluginID  string                 `json:"plugin_id"`
 	Timestamp time.Time              `json:"timestamp"`
+	Size      int64                  `json:"size"`
 	State     []byte                 `json:"-"` // Not included in JSON
 	Metadata  map[string]interface{} `json:"metadata"`
 }
@@ -64,21 +65,64 @@ func (m *FileRollbackManager) CreateCheckpoint(ctx context.Context, pluginID str
 		ID:        checkpointID,
 		PluginID:  pluginID,
 		Timestamp: time.Now(),
+		Size:      int64(len(state)),
 		State:     state,
 		Metadata: map[string]interface{}{
 			"version": version,
 		},
 	}
 	
+	if err := m.writeCheckpoint(checkpoint); err != nil {
+		return "", err
+	}
+	
+	return checkpointID, nil
+}
+
+// SaveCheckpoint stores a checkpoint of state exported elsewhere, such as by
+// the checkpoint scheduler
+func (m *FileRollbackManager) SaveCheckpoint(ctx context.Context, checkpoint Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writeCheckpoint(checkpoint)
+}
+
+// LoadCheckpoint reads a checkpoint with its state
+func (m *FileRollbackManager) LoadCheckpoint(ctx context.Context, checkpointID string) (Checkpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	metadataData, err := os.ReadFile(filepath.Join(m.baseDir, fmt.Sprintf("%s.meta.json", checkpointID)))
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("failed to read checkpoint metadata: %w", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(metadataData, &checkpoint); err != nil {
+		return Checkpoint{}, fmt.Errorf("failed to unmarshal checkpoint metadata: %w", err)
+	}
+	
+	checkpoint.State, err = os.ReadFile(filepath.Join(m.baseDir, fmt.Sprintf("%s.state", checkpointID)))
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("failed to read checkpoint state: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// writeCheckpoint writes a checkpoint's metadata and state. Callers must
+// hold m.mu.
+func (m *FileRollbackManager) writeCheckpoint(checkpoint Checkpoint) error {
+	checkpointID := checkpoint.ID
+	state := checkpoint.State
+	
 	// Save checkpoint metadata
 	metadataPath := filepath.Join(m.baseDir, fmt.Sprintf("%s.meta.json", checkpointID))
 	metadataData, err := json.MarshalIndent(checkpoint, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal checkpoint metadata: %w", err)
+		return fmt.Errorf("failed to marshal checkpoint metadata: %w", err)
 	}
 	
 	if err := os.WriteFile(metadataPath, metadataData, 0644); err != nil {
-		return "", fmt.Errorf("failed to write checkpoint metadata: %w", err)
+		return fmt.Errorf("failed to write checkpoint metadata: %w", err)
 	}
 	
 	// Save checkpoint state
@@ -86,10 +130,10 @@ func (m *FileRollbackManager) CreateCheckpoint(ctx context.Context, pluginID str
 	if err := os.WriteFile(statePath, state, 0644); err != nil {
 		// Clean up metadata on failure
 		_ = os.Remove(metadataPath)
-		return "", fmt.Errorf("failed to write checkpoint state: %w", err)
+		return fmt.Errorf("failed to write checkpoint state: %w", err)
 	}
 	
-	return checkpointID, nil
+	return nil
 }
 
 // Rollback rolls back to a checkpoint
@@ -186,6 +230,12 @@ func (m *FileRollbackManager) ListCheckpoints(ctx context.Context, pluginID stri
 			
 			// Filter by plugin ID
 			if checkpoint.PluginID == pluginID {
+				// Checkpoints from before sizes were recorded
+				if checkpoint.Size == 0 {
+					if info, err := os.Stat(filepath.Join(m.baseDir, fmt.Sprintf("%s.state", checkpoint.ID))); err == nil {
+						checkpoint.Size = info.Size()
+					}
+				}
 				checkpoints = append(checkpoints, checkpoint)
 			}
 		}
@@ -273,6 +323,7 @@ func (m *MemoryRollbackManager) CreateCheckpoint(ctx context.Context, pluginID s
 		ID:        checkpointID,
 		PluginID:  pluginID,
 		Timestamp: time.Now(),
+		Size:      int64(len(state)),
 		State:     append([]byte(nil), state...), // Make a copy
 		Metadata: map[string]interface{}{
 			"version": version,
@@ -315,4 +366,45 @@ func (m *MemoryRollbackManager) CleanupCheckpoint(ctx context.Context, checkpoin
 	
 	delete(m.checkpoints, checkpointID)
 	return nil
-}
\ No newline at end of file
+}
+
+// SaveCheckpoint stores a checkpoint of state exported elsewhere, such as by
+// the checkpoint scheduler
+func (m *MemoryRollbackManager) SaveCheckpoint(ctx context.Context, checkpoint Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	checkpoint.State = append([]byte(nil), checkpoint.State...)
+	m.checkpoints[checkpoint.ID] = &checkpoint
+	return nil
+}
+
+// LoadCheckpoint returns a checkpoint with its state
+func (m *MemoryRollbackManager) LoadCheckpoint(ctx context.Context, checkpointID string) (Checkpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	checkpoint, exists := m.checkpoints[checkpointID]
+	if !exists {
+		return Checkpoint{}, fmt.Errorf("checkpoint %s not found", checkpointID)
+	}
+	loaded := *checkpoint
+	loaded.State = append([]byte(nil), checkpoint.State...)
+	return loaded, nil
+}
+
+// ListCheckpoints lists all checkpoints for a plugin, without their state
+func (m *MemoryRollbackManager) ListCheckpoints(ctx context.Context, pluginID string) ([]Checkpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	
+	var checkpoints []Checkpoint
+	for _, checkpoint := range m.checkpoints {
+		if checkpoint.PluginID == pluginID {
+			listed := *checkpoint
+			listed.State = nil
+			checkpoints = append(checkpoints, listed)
+		}
+	}
+	return checkpoints, nil
+}
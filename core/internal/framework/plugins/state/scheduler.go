@@ -0,0 +1,504 @@
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+// Metadata keys of scheduled checkpoints
+const (
+	// MetadataScheduled marks checkpoints the scheduler took, which are the
+	// only ones its retention policy removes
+	MetadataScheduled = "scheduled"
+	// MetadataTrigger records why a scheduled checkpoint was taken
+	MetadataTrigger = "trigger"
+)
+
+// Checkpoint triggers
+const (
+	TriggerLoaded   = "loaded"
+	TriggerInterval = "interval"
+	TriggerRequests = "requests"
+	TriggerManual   = "manual"
+)
+
+// CheckpointSource is where the scheduler finds plugins and their state. The
+// mesh plugin manager is one.
+type CheckpointSource interface {
+	ListPlugins() []plugins.PluginInfo
+	StateTransfer
+}
+
+// CheckpointStore keeps checkpoints. The rollback managers are stores.
+type CheckpointStore interface {
+	SaveCheckpoint(ctx context.Context, checkpoint Checkpoint) error
+	LoadCheckpoint(ctx context.Context, checkpointID string) (Checkpoint, error)
+	ListCheckpoints(ctx context.Context, pluginID string) ([]Checkpoint, error)
+	CleanupCheckpoint(ctx context.Context, checkpointID string) error
+}
+
+// RetentionPolicy decides which scheduled checkpoints of a plugin are kept,
+// grandfather-father-son style. Going back from the newest, the latest
+// checkpoint of each hour, day and week is kept until each has kept its
+// count. A policy with no counts keeps every checkpoint.
+type RetentionPolicy struct {
+	Last     int   // Most recent checkpoints kept whatever their age
+	Hourly   int   // Hours to keep the latest checkpoint of
+	Daily    int   // Days to keep the latest checkpoint of
+	Weekly   int   // Weeks to keep the latest checkpoint of
+	MaxBytes int64 // Total size of the plugin's checkpoints, 0 for no limit. The oldest go first; the newest is always kept.
+}
+
+// DefaultRetentionPolicy keeps hourly checkpoints for a day and daily ones
+// for a week
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{Last: 3, Hourly: 24, Daily: 7}
+}
+
+// CheckpointPolicy decides when a plugin is checkpointed and which of its
+// checkpoints are kept
+type CheckpointPolicy struct {
+	Interval      time.Duration // Checkpoint at least this often, 0 to only checkpoint after requests
+	AfterRequests int           // Checkpoint after this many state-changing requests, 0 to only checkpoint on the interval
+	Methods       []string      // Request methods that change state, every method if empty
+	Retention     RetentionPolicy
+}
+
+// DefaultCheckpointPolicy checkpoints every 15 minutes and keeps checkpoints
+// as DefaultRetentionPolicy does
+func DefaultCheckpointPolicy() CheckpointPolicy {
+	return CheckpointPolicy{Interval: 15 * time.Minute, Retention: DefaultRetentionPolicy()}
+}
+
+// enabled reports whether the policy checkpoints at all
+func (p CheckpointPolicy) enabled() bool {
+	return p.Interval > 0 || p.AfterRequests > 0
+}
+
+// SchedulerConfig configures a CheckpointScheduler
+type SchedulerConfig struct {
+	Source    CheckpointSource
+	Store     CheckpointStore
+	Policy    CheckpointPolicy            // Policy of plugins without an override
+	Overrides map[string]CheckpointPolicy // Policies of individual plugins, replacing Policy
+	Tick      time.Duration               // How often plugins are checked for a due checkpoint
+	Logger    *zap.Logger
+}
+
+// CheckpointScheduler checkpoints the state of every stateful plugin on an
+// interval and after a number of state-changing requests, and prunes the
+// checkpoints by each plugin's retention policy. A plugin that goes bad,
+// such as after a release, can be restored to a recent checkpoint whether
+// or not it was hot-swapped. It is a plugins.RequestObserver, which is how
+// it counts requests.
+type CheckpointScheduler struct {
+	config SchedulerConfig
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	plugins map[string]*scheduledPlugin
+
+	// checkpointMu serializes checkpoints, so retention sees each one
+	checkpointMu sync.Mutex
+
+	wake      chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// scheduledPlugin is the scheduler's view of one plugin
+type scheduledPlugin struct {
+	version  string
+	last     time.Time // of the last checkpoint, or when the plugin was found not to keep state
+	checksum [sha256.Size]byte
+	requests int
+	due      bool
+	// stateless plugins are skipped until their version changes
+	stateless bool
+}
+
+// NewCheckpointScheduler creates a scheduler, which starts checkpointing
+// when Start is called
+func NewCheckpointScheduler(config SchedulerConfig) *CheckpointScheduler {
+	if config.Tick <= 0 {
+		config.Tick = 10 * time.Second
+	}
+	if config.Logger == nil {
+		config.Logger = zap.NewNop()
+	}
+	return &CheckpointScheduler{
+		config:  config,
+		logger:  config.Logger,
+		plugins: make(map[string]*scheduledPlugin),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start starts checkpointing in the background
+func (s *CheckpointScheduler) Start() {
+	s.startOnce.Do(func() {
+		go s.run()
+	})
+}
+
+// Stop stops checkpointing, waiting for a checkpoint being taken
+func (s *CheckpointScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+		s.startOnce.Do(func() { close(s.stopped) })
+		<-s.stopped
+	})
+}
+
+// ForgetPlugin stops tracking an unloaded plugin. A version loaded later is
+// checkpointed as a new plugin.
+func (s *CheckpointScheduler) ForgetPlugin(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.plugins, name)
+}
+
+// ObserveRequest counts a request a plugin served, making the plugin due a
+// checkpoint once enough state-changing requests were served
+func (s *CheckpointScheduler) ObserveRequest(plugin string, request plugins.PluginRequest, err error) {
+	if err != nil {
+		return
+	}
+	policy := s.policyFor(plugin)
+	if policy.AfterRequests <= 0 {
+		return
+	}
+	if len(policy.Methods) > 0 && !slices.Contains(policy.Methods, request.Method) {
+		return
+	}
+
+	s.mu.Lock()
+	p := s.pluginState(plugin)
+	p.requests++
+	due := p.requests >= policy.AfterRequests && !p.stateless
+	if due {
+		p.due = true
+	}
+	s.mu.Unlock()
+
+	if due {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Checkpoint checkpoints a plugin now and prunes its checkpoints
+func (s *CheckpointScheduler) Checkpoint(ctx context.Context, pluginID string) (Checkpoint, error) {
+	for _, info := range s.config.Source.ListPlugins() {
+		if info.Name == pluginID {
+			return s.checkpoint(ctx, info, TriggerManual)
+		}
+	}
+	return Checkpoint{}, plugins.ErrPluginNotFound
+}
+
+// Restore imports the state of a scheduled checkpoint into the running
+// plugin. Hot-swap checkpoints hold state as stored rather than as
+// exported, and are restored by rolling the swap back.
+func (s *CheckpointScheduler) Restore(ctx context.Context, pluginID, checkpointID string) error {
+	checkpoint, err := s.config.Store.LoadCheckpoint(ctx, checkpointID)
+	if err != nil {
+		return err
+	}
+	if checkpoint.PluginID != pluginID {
+		return fmt.Errorf("checkpoint %s is for plugin %s, not %s", checkpointID, checkpoint.PluginID, pluginID)
+	}
+	if scheduled, _ := checkpoint.Metadata[MetadataScheduled].(bool); !scheduled {
+		return fmt.Errorf("checkpoint %s was not taken by the scheduler", checkpointID)
+	}
+	if err := s.config.Source.ImportPluginState(pluginID, checkpoint.State); err != nil {
+		return fmt.Errorf("failed to restore checkpoint %s: %w", checkpointID, err)
+	}
+
+	s.logger.Info("Restored plugin checkpoint",
+		zap.String("plugin", pluginID),
+		zap.String("checkpoint", checkpointID),
+		zap.Time("taken", checkpoint.Timestamp))
+	return nil
+}
+
+// Prune removes the scheduled checkpoints of a plugin its retention policy
+// doesn't keep
+func (s *CheckpointScheduler) Prune(ctx context.Context, pluginID string) error {
+	checkpoints, err := s.config.Store.ListCheckpoints(ctx, pluginID)
+	if err != nil {
+		return fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+
+	var scheduled []Checkpoint
+	for _, checkpoint := range checkpoints {
+		if flag, _ := checkpoint.Metadata[MetadataScheduled].(bool); flag {
+			scheduled = append(scheduled, checkpoint)
+		}
+	}
+
+	for _, checkpoint := range expired(scheduled, s.policyFor(pluginID).Retention) {
+		if err := s.config.Store.CleanupCheckpoint(ctx, checkpoint.ID); err != nil {
+			return fmt.Errorf("failed to remove checkpoint %s: %w", checkpoint.ID, err)
+		}
+	}
+	return nil
+}
+
+// run checkpoints plugins as they become due until Stop
+func (s *CheckpointScheduler) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.config.Tick)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.done
+		cancel()
+	}()
+
+	s.checkpointDue(ctx)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		s.checkpointDue(ctx)
+	}
+}
+
+// checkpointDue checkpoints every plugin that is due one
+func (s *CheckpointScheduler) checkpointDue(ctx context.Context) {
+	now := time.Now()
+	listed := make(map[string]bool)
+
+	for _, info := range s.config.Source.ListPlugins() {
+		listed[info.Name] = true
+		policy := s.policyFor(info.Name)
+		if !policy.enabled() {
+			continue
+		}
+
+		s.mu.Lock()
+		p := s.pluginState(info.Name)
+		if p.version != info.Version {
+			// A new version may keep state the old one didn't. Like a newly
+			// loaded plugin, it is checkpointed straight away.
+			p.version = info.Version
+			p.stateless = false
+			p.last = time.Time{}
+		}
+		trigger := ""
+		switch {
+		case p.stateless:
+		case p.due:
+			trigger = TriggerRequests
+		case p.last.IsZero():
+			trigger = TriggerLoaded
+		case policy.Interval > 0 && now.Sub(p.last) >= policy.Interval:
+			trigger = TriggerInterval
+		}
+		s.mu.Unlock()
+
+		if trigger == "" {
+			continue
+		}
+		if _, err := s.checkpoint(ctx, info, trigger); err != nil && !errors.Is(err, plugins.ErrStateNotSupported) {
+			s.logger.Warn("Failed to checkpoint plugin",
+				zap.String("plugin", info.Name),
+				zap.Error(err))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	// Forget unloaded plugins
+	s.mu.Lock()
+	for name := range s.plugins {
+		if !listed[name] {
+			delete(s.plugins, name)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// checkpoint exports a plugin's state and stores it, unless it hasn't
+// changed since the last checkpoint, then prunes the plugin's checkpoints
+func (s *CheckpointScheduler) checkpoint(ctx context.Context, info plugins.PluginInfo, trigger string) (Checkpoint, error) {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	state, err := s.config.Source.ExportPluginState(info.Name)
+	now := time.Now()
+	if errors.Is(err, plugins.ErrStateNotSupported) {
+		s.mu.Lock()
+		p := s.pluginState(info.Name)
+		p.stateless = true
+		p.due = false
+		p.version = info.Version
+		s.mu.Unlock()
+		return Checkpoint{}, err
+	}
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("failed to export state: %w", err)
+	}
+
+	checksum := sha256.Sum256(state)
+	s.mu.Lock()
+	p := s.pluginState(info.Name)
+	unchanged := trigger != TriggerManual && !p.last.IsZero() && p.checksum == checksum
+	p.last = now
+	p.requests = 0
+	p.due = false
+	s.mu.Unlock()
+	if unchanged {
+		return Checkpoint{}, nil
+	}
+
+	checkpoint := Checkpoint{
+		ID:        uuid.New().String(),
+		PluginID:  info.Name,
+		Timestamp: now,
+		Size:      int64(len(state)),
+		State:     state,
+		Metadata: map[string]interface{}{
+			"version":         info.Version,
+			MetadataScheduled: true,
+			MetadataTrigger:   trigger,
+		},
+	}
+	if err := s.config.Store.SaveCheckpoint(ctx, checkpoint); err != nil {
+		return Checkpoint{}, fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	s.mu.Lock()
+	s.pluginState(info.Name).checksum = checksum
+	s.mu.Unlock()
+
+	s.logger.Debug("Checkpointed plugin",
+		zap.String("plugin", info.Name),
+		zap.String("trigger", trigger),
+		zap.Int("size", len(state)))
+
+	if err := s.Prune(ctx, info.Name); err != nil {
+		s.logger.Warn("Failed to prune plugin checkpoints",
+			zap.String("plugin", info.Name),
+			zap.Error(err))
+	}
+	return checkpoint, nil
+}
+
+// policyFor returns the checkpoint policy of a plugin
+func (s *CheckpointScheduler) policyFor(pluginID string) CheckpointPolicy {
+	if policy, exists := s.config.Overrides[pluginID]; exists {
+		return policy
+	}
+	return s.config.Policy
+}
+
+// pluginState returns the scheduler's view of a plugin, creating it if
+// needed. Callers must hold s.mu.
+func (s *CheckpointScheduler) pluginState(pluginID string) *scheduledPlugin {
+	p, exists := s.plugins[pluginID]
+	if !exists {
+		p = &scheduledPlugin{}
+		s.plugins[pluginID] = p
+	}
+	return p
+}
+
+// retentionRule keeps the latest checkpoint of each of count periods
+type retentionRule struct {
+	count  int
+	period func(time.Time) string
+}
+
+// expired returns the checkpoints the retention policy doesn't keep
+func expired(checkpoints []Checkpoint, policy RetentionPolicy) []Checkpoint {
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Timestamp.After(checkpoints[j].Timestamp)
+	})
+
+	rules := []retentionRule{
+		{policy.Hourly, func(t time.Time) string { return t.UTC().Format("2006-01-02T15") }},
+		{policy.Daily, func(t time.Time) string { return t.UTC().Format("2006-01-02") }},
+		{policy.Weekly, func(t time.Time) string {
+			year, week := t.UTC().ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+	}
+
+	keep := make([]bool, len(checkpoints))
+	for i := range checkpoints {
+		keep[i] = i < policy.Last
+	}
+	// A policy without any count keeps everything
+	keepAll := policy.Last <= 0
+	for _, rule := range rules {
+		if rule.count <= 0 {
+			continue
+		}
+		keepAll = false
+		kept, last := 0, ""
+		for i, checkpoint := range checkpoints {
+			if kept == rule.count {
+				break
+			}
+			if period := rule.period(checkpoint.Timestamp); period != last {
+				keep[i] = true
+				kept++
+				last = period
+			}
+		}
+	}
+	if keepAll {
+		for i := range keep {
+			keep[i] = true
+		}
+	}
+
+	// Enforce the size budget, always keeping the newest checkpoint
+	if policy.MaxBytes > 0 {
+		var total int64
+		for i, checkpoint := range checkpoints {
+			if !keep[i] {
+				continue
+			}
+			total += checkpoint.Size
+			if i > 0 && total > policy.MaxBytes {
+				keep[i] = false
+				total -= checkpoint.Size
+			}
+		}
+	}
+
+	var drop []Checkpoint
+	for i, checkpoint := range checkpoints {
+		if !keep[i] {
+			drop = append(drop, checkpoint)
+		}
+	}
+	return drop
+}
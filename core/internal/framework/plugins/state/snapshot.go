@@ -0,0 +1,309 @@
+package state
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+// A node snapshot is a gzip-compressed tar archive with the layout
+//
+//	manifest.json           SnapshotManifest
+//	state/<plugin>.state    exported state of each plugin that keeps state
+//
+// The manifest comes first so a reader knows what to expect, and lists the
+// SHA-256 of every state entry.
+const (
+	SnapshotManifestFile = "manifest.json"
+	SnapshotStateDir     = "state"
+
+	// SnapshotFormatVersion is the version of the snapshot layout written
+	SnapshotFormatVersion = 1
+)
+
+// maxSnapshotManifestSize bounds the manifest entry
+const maxSnapshotManifestSize = 16 << 20
+
+var (
+	// ErrNotSnapshot is returned for archives that aren't node snapshots
+	ErrNotSnapshot = errors.New("not a node snapshot")
+
+	// ErrSnapshotFormat is returned for snapshots of an unknown layout
+	ErrSnapshotFormat = errors.New("unsupported snapshot format")
+)
+
+// SnapshotManifest describes a node snapshot
+type SnapshotManifest struct {
+	FormatVersion int              `json:"format_version"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Plugins       []SnapshotPlugin `json:"plugins"` // each after the plugins it depends on
+}
+
+// SnapshotPlugin is a plugin in a node snapshot
+type SnapshotPlugin struct {
+	Spec   plugins.PluginSpec `json:"spec"`
+	State  string             `json:"state,omitempty"` // archive entry, empty if the plugin keeps no state
+	Size   int64              `json:"size"`
+	SHA256 string             `json:"sha256,omitempty"`
+}
+
+// NodeSnapshot is a verified node snapshot read into memory
+type NodeSnapshot struct {
+	Manifest SnapshotManifest
+	States   map[string][]byte // by plugin name
+}
+
+// SnapshotSource is a node whose plugins can be snapshotted. The mesh plugin
+// manager is one.
+type SnapshotSource interface {
+	PluginSpecs() []plugins.PluginSpec
+	Quiesce(ctx context.Context) (func(), error)
+	StateTransfer
+}
+
+// SnapshotTarget is a node a snapshot can be restored to. The mesh plugin
+// manager is one.
+type SnapshotTarget interface {
+	SnapshotSource
+	LoadPlugins(specs []plugins.PluginSpec) error
+	HotSwapPlugin(name string, newVersion string) error
+}
+
+// CreateNodeSnapshot writes a snapshot of every plugin on a node to w.
+// Plugins are quiesced while their state is exported, so the snapshot is
+// consistent across plugins, and resumed before the archive is written.
+func CreateNodeSnapshot(ctx context.Context, source SnapshotSource, w io.Writer) (*SnapshotManifest, error) {
+	resume, err := source.Quiesce(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quiesce plugins: %w", err)
+	}
+
+	manifest := SnapshotManifest{
+		FormatVersion: SnapshotFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+	}
+	states := make(map[string][]byte)
+	for _, spec := range source.PluginSpecs() {
+		entry := SnapshotPlugin{Spec: spec}
+		state, err := source.ExportPluginState(spec.Name)
+		switch {
+		case errors.Is(err, plugins.ErrStateNotSupported):
+		case err != nil:
+			resume()
+			return nil, fmt.Errorf("failed to export state of plugin %s: %w", spec.Name, err)
+		default:
+			sum := sha256.Sum256(state)
+			entry.State = path.Join(SnapshotStateDir, spec.Name+".state")
+			entry.Size = int64(len(state))
+			entry.SHA256 = hex.EncodeToString(sum[:])
+			states[entry.State] = state
+		}
+		manifest.Plugins = append(manifest.Plugins, entry)
+	}
+	resume()
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeSnapshotEntry(tw, SnapshotManifestFile, manifestData, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Plugins {
+		if entry.State == "" {
+			continue
+		}
+		if err := writeSnapshotEntry(tw, entry.State, states[entry.State], manifest.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return &manifest, nil
+}
+
+// writeSnapshotEntry writes one file to a snapshot archive
+func writeSnapshotEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write snapshot entry %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write snapshot entry %s: %w", name, err)
+	}
+	return nil
+}
+
+// ReadNodeSnapshot reads a snapshot from r, checking every state against
+// the manifest. State that doesn't match is reported with an IntegrityError.
+func ReadNodeSnapshot(r io.Reader) (*NodeSnapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotSnapshot, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != SnapshotManifestFile {
+		return nil, fmt.Errorf("%w: manifest must come first", ErrNotSnapshot)
+	}
+	manifestData, err := io.ReadAll(io.LimitReader(tr, maxSnapshotManifestSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot manifest: %w", err)
+	}
+	var snapshot NodeSnapshot
+	if err := json.Unmarshal(manifestData, &snapshot.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrNotSnapshot, err)
+	}
+	if snapshot.Manifest.FormatVersion != SnapshotFormatVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrSnapshotFormat, snapshot.Manifest.FormatVersion)
+	}
+
+	expected := make(map[string]SnapshotPlugin)
+	for _, entry := range snapshot.Manifest.Plugins {
+		if entry.State != "" {
+			expected[entry.State] = entry
+		}
+	}
+
+	snapshot.States = make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		entry, listed := expected[header.Name]
+		if !listed {
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrNotSnapshot, header.Name)
+		}
+		delete(expected, header.Name)
+
+		state, err := io.ReadAll(io.LimitReader(tr, entry.Size+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot entry %s: %w", header.Name, err)
+		}
+		sum := sha256.Sum256(state)
+		if int64(len(state)) != entry.Size || hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return nil, &IntegrityError{PluginID: entry.Spec.Name, Version: entry.Spec.Version, Reason: "snapshot checksum mismatch"}
+		}
+		snapshot.States[entry.Spec.Name] = state
+	}
+	for _, entry := range expected {
+		return nil, &IntegrityError{PluginID: entry.Spec.Name, Version: entry.Spec.Version, Reason: "state missing from snapshot"}
+	}
+	return &snapshot, nil
+}
+
+// RestoreNodeSnapshot brings a node to the state of a snapshot. Plugins that
+// aren't loaded are loaded, those loaded at another version are hot-swapped
+// to the snapshot's version, and then, with plugins quiesced, the snapshot's
+// state is imported into each. Plugins not in the snapshot are left alone.
+func RestoreNodeSnapshot(ctx context.Context, target SnapshotTarget, snapshot *NodeSnapshot) error {
+	loaded := make(map[string]string)
+	for _, spec := range target.PluginSpecs() {
+		loaded[spec.Name] = spec.Version
+	}
+
+	var missing []plugins.PluginSpec
+	for _, entry := range snapshot.Manifest.Plugins {
+		if _, exists := loaded[entry.Spec.Name]; !exists {
+			missing = append(missing, entry.Spec)
+		}
+	}
+	if len(missing) > 0 {
+		if err := target.LoadPlugins(missing); err != nil {
+			return fmt.Errorf("failed to load snapshot plugins: %w", err)
+		}
+	}
+	for _, entry := range snapshot.Manifest.Plugins {
+		version, exists := loaded[entry.Spec.Name]
+		if !exists || version == entry.Spec.Version {
+			continue
+		}
+		if err := target.HotSwapPlugin(entry.Spec.Name, entry.Spec.Version); err != nil {
+			return fmt.Errorf("failed to swap plugin %s to version %s: %w", entry.Spec.Name, entry.Spec.Version, err)
+		}
+	}
+
+	resume, err := target.Quiesce(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to quiesce plugins: %w", err)
+	}
+	defer resume()
+
+	for _, entry := range snapshot.Manifest.Plugins {
+		state, exists := snapshot.States[entry.Spec.Name]
+		if !exists {
+			continue
+		}
+		if err := target.ImportPluginState(entry.Spec.Name, state); err != nil {
+			return fmt.Errorf("failed to restore state of plugin %s: %w", entry.Spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// SnapshotHandler is a node's snapshot API. GET returns a snapshot of the
+// node, and POST restores the node to the snapshot in the request body,
+// answering with the snapshot's manifest.
+func SnapshotHandler(target SnapshotTarget) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			// The snapshot is written once it is complete, so a failure can
+			// still be reported
+			var archive bytes.Buffer
+			if _, err := CreateNodeSnapshot(r.Context(), target, &archive); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(archive.Bytes())
+
+		case http.MethodPost:
+			snapshot, err := ReadNodeSnapshot(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := RestoreNodeSnapshot(r.Context(), target, snapshot); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snapshot.Manifest)
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
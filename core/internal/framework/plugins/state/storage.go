@@ -108,7 +108,11 @@ func (s *FileStateStorage) Load(ctx context.Context, pluginID string, version st
 	hash := sha256.Sum256(state)
 	checksum := hex.EncodeToString(hash[:])
 	if checksum != metadata.Checksum {
-		return nil, fmt.Errorf("state checksum mismatch: expected %s, got %s", metadata.Checksum, checksum)
+		return nil, &IntegrityError{
+			PluginID: pluginID,
+			Version:  version,
+			Reason:   fmt.Sprintf("checksum mismatch: expected %s, got %s", metadata.Checksum, checksum),
+		}
 	}
 	
 	return state, nil
@@ -334,4 +338,14 @@ func (s *StreamingStateStorage) LoadStream(ctx context.Context, pluginID string,
 	
 	_, err = writer.Write(data)
 	return err
-}
\ No newline at end of file
+}
+// syncDir flushes a directory, so files created or renamed in it survive a
+// crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
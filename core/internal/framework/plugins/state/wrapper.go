@@ -45,6 +45,17 @@ func (w *StateManagerWrapper) LoadState(plugin plugins.Plugin) error {
 	return plugin.ImportState(data)
 }
 
+// RegisterMigrator registers a migrator for a plugin's state from one
+// version to another
+func (w *StateManagerWrapper) RegisterMigrator(pluginID, fromVersion, toVersion string, migrator StateMigrator) error {
+	return w.manager.RegisterMigrator(pluginID, fromVersion, toVersion, migrator)
+}
+
+// RegisterSerializer registers what a plugin's exported state is encoded with
+func (w *StateManagerWrapper) RegisterSerializer(pluginID string, serializer StateSerializer) {
+	w.manager.RegisterSerializer(pluginID, serializer)
+}
+
 // MigrateState migrates plugin state between versions
 func (w *StateManagerWrapper) MigrateState(plugin plugins.Plugin, fromVersion, toVersion string) error {
 	info := plugin.Info()
@@ -0,0 +1,110 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// ErrStreamingUnsupported is returned when opening a stream to a plugin that
+// can't stream request or response bodies
+var ErrStreamingUnsupported = errors.New("plugin does not support streaming")
+
+// StreamMode says which sides of a request stream a body
+type StreamMode = protocol.StreamMode
+
+// Stream modes
+const (
+	StreamClient = protocol.StreamClient
+	StreamServer = protocol.StreamServer
+	StreamBidi   = protocol.StreamBidi
+)
+
+// PluginStream is a request whose body, response body or both are streamed.
+// Writes go to the plugin until CloseSend; reads return what the plugin
+// writes until it returns its response.
+type PluginStream interface {
+	io.Reader
+	io.Writer
+	// CloseSend ends the request body
+	CloseSend() error
+	// Response waits for the plugin's response. Client-streaming callers
+	// must CloseSend first.
+	Response() (PluginResponse, error)
+}
+
+// StreamingPlugin is implemented by plugins that can open streamed requests
+type StreamingPlugin interface {
+	OpenStream(ctx context.Context, request PluginRequest, mode StreamMode) (PluginStream, error)
+}
+
+// StreamHandler is implemented by plugins that handle streamed requests,
+// both in-process and when served with Run. in is empty unless the caller
+// streams a request body; out is closed unless it reads a response body.
+type StreamHandler interface {
+	HandleStream(ctx context.Context, request PluginRequest, in io.Reader, out io.Writer) (PluginResponse, error)
+}
+
+// openStream opens a stream to a plugin that streams over its transport or
+// handles streams in-process
+func openStream(ctx context.Context, plugin Plugin, request PluginRequest, mode StreamMode) (PluginStream, error) {
+	if streaming, ok := plugin.(StreamingPlugin); ok {
+		return streaming.OpenStream(ctx, request, mode)
+	}
+	if handler, ok := plugin.(StreamHandler); ok {
+		return NewLocalStream(ctx, handler, request, mode), nil
+	}
+	return nil, ErrStreamingUnsupported
+}
+
+// NewLocalStream runs a StreamHandler in-process, returning the caller's
+// end of the stream
+func NewLocalStream(ctx context.Context, handler StreamHandler, request PluginRequest, mode StreamMode) PluginStream {
+	return newLocalStream(ctx, handler, request, mode)
+}
+
+// localStream runs a StreamHandler in-process over pipes
+type localStream struct {
+	reqW  *io.PipeWriter
+	respR *io.PipeReader
+
+	done     chan struct{}
+	response PluginResponse
+	err      error
+}
+
+func newLocalStream(ctx context.Context, handler StreamHandler, request PluginRequest, mode StreamMode) *localStream {
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	s := &localStream{reqW: reqW, respR: respR, done: make(chan struct{})}
+
+	if !mode.ClientStreams() {
+		reqW.Close()
+	}
+	if !mode.ServerStreams() {
+		respR.CloseWithError(protocol.ErrStreamClosed)
+	}
+
+	go func() {
+		defer close(s.done)
+		s.response, s.err = handler.HandleStream(ctx, request, reqR, respW)
+		reqR.CloseWithError(protocol.ErrStreamClosed)
+		if s.err != nil {
+			respW.CloseWithError(s.err)
+		} else {
+			respW.Close()
+		}
+	}()
+	return s
+}
+
+func (s *localStream) Read(p []byte) (int, error)  { return s.respR.Read(p) }
+func (s *localStream) Write(p []byte) (int, error) { return s.reqW.Write(p) }
+func (s *localStream) CloseSend() error            { return s.reqW.Close() }
+
+func (s *localStream) Response() (PluginResponse, error) {
+	<-s.done
+	return s.response, s.err
+}
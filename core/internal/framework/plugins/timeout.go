@@ -0,0 +1,51 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is matched by errors for requests that ran past their deadline
+var ErrTimeout = errors.New("plugin request timed out")
+
+// TimeoutError reports a request a plugin didn't answer before its deadline.
+// errors.Is matches it against ErrTimeout and context.DeadlineExceeded.
+type TimeoutError struct {
+	Plugin   string
+	Method   string
+	Deadline time.Time
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("plugin %s timed out handling %s", e.Plugin, e.Method)
+}
+
+// Timeout reports true, like net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Is makes the error match ErrTimeout and context.DeadlineExceeded
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout || target == context.DeadlineExceeded
+}
+
+// CheckTimeout returns a *TimeoutError for the request if it failed once
+// ctx's deadline had passed, and err otherwise. Plugins see the same deadline
+// and may report it before the host's context expires.
+func CheckTimeout(ctx context.Context, plugin string, request PluginRequest, err error) error {
+	if err == nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Now().Before(deadline) || ctx.Err() == context.Canceled {
+		return err
+	}
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		return err
+	}
+	return &TimeoutError{Plugin: plugin, Method: request.Method, Deadline: deadline}
+}
@@ -0,0 +1,101 @@
+package trust
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
+)
+
+// Signer signs packages with a publisher's ed25519 key. It implements
+// archive.Signer.
+type Signer struct {
+	KeyID      string
+	Publisher  string
+	PrivateKey ed25519.PrivateKey
+}
+
+// signerFile is the on-disk form of a Signer
+type signerFile struct {
+	KeyID      string `json:"key_id"`
+	Publisher  string `json:"publisher"`
+	PrivateKey string `json:"private_key"`
+}
+
+// NewSigner creates a signer for a private key
+func NewSigner(publisher string, priv ed25519.PrivateKey) *Signer {
+	return &Signer{
+		KeyID:      KeyID(priv.Public().(ed25519.PublicKey)),
+		Publisher:  publisher,
+		PrivateKey: priv,
+	}
+}
+
+// GenerateKey creates a new signing key for publisher and the matching
+// public key to add to trust stores
+func GenerateKey(publisher string) (*Signer, Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, Key{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	signer := NewSigner(publisher, priv)
+	return signer, signer.PublicKey(), nil
+}
+
+// PublicKey returns the trust store entry for the signer's key
+func (s *Signer) PublicKey() Key {
+	return Key{
+		ID:        s.KeyID,
+		Publisher: s.Publisher,
+		PublicKey: s.PrivateKey.Public().(ed25519.PublicKey),
+		NotBefore: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// Sign implements archive.Signer
+func (s *Signer) Sign(manifest archive.Manifest, checksums []byte) (*archive.Signature, error) {
+	signedAt := time.Now().UTC()
+	return &archive.Signature{
+		Algorithm: "ed25519",
+		KeyID:     s.KeyID,
+		Publisher: s.Publisher,
+		SignedAt:  signedAt,
+		Value:     ed25519.Sign(s.PrivateKey, signingPayload(manifest, signedAt, checksums)),
+	}, nil
+}
+
+// LoadSigner reads a private key file written by WriteFile
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	var f signerFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(f.PrivateKey))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid private key in %s", path)
+	}
+	return NewSigner(f.Publisher, ed25519.NewKeyFromSeed(seed)), nil
+}
+
+// WriteFile writes the private key, readable only by the owner
+func (s *Signer) WriteFile(path string) error {
+	data, err := json.MarshalIndent(signerFile{
+		KeyID:      s.KeyID,
+		Publisher:  s.Publisher,
+		PrivateKey: base64.StdEncoding.EncodeToString(s.PrivateKey.Seed()),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
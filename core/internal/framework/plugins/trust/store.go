@@ -0,0 +1,243 @@
+// Package trust verifies plugin package signatures against a store of
+// publisher keys and a per-node signature policy.
+package trust
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tier is how much a publisher key is trusted
+type Tier string
+
+const (
+	// TierOfficial keys belong to the Blackhole Foundation
+	TierOfficial Tier = "official"
+	// TierCommunity keys belong to reviewed community publishers
+	TierCommunity Tier = "community"
+	// TierLocal keys were added by the node operator
+	TierLocal Tier = "local"
+)
+
+// Tiers lists the trust tiers, most trusted first
+var Tiers = []Tier{TierOfficial, TierCommunity, TierLocal}
+
+// revocationFile is the revocation list inside a trust directory
+const revocationFile = "revoked.json"
+
+// Key is a trusted publisher key. A publisher rotates keys by adding a new
+// key and setting Expires on the old one; packages signed while a key was
+// valid keep verifying after it expires.
+type Key struct {
+	ID        string            `json:"key_id"`
+	Publisher string            `json:"publisher"`
+	Tier      Tier              `json:"-"`
+	PublicKey ed25519.PublicKey `json:"-"`
+	NotBefore time.Time         `json:"not_before,omitempty"`
+	Expires   time.Time         `json:"expires,omitempty"`
+}
+
+// keyFile is the on-disk form of a Key
+type keyFile struct {
+	Key
+	PublicKey string `json:"public_key"`
+}
+
+// validAt reports whether the key was valid at t
+func (k Key) validAt(t time.Time) bool {
+	if !k.NotBefore.IsZero() && t.Before(k.NotBefore) {
+		return false
+	}
+	if !k.Expires.IsZero() && t.After(k.Expires) {
+		return false
+	}
+	return true
+}
+
+// Revocation withdraws trust in a key. Every signature made with a revoked
+// key is rejected, whenever it claims to have been made, since a
+// compromised key can backdate signatures.
+type Revocation struct {
+	KeyID     string    `json:"key_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Store holds the trusted publisher keys and revocations of a node
+type Store struct {
+	mu      sync.RWMutex
+	keys    map[string]Key
+	revoked map[string]Revocation
+}
+
+// NewStore creates an empty trust store
+func NewStore() *Store {
+	return &Store{
+		keys:    make(map[string]Key),
+		revoked: make(map[string]Revocation),
+	}
+}
+
+// LoadStore reads a trust directory laid out as
+//
+//	<dir>/official/*.json
+//	<dir>/community/*.json
+//	<dir>/local/*.json
+//	<dir>/revoked.json
+//
+// A missing directory yields an empty store.
+func LoadStore(dir string) (*Store, error) {
+	s := NewStore()
+
+	for _, tier := range Tiers {
+		files, err := filepath.Glob(filepath.Join(dir, string(tier), "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			key, err := ReadKeyFile(file)
+			if err != nil {
+				return nil, err
+			}
+			key.Tier = tier
+			if err := s.AddKey(key); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, revocationFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read revocation list: %w", err)
+	}
+	if err == nil {
+		var revocations []Revocation
+		if err := json.Unmarshal(data, &revocations); err != nil {
+			return nil, fmt.Errorf("failed to parse revocation list: %w", err)
+		}
+		for _, r := range revocations {
+			s.Revoke(r)
+		}
+	}
+
+	return s, nil
+}
+
+// AddKey trusts a key. A key ID that doesn't match the public key is an error.
+func (s *Store) AddKey(key Key) error {
+	if len(key.PublicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid ed25519 public key")
+	}
+	if key.Publisher == "" {
+		return errors.New("key has no publisher")
+	}
+	id := KeyID(key.PublicKey)
+	if key.ID != "" && key.ID != id {
+		return fmt.Errorf("key id %s does not match public key %s", key.ID, id)
+	}
+	key.ID = id
+	if key.Tier == "" {
+		key.Tier = TierLocal
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = key
+	return nil
+}
+
+// Revoke adds a key to the revocation list. Keys can be revoked before they
+// are added, so a revocation list can be distributed independently.
+func (s *Store) Revoke(r Revocation) {
+	if r.RevokedAt.IsZero() {
+		r.RevokedAt = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[r.KeyID] = r
+}
+
+// Key returns a trusted key by ID
+func (s *Store) Key(id string) (Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// Revoked returns the revocation of a key, if any
+func (s *Store) Revoked(id string) (Revocation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.revoked[id]
+	return r, ok
+}
+
+// Keys returns the trusted keys sorted by publisher and ID
+func (s *Store) Keys() []Key {
+	s.mu.RLock()
+	keys := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Publisher != keys[j].Publisher {
+			return keys[i].Publisher < keys[j].Publisher
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// KeyID derives the ID of a public key
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ReadKeyFile reads a public key file
+func ReadKeyFile(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to read key file: %w", err)
+	}
+	var f keyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Key{}, fmt.Errorf("failed to parse key file %s: %w", path, err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(f.PublicKey))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Key{}, fmt.Errorf("invalid public key in %s", path)
+	}
+	key := f.Key
+	key.PublicKey = pub
+	return key, nil
+}
+
+// WriteFile writes the key in the format read by LoadStore
+func (k Key) WriteFile(path string) error {
+	if k.ID == "" {
+		k.ID = KeyID(k.PublicKey)
+	}
+	data, err := json.MarshalIndent(keyFile{
+		Key:       k,
+		PublicKey: base64.StdEncoding.EncodeToString(k.PublicKey),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
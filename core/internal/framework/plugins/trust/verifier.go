@@ -0,0 +1,188 @@
+package trust
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
+)
+
+// Verification errors
+var (
+	ErrUnsigned             = errors.New("package is not signed")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+	ErrUnknownKey           = errors.New("signing key is not trusted")
+	ErrKeyRevoked           = errors.New("signing key has been revoked")
+	ErrKeyExpired           = errors.New("signature made outside the key's validity period")
+	ErrBadSignature         = errors.New("signature does not match package contents")
+	ErrPublisherMismatch    = errors.New("signature publisher does not match key")
+	ErrTierNotAllowed       = errors.New("publisher tier not allowed by policy")
+)
+
+// Mode is how a node treats packages that aren't signed by a trusted key
+type Mode string
+
+const (
+	// ModeRequire rejects anything not signed by a trusted key
+	ModeRequire Mode = "require"
+	// ModeWarn loads unsigned and untrusted packages with a warning
+	ModeWarn Mode = "warn"
+	// ModeAllow loads unsigned and untrusted packages silently
+	ModeAllow Mode = "allow"
+)
+
+// ParseMode parses a policy mode, defaulting to ModeWarn for ""
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "":
+		return ModeWarn, nil
+	case ModeRequire, ModeWarn, ModeAllow:
+		return Mode(s), nil
+	default:
+		return "", fmt.Errorf("invalid signature policy %q: must be require, warn or allow", s)
+	}
+}
+
+// Policy is the signature policy of a node
+type Policy struct {
+	Mode Mode
+	// Tiers limits the trusted tiers, all tiers are trusted if empty
+	Tiers []Tier
+}
+
+// VerificationError reports why a package failed verification and who
+// it claims to come from
+type VerificationError struct {
+	Plugin    string
+	Version   string
+	Publisher string
+	KeyID     string
+	Err       error
+}
+
+func (e *VerificationError) Error() string {
+	if e.Publisher == "" && e.KeyID == "" {
+		return fmt.Sprintf("plugin %s %s: %v", e.Plugin, e.Version, e.Err)
+	}
+	return fmt.Sprintf("plugin %s %s from publisher %q (key %s): %v",
+		e.Plugin, e.Version, e.Publisher, e.KeyID, e.Err)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Verifier checks package signatures against a trust store. It implements
+// archive.SignatureVerifier.
+type Verifier struct {
+	store  *Store
+	policy Policy
+	logger *zap.Logger
+}
+
+// NewVerifier creates a verifier enforcing policy with the keys in store
+func NewVerifier(store *Store, policy Policy, logger *zap.Logger) *Verifier {
+	if store == nil {
+		store = NewStore()
+	}
+	if policy.Mode == "" {
+		policy.Mode = ModeWarn
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Verifier{store: store, policy: policy, logger: logger}
+}
+
+// Policy returns the policy being enforced
+func (v *Verifier) Policy() Policy {
+	return v.policy
+}
+
+// VerifySignature implements archive.SignatureVerifier. Signatures that are
+// present but don't match, or were made with a revoked key, are rejected
+// under every policy; missing or untrusted signatures only under ModeRequire.
+func (v *Verifier) VerifySignature(manifest archive.Manifest, checksums []byte, sig *archive.Signature) error {
+	err := v.check(manifest, checksums, sig)
+	if err == nil {
+		return nil
+	}
+
+	if v.policy.Mode == ModeRequire || errors.Is(err, ErrBadSignature) || errors.Is(err, ErrKeyRevoked) {
+		return err
+	}
+	if v.policy.Mode == ModeWarn {
+		v.logger.Warn("Loading plugin that failed signature policy",
+			zap.String("plugin", manifest.Name),
+			zap.String("version", manifest.Version),
+			zap.Error(err))
+	}
+	return nil
+}
+
+func (v *Verifier) check(manifest archive.Manifest, checksums []byte, sig *archive.Signature) error {
+	fail := func(publisher, keyID string, err error) error {
+		return &VerificationError{
+			Plugin:    manifest.Name,
+			Version:   manifest.Version,
+			Publisher: publisher,
+			KeyID:     keyID,
+			Err:       err,
+		}
+	}
+
+	if sig == nil {
+		return fail("", "", ErrUnsigned)
+	}
+	if sig.Algorithm != "ed25519" {
+		return fail(sig.Publisher, sig.KeyID, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, sig.Algorithm))
+	}
+	if _, revoked := v.store.Revoked(sig.KeyID); revoked {
+		return fail(sig.Publisher, sig.KeyID, ErrKeyRevoked)
+	}
+	key, ok := v.store.Key(sig.KeyID)
+	if !ok {
+		return fail(sig.Publisher, sig.KeyID, ErrUnknownKey)
+	}
+
+	if !ed25519.Verify(key.PublicKey, signingPayload(manifest, sig.SignedAt, checksums), sig.Value) {
+		return fail(key.Publisher, key.ID, ErrBadSignature)
+	}
+	if sig.Publisher != "" && sig.Publisher != key.Publisher {
+		return fail(key.Publisher, key.ID, fmt.Errorf("%w: signature claims %q", ErrPublisherMismatch, sig.Publisher))
+	}
+	if !key.validAt(sig.SignedAt) {
+		return fail(key.Publisher, key.ID, fmt.Errorf("%w: signed %s", ErrKeyExpired, sig.SignedAt.Format(time.RFC3339)))
+	}
+	if !v.tierAllowed(key.Tier) {
+		return fail(key.Publisher, key.ID, fmt.Errorf("%w: %s", ErrTierNotAllowed, key.Tier))
+	}
+
+	return nil
+}
+
+func (v *Verifier) tierAllowed(tier Tier) bool {
+	if len(v.policy.Tiers) == 0 {
+		return true
+	}
+	for _, allowed := range v.policy.Tiers {
+		if allowed == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// signingPayload is the message covered by a signature. CHECKSUMS includes
+// the hash of plugin.yaml, so the whole manifest is signed; name, version
+// and time are bound explicitly so a signature can't be moved to another
+// package or redated.
+func signingPayload(manifest archive.Manifest, signedAt time.Time, checksums []byte) []byte {
+	header := fmt.Sprintf("blackhole-plugin-signature-v1\n%s\n%s\n%s\n",
+		manifest.Name, manifest.Version, signedAt.UTC().Format(time.RFC3339Nano))
+	return append([]byte(header), checksums...)
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
 )
 
 // ComplianceValidator validates plugin compliance at runtime
@@ -78,6 +80,12 @@ func (v *ComplianceValidator) ValidatePluginPackage(packagePath string) (*Valida
 		Warnings: []string{},
 	}
 
+	// Check the package format and checksums before looking at contents
+	if _, err := archive.Verify(packagePath, nil); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Package integrity check failed: %v", err))
+		result.Valid = false
+	}
+
 	// Open the package file
 	file, err := os.Open(packagePath)
 	if err != nil {
@@ -0,0 +1,168 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	lifecyclev1 "github.com/blackhole-pro/blackhole/core/pkg/plugins/lifecycle/proto/v1"
+)
+
+// stateChunkSize is the most state sent in one ExportState message
+const stateChunkSize = 32 << 10
+
+// lifecycleServer serves the plugin.lifecycle.v1 service to the host when
+// the plugin is served over gRPC
+type lifecycleServer struct {
+	lifecyclev1.UnimplementedPluginLifecycleServer
+	s *server
+}
+
+func registerLifecycle(grpcServer *grpc.Server, s *server) {
+	lifecyclev1.RegisterPluginLifecycleServer(grpcServer, &lifecycleServer{s: s})
+}
+
+func (l *lifecycleServer) Handshake(_ context.Context, in *lifecyclev1.HandshakeMessage) (*lifecyclev1.HandshakeMessage, error) {
+	reply, err := l.s.accept(in.AsHandshake())
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return lifecyclev1.NewHandshakeMessage(reply), nil
+}
+
+func (l *lifecycleServer) Handle(ctx context.Context, in *lifecyclev1.HandleRequest) (*lifecyclev1.HandleResponse, error) {
+	handler, ok := l.s.plugin.(Handler)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "plugin does not handle requests")
+	}
+
+	req := Request{
+		ID:     in.GetId(),
+		Method: in.GetMethod(),
+		Params: in.GetParams().AsMap(),
+		Data:   in.GetData(),
+	}
+	if rc := in.GetContext(); rc != nil {
+		req.Context = RequestContext{
+			UserID:    rc.GetUserId(),
+			SessionID: rc.GetSessionId(),
+			Headers:   rc.GetHeaders(),
+		}
+		if rc.GetTimestampUnixNano() != 0 {
+			req.Context.Timestamp = time.Unix(0, rc.GetTimestampUnixNano())
+		}
+	}
+
+	startTime := time.Now()
+	resp, err := handler.Handle(ctx, req)
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+
+	if resp.ID == "" {
+		resp.ID = req.ID
+	}
+	if resp.Metadata.ProcessingTime == 0 {
+		resp.Metadata.ProcessingTime = time.Since(startTime)
+	}
+
+	result, err := toStruct(resp.Result)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode result: %v", err)
+	}
+	return &lifecyclev1.HandleResponse{
+		Id:             resp.ID,
+		Success:        resp.Success,
+		Result:         result,
+		Data:           resp.Data,
+		Error:          resp.Error,
+		ProcessingTime: durationpb.New(resp.Metadata.ProcessingTime),
+		CacheHit:       resp.Metadata.CacheHit,
+	}, nil
+}
+
+func (l *lifecycleServer) HealthCheck(ctx context.Context, _ *lifecyclev1.HealthCheckRequest) (*lifecyclev1.HealthCheckResponse, error) {
+	if err := l.s.plugin.HealthCheck(ctx); err != nil {
+		return &lifecyclev1.HealthCheckResponse{Message: err.Error()}, nil
+	}
+	return &lifecyclev1.HealthCheckResponse{Healthy: true}, nil
+}
+
+func (l *lifecycleServer) PrepareShutdown(ctx context.Context, _ *lifecyclev1.PrepareShutdownRequest) (*lifecyclev1.PrepareShutdownResponse, error) {
+	if err := l.s.prepareShutdown(); err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
+	}
+	return &lifecyclev1.PrepareShutdownResponse{}, nil
+}
+
+func (l *lifecycleServer) ExportState(_ *lifecyclev1.ExportStateRequest, stream lifecyclev1.PluginLifecycle_ExportStateServer) error {
+	stateful, ok := l.s.plugin.(StatefulPlugin)
+	if !ok {
+		return status.Error(codes.Unimplemented, "plugin does not support state export")
+	}
+
+	state, err := stateful.ExportState(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unknown, err.Error())
+	}
+
+	for len(state) > 0 {
+		n := min(len(state), stateChunkSize)
+		if err := stream.Send(&lifecyclev1.StateChunk{Data: state[:n]}); err != nil {
+			return err
+		}
+		state = state[n:]
+	}
+	return nil
+}
+
+func (l *lifecycleServer) ImportState(stream lifecyclev1.PluginLifecycle_ImportStateServer) error {
+	stateful, ok := l.s.plugin.(StatefulPlugin)
+	if !ok {
+		return status.Error(codes.Unimplemented, "plugin does not support state import")
+	}
+
+	var state bytes.Buffer
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		state.Write(chunk.GetData())
+	}
+
+	if err := stateful.ImportState(stream.Context(), state.Bytes()); err != nil {
+		return status.Error(codes.Unknown, err.Error())
+	}
+	return stream.SendAndClose(&lifecyclev1.ImportStateResponse{})
+}
+
+// toStruct converts a result to a Struct through JSON, so any value that
+// encodes as a JSON object is accepted
+func toStruct(m map[string]interface{}) (*structpb.Struct, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
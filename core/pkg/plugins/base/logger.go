@@ -0,0 +1,37 @@
+package base
+
+import (
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger creates the structured logger used by plugins. Logs are written
+// to stderr because stdout may carry protocol messages. The level is taken
+// from the LOG_LEVEL environment variable.
+func NewLogger(pluginName string) *zap.Logger {
+	level := zapcore.InfoLevel
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level = zapcore.DebugLevel
+	case "warn":
+		level = zapcore.WarnLevel
+	case "error":
+		level = zapcore.ErrorLevel
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "timestamp"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.StacktraceKey = ""
+
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(encoderConfig),
+		zapcore.Lock(os.Stderr),
+		level,
+	)
+
+	return zap.New(core).With(zap.String("plugin", pluginName))
+}
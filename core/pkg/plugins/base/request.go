@@ -0,0 +1,61 @@
+package base
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Request is a request delivered to a plugin by the host
+type Request struct {
+	ID      string                 `json:"id"`
+	Method  string                 `json:"method"`
+	Params  map[string]interface{} `json:"params"`
+	Data    []byte                 `json:"data,omitempty"`
+	Context RequestContext         `json:"context"`
+}
+
+// RequestContext carries caller information for a request
+type RequestContext struct {
+	UserID    string            `json:"user_id,omitempty"`
+	SessionID string            `json:"session_id,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Response is a plugin's reply to a Request
+type Response struct {
+	ID       string                 `json:"id"`
+	Success  bool                   `json:"success"`
+	Result   map[string]interface{} `json:"result,omitempty"`
+	Data     []byte                 `json:"data,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	Metadata ResponseMetadata       `json:"metadata"`
+}
+
+// ResponseMetadata provides metadata for plugin responses
+type ResponseMetadata struct {
+	ProcessingTime time.Duration `json:"processing_time"`
+	CacheHit       bool          `json:"cache_hit,omitempty"`
+}
+
+// Handler is implemented by plugins that accept requests from the host
+type Handler interface {
+	// Handle processes a single request. It is called concurrently, up to
+	// the number of workers Serve was given.
+	Handle(ctx context.Context, req Request) (Response, error)
+}
+
+// StreamHandler is implemented by plugins with methods that stream a body.
+// in reads the body streamed by the host and is empty unless the host
+// streams one; writes to out reach the host only if it asked for a streamed
+// response. The Response is sent once HandleStream returns.
+type StreamHandler interface {
+	HandleStream(ctx context.Context, req Request, in io.Reader, out io.Writer) (Response, error)
+}
+
+// ShutdownPreparer is implemented by plugins that need to finish work before they are stopped
+type ShutdownPreparer interface {
+	// PrepareShutdown stops accepting new work and flushes pending work
+	PrepareShutdown(ctx context.Context) error
+}
@@ -0,0 +1,289 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// Option configures Serve
+type Option func(*serveOptions)
+
+type serveOptions struct {
+	transport       protocol.Transport
+	socketPath      string
+	logger          *zap.Logger
+	config          map[string]interface{}
+	registrars      []func(*grpc.Server)
+	shutdownTimeout time.Duration
+	healthInterval  time.Duration
+	stdin           io.Reader
+	stdout          io.Writer
+	workers         int
+}
+
+// WithTransport overrides the transport requested by the host in PLUGIN_TRANSPORT
+func WithTransport(transport protocol.Transport) Option {
+	return func(o *serveOptions) {
+		o.transport = transport
+	}
+}
+
+// WithSocket overrides the unix socket path passed by the host in PLUGIN_SOCKET
+func WithSocket(path string) Option {
+	return func(o *serveOptions) {
+		o.socketPath = path
+	}
+}
+
+// WithLogger sets the logger used by Serve
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *serveOptions) {
+		o.logger = logger
+	}
+}
+
+// WithConfig sets configuration merged into the config passed to Initialize
+func WithConfig(config map[string]interface{}) Option {
+	return func(o *serveOptions) {
+		o.config = config
+	}
+}
+
+// WithGRPCService registers additional gRPC services when serving over gRPC
+func WithGRPCService(register func(*grpc.Server)) Option {
+	return func(o *serveOptions) {
+		o.registrars = append(o.registrars, register)
+	}
+}
+
+// WithShutdownTimeout sets how long PrepareShutdown and Stop may take
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *serveOptions) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithHealthInterval sets how often the gRPC health status is refreshed
+func WithHealthInterval(interval time.Duration) Option {
+	return func(o *serveOptions) {
+		o.healthInterval = interval
+	}
+}
+
+// WithStdio replaces stdin and stdout for the stdio transport
+func WithStdio(r io.Reader, w io.Writer) Option {
+	return func(o *serveOptions) {
+		o.stdin = r
+		o.stdout = w
+	}
+}
+
+// WithWorkers sets how many requests are handled at once on line protocol
+// connections. Handle may be called concurrently up to this limit.
+func WithWorkers(workers int) Option {
+	return func(o *serveOptions) {
+		o.workers = workers
+	}
+}
+
+// Serve runs the plugin until the host shuts it down or the process receives
+// SIGINT or SIGTERM. It sets up the transport requested by the host, performs
+// the protocol handshake, serves lifecycle, request and state calls, and
+// finally calls PrepareShutdown and Stop.
+func Serve(plugin Plugin, opts ...Option) error {
+	o := serveOptions{
+		transport:       protocol.Transport(os.Getenv(protocol.EnvTransport)),
+		socketPath:      os.Getenv(protocol.EnvSocket),
+		shutdownTimeout: 10 * time.Second,
+		healthInterval:  10 * time.Second,
+		stdin:           os.Stdin,
+		stdout:          os.Stdout,
+		workers:         protocol.DefaultWorkers,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.transport == "" {
+		o.transport = protocol.TransportStdio
+		if o.socketPath != "" {
+			o.transport = protocol.TransportSocket
+		}
+	}
+	if o.logger == nil {
+		o.logger = NewLogger(plugin.Info().Name)
+	}
+
+	s := newServer(plugin, o)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	s.logger.Info("Plugin starting",
+		zap.String("version", plugin.Info().Version),
+		zap.String("transport", string(o.transport)))
+
+	var err error
+	switch o.transport {
+	case protocol.TransportStdio:
+		err = s.serveConn(ctx, protocol.NewConn(o.stdin, o.stdout))
+	case protocol.TransportSocket:
+		err = s.serveSocket(ctx)
+	case protocol.TransportGRPC:
+		err = s.serveGRPC(ctx)
+	default:
+		err = fmt.Errorf("unsupported plugin transport: %s", o.transport)
+	}
+
+	s.shutdown()
+	s.logger.Info("Plugin exiting")
+
+	return err
+}
+
+// listen creates the unix socket listener for socket-based transports
+func (s *server) listen() (net.Listener, error) {
+	if s.opts.socketPath == "" {
+		return nil, fmt.Errorf("%s environment variable not set", protocol.EnvSocket)
+	}
+
+	os.Remove(s.opts.socketPath)
+
+	listener, err := net.Listen("unix", s.opts.socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket %s: %w", s.opts.socketPath, err)
+	}
+	// Only the host may connect; other plugins go through the mesh
+	return protocol.HostOnly(listener, protocol.HostPID()), nil
+}
+
+// serveSocket serves the line protocol to every connection on the plugin socket
+func (s *server) serveSocket(ctx context.Context) error {
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(s.opts.socketPath)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-s.done:
+				return nil
+			default:
+				return fmt.Errorf("failed to accept connection: %w", err)
+			}
+		}
+
+		go func() {
+			defer conn.Close()
+			if err := s.serveConn(ctx, protocol.NewConn(conn, conn)); err != nil {
+				s.logger.Warn("Connection closed with error", zap.Error(err))
+			}
+		}()
+	}
+}
+
+// serveGRPC starts the plugin and serves it as a gRPC server with the
+// plugin lifecycle service the host calls, the standard health service and
+// any services registered with WithGRPCService
+func (s *server) serveGRPC(ctx context.Context) error {
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(s.opts.socketPath)
+
+	grpcServer := grpc.NewServer()
+	registerLifecycle(grpcServer, s)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	for _, register := range s.opts.registrars {
+		register(grpcServer)
+	}
+
+	if err := s.start(ctx, nil); err != nil {
+		listener.Close()
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- grpcServer.Serve(listener)
+	}()
+
+	ticker := time.NewTicker(s.opts.healthInterval)
+	defer ticker.Stop()
+
+	s.updateHealth(ctx, healthServer)
+
+	for {
+		select {
+		case <-ctx.Done():
+			healthServer.Shutdown()
+			s.stopGRPC(grpcServer)
+			return nil
+		case <-s.done:
+			healthServer.Shutdown()
+			s.stopGRPC(grpcServer)
+			return nil
+		case err := <-serveErr:
+			return err
+		case <-ticker.C:
+			s.updateHealth(ctx, healthServer)
+		}
+	}
+}
+
+// updateHealth publishes the result of the plugin's health check
+func (s *server) updateHealth(ctx context.Context, healthServer *health.Server) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if err := s.plugin.HealthCheck(ctx); err != nil {
+		s.logger.Warn("Health check failed", zap.Error(err))
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	healthServer.SetServingStatus("", status)
+	healthServer.SetServingStatus(s.plugin.Info().Name, status)
+}
+
+// stopGRPC stops the gRPC server, forcing it down after the shutdown timeout
+func (s *server) stopGRPC(grpcServer *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(s.opts.shutdownTimeout):
+		s.logger.Warn("gRPC server did not stop gracefully, forcing stop")
+		grpcServer.Stop()
+	}
+}
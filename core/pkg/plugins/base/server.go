@@ -0,0 +1,473 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// server dispatches protocol messages to a plugin
+type server struct {
+	plugin Plugin
+	opts   serveOptions
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	started  bool
+	peer     protocol.Handshake
+	done     chan struct{}
+	doneOnce sync.Once
+	stopOnce sync.Once
+}
+
+func newServer(plugin Plugin, opts serveOptions) *server {
+	return &server{
+		plugin: plugin,
+		opts:   opts,
+		logger: opts.logger,
+		done:   make(chan struct{}),
+	}
+}
+
+// features returns the protocol features this plugin supports
+func (s *server) features() []protocol.Feature {
+	features := []protocol.Feature{protocol.FeatureCancellation}
+	if _, ok := s.plugin.(StreamHandler); ok {
+		features = append(features, protocol.FeatureStreaming)
+	}
+	if _, ok := s.plugin.(StatefulPlugin); ok {
+		features = append(features, protocol.FeatureState)
+	}
+	return features
+}
+
+// readResult is a message or error read from a connection
+type readResult struct {
+	msg protocol.Message
+	err error
+}
+
+// serveConn serves the line protocol on a single connection until the host
+// closes it, asks the plugin to shut down, or ctx is cancelled. Requests run
+// on a worker pool, so responses may be written out of order, and never hold
+// up reading: cancellations and stream data get through while an exclusive
+// request waits for the ones before it. The connection is closed on return,
+// once every response has been written.
+func (s *server) serveConn(ctx context.Context, conn *protocol.Conn) error {
+	defer conn.Close()
+	stopped := make(chan struct{})
+	defer close(stopped)
+	workers := protocol.NewWorkerPool(s.opts.workers)
+	defer workers.Wait()
+	cancels := protocol.NewCancellations()
+	streams := protocol.NewStreams(conn)
+	defer streams.AbortAll(io.ErrClosedPipe)
+
+	messages := make(chan readResult)
+	go func() {
+		for {
+			msg, err := conn.Read()
+			select {
+			case messages <- readResult{msg: msg, err: err}:
+			case <-stopped:
+				return
+			case <-s.done:
+				return
+			}
+			var perr *protocol.Error
+			if err != nil && !errors.As(err, &perr) {
+				return
+			}
+		}
+	}()
+
+	var shutdown <-chan struct{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return nil
+		case <-shutdown:
+			s.doneOnce.Do(func() { close(s.done) })
+			return nil
+		case read := <-messages:
+			if read.err != nil {
+				var perr *protocol.Error
+				if errors.As(read.err, &perr) {
+					s.logger.Warn("Failed to decode message", zap.Error(read.err))
+					continue
+				}
+				if read.err == io.EOF {
+					return nil
+				}
+				return read.err
+			}
+
+			if read.msg.IsNotification() {
+				if read.msg.Method == protocol.MethodCancel {
+					cancels.Cancel(read.msg)
+				} else {
+					streams.Dispatch(read.msg)
+				}
+				continue
+			}
+
+			// Lifecycle calls get the connection's context, since plugins
+			// may hold on to the context passed to Start
+			msg := read.msg
+			if msg.Stream != protocol.StreamNone && msg.Method == protocol.MethodHandle {
+				reqCtx, done := cancels.Track(ctx, msg)
+				stream := streams.Open(msg.ID)
+				workers.Go(func() {
+					defer done()
+					// Unblock the handler if the host gives up on the request
+					stop := context.AfterFunc(reqCtx, func() { streams.Finish(msg.ID, reqCtx.Err()) })
+					response := s.handleStream(reqCtx, msg, stream)
+					stop()
+					streams.Finish(msg.ID, nil)
+					if err := conn.Write(response); err != nil {
+						s.logger.Warn("Failed to write response", zap.String("id", msg.ID), zap.Error(err))
+					}
+				})
+				continue
+			}
+			if protocol.Concurrent(msg.Method) {
+				reqCtx, done := cancels.Track(ctx, msg)
+				workers.Go(func() {
+					defer done()
+					if err := conn.Write(s.dispatch(reqCtx, msg)); err != nil {
+						s.logger.Warn("Failed to write response", zap.String("id", msg.ID), zap.Error(err))
+					}
+				})
+				continue
+			}
+
+			done := workers.Exclusive(func() {
+				if err := conn.Write(s.dispatch(ctx, msg)); err != nil {
+					s.logger.Warn("Failed to write response", zap.String("id", msg.ID), zap.Error(err))
+				}
+			})
+			if msg.Method == protocol.MethodShutdown {
+				shutdown = done
+			}
+		}
+	}
+}
+
+// dispatch handles a single request and builds its response
+func (s *server) dispatch(ctx context.Context, msg protocol.Message) protocol.Message {
+	switch msg.Method {
+	case protocol.MethodHandshake:
+		return s.handleHandshake(msg)
+	case protocol.MethodInitialize:
+		var config map[string]interface{}
+		if len(msg.Params) > 0 {
+			if err := json.Unmarshal(msg.Params, &config); err != nil {
+				return invalidParams(msg.ID, err)
+			}
+		}
+		if err := s.start(ctx, config); err != nil {
+			return pluginError(msg.ID, err)
+		}
+		return protocol.NewResult(msg.ID, map[string]interface{}{"status": "initialized"})
+	case protocol.MethodStart:
+		if err := s.start(ctx, nil); err != nil {
+			return pluginError(msg.ID, err)
+		}
+		return protocol.NewResult(msg.ID, map[string]interface{}{"status": "started"})
+	case protocol.MethodStop:
+		if err := s.stop(); err != nil {
+			return pluginError(msg.ID, err)
+		}
+		return protocol.NewResult(msg.ID, map[string]interface{}{"status": "stopped"})
+	case protocol.MethodHandle:
+		return s.handleRequest(ctx, msg)
+	case protocol.MethodHealthCheck:
+		if err := s.plugin.HealthCheck(ctx); err != nil {
+			return pluginError(msg.ID, err)
+		}
+		return protocol.NewResult(msg.ID, map[string]interface{}{"healthy": true})
+	case protocol.MethodGetInfo:
+		return protocol.NewResult(msg.ID, s.plugin.Info())
+	case protocol.MethodGetStatus:
+		return protocol.NewResult(msg.ID, map[string]interface{}{"status": s.status()})
+	case protocol.MethodPrepareShutdown:
+		if err := s.prepareShutdown(); err != nil {
+			return pluginError(msg.ID, err)
+		}
+		return protocol.NewResult(msg.ID, map[string]interface{}{"status": "prepared"})
+	case protocol.MethodShutdown:
+		s.shutdown()
+		return protocol.NewResult(msg.ID, map[string]interface{}{"status": "shutdown"})
+	case protocol.MethodExportState:
+		return s.handleExportState(ctx, msg)
+	case protocol.MethodImportState:
+		return s.handleImportState(ctx, msg)
+	default:
+		return protocol.NewErrorResponse(msg.ID,
+			protocol.NewError(protocol.CodeMethodNotFound, "unknown method: %s", msg.Method))
+	}
+}
+
+func (s *server) handleHandshake(msg protocol.Message) protocol.Message {
+	var offer protocol.Handshake
+	if err := json.Unmarshal(msg.Params, &offer); err != nil {
+		return invalidParams(msg.ID, err)
+	}
+
+	reply, err := s.accept(offer)
+	if err != nil {
+		return protocol.NewErrorResponse(msg.ID,
+			protocol.NewError(protocol.CodeIncompatibleVersion, "%v", err))
+	}
+	return protocol.NewResult(msg.ID, reply)
+}
+
+// accept answers the host's handshake offer on any transport
+func (s *server) accept(offer protocol.Handshake) (protocol.Handshake, error) {
+	info := s.plugin.Info()
+	reply, err := protocol.Accept(protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            info.Name,
+		Version:         info.Version,
+		Transport:       s.opts.transport,
+		Features:        s.features(),
+	}, offer)
+	if err != nil {
+		return protocol.Handshake{}, err
+	}
+
+	s.mu.Lock()
+	s.peer = reply
+	s.mu.Unlock()
+
+	s.logger.Debug("Handshake completed",
+		zap.Int("protocol_version", reply.ProtocolVersion),
+		zap.Any("features", reply.Features))
+
+	return reply, nil
+}
+
+func (s *server) handleRequest(ctx context.Context, msg protocol.Message) protocol.Message {
+	handler, ok := s.plugin.(Handler)
+	if !ok {
+		return protocol.NewErrorResponse(msg.ID,
+			protocol.NewError(protocol.CodeMethodNotFound, "plugin does not handle requests"))
+	}
+
+	var req Request
+	if err := json.Unmarshal(msg.Params, &req); err != nil {
+		return invalidParams(msg.ID, err)
+	}
+
+	startTime := time.Now()
+	resp, err := handler.Handle(ctx, req)
+	if err != nil {
+		return pluginError(msg.ID, err)
+	}
+
+	if resp.ID == "" {
+		resp.ID = req.ID
+	}
+	if resp.Metadata.ProcessingTime == 0 {
+		resp.Metadata.ProcessingTime = time.Since(startTime)
+	}
+
+	return protocol.NewResult(msg.ID, resp)
+}
+
+// handleStream runs a streamed request, ending the response body before the
+// response is sent
+func (s *server) handleStream(ctx context.Context, msg protocol.Message, stream *protocol.Stream) protocol.Message {
+	handler, ok := s.plugin.(StreamHandler)
+	if !ok {
+		return protocol.NewErrorResponse(msg.ID,
+			protocol.NewError(protocol.CodeMethodNotFound, "plugin does not handle streams"))
+	}
+
+	var req Request
+	if err := json.Unmarshal(msg.Params, &req); err != nil {
+		return invalidParams(msg.ID, err)
+	}
+
+	var in io.Reader = stream
+	if !msg.Stream.ClientStreams() {
+		in = eofReader{}
+	}
+	var out io.Writer = stream
+	if !msg.Stream.ServerStreams() {
+		out = closedWriter{}
+	}
+
+	startTime := time.Now()
+	resp, err := handler.HandleStream(ctx, req, in, out)
+	if msg.Stream.ServerStreams() {
+		stream.CloseWriteWithError(err)
+	}
+	if err != nil {
+		return pluginError(msg.ID, err)
+	}
+
+	if resp.ID == "" {
+		resp.ID = req.ID
+	}
+	if resp.Metadata.ProcessingTime == 0 {
+		resp.Metadata.ProcessingTime = time.Since(startTime)
+	}
+
+	return protocol.NewResult(msg.ID, resp)
+}
+
+// eofReader is the request body of requests the host doesn't stream
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+// closedWriter is the response body of requests the host doesn't stream
+type closedWriter struct{}
+
+func (closedWriter) Write([]byte) (int, error) { return 0, protocol.ErrStreamClosed }
+
+func (s *server) handleExportState(ctx context.Context, msg protocol.Message) protocol.Message {
+	stateful, ok := s.plugin.(StatefulPlugin)
+	if !ok {
+		return protocol.NewErrorResponse(msg.ID,
+			protocol.NewError(protocol.CodeMethodNotFound, "plugin does not support state export"))
+	}
+
+	state, err := stateful.ExportState(ctx)
+	if err != nil {
+		return pluginError(msg.ID, err)
+	}
+
+	s.mu.Lock()
+	peer := s.peer
+	s.mu.Unlock()
+
+	result, err := protocol.EncodeState(peer, state)
+	if err != nil {
+		return pluginError(msg.ID, err)
+	}
+
+	return protocol.Message{ID: msg.ID, Result: result}
+}
+
+func (s *server) handleImportState(ctx context.Context, msg protocol.Message) protocol.Message {
+	stateful, ok := s.plugin.(StatefulPlugin)
+	if !ok {
+		return protocol.NewErrorResponse(msg.ID,
+			protocol.NewError(protocol.CodeMethodNotFound, "plugin does not support state import"))
+	}
+
+	state, err := protocol.DecodeState(msg.Params)
+	if err != nil {
+		return invalidParams(msg.ID, err)
+	}
+
+	if err := stateful.ImportState(ctx, state); err != nil {
+		return pluginError(msg.ID, err)
+	}
+
+	return protocol.NewResult(msg.ID, map[string]interface{}{"status": "imported"})
+}
+
+// start initializes and starts the plugin once
+func (s *server) start(ctx context.Context, config map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return nil
+	}
+
+	merged := make(map[string]interface{}, len(s.opts.config)+len(config))
+	for k, v := range s.opts.config {
+		merged[k] = v
+	}
+	for k, v := range config {
+		merged[k] = v
+	}
+
+	if err := s.plugin.Initialize(ctx, merged); err != nil {
+		return err
+	}
+	if err := s.plugin.Start(ctx); err != nil {
+		return err
+	}
+
+	s.started = true
+	s.logger.Info("Plugin started")
+	return nil
+}
+
+// stop stops the plugin if it is running
+func (s *server) stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.shutdownTimeout)
+	defer cancel()
+
+	if err := s.plugin.Stop(ctx); err != nil {
+		return err
+	}
+
+	s.started = false
+	s.logger.Info("Plugin stopped")
+	return nil
+}
+
+// prepareShutdown calls PrepareShutdown if the plugin implements it
+func (s *server) prepareShutdown() error {
+	preparer, ok := s.plugin.(ShutdownPreparer)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.shutdownTimeout)
+	defer cancel()
+
+	return preparer.PrepareShutdown(ctx)
+}
+
+// shutdown prepares and stops the plugin exactly once
+func (s *server) shutdown() {
+	s.stopOnce.Do(func() {
+		if err := s.prepareShutdown(); err != nil {
+			s.logger.Error("Error preparing for shutdown", zap.Error(err))
+		}
+		if err := s.stop(); err != nil {
+			s.logger.Error("Error stopping plugin", zap.Error(err))
+		}
+	})
+}
+
+func (s *server) status() PluginStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return PluginStatusRunning
+	}
+	return PluginStatusStopped
+}
+
+func invalidParams(id string, err error) protocol.Message {
+	return protocol.NewErrorResponse(id, protocol.NewError(protocol.CodeInvalidParams, "invalid params: %v", err))
+}
+
+func pluginError(id string, err error) protocol.Message {
+	return protocol.NewErrorResponse(id, protocol.NewError(protocol.CodePluginError, "%v", err))
+}
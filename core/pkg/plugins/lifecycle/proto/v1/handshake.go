@@ -0,0 +1,33 @@
+package lifecyclev1
+
+import "github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+
+// NewHandshakeMessage converts a handshake for the Handshake call
+func NewHandshakeMessage(h protocol.Handshake) *HandshakeMessage {
+	features := make([]string, len(h.Features))
+	for i, f := range h.Features {
+		features[i] = string(f)
+	}
+	return &HandshakeMessage{
+		ProtocolVersion: int32(h.ProtocolVersion),
+		Name:            h.Name,
+		Version:         h.Version,
+		Transport:       string(h.Transport),
+		Features:        features,
+	}
+}
+
+// AsHandshake converts the message back to a handshake
+func (m *HandshakeMessage) AsHandshake() protocol.Handshake {
+	features := make([]protocol.Feature, len(m.GetFeatures()))
+	for i, f := range m.GetFeatures() {
+		features[i] = protocol.Feature(f)
+	}
+	return protocol.Handshake{
+		ProtocolVersion: int(m.GetProtocolVersion()),
+		Name:            m.GetName(),
+		Version:         m.GetVersion(),
+		Transport:       protocol.Transport(m.GetTransport()),
+		Features:        features,
+	}
+}
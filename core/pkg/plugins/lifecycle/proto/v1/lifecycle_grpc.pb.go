@@ -0,0 +1,330 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: lifecycle.proto
+
+package lifecyclev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PluginLifecycle_Handshake_FullMethodName       = "/plugin.lifecycle.v1.PluginLifecycle/Handshake"
+	PluginLifecycle_Handle_FullMethodName          = "/plugin.lifecycle.v1.PluginLifecycle/Handle"
+	PluginLifecycle_HealthCheck_FullMethodName     = "/plugin.lifecycle.v1.PluginLifecycle/HealthCheck"
+	PluginLifecycle_PrepareShutdown_FullMethodName = "/plugin.lifecycle.v1.PluginLifecycle/PrepareShutdown"
+	PluginLifecycle_ExportState_FullMethodName     = "/plugin.lifecycle.v1.PluginLifecycle/ExportState"
+	PluginLifecycle_ImportState_FullMethodName     = "/plugin.lifecycle.v1.PluginLifecycle/ImportState"
+)
+
+// PluginLifecycleClient is the client API for PluginLifecycle service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PluginLifecycle is served by every plugin running in mesh isolation. The
+// host calls it over the plugin's socket; it is not reachable through the
+// mesh ingress.
+type PluginLifecycleClient interface {
+	// Handshake negotiates the protocol version and features, as $/handshake
+	// does on the line protocol
+	Handshake(ctx context.Context, in *HandshakeMessage, opts ...grpc.CallOption) (*HandshakeMessage, error)
+	// Handle processes a single request
+	Handle(ctx context.Context, in *HandleRequest, opts ...grpc.CallOption) (*HandleResponse, error)
+	// HealthCheck runs the plugin's health check
+	HealthCheck(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error)
+	// PrepareShutdown asks the plugin to finish pending work before it is stopped
+	PrepareShutdown(ctx context.Context, in *PrepareShutdownRequest, opts ...grpc.CallOption) (*PrepareShutdownResponse, error)
+	// ExportState streams the plugin's state in chunks
+	ExportState(ctx context.Context, in *ExportStateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StateChunk], error)
+	// ImportState replaces the plugin's state with the streamed chunks
+	ImportState(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StateChunk, ImportStateResponse], error)
+}
+
+type pluginLifecycleClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPluginLifecycleClient(cc grpc.ClientConnInterface) PluginLifecycleClient {
+	return &pluginLifecycleClient{cc}
+}
+
+func (c *pluginLifecycleClient) Handshake(ctx context.Context, in *HandshakeMessage, opts ...grpc.CallOption) (*HandshakeMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HandshakeMessage)
+	err := c.cc.Invoke(ctx, PluginLifecycle_Handshake_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginLifecycleClient) Handle(ctx context.Context, in *HandleRequest, opts ...grpc.CallOption) (*HandleResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HandleResponse)
+	err := c.cc.Invoke(ctx, PluginLifecycle_Handle_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginLifecycleClient) HealthCheck(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HealthCheckResponse)
+	err := c.cc.Invoke(ctx, PluginLifecycle_HealthCheck_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginLifecycleClient) PrepareShutdown(ctx context.Context, in *PrepareShutdownRequest, opts ...grpc.CallOption) (*PrepareShutdownResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PrepareShutdownResponse)
+	err := c.cc.Invoke(ctx, PluginLifecycle_PrepareShutdown_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginLifecycleClient) ExportState(ctx context.Context, in *ExportStateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StateChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PluginLifecycle_ServiceDesc.Streams[0], PluginLifecycle_ExportState_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportStateRequest, StateChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PluginLifecycle_ExportStateClient = grpc.ServerStreamingClient[StateChunk]
+
+func (c *pluginLifecycleClient) ImportState(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[StateChunk, ImportStateResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PluginLifecycle_ServiceDesc.Streams[1], PluginLifecycle_ImportState_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StateChunk, ImportStateResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PluginLifecycle_ImportStateClient = grpc.ClientStreamingClient[StateChunk, ImportStateResponse]
+
+// PluginLifecycleServer is the server API for PluginLifecycle service.
+// All implementations must embed UnimplementedPluginLifecycleServer
+// for forward compatibility.
+//
+// PluginLifecycle is served by every plugin running in mesh isolation. The
+// host calls it over the plugin's socket; it is not reachable through the
+// mesh ingress.
+type PluginLifecycleServer interface {
+	// Handshake negotiates the protocol version and features, as $/handshake
+	// does on the line protocol
+	Handshake(context.Context, *HandshakeMessage) (*HandshakeMessage, error)
+	// Handle processes a single request
+	Handle(context.Context, *HandleRequest) (*HandleResponse, error)
+	// HealthCheck runs the plugin's health check
+	HealthCheck(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error)
+	// PrepareShutdown asks the plugin to finish pending work before it is stopped
+	PrepareShutdown(context.Context, *PrepareShutdownRequest) (*PrepareShutdownResponse, error)
+	// ExportState streams the plugin's state in chunks
+	ExportState(*ExportStateRequest, grpc.ServerStreamingServer[StateChunk]) error
+	// ImportState replaces the plugin's state with the streamed chunks
+	ImportState(grpc.ClientStreamingServer[StateChunk, ImportStateResponse]) error
+	mustEmbedUnimplementedPluginLifecycleServer()
+}
+
+// UnimplementedPluginLifecycleServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPluginLifecycleServer struct{}
+
+func (UnimplementedPluginLifecycleServer) Handshake(context.Context, *HandshakeMessage) (*HandshakeMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Handshake not implemented")
+}
+func (UnimplementedPluginLifecycleServer) Handle(context.Context, *HandleRequest) (*HandleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Handle not implemented")
+}
+func (UnimplementedPluginLifecycleServer) HealthCheck(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HealthCheck not implemented")
+}
+func (UnimplementedPluginLifecycleServer) PrepareShutdown(context.Context, *PrepareShutdownRequest) (*PrepareShutdownResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PrepareShutdown not implemented")
+}
+func (UnimplementedPluginLifecycleServer) ExportState(*ExportStateRequest, grpc.ServerStreamingServer[StateChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method ExportState not implemented")
+}
+func (UnimplementedPluginLifecycleServer) ImportState(grpc.ClientStreamingServer[StateChunk, ImportStateResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ImportState not implemented")
+}
+func (UnimplementedPluginLifecycleServer) mustEmbedUnimplementedPluginLifecycleServer() {}
+func (UnimplementedPluginLifecycleServer) testEmbeddedByValue()                         {}
+
+// UnsafePluginLifecycleServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PluginLifecycleServer will
+// result in compilation errors.
+type UnsafePluginLifecycleServer interface {
+	mustEmbedUnimplementedPluginLifecycleServer()
+}
+
+func RegisterPluginLifecycleServer(s grpc.ServiceRegistrar, srv PluginLifecycleServer) {
+	// If the following call pancis, it indicates UnimplementedPluginLifecycleServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PluginLifecycle_ServiceDesc, srv)
+}
+
+func _PluginLifecycle_Handshake_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HandshakeMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginLifecycleServer).Handshake(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PluginLifecycle_Handshake_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginLifecycleServer).Handshake(ctx, req.(*HandshakeMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PluginLifecycle_Handle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HandleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginLifecycleServer).Handle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PluginLifecycle_Handle_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginLifecycleServer).Handle(ctx, req.(*HandleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PluginLifecycle_HealthCheck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthCheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginLifecycleServer).HealthCheck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PluginLifecycle_HealthCheck_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginLifecycleServer).HealthCheck(ctx, req.(*HealthCheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PluginLifecycle_PrepareShutdown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PrepareShutdownRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginLifecycleServer).PrepareShutdown(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PluginLifecycle_PrepareShutdown_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginLifecycleServer).PrepareShutdown(ctx, req.(*PrepareShutdownRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PluginLifecycle_ExportState_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportStateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PluginLifecycleServer).ExportState(m, &grpc.GenericServerStream[ExportStateRequest, StateChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PluginLifecycle_ExportStateServer = grpc.ServerStreamingServer[StateChunk]
+
+func _PluginLifecycle_ImportState_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PluginLifecycleServer).ImportState(&grpc.GenericServerStream[StateChunk, ImportStateResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PluginLifecycle_ImportStateServer = grpc.ClientStreamingServer[StateChunk, ImportStateResponse]
+
+// PluginLifecycle_ServiceDesc is the grpc.ServiceDesc for PluginLifecycle service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PluginLifecycle_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "plugin.lifecycle.v1.PluginLifecycle",
+	HandlerType: (*PluginLifecycleServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Handshake",
+			Handler:    _PluginLifecycle_Handshake_Handler,
+		},
+		{
+			MethodName: "Handle",
+			Handler:    _PluginLifecycle_Handle_Handler,
+		},
+		{
+			MethodName: "HealthCheck",
+			Handler:    _PluginLifecycle_HealthCheck_Handler,
+		},
+		{
+			MethodName: "PrepareShutdown",
+			Handler:    _PluginLifecycle_PrepareShutdown_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportState",
+			Handler:       _PluginLifecycle_ExportState_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportState",
+			Handler:       _PluginLifecycle_ImportState_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "lifecycle.proto",
+}
@@ -0,0 +1,53 @@
+// Package main implements the protocol handshake for the node plugin
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	lifecyclev1 "github.com/blackhole-pro/blackhole/core/pkg/plugins/lifecycle/proto/v1"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+
+	"node/plugin"
+)
+
+// acceptHandshake answers the host's handshake offer with the features the
+// node plugin supports on the transport
+func acceptHandshake(p *plugin.Plugin, transport protocol.Transport, features []protocol.Feature, offer protocol.Handshake) (protocol.Handshake, error) {
+	info := p.Info()
+	return protocol.Accept(protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            info.Name,
+		Version:         info.Version,
+		Transport:       transport,
+		Features:        features,
+	}, offer)
+}
+
+// Handshake negotiates the protocol with a host on the net/rpc transport,
+// where state calls are served by the plugin's RPC methods
+func (r *rpcPlugin) Handshake(offer *protocol.Handshake, reply *protocol.Handshake) error {
+	accepted, err := acceptHandshake(r.plugin, protocol.TransportSocket, []protocol.Feature{protocol.FeatureState}, *offer)
+	if err != nil {
+		return err
+	}
+	*reply = accepted
+	return nil
+}
+
+// lifecycleServer serves the handshake of the plugin lifecycle service on
+// the gRPC transport. The node plugin's own calls are served by NodePlugin.
+type lifecycleServer struct {
+	lifecyclev1.UnimplementedPluginLifecycleServer
+	plugin *plugin.Plugin
+}
+
+func (l *lifecycleServer) Handshake(_ context.Context, in *lifecyclev1.HandshakeMessage) (*lifecyclev1.HandshakeMessage, error) {
+	reply, err := acceptHandshake(l.plugin, protocol.TransportGRPC, []protocol.Feature{protocol.FeatureCancellation}, in.AsHandshake())
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return lifecyclev1.NewHandshakeMessage(reply), nil
+}
@@ -14,10 +14,16 @@ import (
 	"syscall"
 	"time"
 
+	"node/mesh"
 	"node/plugin"
+	nodev1 "node/proto/v1"
 	"node/types"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+
+	lifecyclev1 "github.com/blackhole-pro/blackhole/core/pkg/plugins/lifecycle/proto/v1"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
 )
 
 // rpcPlugin wraps the plugin for RPC communication
@@ -105,12 +111,88 @@ func main() {
 		logger.Fatal("Failed to create plugin", zap.Error(err))
 	}
 
-	// Run plugin with RPC
-	if err := runPlugin(plugin, logger); err != nil {
+	// Serve over the transport requested by the host. Hosts that predate
+	// PLUGIN_TRANSPORT get the legacy net/rpc server.
+	run := runPlugin
+	if protocol.Transport(os.Getenv(protocol.EnvTransport)) == protocol.TransportGRPC {
+		run = runGRPCPlugin
+	}
+
+	if err := run(plugin, logger); err != nil {
 		logger.Fatal("Plugin failed", zap.Error(err))
 	}
 }
 
+func runGRPCPlugin(p *plugin.Plugin, logger *zap.Logger) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	socketPath := os.Getenv("PLUGIN_SOCKET")
+	if socketPath == "" {
+		return fmt.Errorf("PLUGIN_SOCKET environment variable not set")
+	}
+
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on socket %s: %w", socketPath, err)
+	}
+	// Only the host may connect; other plugins go through the mesh
+	listener = protocol.HostOnly(listener, protocol.HostPID())
+
+	meshClient, err := mesh.NewClient(ctx, mesh.Config{
+		MeshEndpoint: os.Getenv("PLUGIN_MESH_ENDPOINT"),
+		ServiceName:  "node",
+	})
+	if err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to create mesh client: %w", err)
+	}
+
+	server := grpc.NewServer()
+	nodev1.RegisterNodePluginServer(server, NewNodePluginServer(p, meshClient))
+	lifecyclev1.RegisterPluginLifecycleServer(server, &lifecycleServer{plugin: p})
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	logger.Info("Plugin started",
+		zap.String("socket", socketPath),
+		zap.String("transport", string(protocol.TransportGRPC)),
+		zap.String("version", p.Info().Version))
+
+	select {
+	case sig := <-sigCh:
+		logger.Info("Received signal", zap.String("signal", sig.String()))
+	case err := <-serveErr:
+		if err != nil {
+			logger.Error("gRPC server stopped", zap.Error(err))
+		}
+	}
+
+	if err := p.PrepareShutdown(); err != nil {
+		logger.Error("Error preparing for shutdown", zap.Error(err))
+	}
+
+	server.GracefulStop()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer stopCancel()
+
+	if err := p.Stop(stopCtx); err != nil {
+		logger.Error("Error stopping plugin", zap.Error(err))
+	}
+
+	return nil
+}
+
+// runPlugin serves the legacy net/rpc protocol on PLUGIN_SOCKET
 func runPlugin(p *plugin.Plugin, logger *zap.Logger) error {
 	// Create context for plugin lifecycle
 	ctx, cancel := context.WithCancel(context.Background())
@@ -146,6 +228,8 @@ func runPlugin(p *plugin.Plugin, logger *zap.Logger) error {
 	if err != nil {
 		return fmt.Errorf("failed to listen on socket %s: %w", socketPath, err)
 	}
+	// Only the host may connect; other plugins go through the mesh
+	listener = protocol.HostOnly(listener, protocol.HostPID())
 	defer listener.Close()
 
 	logger.Info("Plugin started",
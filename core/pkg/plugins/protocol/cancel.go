@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// CancelParams are the params of a $/cancel notification
+type CancelParams struct {
+	ID string `json:"id"`
+}
+
+// NewCancel creates the $/cancel notification for the request with id
+func NewCancel(id string) Message {
+	params, _ := json.Marshal(CancelParams{ID: id})
+	return Message{Method: MethodCancel, Params: params}
+}
+
+// Cancellations tracks the contexts of running requests so they end when
+// the host sends $/cancel or the request's deadline passes
+type Cancellations struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// NewCancellations creates an empty set of running requests
+func NewCancellations() *Cancellations {
+	return &Cancellations{cancels: make(map[string]context.CancelFunc)}
+}
+
+// Track returns the context to handle msg with and a function to call once
+// it has been answered. Track must be called by the goroutine reading the
+// connection so a later $/cancel always finds the request.
+func (c *Cancellations) Track(parent context.Context, msg Message) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	if msg.Deadline != nil {
+		ctx, cancel = withDeadline(ctx, cancel, *msg.Deadline)
+	}
+	if msg.ID == "" {
+		return ctx, cancel
+	}
+
+	c.mu.Lock()
+	c.cancels[msg.ID] = cancel
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.cancels, msg.ID)
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// Cancel ends the request named by a $/cancel notification. It reports
+// whether the request was still running.
+func (c *Cancellations) Cancel(msg Message) bool {
+	var params CancelParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	cancel, ok := c.cancels[params.ID]
+	delete(c.cancels, params.ID)
+	c.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// withDeadline adds a deadline to ctx, cancelling both contexts together
+func withDeadline(ctx context.Context, cancel context.CancelFunc, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx, cancelDeadline := context.WithDeadline(ctx, deadline)
+	return ctx, func() {
+		cancelDeadline()
+		cancel()
+	}
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Conn reads and writes line-delimited protocol messages over a byte stream.
+// Writes are safe for concurrent use; reads must come from a single goroutine.
+type Conn struct {
+	reader *bufio.Reader
+	closer io.Closer
+	writer io.Writer
+	mu     sync.Mutex
+}
+
+// NewConn creates a new connection over the given reader and writer
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	closer, _ := r.(io.Closer)
+	return &Conn{
+		reader: bufio.NewReaderSize(r, 64*1024),
+		closer: closer,
+		writer: w,
+	}
+}
+
+// Close closes the underlying reader if it can be closed, unblocking a
+// pending Read
+func (c *Conn) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// Read reads the next message, skipping blank lines
+func (c *Conn) Read() (Message, error) {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var msg Message
+			if jerr := json.Unmarshal(line, &msg); jerr != nil {
+				return Message{}, &Error{Code: CodeParseError, Message: jerr.Error()}
+			}
+			return msg, nil
+		}
+		if err != nil {
+			return Message{}, err
+		}
+	}
+}
+
+// Write writes a single message followed by a newline
+func (c *Conn) Write(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	data = append(data, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Error codes, following JSON-RPC 2.0 where applicable
+const (
+	CodeParseError          = -32700
+	CodeInvalidRequest      = -32600
+	CodeMethodNotFound      = -32601
+	CodeInvalidParams       = -32602
+	CodeInternalError       = -32603
+	CodePluginError         = -32000
+	CodeIncompatibleVersion = -32001
+)
+
+// Message is a single protocol message. Requests carry a Method, responses
+// carry a Result or an Error, and notifications are requests without an ID.
+type Message struct {
+	ID     string          `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+	// Deadline is when the host stops waiting for the response to a request
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Stream says which sides of a request stream a body under its ID
+	Stream StreamMode `json:"stream,omitempty"`
+}
+
+// IsRequest reports whether the message is a request or notification
+func (m Message) IsRequest() bool {
+	return m.Method != ""
+}
+
+// IsNotification reports whether the message is a request that expects no response
+func (m Message) IsNotification() bool {
+	return m.Method != "" && m.ID == ""
+}
+
+// Error is a protocol-level error
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+// UnmarshalJSON accepts both the structured error object and the bare
+// string errors sent by legacy plugins.
+func (e *Error) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		e.Code = CodePluginError
+		if strings.HasPrefix(strings.ToLower(message), "unknown method") {
+			e.Code = CodeMethodNotFound
+		}
+		e.Message = message
+		return nil
+	}
+
+	type plain Error
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*e = Error(decoded)
+	return nil
+}
+
+// NewError creates a protocol error with a formatted message
+func NewError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// IsMethodNotFound reports whether err is a "method not found" protocol error
+func IsMethodNotFound(err error) bool {
+	var perr *Error
+	return errors.As(err, &perr) && perr.Code == CodeMethodNotFound
+}
+
+// NewRequest creates a request message with JSON-encoded params
+func NewRequest(id, method string, params interface{}) (Message, error) {
+	msg := Message{ID: id, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return Message{}, fmt.Errorf("failed to marshal params: %w", err)
+		}
+		msg.Params = data
+	}
+	return msg, nil
+}
+
+// NewResult creates a response message with a JSON-encoded result
+func NewResult(id string, result interface{}) Message {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return NewErrorResponse(id, NewError(CodeInternalError, "failed to marshal result: %v", err))
+	}
+	return Message{ID: id, Result: data}
+}
+
+// NewErrorResponse creates a response message carrying an error
+func NewErrorResponse(id string, err *Error) Message {
+	return Message{ID: id, Error: err}
+}
@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+)
+
+// ErrNoPeerCredentials is returned where the kernel can't report the process
+// on the other end of a unix socket
+var ErrNoPeerCredentials = errors.New("peer credentials not available")
+
+// HostPID returns the pid of the host that launched the plugin, or 0 if the
+// plugin wasn't launched by a host
+func HostPID() int {
+	pid, err := strconv.Atoi(os.Getenv(EnvHostPID))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// HostOnly wraps the listener on a plugin's socket so that it only accepts
+// connections from the host process, closing any other. Plugins share the
+// socket directory, so without this one plugin could call another directly
+// instead of through the mesh, which checks what it may call. Every
+// connection is accepted if hostPID is 0 or the platform can't report
+// the peer.
+func HostOnly(listener net.Listener, hostPID int) net.Listener {
+	if hostPID <= 0 {
+		return listener
+	}
+	return &hostListener{Listener: listener, hostPID: hostPID}
+}
+
+type hostListener struct {
+	net.Listener
+	hostPID int
+}
+
+func (l *hostListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		pid, _, err := PeerCred(conn)
+		if errors.Is(err, ErrNoPeerCredentials) || (err == nil && pid == l.hostPID) {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
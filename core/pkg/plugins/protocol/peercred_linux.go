@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"net"
+	"syscall"
+)
+
+// PeerCred returns the process and user on the other end of a unix socket
+// connection, as reported by SO_PEERCRED
+func PeerCred(conn net.Conn) (pid, uid int, err error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, 0, ErrNoPeerCredentials
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return 0, 0, err
+	}
+	if credErr != nil {
+		return 0, 0, credErr
+	}
+	return int(cred.Pid), int(cred.Uid), nil
+}
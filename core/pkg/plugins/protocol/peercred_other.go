@@ -0,0 +1,10 @@
+//go:build !linux
+
+package protocol
+
+import "net"
+
+// PeerCred is only implemented with SO_PEERCRED
+func PeerCred(conn net.Conn) (pid, uid int, err error) {
+	return 0, 0, ErrNoPeerCredentials
+}
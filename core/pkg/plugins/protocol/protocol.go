@@ -0,0 +1,164 @@
+// Package protocol defines the versioned wire protocol spoken between the
+// Blackhole host and out-of-process plugins.
+//
+// Every connection starts with a $/handshake exchange in which the host offers
+// its protocol version and features and the plugin answers with its identity
+// and the subset it supports. Both sides then restrict themselves to the
+// negotiated feature set. Plugins that predate the handshake answer it with
+// "method not found" and are treated as LegacyVersion peers.
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// Version is the protocol version implemented by this package
+	Version = 1
+
+	// MinVersion is the oldest protocol version this package can speak
+	MinVersion = 1
+
+	// LegacyVersion identifies plugins that do not implement the handshake
+	LegacyVersion = 0
+)
+
+// Feature is an optional protocol capability negotiated during the handshake
+type Feature string
+
+const (
+	// FeatureStreaming allows chunked request and response bodies
+	FeatureStreaming Feature = "streaming"
+	// FeatureState allows export_state and import_state calls
+	FeatureState Feature = "state"
+	// FeatureCancellation allows the host to send $/cancel notifications
+	FeatureCancellation Feature = "cancellation"
+)
+
+// Transport identifies how protocol messages are carried between host and plugin
+type Transport string
+
+const (
+	// TransportStdio carries line-delimited messages over stdin/stdout
+	TransportStdio Transport = "stdio"
+	// TransportSocket carries line-delimited messages over the unix socket in PLUGIN_SOCKET
+	TransportSocket Transport = "socket"
+	// TransportGRPC serves the plugin as a gRPC service on the unix socket in PLUGIN_SOCKET
+	TransportGRPC Transport = "grpc"
+)
+
+// Environment variables set by the host when it launches a plugin
+const (
+	EnvName            = "PLUGIN_NAME"
+	EnvVersion         = "PLUGIN_VERSION"
+	EnvProtocolVersion = "PLUGIN_PROTOCOL_VERSION"
+	EnvTransport       = "PLUGIN_TRANSPORT"
+	EnvSocket          = "PLUGIN_SOCKET"
+	EnvDataDir         = "PLUGIN_DATA_DIR"
+	EnvMeshEndpoint    = "PLUGIN_MESH_ENDPOINT"
+	EnvMeshToken       = "PLUGIN_MESH_TOKEN"
+	EnvHostPID         = "PLUGIN_HOST_PID"
+)
+
+// gRPC metadata on calls a plugin makes through the mesh endpoint
+const (
+	// MetadataService names the mesh service to route the call to
+	MetadataService = "x-mesh-service"
+	// MetadataToken carries PLUGIN_MESH_TOKEN where the host can't identify
+	// the calling process by its socket credentials
+	MetadataToken = "x-plugin-token"
+	// MetadataPluginVersion pins the call to a version of the service's
+	// plugin while two versions of it are rolled out side by side
+	MetadataPluginVersion = "x-plugin-version"
+)
+
+// Protocol methods
+const (
+	MethodHandshake       = "$/handshake"
+	MethodCancel          = "$/cancel"
+	MethodInitialize      = "initialize"
+	MethodStart           = "start"
+	MethodStop            = "stop"
+	MethodHandle          = "handle"
+	MethodHealthCheck     = "healthcheck"
+	MethodGetInfo         = "getinfo"
+	MethodGetStatus       = "getstatus"
+	MethodPrepareShutdown = "prepare_shutdown"
+	MethodShutdown        = "shutdown"
+	MethodExportState     = "export_state"
+	MethodImportState     = "import_state"
+)
+
+// ErrIncompatibleVersion is returned when host and plugin share no protocol version
+var ErrIncompatibleVersion = errors.New("incompatible plugin protocol version")
+
+// Handshake is exchanged by host and plugin when a connection is established
+type Handshake struct {
+	ProtocolVersion int       `json:"protocol_version"`
+	Name            string    `json:"name"`
+	Version         string    `json:"version"`
+	Transport       Transport `json:"transport,omitempty"`
+	Features        []Feature `json:"features,omitempty"`
+}
+
+// Supports reports whether the feature is part of the handshake
+func (h Handshake) Supports(feature Feature) bool {
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLegacy reports whether the peer predates the handshake
+func (h Handshake) IsLegacy() bool {
+	return h.ProtocolVersion == LegacyVersion
+}
+
+// LegacyHandshake returns the handshake assumed for a plugin that does not
+// implement $/handshake. Legacy stdio plugins always supported state calls.
+func LegacyHandshake(name, version string) Handshake {
+	return Handshake{
+		ProtocolVersion: LegacyVersion,
+		Name:            name,
+		Version:         version,
+		Transport:       TransportStdio,
+		Features:        []Feature{FeatureState},
+	}
+}
+
+// Negotiate returns the protocol version and features both sides support
+func Negotiate(local, remote Handshake) (int, []Feature, error) {
+	version := local.ProtocolVersion
+	if remote.ProtocolVersion < version {
+		version = remote.ProtocolVersion
+	}
+	if version < MinVersion || version > Version {
+		return 0, nil, fmt.Errorf("%w: local=%d remote=%d", ErrIncompatibleVersion,
+			local.ProtocolVersion, remote.ProtocolVersion)
+	}
+
+	features := make([]Feature, 0, len(local.Features))
+	for _, f := range local.Features {
+		if remote.Supports(f) {
+			features = append(features, f)
+		}
+	}
+
+	return version, features, nil
+}
+
+// Accept builds the handshake a plugin replies with to the host's offer
+func Accept(local, offer Handshake) (Handshake, error) {
+	version, features, err := Negotiate(local, offer)
+	if err != nil {
+		return Handshake{}, err
+	}
+
+	reply := local
+	reply.ProtocolVersion = version
+	reply.Features = features
+	return reply, nil
+}
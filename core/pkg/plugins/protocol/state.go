@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// statePayload is the export_state result and import_state params since Version 1
+type statePayload struct {
+	State []byte `json:"state"`
+}
+
+// EncodeState encodes plugin state for the peer described by the handshake.
+// Legacy plugins exchange state as a bare JSON string.
+func EncodeState(peer Handshake, state []byte) (json.RawMessage, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if peer.IsLegacy() {
+		data, err = json.Marshal(string(state))
+	} else {
+		data, err = json.Marshal(statePayload{State: state})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	return data, nil
+}
+
+// DecodeState decodes plugin state in either the current or the legacy encoding
+func DecodeState(raw json.RawMessage) ([]byte, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	if raw[0] == '"' {
+		var legacy string
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return nil, fmt.Errorf("failed to decode state: %w", err)
+		}
+		return []byte(legacy), nil
+	}
+
+	var payload statePayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	return payload.State, nil
+}
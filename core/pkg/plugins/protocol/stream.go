@@ -0,0 +1,347 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// StreamMode says which sides of a request stream a body alongside it
+type StreamMode string
+
+const (
+	// StreamNone is a plain request with a single response
+	StreamNone StreamMode = ""
+	// StreamClient streams the request body from host to plugin
+	StreamClient StreamMode = "client"
+	// StreamServer streams the response body from plugin to host
+	StreamServer StreamMode = "server"
+	// StreamBidi streams in both directions at once
+	StreamBidi StreamMode = "bidi"
+)
+
+// ClientStreams reports whether the host streams a request body
+func (m StreamMode) ClientStreams() bool {
+	return m == StreamClient || m == StreamBidi
+}
+
+// ServerStreams reports whether the plugin streams a response body
+func (m StreamMode) ServerStreams() bool {
+	return m == StreamServer || m == StreamBidi
+}
+
+// Stream notifications. Chunks are sent only against credit granted by the
+// receiver, which starts at StreamWindow chunks and is topped up with
+// $/stream/credit as the receiver consumes them.
+const (
+	MethodStreamData   = "$/stream/data"
+	MethodStreamEnd    = "$/stream/end"
+	MethodStreamCredit = "$/stream/credit"
+)
+
+const (
+	// StreamChunkSize is the largest body chunk sent in one message
+	StreamChunkSize = 32 * 1024
+	// StreamWindow is the number of chunks a sender may have unconsumed
+	StreamWindow = 16
+)
+
+var (
+	// ErrStreamClosed is returned when writing to a stream that has ended
+	ErrStreamClosed = errors.New("stream closed")
+	// ErrFlowControl is returned when a peer sends chunks it had no credit for
+	ErrFlowControl = errors.New("stream flow control violated")
+)
+
+// StreamData carries a chunk of a stream body
+type StreamData struct {
+	ID   string `json:"id"`
+	Data []byte `json:"data"`
+}
+
+// StreamEnd ends one direction of a stream, optionally with an error
+type StreamEnd struct {
+	ID    string `json:"id"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// StreamCredit allows the peer to send more chunks
+type StreamCredit struct {
+	ID     string `json:"id"`
+	Chunks int    `json:"chunks"`
+}
+
+// Stream is one side of a streamed request. It reads the body the peer
+// sends and writes the body sent to the peer, with chunking and flow control.
+type Stream struct {
+	id   string
+	conn *Conn
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	credits    int
+	sendClosed bool
+	sendErr    error
+
+	chunks   chan []byte
+	buf      []byte
+	consumed int
+	recvErr  error
+	ended    bool
+}
+
+func newStream(id string, conn *Conn) *Stream {
+	s := &Stream{
+		id:      id,
+		conn:    conn,
+		credits: StreamWindow,
+		chunks:  make(chan []byte, StreamWindow),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// ID returns the ID of the request the stream belongs to
+func (s *Stream) ID() string {
+	return s.id
+}
+
+// Read reads the body sent by the peer. It returns io.EOF once the peer
+// ends the stream, or the error the peer ended it with.
+func (s *Stream) Read(p []byte) (int, error) {
+	if len(s.buf) == 0 {
+		chunk, ok := <-s.chunks
+		if !ok {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return 0, s.recvErr
+		}
+		s.buf = chunk
+		s.returnCredit()
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// returnCredit tells the peer it may send more once half the window has
+// been consumed
+func (s *Stream) returnCredit() {
+	s.consumed++
+	if s.consumed < StreamWindow/2 {
+		return
+	}
+	params, _ := json.Marshal(StreamCredit{ID: s.id, Chunks: s.consumed})
+	s.consumed = 0
+	s.conn.Write(Message{Method: MethodStreamCredit, Params: params})
+}
+
+// Write sends p to the peer in chunks, waiting for credit as needed
+func (s *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		s.mu.Lock()
+		for s.credits == 0 && !s.sendClosed {
+			s.cond.Wait()
+		}
+		if s.sendClosed {
+			err := s.sendErr
+			s.mu.Unlock()
+			return written, err
+		}
+		s.credits--
+		s.mu.Unlock()
+
+		n := len(p)
+		if n > StreamChunkSize {
+			n = StreamChunkSize
+		}
+		params, err := json.Marshal(StreamData{ID: s.id, Data: p[:n]})
+		if err != nil {
+			return written, err
+		}
+		if err := s.conn.Write(Message{Method: MethodStreamData, Params: params}); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite ends the body sent to the peer
+func (s *Stream) CloseWrite() error {
+	return s.CloseWriteWithError(nil)
+}
+
+// CloseWriteWithError ends the body sent to the peer with an error the peer
+// reads instead of io.EOF
+func (s *Stream) CloseWriteWithError(err error) error {
+	s.mu.Lock()
+	if s.sendClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.sendClosed = true
+	s.sendErr = ErrStreamClosed
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	end := StreamEnd{ID: s.id}
+	if err != nil {
+		end.Error = NewError(CodePluginError, "%v", err)
+	}
+	params, _ := json.Marshal(end)
+	return s.conn.Write(Message{Method: MethodStreamEnd, Params: params})
+}
+
+// abort fails both directions of the stream locally without telling the peer
+func (s *Stream) abort(err error) {
+	s.mu.Lock()
+	if !s.sendClosed {
+		s.sendClosed = true
+		s.sendErr = err
+		s.cond.Broadcast()
+	}
+	s.mu.Unlock()
+	s.endRecv(err)
+}
+
+// endRecv ends the body read from the peer
+func (s *Stream) endRecv(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.recvErr = err
+	close(s.chunks)
+}
+
+// deliver queues a chunk from the peer, failing the stream if the peer
+// exceeded its credit
+func (s *Stream) deliver(data []byte) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	select {
+	case s.chunks <- data:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	s.mu.Unlock()
+	s.abort(ErrFlowControl)
+}
+
+func (s *Stream) grant(chunks int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credits += chunks
+	s.cond.Broadcast()
+}
+
+// Streams tracks the open streams on a connection and routes stream
+// notifications to them
+type Streams struct {
+	conn    *Conn
+	mu      sync.Mutex
+	streams map[string]*Stream
+}
+
+// NewStreams creates the stream table for conn
+func NewStreams(conn *Conn) *Streams {
+	return &Streams{conn: conn, streams: make(map[string]*Stream)}
+}
+
+// Open registers a stream for the request with id. It must be called before
+// the peer can send on it: by the host before writing the request, and by
+// the plugin on the goroutine reading the connection.
+func (s *Streams) Open(id string) *Stream {
+	stream := newStream(id, s.conn)
+	s.mu.Lock()
+	s.streams[id] = stream
+	s.mu.Unlock()
+	return stream
+}
+
+// Finish removes a stream once its request has been answered. Reads see err
+// (io.EOF for nil) if the peer never ended its body, and writes fail.
+func (s *Streams) Finish(id string, err error) {
+	s.mu.Lock()
+	stream, ok := s.streams[id]
+	delete(s.streams, id)
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	stream.mu.Lock()
+	if !stream.sendClosed {
+		stream.sendClosed = true
+		stream.sendErr = ErrStreamClosed
+		stream.cond.Broadcast()
+	}
+	stream.mu.Unlock()
+	stream.endRecv(err)
+}
+
+// AbortAll fails every open stream, for when the connection is lost
+func (s *Streams) AbortAll(err error) {
+	s.mu.Lock()
+	streams := s.streams
+	s.streams = make(map[string]*Stream)
+	s.mu.Unlock()
+
+	for _, stream := range streams {
+		stream.abort(err)
+	}
+}
+
+// Dispatch delivers a stream notification. It reports false for messages
+// that aren't stream notifications.
+func (s *Streams) Dispatch(msg Message) bool {
+	switch msg.Method {
+	case MethodStreamData:
+		var data StreamData
+		if stream := s.decode(msg, &data, &data.ID); stream != nil {
+			stream.deliver(data.Data)
+		}
+	case MethodStreamEnd:
+		var end StreamEnd
+		if stream := s.decode(msg, &end, &end.ID); stream != nil {
+			var err error = io.EOF
+			if end.Error != nil {
+				err = end.Error
+			}
+			stream.endRecv(err)
+		}
+	case MethodStreamCredit:
+		var credit StreamCredit
+		if stream := s.decode(msg, &credit, &credit.ID); stream != nil && credit.Chunks > 0 {
+			stream.grant(credit.Chunks)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// decode unmarshals a notification's params and returns the stream named by
+// its id, if still open
+func (s *Streams) decode(msg Message, params interface{}, id *string) *Stream {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[*id]
+}
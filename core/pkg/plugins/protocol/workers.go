@@ -0,0 +1,102 @@
+package protocol
+
+import "sync"
+
+// DefaultWorkers is the number of requests a plugin handles at once unless
+// configured otherwise
+const DefaultWorkers = 16
+
+// Concurrent reports whether requests for method may run alongside other
+// requests. Lifecycle and state calls run alone so they observe a quiescent
+// plugin.
+func Concurrent(method string) bool {
+	switch method {
+	case MethodHandle, MethodHealthCheck, MethodGetInfo, MethodGetStatus:
+		return true
+	}
+	return false
+}
+
+// WorkerPool runs requests read from a connection on a bounded number of
+// goroutines. It is driven by the single goroutine reading the connection,
+// which it never blocks: every request is queued on a goroutine of its own,
+// so the reader is always free to pass on cancellations and stream data.
+// Requests start in the order they were queued relative to exclusive ones.
+type WorkerPool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu sync.Mutex
+	// exclusive is closed once the last exclusive request queued has run
+	exclusive chan struct{}
+	// running counts the concurrent requests queued since then
+	running *sync.WaitGroup
+}
+
+// NewWorkerPool creates a pool running at most size requests at once
+func NewWorkerPool(size int) *WorkerPool {
+	if size <= 0 {
+		size = DefaultWorkers
+	}
+	exclusive := make(chan struct{})
+	close(exclusive)
+	return &WorkerPool{
+		slots:     make(chan struct{}, size),
+		exclusive: exclusive,
+		running:   new(sync.WaitGroup),
+	}
+}
+
+// Go queues fn to run on a worker once one is free and any exclusive
+// request queued before it has finished
+func (p *WorkerPool) Go(fn func()) {
+	p.mu.Lock()
+	after, running := p.exclusive, p.running
+	running.Add(1)
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer running.Done()
+		<-after
+		p.slots <- struct{}{}
+		defer func() { <-p.slots }()
+		fn()
+	}()
+}
+
+// Exclusive queues fn to run once every request queued before it has
+// finished; requests queued after it wait until it returns. The returned
+// channel is closed when fn has returned.
+func (p *WorkerPool) Exclusive(fn func()) <-chan struct{} {
+	done := make(chan struct{})
+	p.mu.Lock()
+	after, running := p.exclusive, p.running
+	p.exclusive, p.running = done, new(sync.WaitGroup)
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(done)
+		<-after
+		running.Wait()
+		fn()
+	}()
+	return done
+}
+
+// Dispatch runs fn concurrently or exclusively depending on the method
+func (p *WorkerPool) Dispatch(method string, fn func()) {
+	if Concurrent(method) {
+		p.Go(fn)
+		return
+	}
+	p.Exclusive(fn)
+}
+
+// Wait waits for queued requests to finish
+func (p *WorkerPool) Wait() {
+	p.wg.Wait()
+}
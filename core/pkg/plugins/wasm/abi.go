@@ -0,0 +1,97 @@
+// Package wasm defines the ABI between the plugin host and WebAssembly
+// plugins, and implements its guest side for plugins written in Go.
+//
+// A WebAssembly plugin is a WASI (wasip1) reactor module. The host calls
+// the functions the module exports, and the module exchanges data with the
+// host through the functions of the host module. Each call has one input,
+// which the plugin reads, and one output, which the plugin writes:
+//
+//	blackhole_abi_version() i32       the ABI the plugin implements, required
+//	blackhole_handle() i32            input a JSON request, output a JSON response
+//	blackhole_export_state() i32      output the plugin's state
+//	blackhole_import_state() i32      input the state to restore
+//	blackhole_health() i32            output why the plugin is unhealthy
+//	blackhole_prepare_shutdown() i32  finish pending work
+//
+// Each returns a Status. Only blackhole_abi_version and blackhole_handle
+// are required; a plugin without the others keeps no state and is always
+// healthy. On error the output is the error message.
+//
+// The plugin's data directory is its only preopened directory, mounted at
+// DataDir. A plugin has no network access.
+//
+// Plugins written in Go are built with
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o plugin.wasm
+//
+// and register the plugin with Register from an init function.
+package wasm
+
+// ABIVersion is the version of the ABI described above
+const ABIVersion = 1
+
+// HostModule is the module the host functions are imported from
+const HostModule = "blackhole"
+
+// Host functions
+const (
+	// HostInputLen returns the size of the call's input
+	HostInputLen = "input_len" // () i32
+	// HostInputRead copies the call's input to memory at ptr
+	HostInputRead = "input_read" // (ptr i32)
+	// HostOutputWrite sets the call's output to len bytes at ptr
+	HostOutputWrite = "output_write" // (ptr i32, len i32)
+	// HostLog logs len bytes at ptr at a LogLevel
+	HostLog = "log" // (level i32, ptr i32, len i32)
+)
+
+// Plugin exports
+const (
+	ExportABIVersion      = "blackhole_abi_version"
+	ExportHandle          = "blackhole_handle"
+	ExportExportState     = "blackhole_export_state"
+	ExportImportState     = "blackhole_import_state"
+	ExportHealth          = "blackhole_health"
+	ExportPrepareShutdown = "blackhole_prepare_shutdown"
+)
+
+// Status is returned by every plugin export
+type Status int32
+
+const (
+	StatusOK          Status = 0
+	StatusError       Status = 1 // the output is the error message
+	StatusUnsupported Status = 2 // the plugin doesn't implement the call
+)
+
+// LogLevel is the level of a message logged through HostLog
+type LogLevel int32
+
+const (
+	LogDebug LogLevel = 0
+	LogInfo  LogLevel = 1
+	LogWarn  LogLevel = 2
+	LogError LogLevel = 3
+)
+
+// DataDir is where the plugin's data directory is mounted
+const DataDir = "/data"
+
+// Request is a request delivered to a plugin, the input of
+// blackhole_handle. It has the JSON form of the host's plugin requests.
+type Request struct {
+	ID      string                 `json:"id"`
+	Method  string                 `json:"method"`
+	Params  map[string]interface{} `json:"params"`
+	Data    []byte                 `json:"data,omitempty"`
+	Context map[string]interface{} `json:"context,omitempty"`
+}
+
+// Response is a plugin's reply to a Request, the output of blackhole_handle
+type Response struct {
+	ID      string                 `json:"id"`
+	Success bool                   `json:"success"`
+	Result  map[string]interface{} `json:"result,omitempty"`
+	Data    []byte                 `json:"data,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
@@ -0,0 +1,167 @@
+//go:build wasip1
+
+package wasm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// Handler is implemented by every WebAssembly plugin
+type Handler interface {
+	Handle(req Request) (Response, error)
+}
+
+// StateHandler is implemented by plugins that keep state across versions
+type StateHandler interface {
+	ExportState() ([]byte, error)
+	ImportState(state []byte) error
+}
+
+// HealthChecker is implemented by plugins that can report being unhealthy
+type HealthChecker interface {
+	HealthCheck() error
+}
+
+// ShutdownPreparer is implemented by plugins that need to finish work
+// before they are stopped
+type ShutdownPreparer interface {
+	PrepareShutdown() error
+}
+
+// registered is the plugin the exports call
+var registered Handler
+
+// Register sets the plugin the host calls. The host doesn't run main, so
+// plugins register from an init function.
+func Register(plugin Handler) {
+	registered = plugin
+}
+
+// Log logs a message through the host
+func Log(level LogLevel, message string) {
+	if message == "" {
+		return
+	}
+	data := []byte(message)
+	hostLog(int32(level), unsafe.Pointer(&data[0]), int32(len(data)))
+}
+
+//go:wasmimport blackhole input_len
+func hostInputLen() int32
+
+//go:wasmimport blackhole input_read
+func hostInputRead(ptr unsafe.Pointer)
+
+//go:wasmimport blackhole output_write
+func hostOutputWrite(ptr unsafe.Pointer, size int32)
+
+//go:wasmimport blackhole log
+func hostLog(level int32, ptr unsafe.Pointer, size int32)
+
+// input returns the call's input
+func input() []byte {
+	data := make([]byte, hostInputLen())
+	if len(data) > 0 {
+		hostInputRead(unsafe.Pointer(&data[0]))
+	}
+	return data
+}
+
+// output sets the call's output
+func output(data []byte) {
+	if len(data) == 0 {
+		hostOutputWrite(nil, 0)
+		return
+	}
+	hostOutputWrite(unsafe.Pointer(&data[0]), int32(len(data)))
+}
+
+// fail sets the call's output to an error
+func fail(err error) int32 {
+	output([]byte(err.Error()))
+	return int32(StatusError)
+}
+
+//go:wasmexport blackhole_abi_version
+func abiVersion() int32 {
+	return ABIVersion
+}
+
+//go:wasmexport blackhole_handle
+func handle() int32 {
+	if registered == nil {
+		return fail(errors.New("no plugin registered"))
+	}
+
+	var req Request
+	if err := json.Unmarshal(input(), &req); err != nil {
+		return fail(fmt.Errorf("invalid request: %w", err))
+	}
+	resp, err := registered.Handle(req)
+	if err != nil {
+		return fail(err)
+	}
+	if resp.ID == "" {
+		resp.ID = req.ID
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fail(fmt.Errorf("failed to marshal response: %w", err))
+	}
+	output(data)
+	return int32(StatusOK)
+}
+
+//go:wasmexport blackhole_export_state
+func exportState() int32 {
+	stateful, ok := registered.(StateHandler)
+	if !ok {
+		return int32(StatusUnsupported)
+	}
+	state, err := stateful.ExportState()
+	if err != nil {
+		return fail(err)
+	}
+	output(state)
+	return int32(StatusOK)
+}
+
+//go:wasmexport blackhole_import_state
+func importState() int32 {
+	stateful, ok := registered.(StateHandler)
+	if !ok {
+		return int32(StatusUnsupported)
+	}
+	if err := stateful.ImportState(input()); err != nil {
+		return fail(err)
+	}
+	return int32(StatusOK)
+}
+
+//go:wasmexport blackhole_health
+func health() int32 {
+	checker, ok := registered.(HealthChecker)
+	if !ok {
+		return int32(StatusOK)
+	}
+	if err := checker.HealthCheck(); err != nil {
+		return fail(err)
+	}
+	return int32(StatusOK)
+}
+
+//go:wasmexport blackhole_prepare_shutdown
+func prepareShutdown() int32 {
+	preparer, ok := registered.(ShutdownPreparer)
+	if !ok {
+		return int32(StatusOK)
+	}
+	if err := preparer.PrepareShutdown(); err != nil {
+		return fail(err)
+	}
+	return int32(StatusOK)
+}
@@ -0,0 +1,81 @@
+package routing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+)
+
+func TestProtocolRouter_CallerGrants(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	router := routing.NewProtocolRouter(zap.New(core))
+	router.SetCallerGrants("analytics", []routing.Grant{{Service: "plugin.analytics"}})
+	router.SetCallerGrants("app", []routing.Grant{
+		{Service: "plugin.storage", Methods: []string{"/storage.v1.Storage/Get*"}},
+	})
+
+	analytics := routing.WithCaller(context.Background(), "analytics")
+	_, err := router.RouteRequest(analytics, "plugin.storage", "/storage.v1.Storage/Get", nil)
+	require.ErrorIs(t, err, routing.ErrCallDenied)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "analytics", logs.All()[0].ContextMap()["plugin"])
+	assert.Equal(t, "plugin.storage", logs.All()[0].ContextMap()["service"])
+
+	// Its own service is allowed; it just isn't registered here
+	_, err = router.RouteRequest(analytics, "plugin.analytics", "/analytics.v1.Analytics/Track", nil)
+	assert.NotErrorIs(t, err, routing.ErrCallDenied)
+
+	// Grants can be limited to methods
+	app := routing.WithCaller(context.Background(), "app")
+	_, err = router.RouteRequest(app, "plugin.storage", "/storage.v1.Storage/GetObject", nil)
+	assert.NotErrorIs(t, err, routing.ErrCallDenied)
+	_, err = router.RouteRequest(app, "plugin.storage", "/storage.v1.Storage/Delete", nil)
+	assert.ErrorIs(t, err, routing.ErrCallDenied)
+
+	// The node itself is not restricted
+	_, err = router.RouteRequest(context.Background(), "plugin.storage", "/storage.v1.Storage/Delete", nil)
+	assert.NotErrorIs(t, err, routing.ErrCallDenied)
+
+	assert.Equal(t, map[string]uint64{"analytics": 1, "app": 1}, router.DeniedCalls())
+
+	// Released callers have no grants left
+	router.ReleaseCaller("app")
+	assert.Empty(t, router.CallerGrants("app"))
+	_, err = router.RouteRequest(app, "plugin.storage", "/storage.v1.Storage/Get", nil)
+	assert.ErrorIs(t, err, routing.ErrCallDenied)
+}
+
+func TestProtocolRouter_IdentifyCaller(t *testing.T) {
+	router := routing.NewProtocolRouter(zap.NewNop())
+
+	token, err := router.IssueCallerToken("storage")
+	require.NoError(t, err)
+	router.RegisterCallerPID("analytics", 4242)
+
+	caller, ok := router.IdentifyCaller(0, token)
+	require.True(t, ok)
+	assert.Equal(t, "storage", caller)
+
+	// The peer's pid wins over a presented token
+	caller, ok = router.IdentifyCaller(4242, token)
+	require.True(t, ok)
+	assert.Equal(t, "analytics", caller)
+
+	_, ok = router.IdentifyCaller(0, "")
+	assert.False(t, ok)
+
+	// Reissuing invalidates the old token
+	_, err = router.IssueCallerToken("storage")
+	require.NoError(t, err)
+	_, ok = router.IdentifyCaller(0, token)
+	assert.False(t, ok)
+}
@@ -0,0 +1,136 @@
+package routing_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
+)
+
+func TestSplit_PicksByWeightAndPin(t *testing.T) {
+	split := routing.NewSplit("1.0.0", "2.0.0")
+
+	counts := map[string]int{}
+	for i := 0; i < 100; i++ {
+		counts[split.Pick("")]++
+	}
+	assert.Equal(t, 100, counts["1.0.0"], "a new split sends nothing to the canary")
+
+	split.SetWeight(100)
+	assert.Equal(t, "2.0.0", split.Pick(""))
+	assert.Equal(t, "1.0.0", split.Pick("1.0.0"), "pins override the weight")
+	assert.Equal(t, "2.0.0", split.Pick("3.0.0"), "pins to other versions are ignored")
+
+	split.SetWeight(25)
+	counts = map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[split.Pick("")]++
+	}
+	assert.InDelta(t, 1000, counts["2.0.0"], 150)
+
+	split.SetWeight(150)
+	assert.Equal(t, 100, split.Weight())
+}
+
+// observedRequest is a request a routeRecorder was told about
+type observedRequest struct {
+	version string
+	method  string
+	failed  bool
+}
+
+// routeRecorder records the requests the router observes
+type routeRecorder struct {
+	mu       sync.Mutex
+	requests []observedRequest
+}
+
+func (r *routeRecorder) BeginRequest(serviceName, version, fullMethod string) func(error) {
+	return func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, observedRequest{version: version, method: fullMethod, failed: err != nil})
+	}
+}
+
+// startFailingService serves requests on a unix socket, failing those that
+// name a gRPC status code
+func startFailingService(t *testing.T, socketPath string) {
+	t.Helper()
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(pool.RawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			var request []byte
+			if err := stream.RecvMsg(&request); err != nil {
+				return err
+			}
+			switch string(request) {
+			case "unavailable":
+				return status.Error(codes.Unavailable, "down")
+			case "not-found":
+				return status.Error(codes.NotFound, "no such object")
+			}
+			return stream.SendMsg(&request)
+		}),
+	)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+}
+
+func TestProtocolRouter_ObservesRoutedRequests(t *testing.T) {
+	dir, err := os.MkdirTemp("", "observe")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	stableSocket := filepath.Join(dir, "stable.sock")
+	canarySocket := filepath.Join(dir, "canary.sock")
+	startFailingService(t, stableSocket)
+	startFailingService(t, canarySocket)
+
+	router := routing.NewProtocolRouter(zap.NewNop())
+	require.NoError(t, router.RegisterService("plugin.storage", mesh.ServiceEndpoint{Socket: stableSocket, IsLocal: true}))
+	recorder := &routeRecorder{}
+	router.SetRouteObserver(recorder)
+
+	route := func(ctx context.Context, request string) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		router.RouteRequest(ctx, "plugin.storage", "/storage.v1.Storage/Get", []byte(request))
+	}
+	route(context.Background(), "object-1")
+
+	require.NoError(t, router.StartCanary("plugin.storage", routing.NewSplit("1.0.0", "2.0.0"),
+		mesh.ServiceEndpoint{Socket: canarySocket, IsLocal: true}))
+	route(routing.WithPinnedVersion(context.Background(), "1.0.0"), "object-1")
+	route(routing.WithPinnedVersion(context.Background(), "2.0.0"), "unavailable")
+	route(routing.WithPinnedVersion(context.Background(), "2.0.0"), "not-found")
+	cancelled, cancel := context.WithCancel(routing.WithPinnedVersion(context.Background(), "2.0.0"))
+	cancel()
+	route(cancelled, "object-1")
+
+	// Only errors that point at the service count as failures
+	assert.Equal(t, []observedRequest{
+		{version: "", method: "/storage.v1.Storage/Get"},
+		{version: "1.0.0", method: "/storage.v1.Storage/Get"},
+		{version: "2.0.0", method: "/storage.v1.Storage/Get", failed: true},
+		{version: "2.0.0", method: "/storage.v1.Storage/Get"},
+		{version: "2.0.0", method: "/storage.v1.Storage/Get"},
+	}, recorder.requests)
+}
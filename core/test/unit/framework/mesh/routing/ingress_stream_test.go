@@ -0,0 +1,147 @@
+package routing_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// startStreamingService serves StreamStore, which answers with the number of
+// bytes it received, and StreamRetrieve, which sends as many chunks as the
+// request asks for
+func startStreamingService(t *testing.T, socketPath string) {
+	t.Helper()
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(pool.RawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			switch method {
+			case "/blackhole.plugin.storage.v1.StoragePlugin/StreamStore":
+				total := 0
+				for {
+					var chunk []byte
+					err := stream.RecvMsg(&chunk)
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						return err
+					}
+					total += len(chunk)
+				}
+				response := []byte(strconv.Itoa(total))
+				return stream.SendMsg(&response)
+			case "/blackhole.plugin.storage.v1.StoragePlugin/StreamRetrieve":
+				var request []byte
+				if err := stream.RecvMsg(&request); err != nil {
+					return err
+				}
+				count, _ := strconv.Atoi(string(request))
+				for i := 0; i < count; i++ {
+					chunk := []byte(fmt.Sprintf("chunk-%d", i))
+					if err := stream.SendMsg(&chunk); err != nil {
+						return err
+					}
+				}
+				stream.SetTrailer(metadata.Pairs("chunks", strconv.Itoa(count)))
+				return nil
+			}
+			return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+		}),
+	)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+}
+
+func TestIngress_ProxiesStreams(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ingress")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	storageSocket := filepath.Join(dir, "storage.sock")
+	startStreamingService(t, storageSocket)
+
+	router := routing.NewProtocolRouter(zap.NewNop())
+	require.NoError(t, router.RegisterService("plugin.storage", mesh.ServiceEndpoint{
+		Socket:  storageSocket,
+		IsLocal: true,
+	}))
+	router.SetCallerGrants("app", []routing.Grant{{Service: "plugin.storage"}})
+	token, err := router.IssueCallerToken("app")
+	require.NoError(t, err)
+
+	ingress := routing.NewIngress(router, zap.NewNop())
+	ingressSocket := filepath.Join(dir, routing.IngressSocketName)
+	listener, err := ingress.Listen(ingressSocket)
+	require.NoError(t, err)
+	go ingress.Serve(listener)
+	t.Cleanup(ingress.Stop)
+
+	conn := dialIngress(t, ingressSocket)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		protocol.MetadataService, "plugin.storage",
+		protocol.MetadataToken, token)
+	desc := &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+
+	// Client streaming
+	store, err := conn.NewStream(ctx, desc, "/blackhole.plugin.storage.v1.StoragePlugin/StreamStore")
+	require.NoError(t, err)
+	chunk := make([]byte, 64*1024)
+	for i := 0; i < 32; i++ {
+		require.NoError(t, store.SendMsg(&chunk))
+	}
+	require.NoError(t, store.CloseSend())
+	var stored []byte
+	require.NoError(t, store.RecvMsg(&stored))
+	assert.Equal(t, strconv.Itoa(32*len(chunk)), string(stored))
+
+	// Server streaming
+	retrieve, err := conn.NewStream(ctx, desc, "/blackhole.plugin.storage.v1.StoragePlugin/StreamRetrieve")
+	require.NoError(t, err)
+	request := []byte("5")
+	require.NoError(t, retrieve.SendMsg(&request))
+	require.NoError(t, retrieve.CloseSend())
+	var chunks []string
+	for {
+		var chunk []byte
+		err := retrieve.RecvMsg(&chunk)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, string(chunk))
+	}
+	assert.Equal(t, []string{"chunk-0", "chunk-1", "chunk-2", "chunk-3", "chunk-4"}, chunks)
+	assert.Equal(t, []string{"5"}, retrieve.Trailer().Get("chunks"))
+
+	// Service errors reach the caller unchanged
+	missing, err := conn.NewStream(ctx, desc, "/blackhole.plugin.storage.v1.StoragePlugin/Missing")
+	require.NoError(t, err)
+	require.NoError(t, missing.CloseSend())
+	var none []byte
+	assert.Equal(t, codes.Unimplemented, status.Code(missing.RecvMsg(&none)))
+}
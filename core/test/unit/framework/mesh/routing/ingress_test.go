@@ -0,0 +1,185 @@
+package routing_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// startEchoService serves a plugin that echoes every request on a unix socket
+func startEchoService(t *testing.T, socketPath string) {
+	t.Helper()
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(pool.RawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			var request []byte
+			if err := stream.RecvMsg(&request); err != nil {
+				return err
+			}
+			return stream.SendMsg(&request)
+		}),
+	)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+}
+
+// dialIngress connects to the ingress the way a plugin does
+func dialIngress(t *testing.T, socketPath string) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.Dial(socketPath,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(pool.RawCodec{})),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func callStorage(conn *grpc.ClientConn, token string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		protocol.MetadataService, "plugin.storage",
+		protocol.MetadataToken, token)
+
+	request := []byte("object-1")
+	var response []byte
+	err := conn.Invoke(ctx, "/storage.v1.Storage/Get", &request, &response)
+	return response, err
+}
+
+func TestIngress_AuthorizesCallers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ingress")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	storageSocket := filepath.Join(dir, "storage.sock")
+	startEchoService(t, storageSocket)
+
+	router := routing.NewProtocolRouter(zap.NewNop())
+	require.NoError(t, router.RegisterService("plugin.storage", mesh.ServiceEndpoint{
+		Socket:  storageSocket,
+		IsLocal: true,
+	}))
+	router.SetCallerGrants("app", []routing.Grant{{Service: "plugin.storage"}})
+	router.SetCallerGrants("analytics", []routing.Grant{{Service: "plugin.analytics"}})
+	appToken, err := router.IssueCallerToken("app")
+	require.NoError(t, err)
+	analyticsToken, err := router.IssueCallerToken("analytics")
+	require.NoError(t, err)
+
+	ingress := routing.NewIngress(router, zap.NewNop())
+	ingressSocket := filepath.Join(dir, routing.IngressSocketName)
+	listener, err := ingress.Listen(ingressSocket)
+	require.NoError(t, err)
+	go ingress.Serve(listener)
+	t.Cleanup(ingress.Stop)
+
+	conn := dialIngress(t, ingressSocket)
+
+	// The analytics plugin never asked for storage
+	_, err = callStorage(conn, analyticsToken)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	response, err := callStorage(conn, appToken)
+	require.NoError(t, err)
+	assert.Equal(t, "object-1", string(response))
+
+	// Processes that aren't plugins are denied too
+	_, err = callStorage(conn, "forged")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	assert.Equal(t, map[string]uint64{"analytics": 1, "unknown": 1}, router.DeniedCalls())
+}
+
+func TestIngress_IdentifiesCallerByPeerCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials require Linux")
+	}
+	dir, err := os.MkdirTemp("", "ingress")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	storageSocket := filepath.Join(dir, "storage.sock")
+	startEchoService(t, storageSocket)
+
+	router := routing.NewProtocolRouter(zap.NewNop())
+	require.NoError(t, router.RegisterService("plugin.storage", mesh.ServiceEndpoint{
+		Socket:  storageSocket,
+		IsLocal: true,
+	}))
+	router.SetCallerGrants("analytics", []routing.Grant{{Service: "plugin.analytics"}})
+	router.RegisterCallerPID("analytics", os.Getpid())
+
+	ingress := routing.NewIngress(router, zap.NewNop())
+	listener, err := ingress.Listen(filepath.Join(dir, routing.IngressSocketName))
+	require.NoError(t, err)
+	go ingress.Serve(listener)
+	t.Cleanup(ingress.Stop)
+
+	// No token is needed; the kernel reports who is calling
+	_, err = callStorage(dialIngress(t, filepath.Join(dir, routing.IngressSocketName)), "")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, uint64(1), router.DeniedCalls()["analytics"])
+}
+
+func TestIngress_DeniesLifecycleCalls(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ingress")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	storageSocket := filepath.Join(dir, "storage.sock")
+	startEchoService(t, storageSocket)
+
+	router := routing.NewProtocolRouter(zap.NewNop())
+	require.NoError(t, router.RegisterService("plugin.storage", mesh.ServiceEndpoint{
+		Socket:  storageSocket,
+		IsLocal: true,
+	}))
+	router.SetCallerGrants("app", []routing.Grant{{Service: "plugin.storage"}})
+	token, err := router.IssueCallerToken("app")
+	require.NoError(t, err)
+
+	ingress := routing.NewIngress(router, zap.NewNop())
+	ingressSocket := filepath.Join(dir, routing.IngressSocketName)
+	listener, err := ingress.Listen(ingressSocket)
+	require.NoError(t, err)
+	go ingress.Serve(listener)
+	t.Cleanup(ingress.Stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		protocol.MetadataService, "plugin.storage",
+		protocol.MetadataToken, token)
+
+	// Even a caller granted the service can't reach its lifecycle methods
+	request := []byte{}
+	var response []byte
+	err = dialIngress(t, ingressSocket).Invoke(ctx, "/plugin.lifecycle.v1.PluginLifecycle/ExportState", &request, &response)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,82 @@
+package routing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+)
+
+func TestProtocolRouter_DrainHoldsNewRequests(t *testing.T) {
+	router := routing.NewProtocolRouter(zap.NewNop())
+	t.Cleanup(func() { router.Close() })
+	ctx := context.Background()
+
+	finish, err := router.TrackRequest(ctx, "plugin.storage")
+	require.NoError(t, err)
+	assert.Equal(t, 1, router.InFlight("plugin.storage"))
+
+	drained := make(chan error, 1)
+	go func() { drained <- router.Drain(ctx, "plugin.storage") }()
+
+	select {
+	case <-drained:
+		t.Fatal("drain finished with a request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	finish()
+	require.NoError(t, <-drained)
+
+	// Requests arriving once drained wait for the service to resume
+	held := make(chan struct{})
+	go func() {
+		finish, err := router.TrackRequest(ctx, "plugin.storage")
+		if assert.NoError(t, err) {
+			finish()
+		}
+		close(held)
+	}()
+
+	select {
+	case <-held:
+		t.Fatal("request was not held while drained")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Held requests give up with their context
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = router.TrackRequest(timeout, "plugin.storage")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	router.Resume("plugin.storage")
+	<-held
+	assert.Equal(t, 0, router.InFlight("plugin.storage"))
+
+	// Other services are unaffected by a drain
+	require.NoError(t, router.Drain(ctx, "plugin.storage"))
+	finish, err = router.TrackRequest(ctx, "plugin.node")
+	require.NoError(t, err)
+	finish()
+	router.Resume("plugin.storage")
+}
+
+func TestProtocolRouter_DrainTimesOut(t *testing.T) {
+	router := routing.NewProtocolRouter(zap.NewNop())
+	t.Cleanup(func() { router.Close() })
+
+	finish, err := router.TrackRequest(context.Background(), "plugin.storage")
+	require.NoError(t, err)
+	defer finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = router.Drain(ctx, "plugin.storage")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	router.Resume("plugin.storage")
+}
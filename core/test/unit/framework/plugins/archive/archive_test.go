@@ -0,0 +1,260 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
+)
+
+const manifest = `name: node
+version: 1.0.1
+description: P2P networking
+architecture: [linux-amd64, linux-arm64]
+binary:
+  name: node-plugin
+`
+
+// writePluginDir lays out a plugin directory the way the plugin Makefiles do
+func writePluginDir(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"plugin.yaml":                   manifest,
+		"bin/linux-amd64/node-plugin":   "#!/bin/sh\necho amd64\n",
+		"bin/linux-arm64/node-plugin":   "#!/bin/sh\necho arm64\n",
+		"proto/v1/node.proto":           "service NodeService {}\n",
+		"proto/v1/node.pb":              "descriptor",
+		"docs/README.md":                "# Node\n",
+		"LICENSE":                       "MIT\n",
+		"bin/linux-amd64/unrelated.txt": "ignored",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0755))
+	}
+	return dir
+}
+
+func TestPackUnpack(t *testing.T) {
+	dir := writePluginDir(t)
+	out := filepath.Join(t.TempDir(), "node-1.0.1.plugin")
+
+	pkg, err := archive.PackFile(dir, out, archive.PackOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux-amd64", "linux-arm64"}, pkg.Platforms)
+	assert.Equal(t, []string{"proto/v1/node.pb", "proto/v1/node.proto"}, pkg.Protos)
+	assert.True(t, archive.IsPackage(out))
+
+	// Packing is reproducible
+	var again bytes.Buffer
+	_, err = archive.Pack(dir, &again, archive.PackOptions{})
+	require.NoError(t, err)
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, data, again.Bytes())
+
+	verified, err := archive.Verify(out, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "node", verified.Manifest.Name)
+	assert.Equal(t, pkg.Checksums, verified.Checksums)
+	assert.NotContains(t, verified.Checksums, "bin/linux-amd64/unrelated.txt")
+
+	dest := filepath.Join(t.TempDir(), "node")
+	unpacked, err := archive.Unpack(out, dest, nil)
+	require.NoError(t, err)
+	binary, err := unpacked.BinaryPath("linux-arm64")
+	require.NoError(t, err)
+	content, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\necho arm64\n", string(content))
+	info, err := os.Stat(binary)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0111)
+
+	_, err = unpacked.Binary("darwin-arm64")
+	assert.True(t, errors.Is(err, archive.ErrPlatformUnsupported))
+
+	reopened, err := archive.OpenDir(dest)
+	require.NoError(t, err)
+	assert.Equal(t, unpacked.Platforms, reopened.Platforms)
+}
+
+func TestPack_Platforms(t *testing.T) {
+	dir := writePluginDir(t)
+
+	var buf bytes.Buffer
+	pkg, err := archive.Pack(dir, &buf, archive.PackOptions{Platforms: []string{"linux-amd64"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux-amd64"}, pkg.Platforms)
+
+	_, err = archive.Pack(dir, &buf, archive.PackOptions{Platforms: []string{"windows-amd64"}})
+	assert.True(t, errors.Is(err, archive.ErrPlatformUnsupported))
+
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "bin")))
+	_, err = archive.Pack(dir, &buf, archive.PackOptions{})
+	assert.True(t, errors.Is(err, archive.ErrNoBinaries))
+}
+
+// rewrite copies a package, letting edit replace or drop entries and append
+// extra ones
+func rewrite(t *testing.T, src string, edit func(name string, data []byte) ([]byte, bool), extra ...*tar.Header) string {
+	f, err := os.Open(src)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		data, keep := edit(header.Name, data)
+		if !keep {
+			continue
+		}
+		header.Size = int64(len(data))
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	for _, header := range extra {
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(make([]byte, header.Size))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	out := filepath.Join(t.TempDir(), "edited.plugin")
+	require.NoError(t, os.WriteFile(out, buf.Bytes(), 0644))
+	return out
+}
+
+func TestVerify_RejectsTampering(t *testing.T) {
+	dir := writePluginDir(t)
+	src := filepath.Join(t.TempDir(), "node.plugin")
+	_, err := archive.PackFile(dir, src, archive.PackOptions{})
+	require.NoError(t, err)
+
+	keep := func(name string, data []byte) ([]byte, bool) { return data, true }
+
+	tests := []struct {
+		name    string
+		edit    func(name string, data []byte) ([]byte, bool)
+		extra   []*tar.Header
+		wantErr error
+	}{
+		{
+			name: "modified binary",
+			edit: func(name string, data []byte) ([]byte, bool) {
+				if name == "bin/linux-amd64/node-plugin" {
+					return []byte("#!/bin/sh\nrm -rf /\n"), true
+				}
+				return data, true
+			},
+			wantErr: archive.ErrChecksumMismatch,
+		},
+		{
+			name: "missing file",
+			edit: func(name string, data []byte) ([]byte, bool) {
+				return data, name != "LICENSE"
+			},
+			wantErr: archive.ErrMissingFile,
+		},
+		{
+			name:    "unlisted file",
+			edit:    keep,
+			extra:   []*tar.Header{{Name: "bin/linux-amd64/extra", Typeflag: tar.TypeReg, Size: 4, Mode: 0755}},
+			wantErr: archive.ErrUnlistedFile,
+		},
+		{
+			name:    "path traversal",
+			edit:    keep,
+			extra:   []*tar.Header{{Name: "../escape", Typeflag: tar.TypeReg, Size: 4, Mode: 0644}},
+			wantErr: archive.ErrUnsafePath,
+		},
+		{
+			name:    "symlink",
+			edit:    keep,
+			extra:   []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+			wantErr: archive.ErrUnsafePath,
+		},
+		{
+			name: "no checksums",
+			edit: func(name string, data []byte) ([]byte, bool) {
+				return data, name != archive.ChecksumsFile
+			},
+			wantErr: archive.ErrMissingChecksums,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := rewrite(t, src, tt.edit, tt.extra...)
+			_, err := archive.Verify(path, nil)
+			assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+
+			// Nothing is extracted from a bad package
+			dest := filepath.Join(t.TempDir(), "out")
+			_, err = archive.Unpack(path, dest, nil)
+			assert.Error(t, err)
+			_, err = os.Stat(dest)
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+
+	_, err = archive.Verify(filepath.Join(dir, "plugin.yaml"), nil)
+	assert.True(t, errors.Is(err, archive.ErrNotPackage))
+}
+
+type testSigner struct{}
+
+func (testSigner) Sign(m archive.Manifest, checksums []byte) (*archive.Signature, error) {
+	return &archive.Signature{Algorithm: "test", KeyID: "k1", Publisher: "tests", Value: checksums[:8]}, nil
+}
+
+type recordingVerifier struct {
+	sig *archive.Signature
+	err error
+}
+
+func (v *recordingVerifier) VerifySignature(m archive.Manifest, checksums []byte, sig *archive.Signature) error {
+	v.sig = sig
+	return v.err
+}
+
+func TestSignatureBlock(t *testing.T) {
+	dir := writePluginDir(t)
+	out := filepath.Join(t.TempDir(), "node.plugin")
+	_, err := archive.PackFile(dir, out, archive.PackOptions{Signer: testSigner{}})
+	require.NoError(t, err)
+
+	verifier := &recordingVerifier{}
+	pkg, err := archive.Verify(out, verifier)
+	require.NoError(t, err)
+	require.NotNil(t, verifier.sig)
+	assert.Equal(t, "tests", verifier.sig.Publisher)
+	assert.Equal(t, pkg.ChecksumData()[:8], verifier.sig.Value)
+
+	verifier.err = errors.New("untrusted")
+	_, err = archive.Verify(out, verifier)
+	assert.EqualError(t, err, "untrusted")
+}
@@ -0,0 +1,204 @@
+package plugins_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+)
+
+// fakePlugin is an in-memory plugin used by manager tests
+type fakePlugin struct {
+	spec   plugins.PluginSpec
+	status plugins.PluginStatus
+	state  []byte
+}
+
+func (p *fakePlugin) Info() plugins.PluginInfo {
+	return plugins.PluginInfo{Name: p.spec.Name, Version: p.spec.Version, Status: p.status}
+}
+func (p *fakePlugin) Start(ctx context.Context) error {
+	p.status = plugins.PluginStatusRunning
+	return nil
+}
+func (p *fakePlugin) Stop(ctx context.Context) error {
+	p.status = plugins.PluginStatusStopped
+	return nil
+}
+func (p *fakePlugin) Handle(ctx context.Context, req plugins.PluginRequest) (plugins.PluginResponse, error) {
+	return plugins.PluginResponse{ID: req.ID, Success: true}, nil
+}
+func (p *fakePlugin) HealthCheck() error              { return nil }
+func (p *fakePlugin) GetStatus() plugins.PluginStatus { return p.status }
+func (p *fakePlugin) PrepareShutdown() error          { return nil }
+func (p *fakePlugin) ExportState() ([]byte, error)    { return p.state, nil }
+func (p *fakePlugin) ImportState(state []byte) error  { p.state = state; return nil }
+
+// fakeLoader creates fakePlugins and records the load order
+type fakeLoader struct {
+	loaded []string
+	specs  []plugins.PluginSpec
+	fail   map[string]error
+}
+
+func (l *fakeLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin, error) {
+	if err := l.fail[spec.Name]; err != nil {
+		return nil, err
+	}
+	l.loaded = append(l.loaded, spec.Name)
+	l.specs = append(l.specs, spec)
+	return &fakePlugin{spec: spec}, nil
+}
+func (l *fakeLoader) UnloadPlugin(p plugins.Plugin) error          { return nil }
+func (l *fakeLoader) ValidatePlugin(spec plugins.PluginSpec) error { return nil }
+
+func newTestManager(loader *fakeLoader) plugins.PluginManager {
+	return plugins.NewManager(registry.New(nil), loader, nil, nil, nil)
+}
+
+func spec(name, version string, deps ...plugins.PluginDependency) plugins.PluginSpec {
+	return plugins.PluginSpec{Name: name, Version: version, Dependencies: deps}
+}
+
+func dep(name, constraint string) plugins.PluginDependency {
+	return plugins.PluginDependency{Name: name, Version: constraint}
+}
+
+func TestResolveDependencies_LoadOrder(t *testing.T) {
+	ordered, err := plugins.ResolveDependencies([]plugins.PluginSpec{
+		spec("app", "1.0.0", dep("storage", "^2"), dep("node", ">=1.0 <2.0")),
+		spec("storage", "2.3.0", dep("node", "~1.4")),
+		spec("node", "1.4.2"),
+	}, nil, nil)
+	require.NoError(t, err)
+
+	names := make([]string, len(ordered))
+	for i, s := range ordered {
+		names[i] = s.Name
+	}
+	assert.Equal(t, []string{"node", "storage", "app"}, names)
+}
+
+func TestResolveDependencies_ConflictReport(t *testing.T) {
+	_, err := plugins.ResolveDependencies([]plugins.PluginSpec{
+		spec("a", "1.0.0", dep("b", "^2")),
+		spec("c", "1.0.0", dep("b", "^1")),
+		spec("b", "1.5.0"),
+	}, nil, nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, plugins.ErrDependencyNotSatisfied))
+
+	var depErr *plugins.DependencyError
+	require.True(t, errors.As(err, &depErr))
+	require.Len(t, depErr.Conflicts, 1)
+	assert.Contains(t, err.Error(), "b: a needs ^2, c needs ^1 (have 1.5.0, batch)")
+}
+
+func TestResolveDependencies_OptionalAndCycles(t *testing.T) {
+	optional := plugins.PluginDependency{Name: "metrics", Version: "^1", Optional: true}
+	_, err := plugins.ResolveDependencies([]plugins.PluginSpec{spec("a", "1.0.0", optional)}, nil, nil)
+	assert.NoError(t, err)
+
+	_, err = plugins.ResolveDependencies([]plugins.PluginSpec{
+		spec("a", "1.0.0", optional),
+		spec("metrics", "2.0.0"),
+	}, nil, nil)
+	assert.True(t, errors.Is(err, plugins.ErrDependencyNotSatisfied))
+
+	_, err = plugins.ResolveDependencies([]plugins.PluginSpec{
+		spec("a", "1.0.0", dep("b", "*")),
+		spec("b", "1.0.0", dep("a", "*")),
+	}, nil, nil)
+	assert.True(t, errors.Is(err, plugins.ErrDependencyCycle))
+}
+
+func TestManager_LoadPluginsAndUnload(t *testing.T) {
+	loader := &fakeLoader{}
+	manager := newTestManager(loader)
+
+	err := manager.LoadPlugin(spec("app", "1.0.0", dep("node", "^1")))
+	assert.True(t, errors.Is(err, plugins.ErrDependencyNotSatisfied))
+
+	require.NoError(t, manager.LoadPlugins([]plugins.PluginSpec{
+		spec("app", "1.0.0", dep("storage", "^2")),
+		spec("storage", "2.0.0", dep("node", "^1")),
+		spec("node", "1.1.0"),
+	}))
+	assert.Equal(t, []string{"node", "storage", "app"}, loader.loaded)
+
+	err = manager.UnloadPlugin("node")
+	var depErr *plugins.DependentsError
+	require.True(t, errors.As(err, &depErr))
+	assert.Equal(t, []string{"storage"}, depErr.Dependents)
+
+	require.NoError(t, manager.ReloadPlugin("node"))
+
+	require.NoError(t, manager.UnloadPluginCascade("node"))
+	assert.Empty(t, manager.ListPlugins())
+}
+
+func TestManager_LoadPluginsSkipsLoaded(t *testing.T) {
+	loader := &fakeLoader{}
+	manager := newTestManager(loader)
+	require.NoError(t, manager.LoadPlugin(spec("node", "1.0.0")))
+
+	require.NoError(t, manager.LoadPlugins([]plugins.PluginSpec{
+		spec("app", "1.0.0", dep("node", "^1")),
+		spec("node", "1.0.0"),
+	}))
+	assert.Equal(t, []string{"node", "app"}, loader.loaded)
+
+	// Another version of a loaded plugin is still refused
+	err := manager.LoadPlugins([]plugins.PluginSpec{spec("node", "1.1.0")})
+	assert.ErrorIs(t, err, plugins.ErrPluginAlreadyLoaded)
+	assert.Equal(t, []string{"node", "app"}, loader.loaded)
+}
+
+func TestManager_LoadPluginsRollsBack(t *testing.T) {
+	loader := &fakeLoader{fail: map[string]error{"app": errors.New("boom")}}
+	manager := newTestManager(loader)
+
+	err := manager.LoadPlugins([]plugins.PluginSpec{
+		spec("app", "1.0.0", dep("node", "^1")),
+		spec("node", "1.0.0"),
+	})
+	require.Error(t, err)
+	assert.Empty(t, manager.ListPlugins())
+}
+
+// recordingObserver records what the manager tells a background observer
+type recordingObserver struct {
+	forgotten []string
+	stopped   bool
+}
+
+func (o *recordingObserver) ObserveRequest(string, plugins.PluginRequest, error) {}
+func (o *recordingObserver) ForgetPlugin(name string)                            { o.forgotten = append(o.forgotten, name) }
+func (o *recordingObserver) Stop()                                               { o.stopped = true }
+
+func TestMeshManager_ShutdownStopsObserver(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	observer := &recordingObserver{}
+	manager.SetRequestObserver(observer)
+
+	require.NoError(t, manager.LoadPlugins([]plugins.PluginSpec{
+		spec("app", "1.0.0", dep("node", "^1")),
+		spec("node", "1.0.0"),
+		spec("cache", "1.0.0"),
+	}))
+
+	require.NoError(t, manager.UnloadPlugin("cache"))
+	assert.Equal(t, []string{"cache"}, observer.forgotten)
+	assert.False(t, observer.stopped)
+
+	manager.Shutdown()
+	assert.True(t, observer.stopped)
+	// Dependents are unloaded before the plugins they depend on
+	assert.Equal(t, []string{"cache", "app", "node"}, observer.forgotten)
+	assert.Empty(t, manager.ListPlugins())
+}
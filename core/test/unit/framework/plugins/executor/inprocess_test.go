@@ -0,0 +1,244 @@
+package executor_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/executor"
+)
+
+// unrulyPlugin is an in-process plugin that panics, hangs or allocates on
+// request, and otherwise counts
+type unrulyPlugin struct {
+	release chan struct{}
+
+	mu       sync.Mutex
+	count    int
+	imported []byte
+	status   plugins.PluginStatus
+}
+
+func newUnrulyPlugin() *unrulyPlugin {
+	return &unrulyPlugin{release: make(chan struct{}), status: plugins.PluginStatusStopped}
+}
+
+func (p *unrulyPlugin) Info() plugins.PluginInfo {
+	return plugins.PluginInfo{Name: "unruly", Version: "1.0.0", Status: p.GetStatus()}
+}
+
+func (p *unrulyPlugin) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = plugins.PluginStatusRunning
+	return nil
+}
+
+func (p *unrulyPlugin) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = plugins.PluginStatusStopped
+	return nil
+}
+
+func (p *unrulyPlugin) Handle(ctx context.Context, request plugins.PluginRequest) (plugins.PluginResponse, error) {
+	switch request.Method {
+	case "panic":
+		panic("boom")
+	case "hang":
+		<-p.release
+	case "allocate":
+		buf := make([]byte, 8<<20)
+		for i := range buf {
+			buf[i] = 1
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count++
+	return plugins.PluginResponse{Success: true, Result: map[string]interface{}{"count": p.count}}, nil
+}
+
+func (p *unrulyPlugin) HealthCheck() error     { return nil }
+func (p *unrulyPlugin) PrepareShutdown() error { return nil }
+
+func (p *unrulyPlugin) GetStatus() plugins.PluginStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *unrulyPlugin) ExportState() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return []byte(strconv.Itoa(p.count)), nil
+}
+
+func (p *unrulyPlugin) ImportState(state []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.imported = state
+	p.count, _ = strconv.Atoi(string(state))
+	return nil
+}
+
+func startSupervised(t *testing.T, instance plugins.Plugin, config executor.InProcessConfig) plugins.Plugin {
+	t.Helper()
+	spec := plugins.PluginSpec{Name: "unruly", Version: "1.0.0", Isolation: plugins.IsolationNone}
+	plugin := executor.NewInProcessPlugin(spec, instance, config)
+	require.NoError(t, plugin.Start(context.Background()))
+	return plugin
+}
+
+func handle(plugin plugins.Plugin, method string, timeout time.Duration) (plugins.PluginResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return plugin.Handle(ctx, plugins.PluginRequest{Method: method})
+}
+
+func TestInProcessPlugin_RecoversPanics(t *testing.T) {
+	plugin := startSupervised(t, newUnrulyPlugin(), executor.InProcessConfig{})
+
+	_, err := handle(plugin, "panic", time.Second)
+	var panicked *executor.PanicError
+	require.ErrorAs(t, err, &panicked)
+	assert.ErrorIs(t, err, executor.ErrPluginPanicked)
+	assert.Equal(t, "boom", panicked.Value)
+	assert.Equal(t, "panic", panicked.Method)
+	assert.NotEmpty(t, panicked.Stack)
+
+	resp, err := handle(plugin, "count", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resp.Result["count"])
+	assert.Equal(t, plugins.PluginStatusRunning, plugin.GetStatus())
+}
+
+func TestInProcessPlugin_AbandonsCallsPastTheirDeadline(t *testing.T) {
+	instance := newUnrulyPlugin()
+	plugin := startSupervised(t, instance, executor.InProcessConfig{})
+	defer close(instance.release)
+
+	start := time.Now()
+	_, err := handle(plugin, "hang", 50*time.Millisecond)
+	assert.ErrorIs(t, err, plugins.ErrTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, plugins.PluginStatusFailed, plugin.GetStatus())
+	assert.Equal(t, plugins.PluginStatusFailed, plugin.Info().Status)
+
+	_, err = handle(plugin, "count", time.Second)
+	assert.Error(t, err, "failed plugins take no requests")
+
+	// A restart clears the failure
+	require.NoError(t, plugin.Start(context.Background()))
+	_, err = handle(plugin, "count", time.Second)
+	assert.NoError(t, err)
+}
+
+func TestInProcessPlugin_LimitsConcurrentCalls(t *testing.T) {
+	instance := newUnrulyPlugin()
+	plugin := startSupervised(t, instance, executor.InProcessConfig{MaxConcurrent: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handle(plugin, "hang", 5*time.Second)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// The third call waits for a slot until its deadline, which doesn't
+	// fail the plugin since it never ran
+	_, err := handle(plugin, "count", 50*time.Millisecond)
+	assert.ErrorIs(t, err, plugins.ErrTimeout)
+	assert.Equal(t, plugins.PluginStatusRunning, plugin.GetStatus())
+
+	close(instance.release)
+	wg.Wait()
+	resp, err := handle(plugin, "count", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 3, resp.Result["count"])
+}
+
+func TestInProcessPlugin_EnforcesAllocationBudget(t *testing.T) {
+	t.Run("overruns count like panics", func(t *testing.T) {
+		fallback := newUnrulyPlugin()
+		plugin := startSupervised(t, newUnrulyPlugin(), executor.InProcessConfig{
+			AllocBudget:     1 << 20,
+			AllocSampleRate: 1,
+			MaxPanics:       2,
+			Fallback:        func() (plugins.Plugin, error) { return fallback, nil },
+		})
+
+		// A call over its budget still succeeds
+		resp, err := handle(plugin, "allocate", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 1, resp.Result["count"])
+		assert.Equal(t, plugins.PluginStatusStopped, fallback.GetStatus(), "one overrun is tolerated")
+
+		resp, err = handle(plugin, "allocate", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 2, resp.Result["count"])
+		assert.Equal(t, plugins.PluginStatusRunning, fallback.GetStatus())
+		assert.Equal(t, "2", string(fallback.imported))
+	})
+
+	t.Run("set by the plugin's resources", func(t *testing.T) {
+		spec := plugins.PluginSpec{Name: "unruly", Resources: plugins.PluginResources{Allocation: 1}}
+		plugin := executor.NewInProcessPlugin(spec, newUnrulyPlugin(), executor.InProcessConfig{
+			AllocSampleRate: 1,
+			MaxPanics:       1,
+		})
+		require.NoError(t, plugin.Start(context.Background()))
+		t.Cleanup(func() { plugin.Stop(context.Background()) })
+
+		_, err := handle(plugin, "count", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, plugins.PluginStatusRunning, plugin.GetStatus())
+
+		_, err = handle(plugin, "allocate", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, plugins.PluginStatusFailed, plugin.GetStatus(), "without a fallback the plugin fails")
+	})
+}
+
+func TestInProcessPlugin_IsolatesPluginsThatKeepPanicking(t *testing.T) {
+	t.Run("with a fallback", func(t *testing.T) {
+		fallback := newUnrulyPlugin()
+		plugin := startSupervised(t, newUnrulyPlugin(), executor.InProcessConfig{
+			MaxPanics: 2,
+			Fallback:  func() (plugins.Plugin, error) { return fallback, nil },
+		})
+		for i := 0; i < 3; i++ {
+			_, err := handle(plugin, "count", time.Second)
+			require.NoError(t, err)
+		}
+
+		_, err := handle(plugin, "panic", time.Second)
+		assert.ErrorIs(t, err, executor.ErrPluginPanicked)
+		assert.Equal(t, plugins.PluginStatusStopped, fallback.GetStatus(), "one panic is tolerated")
+		_, err = handle(plugin, "panic", time.Second)
+		assert.ErrorIs(t, err, executor.ErrPluginPanicked)
+
+		// Calls now go to the fallback, which has the plugin's state
+		assert.Equal(t, plugins.PluginStatusRunning, fallback.GetStatus())
+		assert.Equal(t, "3", string(fallback.imported))
+		resp, err := handle(plugin, "count", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 4, resp.Result["count"])
+	})
+
+	t.Run("without one", func(t *testing.T) {
+		plugin := startSupervised(t, newUnrulyPlugin(), executor.InProcessConfig{MaxPanics: 2})
+		handle(plugin, "panic", time.Second)
+		handle(plugin, "panic", time.Second)
+		assert.Equal(t, plugins.PluginStatusFailed, plugin.GetStatus())
+	})
+}
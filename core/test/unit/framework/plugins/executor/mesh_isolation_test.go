@@ -0,0 +1,131 @@
+package executor_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/executor"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+func (p *sleepyPlugin) ExportState(ctx context.Context) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state, nil
+}
+
+func (p *sleepyPlugin) ImportState(ctx context.Context, state []byte) error {
+	if bytes.Equal(state, []byte("invalid")) {
+		return errors.New("invalid state")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state = state
+	return nil
+}
+
+// startMeshSleepyPlugin runs the test binary as a mesh-isolated plugin
+func startMeshSleepyPlugin(t *testing.T) plugins.Plugin {
+	t.Helper()
+	t.Setenv(pluginModeEnv, "1")
+
+	binary, err := os.Executable()
+	require.NoError(t, err)
+	dir, err := os.MkdirTemp("", "mesh")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	spec := plugins.PluginSpec{
+		Name:    "sleepy",
+		Version: "1.0.0",
+		Permissions: []plugins.PluginPermission{
+			plugins.PermissionNetwork, plugins.PermissionFileSystem, plugins.PermissionSystem,
+		},
+	}
+	plugin := executor.NewMeshPlugin(spec, binary, executor.MeshIsolationConfig{
+		SocketDir:      dir,
+		DataDir:        dir,
+		DefaultTimeout: 5 * time.Second,
+	})
+	require.NoError(t, plugin.Start(context.Background()))
+	t.Cleanup(func() { plugin.Stop(context.Background()) })
+	return plugin
+}
+
+func TestMeshPlugin_Handle(t *testing.T) {
+	plugin := startMeshSleepyPlugin(t)
+
+	resp, err := sleep(plugin, "req-1", 0)
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+	assert.Equal(t, "req-1", resp.ID)
+	assert.Equal(t, "req-1", resp.Result["id"])
+
+	resp, err = plugin.Handle(context.Background(), plugins.PluginRequest{ID: "req-2", Method: "cancelled"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), resp.Result["count"])
+
+	require.NoError(t, plugin.HealthCheck())
+	require.NoError(t, plugin.PrepareShutdown())
+}
+
+func TestMeshPlugin_NegotiatesProtocol(t *testing.T) {
+	plugin := startMeshSleepyPlugin(t)
+
+	peer := plugin.(interface{ Protocol() protocol.Handshake }).Protocol()
+	assert.Equal(t, protocol.Version, peer.ProtocolVersion)
+	assert.Equal(t, protocol.TransportGRPC, peer.Transport)
+	assert.Equal(t, "sleepy", peer.Name)
+	assert.True(t, peer.Supports(protocol.FeatureState))
+	assert.True(t, peer.Supports(protocol.FeatureCancellation))
+	assert.False(t, peer.Supports(protocol.FeatureStreaming), "not offered over gRPC")
+}
+
+func TestMeshPlugin_HandlePropagatesDeadline(t *testing.T) {
+	plugin := startMeshSleepyPlugin(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := plugin.Handle(ctx, plugins.PluginRequest{
+		ID:     "slow",
+		Method: "sleep",
+		Params: map[string]interface{}{"delay": "5s"},
+	})
+	var timeout *plugins.TimeoutError
+	require.ErrorAs(t, err, &timeout)
+	assert.Equal(t, "sleepy", timeout.Plugin)
+
+	// The plugin saw the deadline and gave up on the request
+	require.Eventually(t, func() bool {
+		resp, err := plugin.Handle(context.Background(), plugins.PluginRequest{Method: "cancelled"})
+		return err == nil && resp.Result["count"] == float64(1)
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestMeshPlugin_StateRoundTrip(t *testing.T) {
+	plugin := startMeshSleepyPlugin(t)
+
+	state, err := plugin.ExportState()
+	require.NoError(t, err)
+	assert.Empty(t, state)
+
+	// Large enough to be streamed in several chunks
+	state = bytes.Repeat([]byte("0123456789abcdef"), 10<<10)
+	require.NoError(t, plugin.ImportState(state))
+
+	exported, err := plugin.ExportState()
+	require.NoError(t, err)
+	assert.Equal(t, state, exported)
+
+	err = plugin.ImportState([]byte("invalid"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid state")
+}
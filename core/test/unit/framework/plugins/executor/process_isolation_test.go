@@ -0,0 +1,219 @@
+package executor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/executor"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/base"
+)
+
+// pluginModeEnv makes the test binary serve sleepyPlugin instead of running tests
+const pluginModeEnv = "EXECUTOR_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(pluginModeEnv) != "" {
+		if err := base.Serve(&sleepyPlugin{}, base.WithLogger(zap.NewNop())); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// sleepyPlugin answers "sleep" requests after the requested delay, and
+// "cancelled" with the number of sleeps that were cancelled
+type sleepyPlugin struct {
+	cancelled int64
+
+	mu    sync.Mutex
+	state []byte
+}
+
+func (p *sleepyPlugin) Info() base.PluginInfo {
+	return base.PluginInfo{Name: "sleepy", Version: "1.0.0"}
+}
+func (p *sleepyPlugin) Initialize(ctx context.Context, config map[string]interface{}) error {
+	return nil
+}
+func (p *sleepyPlugin) Start(ctx context.Context) error       { return nil }
+func (p *sleepyPlugin) Stop(ctx context.Context) error        { return nil }
+func (p *sleepyPlugin) HealthCheck(ctx context.Context) error { return nil }
+
+func (p *sleepyPlugin) Handle(ctx context.Context, req base.Request) (base.Response, error) {
+	if req.Method == "cancelled" {
+		return base.Response{Success: true, Result: map[string]interface{}{
+			"count": atomic.LoadInt64(&p.cancelled),
+		}}, nil
+	}
+
+	delay, _ := time.ParseDuration(fmt.Sprint(req.Params["delay"]))
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		atomic.AddInt64(&p.cancelled, 1)
+		return base.Response{}, ctx.Err()
+	}
+	return base.Response{Success: true, Result: map[string]interface{}{"id": req.ID}}, nil
+}
+
+// startSleepyPlugin runs the test binary as a process-isolated plugin
+func startSleepyPlugin(t *testing.T, resources plugins.PluginResources) plugins.Plugin {
+	t.Helper()
+	t.Setenv(pluginModeEnv, "1")
+
+	binary, err := os.Executable()
+	require.NoError(t, err)
+
+	spec := plugins.PluginSpec{
+		Name:      "sleepy",
+		Version:   "1.0.0",
+		Resources: resources,
+		Permissions: []plugins.PluginPermission{
+			plugins.PermissionNetwork, plugins.PermissionFileSystem, plugins.PermissionSystem,
+		},
+	}
+	plugin := executor.NewProcessPlugin(spec, binary)
+	require.NoError(t, plugin.Start(context.Background()))
+	t.Cleanup(func() { plugin.Stop(context.Background()) })
+	return plugin
+}
+
+func sleep(plugin plugins.Plugin, id string, delay time.Duration) (plugins.PluginResponse, error) {
+	return plugin.Handle(context.Background(), plugins.PluginRequest{
+		ID:     id,
+		Method: "sleep",
+		Params: map[string]interface{}{"delay": delay.String()},
+	})
+}
+
+func TestProcessPlugin_ConcurrentRequests(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+
+	const calls = 8
+	const delay = 300 * time.Millisecond
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	responses := make([]plugins.PluginResponse, calls)
+	errs := make([]error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = sleep(plugin, fmt.Sprintf("req-%d", i), delay)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < calls; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, fmt.Sprintf("req-%d", i), responses[i].ID, "responses must reach their callers")
+	}
+	assert.Less(t, time.Since(start), calls*delay/2, "requests should not be serialized")
+}
+
+func TestProcessPlugin_SlowRequestDoesNotBlockOthers(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := sleep(plugin, "slow", 2*time.Second)
+		slow <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := sleep(plugin, "fast", 0)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	require.NoError(t, plugin.HealthCheck())
+
+	require.NoError(t, <-slow)
+}
+
+func TestProcessPlugin_InFlightLimit(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{Requests: 1})
+
+	const delay = 200 * time.Millisecond
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := sleep(plugin, fmt.Sprintf("req-%d", i), delay)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.GreaterOrEqual(t, time.Since(start), 3*delay, "one request at a time")
+}
+
+// cancelledCount asks the plugin how many of its requests were cancelled
+func cancelledCount(t *testing.T, plugin plugins.Plugin) float64 {
+	resp, err := plugin.Handle(context.Background(), plugins.PluginRequest{Method: "cancelled"})
+	require.NoError(t, err)
+	return resp.Result["count"].(float64)
+}
+
+func TestProcessPlugin_DeadlineCancelsRequestInPlugin(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := plugin.Handle(ctx, plugins.PluginRequest{
+		ID:     "slow",
+		Method: "sleep",
+		Params: map[string]interface{}{"delay": "10s"},
+	})
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	require.ErrorIs(t, err, plugins.ErrTimeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	var timeout *plugins.TimeoutError
+	require.True(t, errors.As(err, &timeout))
+	assert.Equal(t, "sleepy", timeout.Plugin)
+	assert.Equal(t, "sleep", timeout.Method)
+
+	// The handler inside the plugin process saw its context end
+	assert.Eventually(t, func() bool { return cancelledCount(t, plugin) == 1 },
+		2*time.Second, 20*time.Millisecond)
+}
+
+func TestProcessPlugin_CancelPropagatesToPlugin(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		_, err := plugin.Handle(ctx, plugins.PluginRequest{
+			ID:     "cancelled",
+			Method: "sleep",
+			Params: map[string]interface{}{"delay": "10s"},
+		})
+		result <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	err := <-result
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, plugins.ErrTimeout)
+	assert.Eventually(t, func() bool { return cancelledCount(t, plugin) == 1 },
+		2*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,193 @@
+package executor_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/base"
+)
+
+// HandleStream serves "upload", which hashes the request body, "download",
+// which writes the requested number of bytes, and "echo", which copies the
+// request body back
+func (p *sleepyPlugin) HandleStream(ctx context.Context, req base.Request, in io.Reader, out io.Writer) (base.Response, error) {
+	switch req.Method {
+	case "upload":
+		hash := sha256.New()
+		n, err := io.Copy(hash, in)
+		if err != nil {
+			return base.Response{}, err
+		}
+		return base.Response{Success: true, Result: map[string]interface{}{
+			"bytes":  n,
+			"sha256": hex.EncodeToString(hash.Sum(nil)),
+		}}, nil
+	case "download":
+		size, _ := req.Params["size"].(float64)
+		if _, err := io.CopyN(out, &patternReader{}, int64(size)); err != nil {
+			return base.Response{}, err
+		}
+		if req.Params["fail"] == true {
+			return base.Response{}, fmt.Errorf("download failed")
+		}
+		return base.Response{Success: true}, nil
+	case "echo":
+		n, err := io.Copy(out, in)
+		if err != nil {
+			return base.Response{}, err
+		}
+		return base.Response{Success: true, Result: map[string]interface{}{"bytes": n}}, nil
+	case "hang":
+		<-ctx.Done()
+		return base.Response{}, ctx.Err()
+	}
+	return base.Response{}, fmt.Errorf("unknown stream method: %s", req.Method)
+}
+
+// patternReader yields an endless, repeating byte pattern
+type patternReader struct {
+	offset int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte((r.offset + i) % 251)
+	}
+	r.offset += len(p)
+	return len(p), nil
+}
+
+func patterned(size int) []byte {
+	data := make([]byte, size)
+	(&patternReader{}).Read(data)
+	return data
+}
+
+func openStream(t *testing.T, plugin plugins.Plugin, ctx context.Context, method string, params map[string]interface{}, mode plugins.StreamMode) plugins.PluginStream {
+	t.Helper()
+	streaming, ok := plugin.(plugins.StreamingPlugin)
+	require.True(t, ok, "process plugins stream")
+	stream, err := streaming.OpenStream(ctx, plugins.PluginRequest{ID: method, Method: method, Params: params}, mode)
+	require.NoError(t, err)
+	return stream
+}
+
+const streamSize = 4<<20 + 123
+
+func TestProcessPlugin_ClientStream(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+	stream := openStream(t, plugin, context.Background(), "upload", nil, plugins.StreamClient)
+
+	body := patterned(streamSize)
+	n, err := io.Copy(stream, bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.EqualValues(t, streamSize, n)
+	require.NoError(t, stream.CloseSend())
+
+	resp, err := stream.Response()
+	require.NoError(t, err)
+	sum := sha256.Sum256(body)
+	assert.EqualValues(t, streamSize, resp.Result["bytes"])
+	assert.Equal(t, hex.EncodeToString(sum[:]), resp.Result["sha256"])
+
+	// The response body isn't streamed
+	_, err = stream.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestProcessPlugin_ServerStream(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+	stream := openStream(t, plugin, context.Background(), "download",
+		map[string]interface{}{"size": streamSize}, plugins.StreamServer)
+
+	received, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(patterned(streamSize), received))
+
+	resp, err := stream.Response()
+	require.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	// The request body isn't streamed
+	_, err = stream.Write([]byte("x"))
+	assert.Error(t, err)
+}
+
+func TestProcessPlugin_ServerStreamError(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+	stream := openStream(t, plugin, context.Background(), "download",
+		map[string]interface{}{"size": 1000, "fail": true}, plugins.StreamServer)
+
+	received, err := io.ReadAll(stream)
+	assert.Len(t, received, 1000)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "download failed")
+
+	_, err = stream.Response()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "download failed")
+}
+
+func TestProcessPlugin_BidiStream(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+	stream := openStream(t, plugin, context.Background(), "echo", nil, plugins.StreamBidi)
+
+	// Writing the whole body before reading would stall on flow control
+	body := patterned(streamSize)
+	written := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stream, bytes.NewReader(body))
+		if err == nil {
+			err = stream.CloseSend()
+		}
+		written <- err
+	}()
+
+	received, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	require.NoError(t, <-written)
+	assert.True(t, bytes.Equal(body, received))
+
+	resp, err := stream.Response()
+	require.NoError(t, err)
+	assert.EqualValues(t, streamSize, resp.Result["bytes"])
+
+	// Plain requests still work alongside streams
+	_, err = sleep(plugin, "after", 0)
+	require.NoError(t, err)
+}
+
+func TestProcessPlugin_StreamCancel(t *testing.T) {
+	plugin := startSleepyPlugin(t, plugins.PluginResources{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := openStream(t, plugin, ctx, "hang", nil, plugins.StreamBidi)
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(stream)
+		read <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-read:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelling the stream did not unblock its reader")
+	}
+	_, err := stream.Response()
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, plugin.HealthCheck())
+}
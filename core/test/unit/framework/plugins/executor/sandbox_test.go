@@ -0,0 +1,137 @@
+package executor_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/executor"
+)
+
+func TestPolicyForSpec(t *testing.T) {
+	spec := plugins.PluginSpec{Name: "node"}
+	policy := executor.PolicyForSpec(spec, "/var/lib/node", "/run/plugins/")
+	assert.True(t, policy.IsolateNetwork)
+	assert.True(t, policy.ReadOnlyFilesystem)
+	assert.True(t, policy.NoNewPrivileges)
+	assert.Equal(t, []string{"/var/lib/node", "/run/plugins"}, policy.WritablePaths)
+
+	spec.Permissions = []plugins.PluginPermission{
+		plugins.PermissionNetwork, plugins.PermissionFileSystem, plugins.PermissionSystem,
+	}
+	policy = executor.PolicyForSpec(spec, "/var/lib/node")
+	assert.False(t, policy.Restricted())
+	assert.Empty(t, policy.WritablePaths)
+	assert.Equal(t, "unrestricted", policy.String())
+}
+
+func TestProcessPlugin_RefusesUnsandboxed(t *testing.T) {
+	if runtime.GOOS == "linux" {
+		t.Skip("plugins are sandboxed on Linux")
+	}
+	spec := plugins.PluginSpec{Name: "offline", Version: "1.0.0"}
+
+	err := executor.NewProcessPlugin(spec, "/bin/true").Start(context.Background())
+	assert.ErrorIs(t, err, executor.ErrSandboxUnsupported)
+
+	// Operators can let such plugins run anyway
+	plugin := executor.NewProcessPluginWithConfig(spec, "/bin/true", executor.ProcessConfig{AllowUnsandboxed: true})
+	err = plugin.Start(context.Background())
+	assert.NotErrorIs(t, err, executor.ErrSandboxUnsupported)
+	plugin.Stop(context.Background())
+}
+
+func TestSandbox_KeepsCallerPolicy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox requires Linux namespaces")
+	}
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	dir, err := filepath.Rel(cwd, t.TempDir())
+	require.NoError(t, err)
+
+	policy := executor.PolicyForSpec(plugins.PluginSpec{Name: "relative"}, dir)
+	require.NoError(t, executor.Sandbox(exec.Command("/bin/true"), policy))
+	assert.Equal(t, []string{dir}, policy.WritablePaths)
+}
+
+func TestProcessPlugin_UsesConfiguredDataDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox requires Linux namespaces")
+	}
+	dataDir := t.TempDir()
+	spec := plugins.PluginSpec{Name: "offline", Version: "1.0.0"}
+
+	plugin := executor.NewProcessPluginWithConfig(spec, "/bin/true", executor.ProcessConfig{DataDir: dataDir})
+	plugin.Start(context.Background())
+	defer plugin.Stop(context.Background())
+
+	// The sandbox creates the plugin's data directory under the configured one
+	assert.DirExists(t, filepath.Join(dataDir, "offline"))
+}
+
+// runSandboxed runs a shell script under the sandbox for spec
+func runSandboxed(t *testing.T, spec plugins.PluginSpec, writable []string, script string, args ...string) (string, error) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox requires Linux namespaces")
+	}
+
+	probe := exec.Command("/bin/true")
+	require.NoError(t, executor.Sandbox(probe, executor.PolicyForSpec(plugins.PluginSpec{Name: "probe"})))
+	if err := probe.Run(); err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+
+	cmd := exec.Command("/bin/sh", append([]string{"-c", script, "sh"}, args...)...)
+	require.NoError(t, executor.Sandbox(cmd, executor.PolicyForSpec(spec, writable...)))
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestSandbox_NoNetwork(t *testing.T) {
+	spec := plugins.PluginSpec{Name: "offline", Permissions: []plugins.PluginPermission{plugins.PermissionFileSystem}}
+	out, err := runSandboxed(t, spec, nil, "cat /proc/self/net/dev")
+	require.NoError(t, err, out)
+
+	var interfaces []string
+	for _, line := range strings.Split(out, "\n") {
+		if name, _, ok := strings.Cut(line, ":"); ok && !strings.Contains(name, "|") {
+			interfaces = append(interfaces, strings.TrimSpace(name))
+		}
+	}
+	assert.Equal(t, []string{"lo"}, interfaces)
+}
+
+func TestSandbox_ReadOnlyFilesystem(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	otherDir := t.TempDir()
+
+	spec := plugins.PluginSpec{Name: "readonly", Permissions: []plugins.PluginPermission{plugins.PermissionNetwork}}
+	out, err := runSandboxed(t, spec, []string{dataDir},
+		`echo ok > "$1/state" && echo no > "$2/escaped"`, dataDir, otherDir)
+	require.Error(t, err)
+	assert.Contains(t, out, "Read-only file system")
+
+	data, readErr := os.ReadFile(filepath.Join(dataDir, "state"))
+	require.NoError(t, readErr, "data directory must stay writable")
+	assert.Equal(t, "ok\n", string(data))
+	assert.NoFileExists(t, filepath.Join(otherDir, "escaped"))
+}
+
+func TestSandbox_NoNewPrivileges(t *testing.T) {
+	spec := plugins.PluginSpec{Name: "unprivileged", Permissions: []plugins.PluginPermission{
+		plugins.PermissionNetwork, plugins.PermissionFileSystem,
+	}}
+	out, err := runSandboxed(t, spec, nil, "grep NoNewPrivs /proc/self/status")
+	require.NoError(t, err, out)
+	assert.Contains(t, out, "NoNewPrivs:\t1")
+}
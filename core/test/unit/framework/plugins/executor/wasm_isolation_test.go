@@ -0,0 +1,181 @@
+package executor_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/executor"
+)
+
+var (
+	counterModuleOnce sync.Once
+	counterModule     string
+	counterModuleErr  error
+)
+
+// buildCounterModule compiles the wasm-counter example once per test run
+func buildCounterModule(t *testing.T) string {
+	t.Helper()
+	counterModuleOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "wasm-counter")
+		if err != nil {
+			counterModuleErr = err
+			return
+		}
+		counterModule = filepath.Join(dir, "counter.wasm")
+		cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", counterModule,
+			"github.com/blackhole-pro/blackhole/core/examples/plugins/wasm-counter")
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			counterModuleErr = fmt.Errorf("%v: %s", err, output)
+		}
+	})
+	if counterModuleErr != nil {
+		t.Skipf("cannot build the WebAssembly example: %v", counterModuleErr)
+	}
+	return counterModule
+}
+
+// startCounterModule starts the wasm-counter example as a WebAssembly plugin
+func startCounterModule(t *testing.T, resources plugins.PluginResources, config executor.WASMIsolationConfig) (plugins.Plugin, string) {
+	t.Helper()
+	module := buildCounterModule(t)
+	if config.DataDir == "" {
+		config.DataDir = t.TempDir()
+	}
+	// Compiling the module takes seconds, so tests share compiled code
+	config.CacheDir = filepath.Join(filepath.Dir(module), "cache")
+
+	spec := plugins.PluginSpec{
+		Name:      "counter",
+		Version:   "1.0.0",
+		Isolation: plugins.IsolationWASM,
+		Resources: resources,
+	}
+	plugin := executor.NewWASMPlugin(spec, module, config)
+	require.NoError(t, plugin.Start(context.Background()))
+	t.Cleanup(func() { plugin.Stop(context.Background()) })
+	return plugin, filepath.Join(config.DataDir, spec.Name)
+}
+
+func callWASM(t *testing.T, plugin plugins.Plugin, method string, params map[string]interface{}) plugins.PluginResponse {
+	t.Helper()
+	resp, err := plugin.Handle(context.Background(), plugins.PluginRequest{ID: method, Method: method, Params: params})
+	require.NoError(t, err)
+	return resp
+}
+
+func TestWASMPlugin_HandlesRequestsAndState(t *testing.T) {
+	plugin, _ := startCounterModule(t, plugins.PluginResources{}, executor.WASMIsolationConfig{})
+	assert.Equal(t, plugins.PluginStatusRunning, plugin.GetStatus())
+
+	callWASM(t, plugin, "increment", map[string]interface{}{"name": "a"})
+	resp := callWASM(t, plugin, "increment", map[string]interface{}{"name": "a"})
+	assert.True(t, resp.Success)
+	assert.Equal(t, "increment", resp.ID)
+	assert.EqualValues(t, 2, resp.Result["value"])
+
+	resp = callWASM(t, plugin, "unknown", nil)
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "unknown method")
+
+	state, err := plugin.ExportState()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":2}`, string(state))
+
+	require.NoError(t, plugin.ImportState([]byte(`{"a":41}`)))
+	resp = callWASM(t, plugin, "increment", map[string]interface{}{"name": "a"})
+	assert.EqualValues(t, 42, resp.Result["value"])
+
+	assert.Error(t, plugin.ImportState([]byte("not json")))
+	assert.NoError(t, plugin.HealthCheck())
+}
+
+func TestWASMPlugin_OnlyReachesItsDataDir(t *testing.T) {
+	plugin, dataDir := startCounterModule(t, plugins.PluginResources{}, executor.WASMIsolationConfig{})
+
+	resp := callWASM(t, plugin, "note", map[string]interface{}{"name": "hello", "text": "hi"})
+	require.True(t, resp.Success, resp.Error)
+	data, err := os.ReadFile(filepath.Join(dataDir, "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(data))
+
+	// Paths outside the data directory don't exist for the plugin
+	resp = callWASM(t, plugin, "note", map[string]interface{}{"name": "../../../tmp/escape", "text": "hi"})
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "failed to write note")
+}
+
+func TestWASMPlugin_StopsRunawayCalls(t *testing.T) {
+	t.Run("fuel", func(t *testing.T) {
+		plugin, _ := startCounterModule(t, plugins.PluginResources{}, executor.WASMIsolationConfig{Fuel: 10_000_000})
+
+		_, err := plugin.Handle(context.Background(), plugins.PluginRequest{Method: "spin"})
+		assert.ErrorIs(t, err, executor.ErrFuelExhausted)
+		assert.ErrorIs(t, err, executor.ErrResourceLimitExceeded)
+		assert.Equal(t, plugins.PluginStatusFailed, plugin.GetStatus())
+
+		// A restart gives the plugin a fresh module
+		require.NoError(t, plugin.Stop(context.Background()))
+		require.NoError(t, plugin.Start(context.Background()))
+		resp := callWASM(t, plugin, "increment", nil)
+		assert.EqualValues(t, 1, resp.Result["value"])
+	})
+
+	t.Run("call-free loop", func(t *testing.T) {
+		// Instructions are metered, not just function calls, so a loop that
+		// calls nothing runs out of fuel long before its deadline
+		plugin, _ := startCounterModule(t, plugins.PluginResources{}, executor.WASMIsolationConfig{Fuel: 10_000_000})
+
+		start := time.Now()
+		_, err := plugin.Handle(context.Background(), plugins.PluginRequest{Method: "loop"})
+		assert.ErrorIs(t, err, executor.ErrFuelExhausted)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.Equal(t, plugins.PluginStatusFailed, plugin.GetStatus())
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		plugin, _ := startCounterModule(t, plugins.PluginResources{}, executor.WASMIsolationConfig{Fuel: 1 << 62})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := plugin.Handle(ctx, plugins.PluginRequest{Method: "loop"})
+		assert.ErrorIs(t, err, plugins.ErrTimeout)
+		assert.NotErrorIs(t, err, executor.ErrFuelExhausted)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.Equal(t, plugins.PluginStatusFailed, plugin.GetStatus())
+	})
+
+	t.Run("fuel is per call", func(t *testing.T) {
+		plugin, _ := startCounterModule(t, plugins.PluginResources{}, executor.WASMIsolationConfig{Fuel: 10_000_000})
+		for i := 1; i <= 20; i++ {
+			resp := callWASM(t, plugin, "increment", nil)
+			assert.EqualValues(t, i, resp.Result["value"])
+		}
+	})
+}
+
+func TestWASMPlugin_EnforcesMemoryLimit(t *testing.T) {
+	plugin, _ := startCounterModule(t, plugins.PluginResources{Memory: 32}, executor.WASMIsolationConfig{})
+
+	resp := callWASM(t, plugin, "allocate", map[string]interface{}{"mb": 4})
+	assert.True(t, resp.Success, resp.Error)
+
+	_, err := plugin.Handle(context.Background(), plugins.PluginRequest{
+		Method: "allocate",
+		Params: map[string]interface{}{"mb": 64},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, plugins.PluginStatusFailed, plugin.GetStatus())
+}
@@ -0,0 +1,31 @@
+package factory_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/factory"
+)
+
+func TestNewPluginManager_FailsWithoutRegistry(t *testing.T) {
+	dir := t.TempDir()
+	config := factory.DefaultConfig()
+	config.StatePath = filepath.Join(dir, "state")
+	config.CachePath = filepath.Join(dir, "cache")
+	config.TrustPath = filepath.Join(dir, "trust")
+
+	// A file where the registry directory should be can't be opened
+	config.RegistryPath = filepath.Join(dir, "registry")
+	require.NoError(t, os.WriteFile(config.RegistryPath, nil, 0600))
+	_, err := factory.NewPluginManager(config)
+	assert.ErrorContains(t, err, "failed to open plugin registry")
+
+	config.RegistryPath = filepath.Join(dir, "registry-dir")
+	manager, err := factory.NewPluginManager(config)
+	require.NoError(t, err)
+	assert.NotNil(t, manager)
+}
@@ -0,0 +1,383 @@
+package plugins_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing/pool"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+)
+
+// counterPlugin counts "incr" requests and serves its version over gRPC on
+// its mesh socket while running
+type counterPlugin struct {
+	spec      plugins.PluginSpec
+	socket    string
+	unhealthy bool
+	failing   bool
+	delay     time.Duration // added to every request
+	importing time.Duration // added to every state import
+	stateless bool          // fails to export its state
+	stopping  chan struct{} // if set, Stop waits for it to be closed
+
+	mu       sync.Mutex
+	status   plugins.PluginStatus
+	count    int
+	handled  int
+	server   *grpc.Server
+	listener net.Listener
+}
+
+func (p *counterPlugin) Info() plugins.PluginInfo {
+	return plugins.PluginInfo{Name: p.spec.Name, Version: p.spec.Version, Status: p.GetStatus()}
+}
+
+func (p *counterPlugin) Start(ctx context.Context) error {
+	os.Remove(p.socket)
+	listener, err := net.Listen("unix", p.socket)
+	if err != nil {
+		return err
+	}
+	version := []byte(p.spec.Version)
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(pool.RawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			var request []byte
+			if err := stream.RecvMsg(&request); err != nil {
+				return err
+			}
+			return stream.SendMsg(&version)
+		}),
+	)
+	go server.Serve(listener)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.server = server
+	p.listener = listener
+	p.status = plugins.PluginStatusRunning
+	return nil
+}
+
+func (p *counterPlugin) Stop(ctx context.Context) error {
+	if p.stopping != nil {
+		<-p.stopping
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.server != nil {
+		// Close the listener here, so its socket is gone before the next
+		// version listens even if Serve hasn't started yet
+		p.listener.Close()
+		p.server.Stop()
+		p.server = nil
+	}
+	p.status = plugins.PluginStatusStopped
+	return nil
+}
+
+func (p *counterPlugin) Handle(ctx context.Context, req plugins.PluginRequest) (plugins.PluginResponse, error) {
+	if delay, err := time.ParseDuration(req.Method); err == nil {
+		time.Sleep(delay)
+	}
+	time.Sleep(p.delay)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status != plugins.PluginStatusRunning {
+		return plugins.PluginResponse{}, errors.New("plugin not running")
+	}
+	if p.failing {
+		return plugins.PluginResponse{}, errors.New("internal error")
+	}
+	p.count++
+	p.handled++
+	return plugins.PluginResponse{ID: req.ID, Success: true, Result: map[string]interface{}{
+		"version": p.spec.Version,
+		"count":   p.count,
+	}}, nil
+}
+
+func (p *counterPlugin) HealthCheck() error {
+	if p.unhealthy {
+		return errors.New("unhealthy")
+	}
+	return nil
+}
+
+func (p *counterPlugin) GetStatus() plugins.PluginStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *counterPlugin) PrepareShutdown() error { return nil }
+
+func (p *counterPlugin) ExportState() ([]byte, error) {
+	if p.stateless {
+		return nil, errors.New("state lost")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return []byte(strconv.Itoa(p.count)), nil
+}
+
+func (p *counterPlugin) ImportState(state []byte) error {
+	time.Sleep(p.importing)
+	count, err := strconv.Atoi(string(state))
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count = count
+	return nil
+}
+
+// counterLoader creates counterPlugins; unhealthy versions fail their health
+// check, failing versions fail every request, slow versions take longer and
+// importing versions take longer to import state
+type counterLoader struct {
+	fakeLoader
+	socketDir string
+	unhealthy map[string]bool
+	failing   map[string]bool
+	slow      map[string]time.Duration
+	importing map[string]time.Duration
+
+	mu      sync.Mutex
+	plugins []*counterPlugin
+}
+
+func (l *counterLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin, error) {
+	plugin := &counterPlugin{
+		spec:      spec,
+		socket:    filepath.Join(l.socketDir, spec.Name+".sock"),
+		unhealthy: l.unhealthy[spec.Version],
+		failing:   l.failing[spec.Version],
+		delay:     l.slow[spec.Version],
+		importing: l.importing[spec.Version],
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.plugins = append(l.plugins, plugin)
+	return plugin, nil
+}
+
+// newSwapManager creates a mesh manager with a router and a hot-swap
+// coordinator
+func newSwapManager(t *testing.T, unhealthy ...string) (*plugins.MeshPluginManager, *routing.ProtocolRouter, *counterLoader) {
+	t.Helper()
+	socketDir, err := os.MkdirTemp("", "hotswap")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(socketDir) })
+
+	loader := &counterLoader{
+		socketDir: socketDir,
+		unhealthy: make(map[string]bool),
+		failing:   make(map[string]bool),
+		slow:      make(map[string]time.Duration),
+		importing: make(map[string]time.Duration),
+	}
+	for _, version := range unhealthy {
+		loader.unhealthy[version] = true
+	}
+
+	router := routing.NewProtocolRouter(zap.NewNop())
+	t.Cleanup(func() { router.Close() })
+	manager := plugins.NewMeshPluginManager(plugins.MeshPluginManagerConfig{
+		Registry:       registry.New(nil),
+		Loader:         loader,
+		ProtocolRouter: router,
+		SocketDir:      socketDir,
+	})
+
+	storage := state.NewMemoryStateStorage()
+	manager.SetHotSwapper(state.NewHotSwapCoordinator(
+		manager.SwapManager(),
+		state.NewStateManager(storage, &state.JSONSerializer{}),
+		state.NewMemoryRollbackManager(storage),
+	))
+	return manager, router, loader
+}
+
+func incr(t *testing.T, manager plugins.PluginManager, method string) plugins.PluginResponse {
+	t.Helper()
+	resp, err := manager.ExecutePlugin("counter", plugins.PluginRequest{Method: method})
+	require.NoError(t, err)
+	return resp
+}
+
+// routedVersion asks the plugin's mesh endpoint for its version
+func routedVersion(t *testing.T, router *routing.ProtocolRouter) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	version, err := router.RouteRequest(ctx, "plugin.counter", "/counter.v1.Counter/Version", []byte{})
+	require.NoError(t, err)
+	return string(version)
+}
+
+func TestMeshHotSwap_SwitchesVersionAndKeepsState(t *testing.T) {
+	manager, router, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	assert.Equal(t, "1.0.0", routedVersion(t, router))
+
+	incr(t, manager, "incr")
+	incr(t, manager, "incr")
+
+	require.NoError(t, manager.HotSwapPlugin("counter", "2.0.0"))
+
+	info, err := manager.GetPlugin("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", info.Version)
+	assert.Equal(t, "2.0.0", routedVersion(t, router))
+
+	resp := incr(t, manager, "incr")
+	assert.Equal(t, "2.0.0", resp.Result["version"])
+	assert.Equal(t, 3, resp.Result["count"], "state carries over to the new version")
+}
+
+func TestMeshHotSwap_DrainsInFlightRequests(t *testing.T) {
+	for _, isolation := range []plugins.IsolationLevel{plugins.IsolationProcess, plugins.IsolationWASM} {
+		t.Run(string(isolation), func(t *testing.T) {
+			manager, router, loader := newSwapManager(t)
+			// Held requests must wait for the state, however long it takes
+			loader.importing["2.0.0"] = 50 * time.Millisecond
+			counter := spec("counter", "1.0.0")
+			counter.Isolation = isolation
+			require.NoError(t, manager.LoadPlugin(counter))
+
+			// A slow request is in flight when the swap starts
+			slow := make(chan plugins.PluginResponse, 1)
+			go func() { slow <- incr(t, manager, "300ms") }()
+			require.Eventually(t, func() bool { return router.InFlight("plugin.counter") == 1 },
+				time.Second, 5*time.Millisecond)
+
+			swapped := make(chan error, 1)
+			go func() { swapped <- manager.HotSwapPlugin("counter", "2.0.0") }()
+
+			// Requests made during the swap are held, then served by the new version
+			time.Sleep(50 * time.Millisecond)
+			during := incr(t, manager, "incr")
+
+			require.NoError(t, <-swapped)
+			assert.Equal(t, "1.0.0", (<-slow).Result["version"], "the in-flight request finished on the old version")
+			assert.Equal(t, "2.0.0", during.Result["version"])
+			assert.Equal(t, 2, during.Result["count"], "state is exported after the drain")
+
+			old := loader.plugins[0]
+			assert.Equal(t, 1, old.handled)
+			assert.Equal(t, plugins.PluginStatusStopped, old.GetStatus())
+			assert.Equal(t, 0, router.InFlight("plugin.counter"))
+		})
+	}
+}
+
+func TestMeshHotSwap_RollsBackWhenHealthCheckFails(t *testing.T) {
+	manager, router, loader := newSwapManager(t, "2.0.0")
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	incr(t, manager, "incr")
+
+	err := manager.HotSwapPlugin("counter", "2.0.0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "health check")
+
+	// The old version serves again, with the state it had
+	info, err := manager.GetPlugin("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", info.Version)
+	assert.Equal(t, "1.0.0", routedVersion(t, router))
+
+	resp := incr(t, manager, "incr")
+	assert.Equal(t, "1.0.0", resp.Result["version"])
+	assert.Equal(t, 2, resp.Result["count"])
+
+	failed := loader.plugins[1]
+	assert.Equal(t, "2.0.0", failed.spec.Version)
+	assert.Equal(t, plugins.PluginStatusStopped, failed.GetStatus())
+
+	// The failed version was discarded, so another swap can be tried
+	loader.unhealthy = nil
+	require.NoError(t, manager.HotSwapPlugin("counter", "2.0.1"))
+	assert.Equal(t, "2.0.1", routedVersion(t, router))
+}
+
+func TestMeshHotSwap_RequiresHotSwapper(t *testing.T) {
+	manager := plugins.NewMeshPluginManager(plugins.MeshPluginManagerConfig{
+		Registry: registry.New(nil),
+		Loader:   &fakeLoader{},
+	})
+	err := manager.HotSwapPlugin("counter", "2.0.0")
+	assert.ErrorIs(t, err, plugins.ErrPluginNotFound)
+
+	swap := manager.SwapManager()
+	var _ state.PluginManager = swap
+	var _ state.StateTransfer = swap
+	var _ state.StateStager = swap
+}
+
+func TestMeshHotSwap_StopFailsWhenStateIsLost(t *testing.T) {
+	manager, router, loader := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	loader.plugins[0].stateless = true
+
+	err := manager.SwapManager().StopPlugin(context.Background(), "counter")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "state lost")
+
+	// The plugin wasn't stopped
+	assert.Equal(t, plugins.PluginStatusRunning, loader.plugins[0].GetStatus())
+	assert.Equal(t, "1.0.0", routedVersion(t, router))
+	assert.Equal(t, 1, incr(t, manager, "incr").Result["count"])
+}
+
+func TestMeshHotSwap_ServesOtherPluginsWhileStopping(t *testing.T) {
+	manager, _, loader := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	require.NoError(t, manager.LoadPlugin(spec("other", "1.0.0")))
+
+	release := make(chan struct{})
+	loader.plugins[0].stopping = release
+	stopped := make(chan error, 1)
+	swap := manager.SwapManager()
+	go func() { stopped <- swap.StopPlugin(context.Background(), "counter") }()
+
+	// While counter is stuck stopping, other plugins are served and the
+	// stopping plugin can't be stopped or started again
+	served := make(chan error, 1)
+	go func() {
+		_, err := manager.ExecutePlugin("other", plugins.PluginRequest{Method: "incr"})
+		served <- err
+	}()
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request to another plugin blocked behind the stop")
+	}
+	require.Eventually(t, func() bool {
+		return errors.Is(swap.StopPlugin(context.Background(), "counter"), plugins.ErrHotSwapInProgress)
+	}, time.Second, 5*time.Millisecond)
+	assert.ErrorIs(t, swap.UnloadPlugin(context.Background(), "counter"), plugins.ErrHotSwapInProgress)
+
+	close(release)
+	require.NoError(t, <-stopped)
+	require.NoError(t, swap.StartPlugin(context.Background(), "counter"))
+	assert.Equal(t, 1, incr(t, manager, "incr").Result["count"])
+}
@@ -0,0 +1,279 @@
+package loader_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/loader"
+)
+
+var pluginBinary = []byte("#!/bin/sh\n# test plugin\nexit 0\n")
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestArtifactCache_LRUEviction(t *testing.T) {
+	cache, err := loader.NewArtifactCache(loader.ArtifactCacheConfig{Dir: t.TempDir(), MaxBytes: 20})
+	require.NoError(t, err)
+
+	importBytes := func(data string) string {
+		path := filepath.Join(t.TempDir(), "artifact")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+		digest, err := cache.Import(path, "")
+		require.NoError(t, err)
+		return digest
+	}
+
+	first := importBytes("0123456789")
+	time.Sleep(10 * time.Millisecond)
+	second := importBytes("abcdefghij")
+	time.Sleep(10 * time.Millisecond)
+
+	// Touch the first artifact so the second becomes least recently used
+	_, err = cache.Path("sha256:" + first)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	third := importBytes("ABCDEFGHIJ")
+
+	_, err = cache.Path(first)
+	assert.NoError(t, err)
+	_, err = cache.Path(third)
+	assert.NoError(t, err)
+	_, err = cache.Path(second)
+	assert.True(t, errors.Is(err, loader.ErrArtifactNotCached))
+	assert.Equal(t, int64(20), cache.Size())
+
+	_, err = cache.Path("not-a-digest")
+	assert.True(t, errors.Is(err, loader.ErrInvalidDigest))
+}
+
+func TestArtifactCache_AcquiredArtifactsStay(t *testing.T) {
+	cache, err := loader.NewArtifactCache(loader.ArtifactCacheConfig{Dir: t.TempDir(), MaxBytes: 10})
+	require.NoError(t, err)
+
+	importBytes := func(data string) string {
+		path := filepath.Join(t.TempDir(), "artifact")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+		digest, err := cache.Import(path, "")
+		require.NoError(t, err)
+		return digest
+	}
+
+	running := importBytes("0123456789")
+	path, err := cache.Acquire(running)
+	require.NoError(t, err)
+	assert.True(t, errors.Is(cache.Remove(running), loader.ErrArtifactInUse))
+
+	// The cache outgrows its limit rather than evict the running artifact
+	time.Sleep(10 * time.Millisecond)
+	newer := importBytes("abcdefghij")
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), cache.Size())
+
+	// Once released it is evicted as usual
+	cache.Release(running)
+	_, err = cache.Path(running)
+	assert.True(t, errors.Is(err, loader.ErrArtifactNotCached))
+	_, err = cache.Path(newer)
+	assert.NoError(t, err)
+}
+
+func TestArtifactCache_Seed(t *testing.T) {
+	seed := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(seed, "analytics-1.0.0"), pluginBinary, 0644))
+
+	cacheDir := t.TempDir()
+	cache, err := loader.NewArtifactCache(loader.ArtifactCacheConfig{Dir: cacheDir, SeedDir: seed})
+	require.NoError(t, err)
+
+	path, err := cache.Path(digestOf(pluginBinary))
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0111)
+
+	// Seed files are copied, not moved
+	_, err = os.Stat(filepath.Join(seed, "analytics-1.0.0"))
+	assert.NoError(t, err)
+
+	// Reopening finds the artifact again
+	cache, err = loader.NewArtifactCache(loader.ArtifactCacheConfig{Dir: cacheDir})
+	require.NoError(t, err)
+	_, err = cache.Path(digestOf(pluginBinary))
+	assert.NoError(t, err)
+}
+
+func TestDownloader_ResumesInterruptedDownload(t *testing.T) {
+	payload := bytes.Repeat([]byte("plugin-bytes-"), 1000)
+	var requests atomic.Int32
+	var mu sync.Mutex
+	var ranges []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		if requests.Add(1) == 1 {
+			// Send half of the artifact and drop the connection
+			w.Header().Set("Content-Length", "13000")
+			w.Write(payload[:6500])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "plugin", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer server.Close()
+
+	cache, err := loader.NewArtifactCache(loader.ArtifactCacheConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	downloader := loader.NewDownloader(loader.DownloaderConfig{Cache: cache})
+	ctx := context.Background()
+
+	_, _, err = downloader.Fetch(ctx, server.URL+"/plugin", digestOf(payload))
+	require.Error(t, err)
+
+	path, digest, err := downloader.Fetch(ctx, server.URL+"/plugin", digestOf(payload))
+	require.NoError(t, err)
+	assert.Equal(t, digestOf(payload), digest)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, payload, data)
+
+	mu.Lock()
+	assert.Equal(t, []string{"", "bytes=6500-"}, ranges)
+	mu.Unlock()
+
+	// Later fetches are served from the cache, with or without the digest
+	_, _, err = downloader.Fetch(ctx, server.URL+"/plugin", "")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestDownloader_FetchesURLOnce(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write(pluginBinary)
+	}))
+	defer server.Close()
+
+	cache, err := loader.NewArtifactCache(loader.ArtifactCacheConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	downloader := loader.NewDownloader(loader.DownloaderConfig{Cache: cache})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := downloader.Fetch(context.Background(), server.URL+"/plugin", "")
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Every fetch acquired the artifact
+	digest := digestOf(pluginBinary)
+	for i := 0; i < 3; i++ {
+		downloader.Release(digest)
+		assert.True(t, errors.Is(cache.Remove(digest), loader.ErrArtifactInUse))
+	}
+	downloader.Release(digest)
+	assert.NoError(t, cache.Remove(digest))
+}
+
+func TestDownloader_Limits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 4096)))
+	}))
+	defer server.Close()
+
+	cache, err := loader.NewArtifactCache(loader.ArtifactCacheConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	small := loader.NewDownloader(loader.DownloaderConfig{Cache: cache, MaxSize: 1024})
+	_, _, err = small.Fetch(ctx, server.URL, "")
+	assert.True(t, errors.Is(err, loader.ErrDownloadTooLarge))
+
+	downloader := loader.NewDownloader(loader.DownloaderConfig{Cache: cache})
+	_, _, err = downloader.Fetch(ctx, server.URL, digestOf([]byte("something else")))
+	assert.True(t, errors.Is(err, loader.ErrDigestMismatch))
+
+	_, _, err = downloader.Fetch(ctx, "ftp://example.com/plugin", "")
+	assert.True(t, errors.Is(err, loader.ErrUnsupportedScheme))
+}
+
+func TestMeshPluginLoader_RemoteSource(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first response is not a runnable binary
+		if requests.Add(1) == 1 {
+			w.Write([]byte("garbage"))
+			return
+		}
+		w.Write(pluginBinary)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	l := loader.NewMeshPluginLoader(loader.MeshLoaderConfig{
+		CacheDir:  cacheDir,
+		SocketDir: t.TempDir(),
+	})
+
+	spec := plugins.PluginSpec{
+		Name:      "remote",
+		Version:   "1.0.0",
+		Source:    plugins.PluginSource{Type: plugins.SourceTypeRemote, Path: server.URL + "/remote"},
+		Isolation: plugins.IsolationProcess,
+	}
+	_, err := l.LoadPlugin(spec)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// An air-gapped node loads the same plugin from its seed directory
+	seed := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(seed, "remote"), pluginBinary, 0755))
+	offline := loader.NewMeshPluginLoader(loader.MeshLoaderConfig{
+		CacheDir:  t.TempDir(),
+		SocketDir: t.TempDir(),
+		SeedDir:   seed,
+	})
+	spec.Source.Path = "http://127.0.0.1:1/unreachable"
+	spec.Source.Hash = "sha256:" + digestOf(pluginBinary)
+	_, err = offline.LoadPlugin(spec)
+	require.NoError(t, err)
+}
@@ -0,0 +1,172 @@
+package loader_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/loader"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/trust"
+)
+
+func buildPackage(t *testing.T) string {
+	return buildSignedPackage(t, nil)
+}
+
+func buildSignedPackage(t *testing.T, signer archive.Signer) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plugin.yaml"), []byte("name: packaged\nversion: 1.0.0\n"), 0644))
+	bin := filepath.Join(dir, "bin", archive.CurrentPlatform(), "packaged")
+	require.NoError(t, os.MkdirAll(filepath.Dir(bin), 0755))
+	require.NoError(t, os.WriteFile(bin, pluginBinary, 0755))
+
+	out := filepath.Join(t.TempDir(), "packaged-1.0.0.plugin")
+	_, err := archive.PackFile(dir, out, archive.PackOptions{Signer: signer})
+	require.NoError(t, err)
+	return out
+}
+
+func TestMeshPluginLoader_LoadsPackages(t *testing.T) {
+	pkg := buildPackage(t)
+	cacheDir := t.TempDir()
+	l := loader.NewMeshPluginLoader(loader.MeshLoaderConfig{
+		CacheDir:  cacheDir,
+		SocketDir: t.TempDir(),
+	})
+
+	spec := plugins.PluginSpec{
+		Name:      "packaged",
+		Version:   "1.0.0",
+		Source:    plugins.PluginSource{Type: plugins.SourceTypeLocal, Path: pkg},
+		Isolation: plugins.IsolationProcess,
+	}
+	_, err := l.LoadPlugin(spec)
+	require.NoError(t, err)
+
+	unpacked, err := filepath.Glob(filepath.Join(cacheDir, "unpacked", "*", "bin", archive.CurrentPlatform(), "packaged"))
+	require.NoError(t, err)
+	assert.Len(t, unpacked, 1)
+
+	// Packages fetched from a URL are unpacked the same way
+	data, err := os.ReadFile(pkg)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	spec.Source = plugins.PluginSource{Type: plugins.SourceTypeRemote, Path: server.URL + "/packaged-1.0.0.plugin", Hash: digestOf(data)}
+	_, err = l.LoadPlugin(spec)
+	require.NoError(t, err)
+}
+
+func TestMeshPluginLoader_SignaturePolicy(t *testing.T) {
+	trusted, trustedKey, err := trust.GenerateKey("Blackhole Foundation")
+	require.NoError(t, err)
+	untrusted, _, err := trust.GenerateKey("Mallory")
+	require.NoError(t, err)
+
+	store := trust.NewStore()
+	require.NoError(t, store.AddKey(trustedKey))
+	l := loader.NewMeshPluginLoader(loader.MeshLoaderConfig{
+		CacheDir:  t.TempDir(),
+		SocketDir: t.TempDir(),
+		Verifier:  trust.NewVerifier(store, trust.Policy{Mode: trust.ModeRequire}, nil),
+	})
+
+	load := func(path string) error {
+		_, err := l.LoadPlugin(plugins.PluginSpec{
+			Name:      "packaged",
+			Version:   "1.0.0",
+			Source:    plugins.PluginSource{Type: plugins.SourceTypeLocal, Path: path},
+			Isolation: plugins.IsolationProcess,
+		})
+		return err
+	}
+
+	assert.NoError(t, load(buildSignedPackage(t, trusted)))
+
+	err = load(buildSignedPackage(t, untrusted))
+	assert.True(t, errors.Is(err, trust.ErrUnknownKey))
+	assert.Contains(t, err.Error(), `publisher "Mallory"`)
+
+	err = load(buildPackage(t))
+	assert.True(t, errors.Is(err, trust.ErrUnsigned))
+
+	// Bare binaries have no signature either
+	bare := filepath.Join(t.TempDir(), "packaged")
+	require.NoError(t, os.WriteFile(bare, pluginBinary, 0755))
+	err = load(bare)
+	assert.True(t, errors.Is(err, trust.ErrUnsigned))
+}
+
+func TestMeshPluginLoader_RemoteSignaturePolicyNotRetried(t *testing.T) {
+	data, err := os.ReadFile(buildPackage(t))
+	require.NoError(t, err)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	l := loader.NewMeshPluginLoader(loader.MeshLoaderConfig{
+		CacheDir:  t.TempDir(),
+		SocketDir: t.TempDir(),
+		Verifier:  trust.NewVerifier(trust.NewStore(), trust.Policy{Mode: trust.ModeRequire}, nil),
+	})
+	start := time.Now()
+	_, err = l.LoadPlugin(plugins.PluginSpec{
+		Name:      "packaged",
+		Version:   "1.0.0",
+		Source:    plugins.PluginSource{Type: plugins.SourceTypeRemote, Path: server.URL + "/packaged-1.0.0.plugin"},
+		Isolation: plugins.IsolationProcess,
+	})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, loader.ErrUntrusted))
+	assert.True(t, errors.Is(err, trust.ErrUnsigned))
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestMeshPluginLoader_ReunpacksModifiedPackages(t *testing.T) {
+	pkg := buildPackage(t)
+	cacheDir := t.TempDir()
+	l := loader.NewMeshPluginLoader(loader.MeshLoaderConfig{
+		CacheDir:  cacheDir,
+		SocketDir: t.TempDir(),
+	})
+	spec := plugins.PluginSpec{
+		Name:      "packaged",
+		Version:   "1.0.0",
+		Source:    plugins.PluginSource{Type: plugins.SourceTypeLocal, Path: pkg},
+		Isolation: plugins.IsolationProcess,
+	}
+	_, err := l.LoadPlugin(spec)
+	require.NoError(t, err)
+
+	unpacked, err := filepath.Glob(filepath.Join(cacheDir, "unpacked", "*", "bin", archive.CurrentPlatform(), "packaged"))
+	require.NoError(t, err)
+	require.Len(t, unpacked, 1)
+	info, err := os.Stat(filepath.Join(cacheDir, "unpacked"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	require.NoError(t, os.WriteFile(unpacked[0], []byte("#!/bin/sh\n# replaced\nexit 0\n"), 0755))
+
+	// The modified binary is not reused
+	_, err = l.LoadPlugin(spec)
+	require.NoError(t, err)
+	data, err := os.ReadFile(unpacked[0])
+	require.NoError(t, err)
+	assert.Equal(t, pluginBinary, data)
+}
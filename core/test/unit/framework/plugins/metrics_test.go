@@ -0,0 +1,217 @@
+package plugins_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+)
+
+func TestMeshMetrics_RecordsRequestsPerMethod(t *testing.T) {
+	manager, _, loader := newSwapManager(t)
+	loader.failing["2.0.0"] = true
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	require.NoError(t, manager.LoadPlugin(spec("storage", "2.0.0")))
+
+	for i := 0; i < 9; i++ {
+		incr(t, manager, "incr")
+	}
+	incr(t, manager, "100ms")
+	_, err := manager.ExecutePlugin("storage", plugins.PluginRequest{Method: "get"})
+	require.Error(t, err)
+	_, err = manager.ExecutePlugin("missing", plugins.PluginRequest{Method: "get"})
+	require.ErrorIs(t, err, plugins.ErrPluginNotFound)
+
+	counter, err := manager.PluginMetrics("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", counter.Version)
+	assert.EqualValues(t, 10, counter.Requests)
+	assert.EqualValues(t, 10, counter.Successes)
+	assert.Zero(t, counter.ErrorRate())
+	assert.EqualValues(t, 9, counter.Methods["incr"].Requests)
+	assert.EqualValues(t, 1, counter.Methods["100ms"].Requests)
+	assert.True(t, counter.LastErrorTime.IsZero())
+
+	latency := counter.Latency
+	assert.Less(t, latency.P50, 10*time.Millisecond)
+	assert.Less(t, latency.P90, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, latency.P99, 50*time.Millisecond)
+	assert.LessOrEqual(t, latency.P99, latency.Max)
+	assert.GreaterOrEqual(t, latency.Max, 100*time.Millisecond)
+
+	storage, err := manager.PluginMetrics("storage")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, storage.Failures)
+	assert.Equal(t, 1.0, storage.ErrorRate())
+	assert.Equal(t, "internal error", storage.LastError)
+	assert.False(t, storage.LastErrorTime.IsZero())
+
+	all := manager.AllPluginMetrics()
+	require.Len(t, all, 2)
+	assert.Equal(t, "counter", all[0].Plugin)
+}
+
+func TestMeshMetrics_TracksInFlightRequests(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+
+	slow := make(chan plugins.PluginResponse, 1)
+	go func() { slow <- incr(t, manager, "200ms") }()
+	require.Eventually(t, func() bool {
+		info, err := manager.GetPlugin("counter")
+		return err == nil && info.Metrics != nil && info.Metrics.InFlight == 1
+	}, time.Second, 5*time.Millisecond)
+
+	<-slow
+	info, err := manager.GetPlugin("counter")
+	require.NoError(t, err)
+	assert.Zero(t, info.Metrics.InFlight)
+	assert.EqualValues(t, 1, info.Metrics.Requests)
+}
+
+func TestMeshMetrics_ResetOnReload(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	incr(t, manager, "incr")
+	before, err := manager.PluginMetrics("counter")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, before.Requests)
+
+	require.NoError(t, manager.ReloadPlugin("counter"))
+	after, err := manager.PluginMetrics("counter")
+	require.NoError(t, err)
+	assert.Zero(t, after.Requests)
+	assert.Empty(t, after.Methods)
+	assert.True(t, after.Since.After(before.Since))
+
+	// A swap to another version starts over as well
+	incr(t, manager, "incr")
+	require.NoError(t, manager.HotSwapPlugin("counter", "1.1.0"))
+	swapped, err := manager.PluginMetrics("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", swapped.Version)
+	assert.Zero(t, swapped.Requests)
+}
+
+func TestMeshMetrics_BoundsTrackedMethods(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	for i := 0; i < 70; i++ {
+		incr(t, manager, fmt.Sprintf("method-%d", i))
+	}
+
+	metrics, err := manager.PluginMetrics("counter")
+	require.NoError(t, err)
+	assert.Len(t, metrics.Methods, 65)
+	assert.EqualValues(t, 6, metrics.Methods[plugins.OtherMethods].Requests)
+	assert.EqualValues(t, 70, metrics.Requests)
+}
+
+func TestMeshMetrics_CountsRoutedRequests(t *testing.T) {
+	manager, router, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	routedVersion(t, router)
+	routedVersion(t, router)
+
+	metrics, err := manager.PluginMetrics("counter")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, metrics.Requests)
+	assert.EqualValues(t, 2, metrics.Methods["/counter.v1.Counter/Version"].Requests)
+
+	// During a rollout they count toward the version that served them
+	require.NoError(t, manager.StartRollout("counter", "2.0.0", plugins.RolloutPolicy{
+		Steps:        []int{0, 100},
+		StepInterval: time.Hour,
+		MinRequests:  1000,
+	}))
+	defer manager.AbortRollout("counter")
+	pinnedRoutedVersion(t, router, "2.0.0")
+	routedVersion(t, router)
+
+	status, err := manager.RolloutStatus("counter")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, status.Canary.Requests)
+	assert.EqualValues(t, 1, status.Stable.Requests)
+}
+
+func TestManagerMetrics_RecordsRequests(t *testing.T) {
+	manager := newTestManager(&fakeLoader{})
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	for i := 0; i < 3; i++ {
+		_, err := manager.ExecutePlugin("counter", plugins.PluginRequest{Method: "incr"})
+		require.NoError(t, err)
+	}
+
+	source, ok := manager.(plugins.MetricsSource)
+	require.True(t, ok)
+	metrics, err := source.PluginMetrics("counter")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, metrics.Requests)
+	assert.EqualValues(t, 3, metrics.Methods["incr"].Requests)
+	assert.Len(t, source.AllPluginMetrics(), 1)
+	_, err = source.PluginMetrics("missing")
+	assert.ErrorIs(t, err, plugins.ErrPluginNotFound)
+
+	info, err := manager.GetPlugin("counter")
+	require.NoError(t, err)
+	require.NotNil(t, info.Metrics)
+	assert.EqualValues(t, 3, info.Metrics.Requests)
+
+	require.NoError(t, manager.HotSwapPlugin("counter", "1.1.0"))
+	swapped, err := source.PluginMetrics("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", swapped.Version)
+	assert.Zero(t, swapped.Requests)
+}
+
+func TestPluginMetrics_Base(t *testing.T) {
+	since := time.Now().Add(-time.Minute)
+	metrics := plugins.PluginMetrics{Since: since}
+	metrics.Requests = 10
+	metrics.Failures = 2
+	metrics.Latency.Mean = 1500 * time.Microsecond
+
+	converted := metrics.Base(plugins.PluginResourceUsage{CPU: 12.5, Memory: 64 << 20})
+	assert.Equal(t, since, converted.StartTime)
+	assert.EqualValues(t, 10, converted.RequestsHandled)
+	assert.EqualValues(t, 2, converted.RequestsFailed)
+	assert.InDelta(t, 1.5, converted.AverageLatencyMs, 1e-9)
+	assert.InDelta(t, 64, converted.MemoryUsageMB, 1e-9)
+	assert.Equal(t, 12.5, converted.CPUUsagePercent)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	incr(t, manager, "incr")
+	server := httptest.NewServer(plugins.MetricsHandler(manager))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	var all []plugins.PluginMetrics
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&all))
+	resp.Body.Close()
+	require.Len(t, all, 1)
+	assert.EqualValues(t, 1, all[0].Requests)
+
+	resp, err = http.Get(server.URL + "?plugin=counter")
+	require.NoError(t, err)
+	var one plugins.PluginMetrics
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&one))
+	resp.Body.Close()
+	assert.Equal(t, "counter", one.Plugin)
+	assert.EqualValues(t, 1, one.Methods["incr"].Successes)
+
+	resp, err = http.Get(server.URL + "?plugin=missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
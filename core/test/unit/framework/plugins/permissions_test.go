@@ -0,0 +1,130 @@
+package plugins_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+)
+
+func TestPermissionsFromCapabilities(t *testing.T) {
+	perms := plugins.PermissionsFromCapabilities([]string{
+		"network", "filesystem:read", "filesystem:write", "mesh:publish",
+		"process:spawn", "network.p2p", "storage",
+	})
+	assert.Equal(t, []plugins.PluginPermission{
+		plugins.PermissionNetwork,
+		plugins.PermissionFileSystem,
+		plugins.PermissionOtherPlugins,
+		plugins.PermissionSystem,
+	}, perms)
+
+	assert.Empty(t, plugins.PermissionsFromCapabilities([]string{"storage", "ui"}))
+}
+
+func TestManager_PermissionApproval(t *testing.T) {
+	reg := registry.New(nil)
+	loader := &fakeLoader{}
+	calls := 0
+	approver := plugins.PermissionApproverFunc(func(spec plugins.PluginSpec, requested []plugins.PluginPermission) ([]plugins.PluginPermission, error) {
+		calls++
+		assert.Equal(t, "node", spec.Name)
+		// Grant network, and try to sneak in something that wasn't requested
+		return []plugins.PluginPermission{plugins.PermissionNetwork, plugins.PermissionUserData}, nil
+	})
+	manager := plugins.NewManagerWithApprover(reg, loader, nil, nil, nil, approver)
+
+	node := spec("node", "1.0.0")
+	node.Permissions = []plugins.PluginPermission{plugins.PermissionNetwork, plugins.PermissionFileSystem}
+
+	require.NoError(t, manager.LoadPlugin(node))
+	require.Len(t, loader.specs, 1)
+	assert.Equal(t, []plugins.PluginPermission{plugins.PermissionNetwork}, loader.specs[0].Permissions)
+
+	installed, err := reg.InstalledVersions("node")
+	require.NoError(t, err)
+	require.Len(t, installed, 1)
+	assert.Equal(t, []plugins.PluginPermission{plugins.PermissionNetwork}, installed[0].Permissions)
+	assert.False(t, installed[0].ApprovedAt.IsZero())
+
+	// Reloading the same version uses the recorded approval
+	require.NoError(t, manager.UnloadPlugin("node"))
+	require.NoError(t, manager.LoadPlugin(node))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []plugins.PluginPermission{plugins.PermissionNetwork}, loader.specs[1].Permissions)
+
+	// A new version is asked about again
+	node.Version = "1.1.0"
+	require.NoError(t, manager.UnloadPlugin("node"))
+	require.NoError(t, manager.LoadPlugin(node))
+	assert.Equal(t, 2, calls)
+}
+
+func TestManager_PermissionsRejected(t *testing.T) {
+	loader := &fakeLoader{}
+	approver := plugins.PermissionApproverFunc(func(spec plugins.PluginSpec, requested []plugins.PluginPermission) ([]plugins.PluginPermission, error) {
+		return nil, errors.New("user declined")
+	})
+	manager := plugins.NewManagerWithApprover(registry.New(nil), loader, nil, nil, nil, approver)
+
+	err := manager.LoadPlugin(spec("node", "1.0.0"))
+	require.ErrorIs(t, err, plugins.ErrPermissionsRejected)
+	assert.Contains(t, err.Error(), "user declined")
+	assert.Empty(t, loader.loaded)
+}
+
+func TestManager_DeniesPermissionsWithoutApprover(t *testing.T) {
+	loader := &fakeLoader{}
+	manager := newTestManager(loader)
+
+	node := spec("node", "1.0.0")
+	node.Permissions = []plugins.PluginPermission{plugins.PermissionNetwork}
+	require.NoError(t, manager.LoadPlugin(node))
+	assert.Empty(t, loader.specs[0].Permissions)
+}
+
+func TestPermissionAllowList(t *testing.T) {
+	allowed := plugins.PermissionAllowList{
+		"node":             {plugins.PermissionNetwork},
+		plugins.AllPlugins: {plugins.PermissionOtherPlugins},
+	}
+	requested := []plugins.PluginPermission{
+		plugins.PermissionNetwork, plugins.PermissionFileSystem, plugins.PermissionOtherPlugins,
+	}
+
+	granted, err := allowed.ApprovePermissions(spec("node", "1.0.0"), requested)
+	require.NoError(t, err)
+	assert.Equal(t, []plugins.PluginPermission{plugins.PermissionNetwork, plugins.PermissionOtherPlugins}, granted)
+
+	granted, err = allowed.ApprovePermissions(spec("storage", "1.0.0"), requested)
+	require.NoError(t, err)
+	assert.Equal(t, []plugins.PluginPermission{plugins.PermissionOtherPlugins}, granted)
+}
+
+func TestPromptApprover(t *testing.T) {
+	var out bytes.Buffer
+	approver := plugins.NewPromptApprover(strings.NewReader("y\nno\nYes\n"), &out)
+	loader := &fakeLoader{}
+	manager := plugins.NewManagerWithApprover(registry.New(nil), loader, nil, nil, nil, approver)
+
+	node := spec("node", "1.0.0")
+	node.Permissions = []plugins.PluginPermission{
+		plugins.PermissionNetwork, plugins.PermissionFileSystem, plugins.PermissionOtherPlugins,
+	}
+	require.NoError(t, manager.LoadPlugin(node))
+	assert.Equal(t, []plugins.PluginPermission{plugins.PermissionNetwork, plugins.PermissionOtherPlugins}, loader.specs[0].Permissions)
+	assert.Contains(t, out.String(), "Plugin node 1.0.0 requests 3 permission(s)")
+	assert.Contains(t, out.String(), "filesystem: write outside its data directory. Grant? [y/N]")
+
+	// Without an answer the install is refused
+	storage := spec("storage", "1.0.0")
+	storage.Permissions = []plugins.PluginPermission{plugins.PermissionNetwork}
+	err := manager.LoadPlugin(storage)
+	assert.ErrorIs(t, err, plugins.ErrPermissionsRejected)
+}
@@ -0,0 +1,235 @@
+package registry_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+)
+
+// catalogFixture follows website/api/v1/catalog.json, with "{{URL}}"
+// replaced by the test server address
+const catalogFixture = `{
+  "version": "1.0",
+  "updated": "2025-05-25T03:26:45Z",
+  "plugins": [
+    {
+      "id": "node",
+      "name": "Node Plugin",
+      "description": "P2P networking and distributed node management for Blackhole",
+      "version": "1.0.1",
+      "category": "p2p",
+      "official": true,
+      "downloads": {
+        "linux-amd64": {
+          "url": "{{URL}}/node/v1.0.1/node-linux-amd64.plugin",
+          "checksumUrl": "{{URL}}/node/v1.0.1/node-linux-amd64.plugin.sha256"
+        },
+        "linux-arm64": {
+          "url": "{{URL}}/node/v1.0.1/node-linux-arm64.plugin"
+        }
+      },
+      "metadata": {
+        "author": "Blackhole Foundation",
+        "license": "MIT",
+        "categories": ["p2p"],
+        "keywords": ["libp2p", "mesh"],
+        "dependencies": ["storage@^1.2", {"name": "metrics", "version": ">=0.5", "optional": true}],
+        "resources": {"cpu": "500m", "memory": "512Mi", "storage": "1Gi", "network": "unlimited"},
+        "capabilities": ["network.p2p"],
+        "checksums": {
+          "linux-arm64": "sha256:{{ARM64_SUM}}"
+        }
+      }
+    }
+  ]
+}`
+
+type marketplaceServer struct {
+	*httptest.Server
+	catalogRequests  atomic.Int32
+	notModified      atomic.Int32
+	amd64, arm64     []byte
+	corruptDownloads atomic.Bool
+}
+
+func newMarketplaceServer(t *testing.T) *marketplaceServer {
+	s := &marketplaceServer{
+		amd64: []byte("#!/bin/sh\necho amd64\n"),
+		arm64: []byte("#!/bin/sh\necho arm64\n"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/catalog.json", func(w http.ResponseWriter, r *http.Request) {
+		s.catalogRequests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			s.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		body := strings.ReplaceAll(catalogFixture, "{{URL}}", s.URL)
+		body = strings.ReplaceAll(body, "{{ARM64_SUM}}", sha256Hex(s.arm64))
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	})
+	mux.HandleFunc("/node/v1.0.1/node-linux-amd64.plugin", func(w http.ResponseWriter, r *http.Request) {
+		if s.corruptDownloads.Load() {
+			w.Write([]byte("tampered"))
+			return
+		}
+		w.Write(s.amd64)
+	})
+	mux.HandleFunc("/node/v1.0.1/node-linux-amd64.plugin.sha256", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sha256Hex(s.amd64) + "  node-linux-amd64.plugin\n"))
+	})
+	mux.HandleFunc("/node/v1.0.1/node-linux-arm64.plugin", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(s.arm64)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHTTPMarketplaceClient_FetchPlugin(t *testing.T) {
+	server := newMarketplaceServer(t)
+
+	client := registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: server.URL,
+		Platform:   "linux-amd64",
+	})
+
+	spec, err := client.FetchPlugin("node")
+	require.NoError(t, err)
+	assert.Equal(t, "node", spec.Name)
+	assert.Equal(t, "1.0.1", spec.Version)
+	assert.Equal(t, plugins.SourceTypeMarketplace, spec.Source.Type)
+	assert.Equal(t, "node", spec.Source.Path)
+	assert.Equal(t, sha256Hex(server.amd64), spec.Source.Hash)
+	assert.Equal(t, plugins.IsolationProcess, spec.Isolation)
+	assert.Equal(t, plugins.PluginResources{CPU: 50, Memory: 512, Disk: 1024}, spec.Resources)
+	assert.Equal(t, []plugins.PluginDependency{
+		{Name: "storage", Version: "^1.2"},
+		{Name: "metrics", Version: ">=0.5", Optional: true},
+	}, spec.Dependencies)
+
+	// Checksums from the metadata table are used for other platforms
+	armClient := registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: server.URL + "/api/v1/catalog.json",
+		Platform:   "linux-arm64",
+	})
+	spec, err = armClient.FetchPlugin("node@1.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex(server.arm64), spec.Source.Hash)
+
+	_, err = client.FetchPlugin("node@0.9.0")
+	assert.True(t, errors.Is(err, registry.ErrArtifactNotFound))
+	_, err = client.FetchPlugin("missing")
+	assert.True(t, errors.Is(err, registry.ErrPluginNotInCatalog))
+
+	darwin := registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: server.URL,
+		Platform:   "darwin-arm64",
+	})
+	_, err = darwin.FetchPlugin("node")
+	assert.True(t, errors.Is(err, registry.ErrArtifactNotFound))
+
+	infos, err := client.ListPlugins(context.Background())
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "Blackhole Foundation", infos[0].Author)
+	assert.Equal(t, []string{"libp2p", "mesh"}, infos[0].Keywords)
+}
+
+func TestHTTPMarketplaceClient_CatalogCaching(t *testing.T) {
+	server := newMarketplaceServer(t)
+	cacheDir := t.TempDir()
+
+	client := registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: server.URL,
+		CacheDir:   cacheDir,
+		CacheTTL:   time.Hour,
+	})
+	ctx := context.Background()
+
+	_, err := client.Catalog(ctx)
+	require.NoError(t, err)
+	_, err = client.Catalog(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), server.catalogRequests.Load(), "catalog should be served from memory within the TTL")
+
+	// A new client revalidates the on-disk copy with its ETag
+	client = registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: server.URL,
+		CacheDir:   cacheDir,
+	})
+	catalog, err := client.Catalog(ctx)
+	require.NoError(t, err)
+	assert.Len(t, catalog.Plugins, 1)
+	assert.Equal(t, int32(1), server.notModified.Load())
+
+	// The cached catalog is still usable when the marketplace is down
+	server.Close()
+	client = registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: server.URL,
+		CacheDir:   cacheDir,
+	})
+	catalog, err = client.Catalog(ctx)
+	require.NoError(t, err)
+	assert.Len(t, catalog.Plugins, 1)
+}
+
+func TestHTTPMarketplaceClient_DownloadPlugin(t *testing.T) {
+	server := newMarketplaceServer(t)
+	client := registry.NewHTTPMarketplaceClient(registry.MarketplaceConfig{
+		CatalogURL: server.URL,
+		Platform:   "linux-amd64",
+	})
+	ctx := context.Background()
+
+	spec, err := client.FetchPlugin("node")
+	require.NoError(t, err)
+
+	target := filepath.Join(t.TempDir(), "node", "1.0.1", "plugin")
+	require.NoError(t, client.DownloadPlugin(ctx, spec, target))
+
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, server.amd64, data)
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0111, "downloaded plugin should be executable")
+
+	// Tampered artifacts are rejected and never reach the target path
+	server.corruptDownloads.Store(true)
+	tampered := filepath.Join(t.TempDir(), "plugin")
+	err = client.DownloadPlugin(ctx, spec, tampered)
+	assert.True(t, errors.Is(err, registry.ErrChecksumMismatch))
+	_, err = os.Stat(tampered)
+	assert.True(t, os.IsNotExist(err))
+
+	// A hash pinned in the spec overrides the catalog
+	server.corruptDownloads.Store(false)
+	spec.Source.Hash = "sha256:" + strings.Repeat("0", 64)
+	err = client.DownloadPlugin(ctx, spec, tampered)
+	assert.True(t, errors.Is(err, registry.ErrChecksumMismatch))
+}
@@ -72,7 +72,7 @@ func TestPluginRegistry_SearchPlugins(t *testing.T) {
 	r := registry.New(nil)
 
 	// Register multiple test plugins
-	plugins := []plugins.PluginInfo{
+	infos := []plugins.PluginInfo{
 		{
 			Name:         "storage-plugin",
 			Version:      "1.0.0",
@@ -93,7 +93,7 @@ func TestPluginRegistry_SearchPlugins(t *testing.T) {
 		},
 	}
 
-	for _, p := range plugins {
+	for _, p := range infos {
 		err := r.RegisterPlugin(p)
 		require.NoError(t, err)
 	}
@@ -0,0 +1,155 @@
+package registry_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+)
+
+func newSearchRegistry(t *testing.T) plugins.PluginRegistry {
+	r := registry.New(nil)
+	infos := []plugins.PluginInfo{
+		{
+			Name:        "ipfs-storage",
+			Version:     "1.10.0",
+			Description: "Content addressed storage backed by IPFS",
+			License:     "MIT",
+			Category:    "storage",
+			Keywords:    []string{"ipfs", "content"},
+		},
+		{
+			Name:        "s3-storage",
+			Version:     "1.9.2",
+			Description: "Object storage on S3 compatible services",
+			License:     "Apache-2.0",
+			Category:    "storage",
+			Keywords:    []string{"s3", "cloud"},
+		},
+		{
+			Name:        "analytics",
+			Version:     "2.0.0-beta.1",
+			Description: "Usage analytics with optional storage export",
+			License:     "MIT",
+			Category:    "telemetry",
+			Keywords:    []string{"metrics"},
+		},
+		{
+			Name:        "storage",
+			Version:     "0.3.0",
+			Description: "Minimal local storage",
+			Category:    "storage",
+		},
+	}
+	for _, info := range infos {
+		require.NoError(t, r.RegisterPlugin(info))
+	}
+	return r
+}
+
+func names(infos []plugins.PluginInfo) []string {
+	result := make([]string, len(infos))
+	for i, info := range infos {
+		result[i] = info.Name
+	}
+	return result
+}
+
+func TestSearchPlugins_SemverRange(t *testing.T) {
+	r := newSearchRegistry(t)
+
+	// String comparison would put 1.10.0 below 1.9.0
+	results, err := r.SearchPlugins(plugins.SearchCriteria{MinVersion: "1.9.0", MaxVersion: "1.10"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ipfs-storage", "s3-storage"}, names(results))
+
+	results, err = r.SearchPlugins(plugins.SearchCriteria{MinVersion: "2.0.0-alpha"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"analytics"}, names(results))
+
+	_, err = r.SearchPlugins(plugins.SearchCriteria{MinVersion: "not-a-version"})
+	assert.True(t, errors.Is(err, registry.ErrInvalidSearchCriteria))
+
+	_, err = r.SearchPlugins(plugins.SearchCriteria{MinVersion: "2.0.0", MaxVersion: "1.0.0"})
+	assert.True(t, errors.Is(err, registry.ErrInvalidSearchCriteria))
+}
+
+func TestSearchPlugins_CategoryAndKeywords(t *testing.T) {
+	r := newSearchRegistry(t)
+
+	results, err := r.SearchPlugins(plugins.SearchCriteria{Category: "Storage", License: "mit"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ipfs-storage"}, names(results))
+
+	results, err = r.SearchPlugins(plugins.SearchCriteria{Keywords: []string{"S3", "cloud"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s3-storage"}, names(results))
+
+	results, err = r.SearchPlugins(plugins.SearchCriteria{Keywords: []string{"s3", "ipfs"}})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestSearchPlugins_FullTextRanking(t *testing.T) {
+	r := newSearchRegistry(t)
+
+	// Exact name beats name tokens, which beat description matches
+	results, err := r.SearchPlugins(plugins.SearchCriteria{Query: "storage"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage", "ipfs-storage", "s3-storage", "analytics"}, names(results))
+
+	// Every term must match, and prefixes count
+	results, err = r.SearchPlugins(plugins.SearchCriteria{Query: "stor ipf"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ipfs-storage"}, names(results))
+
+	// Explicit sort overrides relevance
+	results, err = r.SearchPlugins(plugins.SearchCriteria{
+		Query:      "storage",
+		Pagination: plugins.PaginationOptions{SortBy: registry.SortByVersion, SortDirection: "desc"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"analytics", "ipfs-storage", "s3-storage", "storage"}, names(results))
+
+	// Removed plugins disappear from the text index
+	require.NoError(t, r.UnregisterPlugin("storage"))
+	results, err = r.SearchPlugins(plugins.SearchCriteria{Query: "minimal"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestQueryPlugins_Pagination(t *testing.T) {
+	r := newSearchRegistry(t)
+
+	page, err := r.QueryPlugins(plugins.SearchCriteria{Pagination: plugins.PaginationOptions{Limit: 3}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"analytics", "ipfs-storage", "s3-storage"}, names(page.Plugins))
+	assert.Equal(t, 4, page.Pagination.TotalCount)
+	assert.Equal(t, 3, page.Pagination.ReturnedCount)
+	assert.True(t, page.Pagination.HasMore)
+	require.NotEmpty(t, page.Pagination.NextPageToken)
+
+	page, err = r.QueryPlugins(plugins.SearchCriteria{Pagination: plugins.PaginationOptions{
+		Limit:     3,
+		PageToken: page.Pagination.NextPageToken,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage"}, names(page.Plugins))
+	assert.Equal(t, 3, page.Pagination.Offset)
+	assert.False(t, page.Pagination.HasMore)
+	assert.Empty(t, page.Pagination.NextPageToken)
+
+	page, err = r.QueryPlugins(plugins.SearchCriteria{Pagination: plugins.PaginationOptions{Offset: 10}})
+	require.NoError(t, err)
+	assert.Empty(t, page.Plugins)
+
+	_, err = r.QueryPlugins(plugins.SearchCriteria{Pagination: plugins.PaginationOptions{PageToken: "garbage!"}})
+	assert.True(t, errors.Is(err, registry.ErrInvalidSearchCriteria))
+
+	_, err = r.QueryPlugins(plugins.SearchCriteria{Pagination: plugins.PaginationOptions{SortBy: "stars"}})
+	assert.True(t, errors.Is(err, registry.ErrInvalidSearchCriteria))
+}
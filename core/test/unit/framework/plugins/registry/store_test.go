@@ -0,0 +1,144 @@
+package registry_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+)
+
+func TestOpen_PersistsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := registry.Open(dir, nil)
+	require.NoError(t, err)
+	require.NoError(t, r.RegisterPlugin(plugins.PluginInfo{
+		Name:         "ipfs-storage",
+		Version:      "1.2.0",
+		Description:  "Content addressed storage",
+		Status:       plugins.PluginStatusRunning,
+		Capabilities: []plugins.PluginCapability{plugins.CapabilityStorage},
+	}))
+	require.NoError(t, r.RecordInstall(plugins.InstalledVersion{
+		Name:    "ipfs-storage",
+		Version: "1.2.0",
+		Source:  plugins.PluginSource{Type: plugins.SourceTypeLocal, Path: "/opt/ipfs", Hash: "abc"},
+	}))
+
+	// Reopen as if the node restarted
+	r, err = registry.Open(dir, nil)
+	require.NoError(t, err)
+
+	restored, err := r.SearchPlugins(plugins.SearchCriteria{Name: "ipfs-storage"})
+	require.NoError(t, err)
+	require.Len(t, restored, 1)
+	assert.Equal(t, plugins.PluginStatusStopped, restored[0].Status)
+
+	// Search indexes are rebuilt
+	results, err := r.SearchPlugins(plugins.SearchCriteria{Query: "content"})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+	results, err = r.SearchPlugins(plugins.SearchCriteria{
+		Capabilities: []plugins.PluginCapability{plugins.CapabilityStorage},
+	})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	versions, err := r.InstalledVersions("ipfs-storage")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, "abc", versions[0].Hash)
+	assert.Equal(t, "/opt/ipfs", versions[0].Source.Path)
+	assert.False(t, versions[0].InstalledAt.IsZero())
+
+	// The restored entry is replaced when the plugin is loaded again,
+	// but a second live registration is still rejected
+	require.NoError(t, r.RegisterPlugin(plugins.PluginInfo{Name: "ipfs-storage", Version: "1.3.0"}))
+	err = r.RegisterPlugin(plugins.PluginInfo{Name: "ipfs-storage", Version: "1.3.0"})
+	assert.ErrorIs(t, err, registry.ErrPluginAlreadyExists)
+
+	require.NoError(t, r.UnregisterPlugin("ipfs-storage"))
+	r, err = registry.Open(dir, nil)
+	require.NoError(t, err)
+	restored, err = r.SearchPlugins(plugins.SearchCriteria{Name: "ipfs-storage"})
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+}
+
+func TestInstalledVersions(t *testing.T) {
+	dir := t.TempDir()
+	r, err := registry.Open(dir, nil)
+	require.NoError(t, err)
+
+	installedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, v := range []string{"1.9.0", "1.10.0", "2.0.0-rc.1"} {
+		require.NoError(t, r.RecordInstall(plugins.InstalledVersion{
+			Name:        "analytics",
+			Version:     v,
+			InstalledAt: installedAt,
+		}))
+	}
+	require.NoError(t, r.SetPinned("analytics", "1.9.0", true))
+
+	// Re-recording keeps the original install time and pin
+	require.NoError(t, r.RecordInstall(plugins.InstalledVersion{Name: "analytics", Version: "1.9.0", Hash: "new"}))
+
+	r, err = registry.Open(dir, nil)
+	require.NoError(t, err)
+	versions, err := r.InstalledVersions("analytics")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, "2.0.0-rc.1", versions[0].Version)
+	assert.Equal(t, "1.10.0", versions[1].Version)
+	assert.Equal(t, "1.9.0", versions[2].Version)
+	assert.True(t, versions[2].Pinned)
+	assert.Equal(t, "new", versions[2].Hash)
+	assert.True(t, versions[2].InstalledAt.Equal(installedAt))
+
+	err = r.RemoveInstall("analytics", "1.9.0")
+	assert.True(t, errors.Is(err, registry.ErrVersionPinned))
+	require.NoError(t, r.SetPinned("analytics", "1.9.0", false))
+	require.NoError(t, r.RemoveInstall("analytics", "1.9.0"))
+
+	err = r.RemoveInstall("analytics", "1.9.0")
+	assert.True(t, errors.Is(err, registry.ErrVersionNotInstalled))
+	err = r.SetPinned("missing", "1.0.0", true)
+	assert.True(t, errors.Is(err, registry.ErrVersionNotInstalled))
+
+	versions, err = r.InstalledVersions("missing")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestOpen_CrashSafety(t *testing.T) {
+	dir := t.TempDir()
+
+	// A temporary file from an interrupted write is ignored and cleaned up
+	leftover := filepath.Join(dir, ".registry-123.tmp")
+	require.NoError(t, os.WriteFile(leftover, []byte("{partial"), 0644))
+
+	r, err := registry.Open(dir, nil)
+	require.NoError(t, err)
+	results, err := r.SearchPlugins(plugins.SearchCriteria{})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	_, err = os.Stat(leftover)
+	assert.True(t, os.IsNotExist(err))
+
+	// A corrupt index is reported rather than silently discarded
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "registry.json"), []byte("{not json"), 0644))
+	_, err = registry.Open(dir, nil)
+	assert.Error(t, err)
+
+	// An index from a newer release is refused
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "registry.json"), []byte(`{"format_version": 99}`), 0644))
+	_, err = registry.Open(dir, nil)
+	assert.True(t, errors.Is(err, registry.ErrUnsupportedIndex))
+}
@@ -0,0 +1,213 @@
+package plugins_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/mesh/routing"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+func (p *counterPlugin) SetSocketPath(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.socket = path
+}
+
+// pinned sends an "incr" request pinned to a version
+func pinned(t *testing.T, manager plugins.PluginManager, version string) plugins.PluginResponse {
+	t.Helper()
+	resp, err := manager.ExecutePlugin("counter", plugins.PluginRequest{
+		Method:  "incr",
+		Context: plugins.RequestContext{Headers: map[string]string{protocol.MetadataPluginVersion: version}},
+	})
+	require.NoError(t, err)
+	return resp
+}
+
+// pinnedRoutedVersion asks the plugin's mesh endpoint for its version,
+// pinned to version
+func pinnedRoutedVersion(t *testing.T, router *routing.ProtocolRouter, version string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	routed, err := router.RouteRequest(routing.WithPinnedVersion(ctx, version),
+		"plugin.counter", "/counter.v1.Counter/Version", []byte{})
+	require.NoError(t, err)
+	return string(routed)
+}
+
+func rolloutPhase(t *testing.T, manager *plugins.MeshPluginManager) plugins.RolloutPhase {
+	t.Helper()
+	status, err := manager.RolloutStatus("counter")
+	require.NoError(t, err)
+	return status.Phase
+}
+
+func TestRollout_PromotesAndHandsOffState(t *testing.T) {
+	manager, router, loader := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	for i := 0; i < 3; i++ {
+		incr(t, manager, "incr")
+	}
+
+	require.NoError(t, manager.StartRollout("counter", "2.0.0", plugins.RolloutPolicy{
+		Steps:        []int{0, 100},
+		StepInterval: 200 * time.Millisecond,
+		MinRequests:  5,
+	}))
+
+	// Both versions serve side by side, each with its own state
+	canary := pinned(t, manager, "2.0.0")
+	assert.Equal(t, "2.0.0", canary.Result["version"])
+	assert.Equal(t, 1, canary.Result["count"])
+	assert.Equal(t, 4, pinned(t, manager, "1.0.0").Result["count"])
+	assert.Equal(t, "1.0.0", routedVersion(t, router), "no unpinned traffic goes to the canary at 0%")
+	assert.Equal(t, "2.0.0", pinnedRoutedVersion(t, router, "2.0.0"))
+
+	// The first step is held until the old version has served enough
+	// requests for a baseline; the second until the new version has
+	var count int
+	require.Eventually(t, func() bool {
+		count = pinned(t, manager, "1.0.0").Result["count"].(int)
+		status, err := manager.RolloutStatus("counter")
+		return err == nil && status.Weight == 100
+	}, 5*time.Second, 5*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		pinned(t, manager, "2.0.0")
+	}
+	require.Eventually(t, func() bool { return rolloutPhase(t, manager) == plugins.RolloutPromoted },
+		5*time.Second, 20*time.Millisecond)
+
+	info, err := manager.GetPlugin("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", info.Version)
+	assert.Equal(t, "2.0.0", routedVersion(t, router))
+
+	resp := incr(t, manager, "incr")
+	assert.Equal(t, "2.0.0", resp.Result["version"])
+	assert.Equal(t, count+1, resp.Result["count"], "the old version's state is handed off at promotion")
+
+	assert.Equal(t, plugins.PluginStatusStopped, loader.plugins[0].GetStatus())
+	_, split := router.Split("plugin.counter")
+	assert.False(t, split)
+}
+
+func TestRollout_AbortsWhenCanaryFails(t *testing.T) {
+	manager, router, loader := newSwapManager(t)
+	loader.failing["2.0.0"] = true
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+
+	require.NoError(t, manager.StartRollout("counter", "2.0.0", plugins.RolloutPolicy{
+		Steps:        []int{50, 100},
+		StepInterval: 200 * time.Millisecond,
+		MinRequests:  5,
+	}))
+
+	require.Eventually(t, func() bool {
+		manager.ExecutePlugin("counter", plugins.PluginRequest{Method: "incr"})
+		return rolloutPhase(t, manager) == plugins.RolloutAborted
+	}, 5*time.Second, 5*time.Millisecond)
+
+	status, err := manager.RolloutStatus("counter")
+	require.NoError(t, err)
+	assert.Contains(t, status.Reason, "error rate")
+
+	info, err := manager.GetPlugin("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", info.Version)
+	assert.Equal(t, "1.0.0", pinnedRoutedVersion(t, router, "2.0.0"), "pins to the aborted version are ignored")
+	assert.Equal(t, "1.0.0", incr(t, manager, "incr").Result["version"])
+	assert.Equal(t, plugins.PluginStatusStopped, loader.plugins[1].GetStatus())
+}
+
+func TestRollout_ManualAbortAndPromote(t *testing.T) {
+	manager, router, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+
+	// Blue/green: the new version only takes pinned traffic until promoted
+	policy := plugins.RolloutPolicy{Steps: []int{0, 100}, StepInterval: time.Hour}
+	require.NoError(t, manager.StartRollout("counter", "2.0.0", policy))
+	assert.ErrorIs(t, manager.StartRollout("counter", "2.0.1", policy), plugins.ErrRolloutInProgress)
+	assert.ErrorIs(t, manager.HotSwapPlugin("counter", "2.0.1"), plugins.ErrRolloutInProgress)
+
+	require.NoError(t, manager.AbortRollout("counter"))
+	status, err := manager.RolloutStatus("counter")
+	require.NoError(t, err)
+	assert.Equal(t, plugins.RolloutAborted, status.Phase)
+	assert.Equal(t, "aborted by operator", status.Reason)
+	assert.ErrorIs(t, manager.AbortRollout("counter"), plugins.ErrNoRollout)
+
+	// The same version can be rolled out again
+	require.NoError(t, manager.StartRollout("counter", "2.0.0", policy))
+	assert.Equal(t, "2.0.0", pinnedRoutedVersion(t, router, "2.0.0"))
+	require.NoError(t, manager.PromoteRollout("counter"))
+
+	assert.Equal(t, plugins.RolloutPromoted, rolloutPhase(t, manager))
+	assert.Equal(t, "2.0.0", routedVersion(t, router))
+	assert.Equal(t, "2.0.0", incr(t, manager, "incr").Result["version"])
+
+	assert.Error(t, manager.StartRollout("counter", "2.0.0", policy), "already at that version")
+	_, err = manager.RolloutStatus("missing")
+	assert.ErrorIs(t, err, plugins.ErrNoRollout)
+}
+
+func TestRollout_RejectsInvalidSteps(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+
+	err := manager.StartRollout("counter", "2.0.0", plugins.RolloutPolicy{Steps: []int{50, 25, 100}})
+	assert.Error(t, err)
+	err = manager.StartRollout("counter", "2.0.0", plugins.RolloutPolicy{Steps: []int{5, 25}})
+	assert.Error(t, err)
+	assert.ErrorIs(t, manager.StartRollout("missing", "2.0.0", plugins.RolloutPolicy{}), plugins.ErrPluginNotFound)
+}
+
+func TestRollout_AbortsWhenCanaryIsSlow(t *testing.T) {
+	manager, _, loader := newSwapManager(t)
+	loader.slow["2.0.0"] = 20 * time.Millisecond
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+
+	require.NoError(t, manager.StartRollout("counter", "2.0.0", plugins.RolloutPolicy{
+		Steps:        []int{50, 100},
+		StepInterval: 200 * time.Millisecond,
+		MinRequests:  5,
+	}))
+
+	require.Eventually(t, func() bool {
+		manager.ExecutePlugin("counter", plugins.PluginRequest{Method: "incr"})
+		return rolloutPhase(t, manager) == plugins.RolloutAborted
+	}, 5*time.Second, time.Millisecond)
+
+	status, err := manager.RolloutStatus("counter")
+	require.NoError(t, err)
+	assert.Contains(t, status.Reason, "p99 latency")
+}
+
+func TestRollout_HoldsStepsUntilJudged(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+
+	require.NoError(t, manager.StartRollout("counter", "2.0.0", plugins.RolloutPolicy{
+		Steps:        []int{50, 100},
+		StepInterval: 20 * time.Millisecond,
+		MinRequests:  5,
+	}))
+
+	// Without requests the first step can't be judged, so it isn't left
+	time.Sleep(200 * time.Millisecond)
+	status, err := manager.RolloutStatus("counter")
+	require.NoError(t, err)
+	assert.Equal(t, plugins.RolloutProgressing, status.Phase)
+	assert.Equal(t, 50, status.Weight)
+
+	require.Eventually(t, func() bool {
+		manager.ExecutePlugin("counter", plugins.PluginRequest{Method: "incr"})
+		return rolloutPhase(t, manager) == plugins.RolloutPromoted
+	}, 5*time.Second, time.Millisecond)
+}
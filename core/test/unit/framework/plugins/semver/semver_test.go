@@ -0,0 +1,90 @@
+package semver_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/semver"
+)
+
+func TestParse(t *testing.T) {
+	v, err := semver.Parse("v1.2.3-beta.1+build.5")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v.Major)
+	assert.Equal(t, 2, v.Minor)
+	assert.Equal(t, 3, v.Patch)
+	assert.Equal(t, "beta.1", v.Prerelease)
+	assert.Equal(t, "build.5", v.Build)
+	assert.Equal(t, "1.2.3-beta.1+build.5", v.String())
+
+	v, err = semver.Parse("2.1")
+	require.NoError(t, err)
+	assert.Equal(t, "2.1.0", v.String())
+
+	for _, bad := range []string{"", "abc", "1.2.3.4", "1.-2", "1.2.3-"} {
+		_, err := semver.Parse(bad)
+		assert.ErrorIs(t, err, semver.ErrInvalidVersion, bad)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0", "2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		c, err := semver.Compare(ordered[i], ordered[i+1])
+		require.NoError(t, err)
+		assert.Equal(t, -1, c, "%s < %s", ordered[i], ordered[i+1])
+	}
+
+	c, err := semver.Compare("1.0.0+a", "1.0.0+b")
+	require.NoError(t, err)
+	assert.Equal(t, 0, c)
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"^1.2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{">=1.0 <2.0", []string{"1.0.0", "1.5.0"}, []string{"0.9.0", "2.0.0"}},
+		{">= 1.0, < 2", []string{"1.99.0"}, []string{"2.0.0"}},
+		{"1.x", []string{"1.0.0", "1.4.2"}, []string{"2.0.0"}},
+		{"1.2", []string{"1.2.0", "1.2.7"}, []string{"1.3.0"}},
+		{"=1.2.3", []string{"1.2.3"}, []string{"1.2.4"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"1.0 - 2.0", []string{"1.0.0", "2.0.5"}, []string{"2.1.0"}},
+		{"^1 || ^3", []string{"1.5.0", "3.0.0"}, []string{"2.0.0"}},
+		{"*", []string{"0.0.1", "9.9.9"}, []string{"1.0.0-beta"}},
+		{"", []string{"1.0.0"}, nil},
+		{">=1.0.0-beta", []string{"1.0.0-beta.2", "1.0.0", "1.1.0"}, []string{"1.1.0-alpha"}},
+	}
+
+	for _, tt := range tests {
+		c, err := semver.ParseConstraint(tt.constraint)
+		require.NoError(t, err, tt.constraint)
+		for _, v := range tt.match {
+			assert.True(t, c.Check(semver.MustParse(v)), "%s should match %s", v, tt.constraint)
+		}
+		for _, v := range tt.noMatch {
+			assert.False(t, c.Check(semver.MustParse(v)), "%s should not match %s", v, tt.constraint)
+		}
+	}
+}
+
+func TestParseConstraint_Invalid(t *testing.T) {
+	for _, bad := range []string{">=", "^abc", "1.2 ||", ">= 1.0 <"} {
+		_, err := semver.ParseConstraint(bad)
+		assert.ErrorIs(t, err, semver.ErrInvalidConstraint, bad)
+	}
+}
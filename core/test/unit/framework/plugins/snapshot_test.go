@@ -0,0 +1,198 @@
+package plugins_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+)
+
+func count(t *testing.T, manager plugins.PluginManager, name string) int {
+	t.Helper()
+	resp, err := manager.ExecutePlugin(name, plugins.PluginRequest{Method: "incr"})
+	require.NoError(t, err)
+	return resp.Result["count"].(int)
+}
+
+func TestNodeSnapshot_WaitsForInFlightRequests(t *testing.T) {
+	manager, router, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	incr(t, manager, "incr")
+
+	slow := make(chan plugins.PluginResponse, 1)
+	go func() { slow <- incr(t, manager, "300ms") }()
+	require.Eventually(t, func() bool { return router.InFlight("plugin.counter") == 1 },
+		time.Second, 5*time.Millisecond)
+
+	var archive bytes.Buffer
+	manifest, err := state.CreateNodeSnapshot(context.Background(), manager, &archive)
+	require.NoError(t, err)
+	<-slow
+
+	snapshot, err := state.ReadNodeSnapshot(&archive)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Plugins, snapshot.Manifest.Plugins)
+	assert.Equal(t, "2", string(snapshot.States["counter"]), "the in-flight request is in the snapshot")
+
+	// Requests are served again once the snapshot is taken
+	assert.Equal(t, 3, count(t, manager, "counter"))
+}
+
+func TestNodeSnapshot_RestoresOntoAnotherNode(t *testing.T) {
+	source, _, _ := newSwapManager(t)
+	require.NoError(t, source.LoadPlugin(spec("storage", "1.0.0")))
+	require.NoError(t, source.LoadPlugin(spec("counter", "1.0.0", dep("storage", "^1"))))
+	for i := 0; i < 3; i++ {
+		count(t, source, "counter")
+	}
+	count(t, source, "storage")
+
+	var archive bytes.Buffer
+	manifest, err := state.CreateNodeSnapshot(context.Background(), source, &archive)
+	require.NoError(t, err)
+	require.Len(t, manifest.Plugins, 2)
+	assert.Equal(t, "storage", manifest.Plugins[0].Spec.Name, "dependencies come first")
+	snapshot, err := state.ReadNodeSnapshot(bytes.NewReader(archive.Bytes()))
+	require.NoError(t, err)
+
+	t.Run("empty node", func(t *testing.T) {
+		target, _, _ := newSwapManager(t)
+		require.NoError(t, state.RestoreNodeSnapshot(context.Background(), target, snapshot))
+
+		assert.Equal(t, 4, count(t, target, "counter"))
+		assert.Equal(t, 2, count(t, target, "storage"))
+	})
+
+	t.Run("other versions loaded", func(t *testing.T) {
+		target, _, _ := newSwapManager(t)
+		require.NoError(t, target.LoadPlugin(spec("storage", "1.0.0")))
+		require.NoError(t, target.LoadPlugin(spec("counter", "1.2.0", dep("storage", "^1"))))
+		count(t, target, "counter")
+
+		require.NoError(t, state.RestoreNodeSnapshot(context.Background(), target, snapshot))
+
+		info, err := target.GetPlugin("counter")
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.0", info.Version)
+		assert.Equal(t, 4, count(t, target, "counter"))
+	})
+}
+
+func TestNodeSnapshot_RestoresThroughSnapshotAPI(t *testing.T) {
+	source, _, _ := newSwapManager(t)
+	require.NoError(t, source.LoadPlugin(spec("storage", "1.0.0")))
+	require.NoError(t, source.LoadPlugin(spec("counter", "1.0.0", dep("storage", "^1"))))
+	for i := 0; i < 3; i++ {
+		count(t, source, "counter")
+	}
+	sourceAPI := httptest.NewServer(state.SnapshotHandler(source))
+	defer sourceAPI.Close()
+
+	target, _, _ := newSwapManager(t)
+	require.NoError(t, target.LoadPlugin(spec("other", "1.0.0")))
+	targetAPI := httptest.NewServer(state.SnapshotHandler(target))
+	defer targetAPI.Close()
+
+	resp, err := http.Get(sourceAPI.URL)
+	require.NoError(t, err)
+	archive, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Post(targetAPI.URL, "application/gzip", bytes.NewReader(archive))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var manifest state.SnapshotManifest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&manifest))
+	assert.Len(t, manifest.Plugins, 2)
+
+	assert.Equal(t, 4, count(t, target, "counter"))
+	assert.Equal(t, 1, count(t, target, "storage"))
+	assert.Equal(t, 1, count(t, target, "other"), "plugins not in the snapshot are left alone")
+
+	// Snapshots that don't verify aren't restored
+	tampered := rewriteSnapshot(t, archive, func(name string, data []byte) []byte {
+		if name == "state/counter.state" {
+			return []byte("9")
+		}
+		return data
+	})
+	resp, err = http.Post(targetAPI.URL, "application/gzip", bytes.NewReader(tampered))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, 5, count(t, target, "counter"))
+
+	req, err := http.NewRequest(http.MethodDelete, targetAPI.URL, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestNodeSnapshot_RejectsTamperedState(t *testing.T) {
+	manager, _, _ := newSwapManager(t)
+	require.NoError(t, manager.LoadPlugin(spec("counter", "1.0.0")))
+	incr(t, manager, "incr")
+
+	var archive bytes.Buffer
+	_, err := state.CreateNodeSnapshot(context.Background(), manager, &archive)
+	require.NoError(t, err)
+
+	tampered := rewriteSnapshot(t, archive.Bytes(), func(name string, data []byte) []byte {
+		if name == "state/counter.state" {
+			return []byte("9")
+		}
+		return data
+	})
+	_, err = state.ReadNodeSnapshot(bytes.NewReader(tampered))
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+
+	_, err = state.ReadNodeSnapshot(bytes.NewReader([]byte("not a snapshot")))
+	assert.ErrorIs(t, err, state.ErrNotSnapshot)
+}
+
+// rewriteSnapshot copies a snapshot archive, passing each entry through edit
+func rewriteSnapshot(t *testing.T, archive []byte, edit func(name string, data []byte) []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+
+		data = edit(header.Name, data)
+		header.Size = int64(len(data))
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return out.Bytes()
+}
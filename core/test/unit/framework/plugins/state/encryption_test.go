@@ -0,0 +1,172 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+)
+
+func newEncryptedStorage(t *testing.T) (*state.EncryptedStateStorage, *state.FileStateStorage, string) {
+	t.Helper()
+	dir := t.TempDir()
+	backend, err := state.NewFileStateStorage(dir)
+	require.NoError(t, err)
+	storage, err := state.NewEncryptedStateStorage(backend, bytes.Repeat([]byte{7}, state.MasterKeySize))
+	require.NoError(t, err)
+	return storage, backend, dir
+}
+
+func TestEncryptedStorage_RoundTripsWithoutPlaintextOnDisk(t *testing.T) {
+	storage, backend, dir := newEncryptedStorage(t)
+	ctx := context.Background()
+	session := []byte(`{"session":"user-secret-token"}`)
+
+	require.NoError(t, storage.Save(ctx, "auth", "1.0.0", session))
+
+	loaded, err := storage.Load(ctx, "auth", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, session, loaded)
+
+	onDisk, err := os.ReadFile(filepath.Join(dir, "auth", "1.0.0.state"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(onDisk), "user-secret-token")
+
+	// The same state encrypts differently for every save and every plugin
+	require.NoError(t, storage.Save(ctx, "other", "1.0.0", session))
+	first, err := backend.Load(ctx, "auth", "1.0.0")
+	require.NoError(t, err)
+	second, err := backend.Load(ctx, "other", "1.0.0")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestEncryptedStorage_RejectsTamperedState(t *testing.T) {
+	storage, backend, _ := newEncryptedStorage(t)
+	ctx := context.Background()
+	require.NoError(t, storage.Save(ctx, "auth", "1.0.0", []byte(`{"session":"a"}`)))
+	sealed, err := backend.Load(ctx, "auth", "1.0.0")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		state []byte
+	}{
+		{"flipped bit", append(append([]byte(nil), sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1)},
+		{"truncated", sealed[:10]},
+		{"plaintext", []byte(`{"session":"forged"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Saved through the backend, so its checksum matches and only
+			// the encryption can catch it
+			require.NoError(t, backend.Save(ctx, "auth", "1.0.0", tt.state))
+
+			_, err := storage.Load(ctx, "auth", "1.0.0")
+			assert.ErrorIs(t, err, state.ErrStateCorrupted)
+			var integrityErr *state.IntegrityError
+			require.ErrorAs(t, err, &integrityErr)
+			assert.Equal(t, "auth", integrityErr.PluginID)
+		})
+	}
+}
+
+func TestEncryptedStorage_BindsStateToPluginAndVersion(t *testing.T) {
+	storage, backend, _ := newEncryptedStorage(t)
+	ctx := context.Background()
+	require.NoError(t, storage.Save(ctx, "auth", "1.0.0", []byte(`{"session":"a"}`)))
+	sealed, err := backend.Load(ctx, "auth", "1.0.0")
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Save(ctx, "auth", "2.0.0", sealed))
+	_, err = storage.Load(ctx, "auth", "2.0.0")
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+
+	require.NoError(t, backend.Save(ctx, "other", "1.0.0", sealed))
+	_, err = storage.Load(ctx, "other", "1.0.0")
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+
+	// A different master key can't read the state either
+	wrongKey, err := state.NewEncryptedStateStorage(backend, bytes.Repeat([]byte{8}, state.MasterKeySize))
+	require.NoError(t, err)
+	_, err = wrongKey.Load(ctx, "auth", "1.0.0")
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+}
+
+func TestFileStorage_ChecksumMismatchIsIntegrityError(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := state.NewFileStateStorage(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, storage.Save(ctx, "auth", "1.0.0", []byte(`{"a":1}`)))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "auth", "1.0.0.state"), []byte(`{"a":2}`), 0644))
+	_, err = storage.Load(ctx, "auth", "1.0.0")
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+}
+
+func TestLoadOrCreateMasterKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "state.key")
+
+	key, err := state.LoadOrCreateMasterKey(path)
+	require.NoError(t, err)
+	assert.Len(t, key, state.MasterKeySize)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	again, err := state.LoadOrCreateMasterKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	// Only the key is left in its directory
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte("abcd\n"), 0600))
+	_, err = state.LoadOrCreateMasterKey(path)
+	assert.ErrorIs(t, err, state.ErrInvalidMasterKey)
+
+	_, err = state.NewEncryptedStateStorage(state.NewMemoryStateStorage(), key[:16])
+	assert.ErrorIs(t, err, state.ErrInvalidMasterKey)
+}
+
+func TestEncryptedStorage_MigratesPlaintextState(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := state.NewFileStateStorage(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+	legacy := []byte(`{"session":"saved-before-encryption"}`)
+	require.NoError(t, backend.Save(ctx, "auth", "1.0.0", legacy))
+
+	key := bytes.Repeat([]byte{7}, state.MasterKeySize)
+	strict, err := state.NewEncryptedStateStorage(backend, key)
+	require.NoError(t, err)
+	_, err = strict.Load(ctx, "auth", "1.0.0")
+	assert.ErrorIs(t, err, state.ErrStateCorrupted, "plaintext is refused unless allowed")
+
+	migrating, err := state.NewEncryptedStateStorageWithConfig(backend, state.EncryptionConfig{
+		MasterKey:      key,
+		AllowPlaintext: true,
+	})
+	require.NoError(t, err)
+	loaded, err := migrating.Load(ctx, "auth", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, loaded)
+
+	// The state was encrypted in place as it was loaded
+	onDisk, err := os.ReadFile(filepath.Join(dir, "auth", "1.0.0.state"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(onDisk), "saved-before-encryption")
+	loaded, err = strict.Load(ctx, "auth", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, loaded)
+}
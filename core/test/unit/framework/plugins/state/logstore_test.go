@@ -0,0 +1,270 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+)
+
+// openLog opens a log whose background checkpoints and compactions won't
+// run during a test
+func openLog(t *testing.T, dir string, segmentSize int64) *state.LogStateStorage {
+	t.Helper()
+	storage, err := state.NewLogStateStorage(dir, state.LogStorageConfig{
+		SegmentSize:        segmentSize,
+		CheckpointInterval: time.Hour,
+		CompactionInterval: time.Hour,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	return matches
+}
+
+func loadString(t *testing.T, storage state.StateStorage, pluginID, version string) string {
+	t.Helper()
+	data, err := storage.Load(context.Background(), pluginID, version)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLogStorage_SavesLoadsAndReopens(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	storage := openLog(t, dir, 0)
+
+	require.NoError(t, storage.Save(ctx, "counter", "1.0.0", []byte(`{"n":1}`)))
+	require.NoError(t, storage.Save(ctx, "counter", "1.0.0", []byte(`{"n":2}`)))
+	require.NoError(t, storage.Save(ctx, "counter", "2.0.0", []byte(`{"n":3}`)))
+	require.NoError(t, storage.Save(ctx, "auth", "1.0.0", []byte(`{}`)))
+	require.NoError(t, storage.Delete(ctx, "auth", "1.0.0"))
+
+	assert.Equal(t, `{"n":2}`, loadString(t, storage, "counter", "1.0.0"))
+	_, err := storage.Load(ctx, "auth", "1.0.0")
+	assert.Error(t, err)
+
+	versions, err := storage.List(ctx, "counter")
+	require.NoError(t, err)
+	assert.Len(t, versions, 2)
+	for _, version := range versions {
+		assert.Equal(t, int64(7), version.Size)
+		assert.Len(t, version.Checksum, 64)
+	}
+
+	require.NoError(t, storage.Close())
+	assert.ErrorIs(t, storage.Save(ctx, "counter", "1.0.0", nil), state.ErrStorageClosed)
+
+	reopened := openLog(t, dir, 0)
+	assert.Equal(t, `{"n":2}`, loadString(t, reopened, "counter", "1.0.0"))
+	assert.Equal(t, `{"n":3}`, loadString(t, reopened, "counter", "2.0.0"))
+	_, err = reopened.Load(ctx, "auth", "1.0.0")
+	assert.Error(t, err, "deletes survive reopening")
+}
+
+func TestLogStorage_ReplaysRecordsAfterCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	storage := openLog(t, dir, 0)
+
+	require.NoError(t, storage.Save(ctx, "counter", "1.0.0", []byte("before")))
+	require.NoError(t, storage.Checkpoint())
+	require.NoError(t, storage.Save(ctx, "counter", "1.0.0", []byte("after")))
+	require.NoError(t, storage.Save(ctx, "counter", "2.0.0", []byte("new")))
+
+	// Opened as if the first one had crashed, without a final checkpoint
+	recovered := openLog(t, dir, 0)
+	assert.Equal(t, "after", loadString(t, recovered, "counter", "1.0.0"))
+	assert.Equal(t, "new", loadString(t, recovered, "counter", "2.0.0"))
+}
+
+func TestLogStorage_DropsTornTail(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	storage := openLog(t, dir, 0)
+	require.NoError(t, storage.Save(ctx, "counter", "1.0.0", []byte("kept")))
+	require.NoError(t, storage.Close())
+
+	// Half a record, as left by a crash in the middle of an append
+	segments := segmentFiles(t, dir)
+	require.Len(t, segments, 1)
+	file, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0x12, 0x34, 0x00, 0x00, 0x00, 0x40, 0x01})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.NoError(t, os.Remove(filepath.Join(dir, "index.json")))
+
+	recovered := openLog(t, dir, 0)
+	assert.Equal(t, "kept", loadString(t, recovered, "counter", "1.0.0"))
+	require.NoError(t, recovered.Save(ctx, "counter", "1.0.0", []byte("next")))
+	require.NoError(t, recovered.Close())
+
+	again := openLog(t, dir, 0)
+	assert.Equal(t, "next", loadString(t, again, "counter", "1.0.0"))
+}
+
+func TestLogStorage_CorruptedRecordIsIntegrityError(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	storage := openLog(t, dir, 0)
+	require.NoError(t, storage.Save(ctx, "auth", "1.0.0", []byte(`{"session":"abc"}`)))
+
+	segments := segmentFiles(t, dir)
+	data, err := os.ReadFile(segments[0])
+	require.NoError(t, err)
+	data[bytes.Index(data, []byte("abc"))] = 'x'
+	require.NoError(t, os.WriteFile(segments[0], data, 0644))
+
+	_, err = storage.Load(ctx, "auth", "1.0.0")
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+
+	var out bytes.Buffer
+	err = storage.LoadStream(ctx, "auth", "1.0.0", &out)
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+}
+
+func TestLogStorage_CompactsFrequentSaves(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	storage := openLog(t, dir, 4<<10)
+
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, storage.Save(ctx, fmt.Sprintf("plugin-%d", i%4), "1.0.0", []byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+	require.NoError(t, storage.Save(ctx, "removed", "1.0.0", []byte("gone")))
+	require.NoError(t, storage.Delete(ctx, "removed", "1.0.0"))
+	before := len(segmentFiles(t, dir))
+	assert.Greater(t, before, 10)
+
+	require.NoError(t, storage.Compact(ctx))
+	after := len(segmentFiles(t, dir))
+	assert.Less(t, after, 4, "overwritten segments are removed")
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, fmt.Sprintf(`{"n":%d}`, 1996+i), loadString(t, storage, fmt.Sprintf("plugin-%d", i), "1.0.0"))
+	}
+
+	// Both from the checkpoint written after compacting and by replaying
+	// the whole compacted log
+	require.NoError(t, storage.Close())
+	for _, withCheckpoint := range []bool{true, false} {
+		if !withCheckpoint {
+			require.NoError(t, os.Remove(filepath.Join(dir, "index.json")))
+		}
+		reopened := openLog(t, dir, 4<<10)
+		for i := 0; i < 4; i++ {
+			assert.Equal(t, fmt.Sprintf(`{"n":%d}`, 1996+i), loadString(t, reopened, fmt.Sprintf("plugin-%d", i), "1.0.0"))
+		}
+		_, err := reopened.Load(ctx, "removed", "1.0.0")
+		assert.Error(t, err)
+		require.NoError(t, reopened.Close())
+	}
+}
+
+func TestLogStorage_StreamsState(t *testing.T) {
+	ctx := context.Background()
+	storage := openLog(t, t.TempDir(), 0)
+	large := strings.Repeat("state", 100<<10)
+
+	require.NoError(t, storage.SaveStream(ctx, "counter", "1.0.0", strings.NewReader(large)))
+	var out bytes.Buffer
+	require.NoError(t, storage.LoadStream(ctx, "counter", "1.0.0", &out))
+	assert.Equal(t, large, out.String())
+}
+
+func TestLogStorage_ConcurrentSavesAndCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	storage := openLog(t, dir, 2<<10)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 300; i++ {
+				assert.NoError(t, storage.Save(ctx, fmt.Sprintf("plugin-%d", w), "1.0.0", []byte(fmt.Sprint(i))))
+				if i%50 == 0 {
+					assert.NoError(t, storage.Compact(ctx))
+				}
+				_, err := storage.Load(ctx, fmt.Sprintf("plugin-%d", w), "1.0.0")
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	require.NoError(t, storage.Close())
+
+	reopened := openLog(t, dir, 2<<10)
+	for w := 0; w < 4; w++ {
+		assert.Equal(t, "299", loadString(t, reopened, fmt.Sprintf("plugin-%d", w), "1.0.0"))
+	}
+}
+
+// blockedWriter takes the first write, then blocks until released
+type blockedWriter struct {
+	buf     bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockedWriter) Write(p []byte) (int, error) {
+	if w.started != nil {
+		close(w.started)
+		w.started = nil
+		<-w.release
+	}
+	return w.buf.Write(p)
+}
+
+func TestLogStorage_StreamsWithoutBlockingSavesOrCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	storage := openLog(t, dir, 4<<10)
+	large := strings.Repeat("state", 2<<10)
+	require.NoError(t, storage.Save(ctx, "counter", "1.0.0", []byte(large)))
+
+	started := make(chan struct{})
+	out := &blockedWriter{started: started, release: make(chan struct{})}
+	streamed := make(chan error, 1)
+	go func() { streamed <- storage.LoadStream(ctx, "counter", "1.0.0", out) }()
+	<-started
+
+	// While the stream waits on its writer, the state is overwritten and
+	// its segment compacted away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, storage.Save(ctx, "counter", "1.0.0", []byte(fmt.Sprint(i))))
+		}
+		assert.NoError(t, storage.Compact(ctx))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("saves blocked behind a stream")
+	}
+	assert.Equal(t, "99", loadString(t, storage, "counter", "1.0.0"))
+
+	close(out.release)
+	require.NoError(t, <-streamed)
+	assert.Equal(t, large, out.buf.String(), "the stream reads the state it started with")
+}
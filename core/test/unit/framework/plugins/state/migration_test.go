@@ -0,0 +1,215 @@
+package state_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+)
+
+// fieldMigrator migrates between two versions by setting a field, recording
+// every call in calls
+type fieldMigrator struct {
+	from, to string
+	field    string
+	value    interface{}
+	calls    *[]string
+	invalid  bool
+}
+
+func (f fieldMigrator) CanMigrate(fromVersion, toVersion string) bool {
+	return fromVersion == f.from && toVersion == f.to
+}
+
+func (f fieldMigrator) Migrate(ctx context.Context, fromState []byte, fromVersion, toVersion string) ([]byte, error) {
+	*f.calls = append(*f.calls, fromVersion+"->"+toVersion)
+	var fields map[string]interface{}
+	if err := json.Unmarshal(fromState, &fields); err != nil {
+		return nil, err
+	}
+	fields["version"] = toVersion
+	if f.value == nil {
+		delete(fields, f.field)
+	} else {
+		fields[f.field] = f.value
+	}
+	return json.Marshal(fields)
+}
+
+func (f fieldMigrator) Validate(state []byte, version string) error {
+	if f.invalid {
+		return errors.New("missing counters")
+	}
+	return nil
+}
+
+// migratorRegistry is the part of the state manager migrators are
+// registered with
+type migratorRegistry interface {
+	RegisterMigrator(pluginID, fromVersion, toVersion string, migrator state.StateMigrator) error
+}
+
+// registerChain registers upgrades from 1.0.0 to 4.0.0 and downgrades from
+// 3.0.0 to 1.0.0, one version at a time
+func registerChain(t *testing.T, registry migratorRegistry, calls *[]string) {
+	t.Helper()
+	edges := []fieldMigrator{
+		{from: "1.0.0", to: "2.0.0", field: "labels", value: map[string]interface{}{}},
+		{from: "2.0.0", to: "3.0.0", field: "history", value: []interface{}{}},
+		{from: "3.0.0", to: "4.0.0", field: "labels"},
+		{from: "3.0.0", to: "2.0.0", field: "history"},
+		{from: "2.0.0", to: "1.0.0", field: "labels"},
+	}
+	for _, edge := range edges {
+		edge.calls = calls
+		require.NoError(t, registry.RegisterMigrator("counter", edge.from, edge.to, edge))
+	}
+}
+
+func TestMigration_ChainsUpgradesAndDowngrades(t *testing.T) {
+	var calls []string
+	storage := state.NewMemoryStateStorage()
+	manager := state.NewStateManager(storage, &state.JSONSerializer{})
+	registerChain(t, manager, &calls)
+	ctx := context.Background()
+
+	require.NoError(t, manager.SaveState(ctx, "counter", "1.0.0", map[string]interface{}{
+		"version":  "1.0.0",
+		"counters": map[string]interface{}{"a": 1},
+	}))
+
+	migrated, err := manager.MigrateState(ctx, "counter", "1.0.0", "4.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0->2.0.0", "2.0.0->3.0.0", "3.0.0->4.0.0"}, calls)
+	assert.JSONEq(t, `{"version":"4.0.0","counters":{"a":1},"history":[]}`, string(migrated))
+
+	saved, err := storage.Load(ctx, "counter", "4.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, migrated, saved)
+
+	path, err := manager.MigrationPath("counter", "3.0.0", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3.0.0", "2.0.0", "1.0.0"}, path)
+
+	_, err = manager.MigrationPath("counter", "4.0.0", "1.0.0")
+	assert.ErrorIs(t, err, state.ErrNoMigrationPath)
+	_, err = manager.MigrateState(ctx, "counter", "4.0.0", "1.0.0")
+	assert.ErrorIs(t, err, state.ErrNoMigrationPath)
+}
+
+func TestMigration_DryRunReportsChangesWithoutSaving(t *testing.T) {
+	var calls []string
+	storage := state.NewMemoryStateStorage()
+	manager := state.NewStateManager(storage, &state.JSONSerializer{})
+	registerChain(t, manager, &calls)
+	ctx := context.Background()
+
+	require.NoError(t, manager.SaveState(ctx, "counter", "3.0.0", map[string]interface{}{
+		"version":  "3.0.0",
+		"counters": map[string]interface{}{"a": 1},
+		"labels":   map[string]interface{}{"a": "first"},
+		"history":  []interface{}{},
+	}))
+
+	report, err := manager.DryRunMigration(ctx, "counter", "3.0.0", "1.0.0")
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"3.0.0", "2.0.0", "1.0.0"}, report.Path())
+	require.Len(t, report.Steps, 2)
+	assert.Equal(t, []string{"history"}, report.Steps[0].Removed)
+	assert.Equal(t, []string{"version"}, report.Steps[0].Changed)
+	assert.Empty(t, report.Steps[0].Added)
+	assert.Equal(t, []string{"labels"}, report.Steps[1].Removed)
+	assert.Less(t, report.Steps[1].SizeAfter, report.Steps[1].SizeBefore)
+
+	_, err = storage.Load(ctx, "counter", "1.0.0")
+	assert.Error(t, err, "a dry run saves nothing")
+}
+
+func TestMigration_RejectsInvalidState(t *testing.T) {
+	var calls []string
+	storage := state.NewMemoryStateStorage()
+	manager := state.NewStateManager(storage, &state.JSONSerializer{})
+	registerChain(t, manager, &calls)
+	ctx := context.Background()
+
+	require.NoError(t, manager.RegisterMigrator("counter", "4.0.0", "5.0.0",
+		fieldMigrator{from: "4.0.0", to: "5.0.0", field: "counters", calls: &calls, invalid: true}))
+	require.NoError(t, manager.SaveState(ctx, "counter", "4.0.0", map[string]interface{}{"version": "4.0.0"}))
+
+	_, err := manager.MigrateState(ctx, "counter", "4.0.0", "5.0.0")
+	assert.ErrorContains(t, err, "invalid state")
+	_, err = storage.Load(ctx, "counter", "5.0.0")
+	assert.Error(t, err)
+}
+
+func TestMigration_RegisterChecksEdge(t *testing.T) {
+	var calls []string
+	manager := state.NewStateManager(state.NewMemoryStateStorage(), &state.JSONSerializer{})
+	registerChain(t, manager, &calls)
+
+	migrator := fieldMigrator{from: "1.0.0", to: "2.0.0", calls: &calls}
+	assert.Error(t, manager.RegisterMigrator("counter", "2.0.0", "3.0.0", migrator))
+	assert.Error(t, manager.RegisterMigrator("counter", "1.0.0", "1.0.0", migrator))
+}
+
+// byteMigrator migrates binary state by appending a byte
+type byteMigrator struct {
+	from, to string
+	suffix   byte
+}
+
+func (b byteMigrator) CanMigrate(fromVersion, toVersion string) bool {
+	return fromVersion == b.from && toVersion == b.to
+}
+
+func (b byteMigrator) Migrate(ctx context.Context, fromState []byte, fromVersion, toVersion string) ([]byte, error) {
+	return append(append([]byte(nil), fromState...), b.suffix), nil
+}
+
+func TestMigration_BinaryState(t *testing.T) {
+	storage := state.NewMemoryStateStorage()
+	manager := state.NewStateManager(storage, &state.JSONSerializer{})
+	ctx := context.Background()
+	require.NoError(t, manager.RegisterMigrator("blob", "1.0.0", "2.0.0", byteMigrator{from: "1.0.0", to: "2.0.0", suffix: 0xff}))
+	require.NoError(t, storage.Save(ctx, "blob", "1.0.0", []byte{0x00, 0x01}))
+
+	// Plugins without a serializer may keep state in any format
+	migrated, err := manager.MigrateState(ctx, "blob", "1.0.0", "2.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x01, 0xff}, migrated)
+
+	// Once its state is declared JSON, it must stay JSON
+	manager.RegisterSerializer("blob", &state.JSONSerializer{})
+	_, err = manager.MigrateState(ctx, "blob", "1.0.0", "2.0.0")
+	assert.ErrorContains(t, err, "invalid state")
+}
+
+func TestMigration_RegisterWhileMigrating(t *testing.T) {
+	manager := state.NewStateManager(state.NewMemoryStateStorage(), &state.JSONSerializer{})
+	for i := 1; i < 20; i++ {
+		from, to := fmt.Sprintf("%d.0.0", i), fmt.Sprintf("%d.0.0", i+1)
+		require.NoError(t, manager.RegisterMigrator("blob", from, to, byteMigrator{from: from, to: to}))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			from, to := fmt.Sprintf("%d.0.0", i%19+1), fmt.Sprintf("%d.0.0", i%19+2)
+			manager.RegisterMigrator("blob", from, to, byteMigrator{from: from, to: to, suffix: byte(i)})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		path, err := manager.MigrationPath("blob", "1.0.0", "20.0.0")
+		require.NoError(t, err)
+		assert.Len(t, path, 20)
+	}
+	<-done
+}
@@ -0,0 +1,324 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/state"
+)
+
+// fakeSource serves plugin state kept in memory
+type fakeSource struct {
+	mu      sync.Mutex
+	plugins map[string]string // name to version
+	state   map[string][]byte
+	exports map[string]int
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		plugins: make(map[string]string),
+		state:   make(map[string][]byte),
+		exports: make(map[string]int),
+	}
+}
+
+func (s *fakeSource) set(name, version string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plugins[name] = version
+	s.state[name] = data
+}
+
+func (s *fakeSource) exported(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exports[name]
+}
+
+func (s *fakeSource) ListPlugins() []plugins.PluginInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var infos []plugins.PluginInfo
+	for name, version := range s.plugins {
+		infos = append(infos, plugins.PluginInfo{Name: name, Version: version})
+	}
+	return infos
+}
+
+func (s *fakeSource) ExportPluginState(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exports[name]++
+	data, exists := s.state[name]
+	if !exists {
+		return nil, plugins.ErrStateNotSupported
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *fakeSource) ImportPluginState(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func scheduledCheckpoint(id string, at time.Time, size int64) state.Checkpoint {
+	return state.Checkpoint{
+		ID:        id,
+		PluginID:  "counter",
+		Timestamp: at,
+		Size:      size,
+		State:     make([]byte, size),
+		Metadata:  map[string]interface{}{state.MetadataScheduled: true},
+	}
+}
+
+func checkpointIDs(t *testing.T, store state.CheckpointStore, pluginID string) map[string]bool {
+	t.Helper()
+	checkpoints, err := store.ListCheckpoints(context.Background(), pluginID)
+	require.NoError(t, err)
+	ids := make(map[string]bool)
+	for _, checkpoint := range checkpoints {
+		ids[checkpoint.ID] = true
+	}
+	return ids
+}
+
+func TestScheduler_PrunesGrandfatherFatherSon(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryRollbackManager(state.NewMemoryStateStorage())
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	// Every 20 minutes for three days
+	for i := 0; i < 3*24*3; i++ {
+		at := now.Add(-time.Duration(i) * 20 * time.Minute)
+		require.NoError(t, store.SaveCheckpoint(ctx, scheduledCheckpoint(fmt.Sprint(i), at, 10)))
+	}
+	// Hot-swap checkpoints aren't the scheduler's to remove
+	require.NoError(t, store.SaveCheckpoint(ctx, state.Checkpoint{ID: "swap", PluginID: "counter", Timestamp: now.Add(-72 * time.Hour)}))
+
+	scheduler := state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source: newFakeSource(),
+		Store:  store,
+		Policy: state.CheckpointPolicy{Retention: state.RetentionPolicy{Last: 2, Hourly: 4, Daily: 3}},
+	})
+	require.NoError(t, scheduler.Prune(ctx, "counter"))
+
+	ids := checkpointIDs(t, store, "counter")
+	expected := map[string]bool{
+		"0": true, "1": true, // the last two, 12:30 and 12:10
+		"2": true, "5": true, "8": true, // the latest of 11:00, 10:00 and 09:00
+		"38": true, "110": true, // the latest of March 9 and March 8, both 23:50
+		"swap": true,
+	}
+	assert.Equal(t, expected, ids)
+}
+
+func TestScheduler_PrunesWithoutLast(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryRollbackManager(state.NewMemoryStateStorage())
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	// Every 20 minutes for three days
+	for i := 0; i < 3*24*3; i++ {
+		at := now.Add(-time.Duration(i) * 20 * time.Minute)
+		require.NoError(t, store.SaveCheckpoint(ctx, scheduledCheckpoint(fmt.Sprint(i), at, 10)))
+	}
+
+	scheduler := state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source: newFakeSource(),
+		Store:  store,
+		Policy: state.CheckpointPolicy{Retention: state.RetentionPolicy{Hourly: 24, Daily: 7}},
+	})
+	require.NoError(t, scheduler.Prune(ctx, "counter"))
+
+	// The latest of each of the last 24 hours: 12:30, then xx:50 back to 13:50
+	expected := map[string]bool{"0": true}
+	for i := 2; i < 3*23; i += 3 {
+		expected[fmt.Sprint(i)] = true
+	}
+	// The latest of March 9, 8 and 7, all 23:50
+	expected["110"] = true
+	expected["182"] = true
+	assert.Equal(t, expected, checkpointIDs(t, store, "counter"))
+}
+
+func TestScheduler_EnforcesSizeBudget(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryRollbackManager(state.NewMemoryStateStorage())
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.SaveCheckpoint(ctx, scheduledCheckpoint(fmt.Sprint(i), now.Add(-time.Duration(i)*time.Minute), 40)))
+	}
+
+	scheduler := state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source:    newFakeSource(),
+		Store:     store,
+		Overrides: map[string]state.CheckpointPolicy{"counter": {Retention: state.RetentionPolicy{MaxBytes: 100}}},
+	})
+	require.NoError(t, scheduler.Prune(ctx, "counter"))
+	assert.Equal(t, map[string]bool{"0": true, "1": true}, checkpointIDs(t, store, "counter"))
+
+	// The newest checkpoint is kept even when it alone is over budget
+	scheduler = state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source: newFakeSource(),
+		Store:  store,
+		Policy: state.CheckpointPolicy{Retention: state.RetentionPolicy{MaxBytes: 10}},
+	})
+	require.NoError(t, scheduler.Prune(ctx, "counter"))
+	assert.Equal(t, map[string]bool{"0": true}, checkpointIDs(t, store, "counter"))
+}
+
+func TestScheduler_CheckpointsAfterRequestsAndRestores(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource()
+	source.set("counter", "1.0.0", []byte(`{"n":0}`))
+	source.set("stateless", "1.0.0", nil)
+	source.mu.Lock()
+	delete(source.state, "stateless")
+	source.mu.Unlock()
+	store := state.NewMemoryRollbackManager(state.NewMemoryStateStorage())
+
+	scheduler := state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source: source,
+		Store:  store,
+		Policy: state.CheckpointPolicy{AfterRequests: 3, Methods: []string{"increment"}},
+		Tick:   time.Hour,
+	})
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// Plugins are checkpointed as soon as they are found
+	require.Eventually(t, func() bool { return len(checkpointIDs(t, store, "counter")) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, source.exported("stateless"))
+
+	source.set("counter", "1.0.0", []byte(`{"n":3}`))
+	for i := 0; i < 2; i++ {
+		scheduler.ObserveRequest("counter", plugins.PluginRequest{Method: "increment"}, nil)
+	}
+	scheduler.ObserveRequest("counter", plugins.PluginRequest{Method: "get"}, nil)
+	scheduler.ObserveRequest("counter", plugins.PluginRequest{Method: "increment"}, fmt.Errorf("failed"))
+	for i := 0; i < 5; i++ {
+		scheduler.ObserveRequest("stateless", plugins.PluginRequest{Method: "increment"}, nil)
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, checkpointIDs(t, store, "counter"), 1, "only successful state-changing requests count")
+
+	scheduler.ObserveRequest("counter", plugins.PluginRequest{Method: "increment"}, nil)
+	require.Eventually(t, func() bool { return len(checkpointIDs(t, store, "counter")) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, source.exported("stateless"), "plugins without state aren't exported again")
+
+	checkpoints, err := store.ListCheckpoints(ctx, "counter")
+	require.NoError(t, err)
+	var first state.Checkpoint
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Metadata[state.MetadataTrigger] == state.TriggerLoaded {
+			first = checkpoint
+		}
+	}
+	require.NotEmpty(t, first.ID)
+	assert.Equal(t, "1.0.0", first.Metadata["version"])
+
+	require.NoError(t, scheduler.Restore(ctx, "counter", first.ID))
+	restored, err := source.ExportPluginState("counter")
+	require.NoError(t, err)
+	assert.Equal(t, `{"n":0}`, string(restored))
+
+	assert.Error(t, scheduler.Restore(ctx, "other", first.ID))
+}
+
+func TestScheduler_CheckpointsOnIntervalWhenStateChanges(t *testing.T) {
+	source := newFakeSource()
+	source.set("counter", "1.0.0", []byte(`{"n":0}`))
+	store := state.NewMemoryRollbackManager(state.NewMemoryStateStorage())
+
+	scheduler := state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source: source,
+		Store:  store,
+		Policy: state.CheckpointPolicy{Interval: 20 * time.Millisecond},
+		Tick:   5 * time.Millisecond,
+	})
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	require.Eventually(t, func() bool { return source.exported("counter") >= 3 }, 5*time.Second, 5*time.Millisecond)
+	assert.Len(t, checkpointIDs(t, store, "counter"), 1, "unchanged state isn't checkpointed again")
+
+	source.set("counter", "1.0.0", []byte(`{"n":1}`))
+	require.Eventually(t, func() bool { return len(checkpointIDs(t, store, "counter")) == 2 }, 5*time.Second, 5*time.Millisecond)
+
+	// A manual checkpoint is taken whether or not state changed
+	_, err := scheduler.Checkpoint(context.Background(), "counter")
+	require.NoError(t, err)
+	assert.Len(t, checkpointIDs(t, store, "counter"), 3)
+
+	_, err = scheduler.Checkpoint(context.Background(), "missing")
+	assert.ErrorIs(t, err, plugins.ErrPluginNotFound)
+}
+
+func TestScheduler_ForgetsUnloadedPlugins(t *testing.T) {
+	source := newFakeSource()
+	source.set("counter", "1.0.0", []byte(`{"n":0}`))
+	store := state.NewMemoryRollbackManager(state.NewMemoryStateStorage())
+
+	scheduler := state.NewCheckpointScheduler(state.SchedulerConfig{
+		Source: source,
+		Store:  store,
+		Policy: state.CheckpointPolicy{AfterRequests: 100},
+		Tick:   5 * time.Millisecond,
+	})
+	var _ plugins.BackgroundObserver = scheduler
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	require.Eventually(t, func() bool { return len(checkpointIDs(t, store, "counter")) == 1 }, 5*time.Second, 5*time.Millisecond)
+
+	// Reloaded between ticks, the plugin is checkpointed as newly loaded
+	source.set("counter", "1.0.0", []byte(`{"n":1}`))
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, checkpointIDs(t, store, "counter"), 1)
+	scheduler.ForgetPlugin("counter")
+	require.Eventually(t, func() bool { return len(checkpointIDs(t, store, "counter")) == 2 }, 5*time.Second, 5*time.Millisecond)
+
+	checkpoints, err := store.ListCheckpoints(context.Background(), "counter")
+	require.NoError(t, err)
+	for _, checkpoint := range checkpoints {
+		assert.Equal(t, state.TriggerLoaded, checkpoint.Metadata[state.MetadataTrigger])
+	}
+}
+
+func TestEncryptedCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	backend := state.NewMemoryRollbackManager(state.NewMemoryStateStorage())
+	store, err := state.NewEncryptedCheckpointStore(backend, bytes.Repeat([]byte{7}, state.MasterKeySize))
+	require.NoError(t, err)
+
+	checkpoint := scheduledCheckpoint("a", time.Now(), 0)
+	checkpoint.State = []byte(`{"session":"user-secret-token"}`)
+	require.NoError(t, store.SaveCheckpoint(ctx, checkpoint))
+
+	raw, err := backend.LoadCheckpoint(ctx, "a")
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw.State), "user-secret-token")
+
+	loaded, err := store.LoadCheckpoint(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint.State, loaded.State)
+
+	// State moved to another checkpoint doesn't authenticate
+	raw.ID = "b"
+	require.NoError(t, backend.SaveCheckpoint(ctx, raw))
+	_, err = store.LoadCheckpoint(ctx, "b")
+	assert.ErrorIs(t, err, state.ErrStateCorrupted)
+}
@@ -0,0 +1,72 @@
+package plugins_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+)
+
+// upperPlugin streams its request body back upper-cased
+type upperPlugin struct {
+	fakePlugin
+}
+
+func (p *upperPlugin) HandleStream(ctx context.Context, req plugins.PluginRequest, in io.Reader, out io.Writer) (plugins.PluginResponse, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return plugins.PluginResponse{}, err
+	}
+	if _, err := out.Write(bytes.ToUpper(data)); err != nil {
+		return plugins.PluginResponse{}, err
+	}
+	return plugins.PluginResponse{ID: req.ID, Success: true, Result: map[string]interface{}{"bytes": len(data)}}, nil
+}
+
+type upperLoader struct {
+	fakeLoader
+}
+
+func (l *upperLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin, error) {
+	return &upperPlugin{fakePlugin{spec: spec}}, nil
+}
+
+func TestManager_OpenPluginStream(t *testing.T) {
+	manager := plugins.NewManager(registry.New(nil), &upperLoader{}, nil, nil, nil)
+	require.NoError(t, manager.LoadPlugin(spec("upper", "1.0.0")))
+
+	stream, err := manager.OpenPluginStream(context.Background(), "upper",
+		plugins.PluginRequest{ID: "r1", Method: "upper"}, plugins.StreamBidi)
+	require.NoError(t, err)
+
+	body := strings.Repeat("stream me ", 10000)
+	go func() {
+		io.Copy(stream, strings.NewReader(body))
+		stream.CloseSend()
+	}()
+
+	received, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToUpper(body), string(received))
+
+	resp, err := stream.Response()
+	require.NoError(t, err)
+	assert.Equal(t, "r1", resp.ID)
+	assert.Equal(t, len(body), resp.Result["bytes"])
+
+	// Plugins that don't handle streams can't open them
+	_, err = manager.OpenPluginStream(context.Background(), "missing", plugins.PluginRequest{}, plugins.StreamClient)
+	assert.ErrorIs(t, err, plugins.ErrPluginNotFound)
+
+	plain := plugins.NewManager(registry.New(nil), &fakeLoader{}, nil, nil, nil)
+	require.NoError(t, plain.LoadPlugin(spec("plain", "1.0.0")))
+	_, err = plain.OpenPluginStream(context.Background(), "plain", plugins.PluginRequest{}, plugins.StreamClient)
+	assert.ErrorIs(t, err, plugins.ErrStreamingUnsupported)
+}
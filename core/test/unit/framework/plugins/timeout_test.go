@@ -0,0 +1,55 @@
+package plugins_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/registry"
+)
+
+// blockingPlugin handles requests by waiting for their context to end
+type blockingPlugin struct {
+	fakePlugin
+}
+
+func (p *blockingPlugin) Handle(ctx context.Context, req plugins.PluginRequest) (plugins.PluginResponse, error) {
+	<-ctx.Done()
+	return plugins.PluginResponse{}, ctx.Err()
+}
+
+type blockingLoader struct {
+	fakeLoader
+}
+
+func (l *blockingLoader) LoadPlugin(spec plugins.PluginSpec) (plugins.Plugin, error) {
+	return &blockingPlugin{fakePlugin{spec: spec}}, nil
+}
+
+func TestManager_ExecutePluginContextTimeout(t *testing.T) {
+	manager := plugins.NewManager(registry.New(nil), &blockingLoader{}, nil, nil, nil)
+	require.NoError(t, manager.LoadPlugin(spec("slow", "1.0.0")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := manager.ExecutePluginContext(ctx, "slow", plugins.PluginRequest{ID: "r1", Method: "query"})
+
+	require.ErrorIs(t, err, plugins.ErrTimeout)
+	var timeout *plugins.TimeoutError
+	require.True(t, errors.As(err, &timeout))
+	assert.Equal(t, "slow", timeout.Plugin)
+	assert.Equal(t, "query", timeout.Method)
+	assert.True(t, timeout.Timeout())
+
+	// Cancellation is not a timeout
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = manager.ExecutePluginContext(ctx, "slow", plugins.PluginRequest{ID: "r2"})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, plugins.ErrTimeout)
+}
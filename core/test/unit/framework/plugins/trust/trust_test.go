@@ -0,0 +1,164 @@
+package trust_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/archive"
+	"github.com/blackhole-pro/blackhole/core/internal/framework/plugins/trust"
+)
+
+var manifest = archive.Manifest{Name: "node", Version: "1.0.1"}
+
+const checksums = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef  plugin.yaml\n"
+
+func newSigner(t *testing.T, publisher string) (*trust.Signer, trust.Key) {
+	signer, key, err := trust.GenerateKey(publisher)
+	require.NoError(t, err)
+	return signer, key
+}
+
+func sign(t *testing.T, signer *trust.Signer) *archive.Signature {
+	sig, err := signer.Sign(manifest, []byte(checksums))
+	require.NoError(t, err)
+	return sig
+}
+
+func TestVerifier_Policies(t *testing.T) {
+	official, officialKey := newSigner(t, "Blackhole Foundation")
+	stranger, _ := newSigner(t, "Stranger")
+
+	store := trust.NewStore()
+	officialKey.Tier = trust.TierOfficial
+	require.NoError(t, store.AddKey(officialKey))
+
+	strict := trust.NewVerifier(store, trust.Policy{Mode: trust.ModeRequire}, nil)
+	warn := trust.NewVerifier(store, trust.Policy{Mode: trust.ModeWarn}, nil)
+	allow := trust.NewVerifier(store, trust.Policy{Mode: trust.ModeAllow}, nil)
+
+	good := sign(t, official)
+	for _, v := range []*trust.Verifier{strict, warn, allow} {
+		assert.NoError(t, v.VerifySignature(manifest, []byte(checksums), good))
+	}
+
+	// Unsigned and untrusted packages only fail when signatures are required
+	err := strict.VerifySignature(manifest, []byte(checksums), nil)
+	assert.True(t, errors.Is(err, trust.ErrUnsigned))
+	assert.NoError(t, warn.VerifySignature(manifest, []byte(checksums), nil))
+	assert.NoError(t, allow.VerifySignature(manifest, []byte(checksums), nil))
+
+	err = strict.VerifySignature(manifest, []byte(checksums), sign(t, stranger))
+	assert.True(t, errors.Is(err, trust.ErrUnknownKey))
+	assert.Contains(t, err.Error(), `"Stranger"`)
+	assert.NoError(t, warn.VerifySignature(manifest, []byte(checksums), sign(t, stranger)))
+
+	// Tampered contents fail under every policy and name the publisher
+	for _, v := range []*trust.Verifier{strict, warn, allow} {
+		err := v.VerifySignature(manifest, []byte(checksums+"extra\n"), good)
+		assert.True(t, errors.Is(err, trust.ErrBadSignature))
+
+		var verr *trust.VerificationError
+		require.True(t, errors.As(err, &verr))
+		assert.Equal(t, "Blackhole Foundation", verr.Publisher)
+		assert.Equal(t, "node", verr.Plugin)
+	}
+
+	// A signature can't be moved to another plugin
+	other := archive.Manifest{Name: "storage", Version: "1.0.1"}
+	err = allow.VerifySignature(other, []byte(checksums), good)
+	assert.True(t, errors.Is(err, trust.ErrBadSignature))
+
+	// Claiming another publisher's name is caught
+	forged := *good
+	forged.Publisher = "Someone Else"
+	err = strict.VerifySignature(manifest, []byte(checksums), &forged)
+	assert.True(t, errors.Is(err, trust.ErrPublisherMismatch))
+}
+
+func TestVerifier_Tiers(t *testing.T) {
+	community, key := newSigner(t, "Community Dev")
+	key.Tier = trust.TierCommunity
+	store := trust.NewStore()
+	require.NoError(t, store.AddKey(key))
+
+	officialOnly := trust.NewVerifier(store, trust.Policy{
+		Mode:  trust.ModeRequire,
+		Tiers: []trust.Tier{trust.TierOfficial},
+	}, nil)
+	err := officialOnly.VerifySignature(manifest, []byte(checksums), sign(t, community))
+	assert.True(t, errors.Is(err, trust.ErrTierNotAllowed))
+}
+
+func TestVerifier_RotationAndRevocation(t *testing.T) {
+	oldSigner, oldKey := newSigner(t, "Blackhole Foundation")
+	rotated, newKey := newSigner(t, "Blackhole Foundation")
+
+	store := trust.NewStore()
+	v := trust.NewVerifier(store, trust.Policy{Mode: trust.ModeRequire}, nil)
+
+	// Packages signed before the old key was retired keep verifying
+	signedBefore := sign(t, oldSigner)
+	oldKey.Expires = time.Now().Add(time.Minute)
+	require.NoError(t, store.AddKey(oldKey))
+	require.NoError(t, store.AddKey(newKey))
+	assert.NoError(t, v.VerifySignature(manifest, []byte(checksums), signedBefore))
+	assert.NoError(t, v.VerifySignature(manifest, []byte(checksums), sign(t, rotated)))
+
+	// Signatures made after it expired don't
+	oldKey.Expires = time.Now().Add(-time.Minute)
+	require.NoError(t, store.AddKey(oldKey))
+	err := v.VerifySignature(manifest, []byte(checksums), sign(t, oldSigner))
+	assert.True(t, errors.Is(err, trust.ErrKeyExpired))
+
+	// Revoked keys are rejected outright, even when only warning
+	store.Revoke(trust.Revocation{KeyID: oldKey.ID, Reason: "compromised"})
+	warn := trust.NewVerifier(store, trust.Policy{Mode: trust.ModeWarn}, nil)
+	err = warn.VerifySignature(manifest, []byte(checksums), signedBefore)
+	assert.True(t, errors.Is(err, trust.ErrKeyRevoked))
+}
+
+func TestLoadStore(t *testing.T) {
+	dir := t.TempDir()
+	signer, key := newSigner(t, "Acme")
+	_, revokedKey := newSigner(t, "Acme")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "community"), 0755))
+	require.NoError(t, key.WriteFile(filepath.Join(dir, "community", "acme.json")))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "local"), 0755))
+	require.NoError(t, revokedKey.WriteFile(filepath.Join(dir, "local", "acme-old.json")))
+	revocations, err := json.Marshal([]trust.Revocation{{KeyID: revokedKey.ID, RevokedAt: time.Now()}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "revoked.json"), revocations, 0644))
+
+	store, err := trust.LoadStore(dir)
+	require.NoError(t, err)
+	loaded, ok := store.Key(key.ID)
+	require.True(t, ok)
+	assert.Equal(t, trust.TierCommunity, loaded.Tier)
+	assert.Equal(t, "Acme", loaded.Publisher)
+	_, revoked := store.Revoked(revokedKey.ID)
+	assert.True(t, revoked)
+
+	// Signing keys round-trip through their file
+	keyPath := filepath.Join(t.TempDir(), "acme.key")
+	require.NoError(t, signer.WriteFile(keyPath))
+	reloaded, err := trust.LoadSigner(keyPath)
+	require.NoError(t, err)
+	v := trust.NewVerifier(store, trust.Policy{Mode: trust.ModeRequire}, nil)
+	assert.NoError(t, v.VerifySignature(manifest, []byte(checksums), sign(t, reloaded)))
+
+	// A missing trust directory is an empty store
+	empty, err := trust.LoadStore(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, empty.Keys())
+
+	_, err = trust.ParseMode("sometimes")
+	assert.Error(t, err)
+}
@@ -0,0 +1,342 @@
+package base_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/base"
+	lifecyclev1 "github.com/blackhole-pro/blackhole/core/pkg/plugins/lifecycle/proto/v1"
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// echoPlugin is a minimal stateful plugin used to exercise Serve
+type echoPlugin struct {
+	started  bool
+	stopped  bool
+	prepared bool
+	state    []byte
+}
+
+func (p *echoPlugin) Initialize(ctx context.Context, config map[string]interface{}) error { return nil }
+func (p *echoPlugin) Start(ctx context.Context) error                                     { p.started = true; return nil }
+func (p *echoPlugin) Stop(ctx context.Context) error                                      { p.stopped = true; return nil }
+func (p *echoPlugin) HealthCheck(ctx context.Context) error                               { return nil }
+func (p *echoPlugin) PrepareShutdown(ctx context.Context) error                           { p.prepared = true; return nil }
+
+func (p *echoPlugin) Info() base.PluginInfo {
+	return base.PluginInfo{Name: "echo", Version: "1.2.3"}
+}
+
+func (p *echoPlugin) Handle(ctx context.Context, req base.Request) (base.Response, error) {
+	return base.Response{Success: true, Result: map[string]interface{}{"method": req.Method}}, nil
+}
+
+func (p *echoPlugin) ExportState(ctx context.Context) ([]byte, error) { return p.state, nil }
+func (p *echoPlugin) ImportState(ctx context.Context, state []byte) error {
+	p.state = state
+	return nil
+}
+
+// host drives a plugin served over in-memory pipes
+type host struct {
+	t    *testing.T
+	conn *protocol.Conn
+	next int
+}
+
+func (h *host) call(method string, params interface{}) protocol.Message {
+	h.next++
+	req, err := protocol.NewRequest(string(rune('a'+h.next)), method, params)
+	require.NoError(h.t, err)
+	require.NoError(h.t, h.conn.Write(req))
+
+	resp, err := h.conn.Read()
+	require.NoError(h.t, err)
+	require.Equal(h.t, req.ID, resp.ID)
+	return resp
+}
+
+func TestServe_StdioLifecycle(t *testing.T) {
+	hostReader, pluginWriter := io.Pipe()
+	pluginReader, hostWriter := io.Pipe()
+
+	plugin := &echoPlugin{}
+	done := make(chan error, 1)
+	go func() {
+		done <- base.Serve(plugin,
+			base.WithTransport(protocol.TransportStdio),
+			base.WithStdio(pluginReader, pluginWriter),
+			base.WithLogger(zap.NewNop()))
+	}()
+
+	h := &host{t: t, conn: protocol.NewConn(hostReader, hostWriter)}
+
+	resp := h.call(protocol.MethodHandshake, protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            "blackhole",
+		Features:        []protocol.Feature{protocol.FeatureState, protocol.FeatureStreaming},
+	})
+	require.Nil(t, resp.Error)
+	var hs protocol.Handshake
+	require.NoError(t, json.Unmarshal(resp.Result, &hs))
+	assert.Equal(t, "echo", hs.Name)
+	assert.Equal(t, "1.2.3", hs.Version)
+	assert.Equal(t, []protocol.Feature{protocol.FeatureState}, hs.Features)
+
+	resp = h.call(protocol.MethodInitialize, map[string]interface{}{"name": "echo"})
+	require.Nil(t, resp.Error)
+	assert.True(t, plugin.started)
+
+	resp = h.call(protocol.MethodHandle, base.Request{ID: "r1", Method: "ping"})
+	require.Nil(t, resp.Error)
+	var out base.Response
+	require.NoError(t, json.Unmarshal(resp.Result, &out))
+	assert.Equal(t, "r1", out.ID)
+	assert.Equal(t, "ping", out.Result["method"])
+
+	params, err := protocol.EncodeState(hs, []byte("saved"))
+	require.NoError(t, err)
+	resp = h.call(protocol.MethodImportState, json.RawMessage(params))
+	require.Nil(t, resp.Error)
+
+	resp = h.call(protocol.MethodExportState, nil)
+	require.Nil(t, resp.Error)
+	state, err := protocol.DecodeState(resp.Result)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("saved"), state)
+
+	resp = h.call("bogus", nil)
+	assert.True(t, protocol.IsMethodNotFound(resp.Error))
+
+	resp = h.call(protocol.MethodShutdown, nil)
+	require.Nil(t, resp.Error)
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after shutdown")
+	}
+	assert.True(t, plugin.prepared)
+	assert.True(t, plugin.stopped)
+}
+
+func TestServe_StopsReadingOnReturn(t *testing.T) {
+	serve := func() {
+		hostReader, pluginWriter := io.Pipe()
+		pluginReader, hostWriter := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- base.Serve(&echoPlugin{},
+				base.WithTransport(protocol.TransportStdio),
+				base.WithStdio(pluginReader, pluginWriter),
+				base.WithLogger(zap.NewNop()))
+		}()
+
+		// The host keeps its end open, so only Serve can end the read
+		h := &host{t: t, conn: protocol.NewConn(hostReader, hostWriter)}
+		resp := h.call(protocol.MethodShutdown, nil)
+		require.Nil(t, resp.Error)
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Serve did not return after shutdown")
+		}
+	}
+
+	// The first run starts the signal handling goroutines, which stay
+	serve()
+	baseline := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		serve()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), baseline)
+}
+
+func TestServe_GRPCHandshakeAndState(t *testing.T) {
+	dir, err := os.MkdirTemp("", "grpc")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "echo.sock")
+
+	plugin := &echoPlugin{}
+	done := make(chan error, 1)
+	go func() {
+		done <- base.Serve(plugin,
+			base.WithTransport(protocol.TransportGRPC),
+			base.WithSocket(socket),
+			base.WithLogger(zap.NewNop()))
+	}()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socket)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := lifecyclev1.NewPluginLifecycleClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hs, err := client.Handshake(ctx, lifecyclev1.NewHandshakeMessage(protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            "blackhole",
+		Features:        []protocol.Feature{protocol.FeatureState, protocol.FeatureCancellation},
+	}))
+	require.NoError(t, err)
+	peer := hs.AsHandshake()
+	assert.Equal(t, "echo", peer.Name)
+	assert.Equal(t, protocol.TransportGRPC, peer.Transport)
+	assert.True(t, peer.Supports(protocol.FeatureState))
+
+	// State survives a round trip in several chunks
+	state := bytes.Repeat([]byte("state"), 20<<10)
+	upload, err := client.ImportState(ctx)
+	require.NoError(t, err)
+	for chunk := state; len(chunk) > 0; chunk = chunk[min(len(chunk), 32<<10):] {
+		require.NoError(t, upload.Send(&lifecyclev1.StateChunk{Data: chunk[:min(len(chunk), 32<<10)]}))
+	}
+	_, err = upload.CloseAndRecv()
+	require.NoError(t, err)
+
+	download, err := client.ExportState(ctx, &lifecyclev1.ExportStateRequest{})
+	require.NoError(t, err)
+	var exported []byte
+	for {
+		chunk, err := download.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		exported = append(exported, chunk.GetData()...)
+	}
+	assert.Equal(t, state, exported)
+
+	// The host stops gRPC plugins with SIGTERM, which Serve handles
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after SIGTERM")
+	}
+	assert.True(t, plugin.prepared)
+	assert.True(t, plugin.stopped)
+}
+
+// blockingPlugin holds "wait" requests until release is closed
+type blockingPlugin struct {
+	echoPlugin
+	release chan struct{}
+}
+
+func (p *blockingPlugin) Handle(ctx context.Context, req base.Request) (base.Response, error) {
+	if req.Method == "wait" {
+		<-p.release
+	}
+	return base.Response{Success: true}, nil
+}
+
+func TestServe_ConcurrentRequests(t *testing.T) {
+	hostReader, pluginWriter := io.Pipe()
+	pluginReader, hostWriter := io.Pipe()
+
+	plugin := &blockingPlugin{release: make(chan struct{})}
+	go base.Serve(plugin,
+		base.WithTransport(protocol.TransportStdio),
+		base.WithStdio(pluginReader, pluginWriter),
+		base.WithLogger(zap.NewNop()),
+		base.WithWorkers(2))
+	t.Cleanup(func() { hostWriter.Close() })
+
+	conn := protocol.NewConn(hostReader, hostWriter)
+	for _, req := range []base.Request{{ID: "r1", Method: "wait"}, {ID: "r2", Method: "ping"}} {
+		msg, err := protocol.NewRequest(req.ID, protocol.MethodHandle, req)
+		require.NoError(t, err)
+		require.NoError(t, conn.Write(msg))
+	}
+
+	// The second request is answered while the first is still running
+	resp, err := conn.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "r2", resp.ID)
+
+	close(plugin.release)
+	resp, err = conn.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "r1", resp.ID)
+}
+
+// cancellablePlugin holds "wait" requests until they are cancelled
+type cancellablePlugin struct {
+	echoPlugin
+}
+
+func (p *cancellablePlugin) Handle(ctx context.Context, req base.Request) (base.Response, error) {
+	if req.Method == "wait" {
+		<-ctx.Done()
+		return base.Response{}, ctx.Err()
+	}
+	return base.Response{Success: true}, nil
+}
+
+func TestServe_ReadsWhileExclusiveRequestWaits(t *testing.T) {
+	hostReader, pluginWriter := io.Pipe()
+	pluginReader, hostWriter := io.Pipe()
+
+	go base.Serve(&cancellablePlugin{},
+		base.WithTransport(protocol.TransportStdio),
+		base.WithStdio(pluginReader, pluginWriter),
+		base.WithLogger(zap.NewNop()))
+	t.Cleanup(func() { hostWriter.Close() })
+
+	conn := protocol.NewConn(hostReader, hostWriter)
+	wait, err := protocol.NewRequest("r1", protocol.MethodHandle, base.Request{ID: "r1", Method: "wait"})
+	require.NoError(t, err)
+	export, err := protocol.NewRequest("r2", protocol.MethodExportState, nil)
+	require.NoError(t, err)
+	for _, msg := range []protocol.Message{wait, export, protocol.NewCancel("r1")} {
+		require.NoError(t, conn.Write(msg))
+	}
+
+	// The export waits for the handler, whose cancellation is still read
+	ids := make(chan string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			resp, err := conn.Read()
+			if err != nil {
+				return
+			}
+			ids <- resp.ID
+		}
+	}()
+	for _, want := range []string{"r1", "r2"} {
+		select {
+		case id := <-ids:
+			assert.Equal(t, want, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no response to %s", want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package protocol_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+// acceptOne accepts a connection on a host-only listener for hostPID and
+// returns whether the dialing connection was let through
+func acceptOne(t *testing.T, hostPID int) bool {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "peercred")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	inner, err := net.Listen("unix", filepath.Join(dir, "plugin.sock"))
+	require.NoError(t, err)
+	listener := protocol.HostOnly(inner, hostPID)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	conn, err := net.Dial("unix", filepath.Join(dir, "plugin.sock"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	select {
+	case server := <-accepted:
+		server.Close()
+		return true
+	case <-time.After(200 * time.Millisecond):
+		// A rejected connection is closed by the listener
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := conn.Read(make([]byte, 1))
+		assert.Error(t, err)
+		return false
+	}
+}
+
+func TestHostOnly_AcceptsOnlyTheHost(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials require SO_PEERCRED")
+	}
+
+	pid, _, err := protocol.PeerCred(nil)
+	assert.ErrorIs(t, err, protocol.ErrNoPeerCredentials)
+	assert.Zero(t, pid)
+
+	assert.True(t, acceptOne(t, os.Getpid()))
+	assert.False(t, acceptOne(t, os.Getpid()+1), "another process")
+	assert.True(t, acceptOne(t, 0), "not launched by a host")
+}
+
+func TestHostPID(t *testing.T) {
+	t.Setenv(protocol.EnvHostPID, "1234")
+	assert.Equal(t, 1234, protocol.HostPID())
+	t.Setenv(protocol.EnvHostPID, "")
+	assert.Zero(t, protocol.HostPID())
+}
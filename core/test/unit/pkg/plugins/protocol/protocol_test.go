@@ -0,0 +1,288 @@
+package protocol_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/blackhole-pro/blackhole/core/pkg/plugins/protocol"
+)
+
+func TestNegotiate_IntersectsFeatures(t *testing.T) {
+	host := protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Features:        []protocol.Feature{protocol.FeatureState, protocol.FeatureCancellation},
+	}
+	plugin := protocol.Handshake{
+		ProtocolVersion: protocol.Version,
+		Name:            "hello",
+		Version:         "1.0.0",
+		Features:        []protocol.Feature{protocol.FeatureState, protocol.FeatureStreaming},
+	}
+
+	reply, err := protocol.Accept(plugin, host)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", reply.Name)
+	assert.Equal(t, protocol.Version, reply.ProtocolVersion)
+	assert.Equal(t, []protocol.Feature{protocol.FeatureState}, reply.Features)
+	assert.True(t, reply.Supports(protocol.FeatureState))
+	assert.False(t, reply.Supports(protocol.FeatureStreaming))
+}
+
+func TestNegotiate_IncompatibleVersion(t *testing.T) {
+	host := protocol.Handshake{ProtocolVersion: protocol.Version}
+	plugin := protocol.Handshake{ProtocolVersion: protocol.LegacyVersion}
+
+	_, _, err := protocol.Negotiate(host, plugin)
+	assert.True(t, errors.Is(err, protocol.ErrIncompatibleVersion))
+}
+
+func TestError_LegacyStringErrors(t *testing.T) {
+	var msg protocol.Message
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"1","error":"unknown method: $/handshake"}`), &msg))
+	require.NotNil(t, msg.Error)
+	assert.True(t, protocol.IsMethodNotFound(msg.Error))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"2","error":"boom"}`), &msg))
+	assert.Equal(t, protocol.CodePluginError, msg.Error.Code)
+	assert.Equal(t, "boom", msg.Error.Message)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"3","error":{"code":-32601,"message":"Method not found"}}`), &msg))
+	assert.True(t, protocol.IsMethodNotFound(msg.Error))
+}
+
+func TestState_RoundTrip(t *testing.T) {
+	state := []byte(`{"count":3}`)
+
+	current, err := protocol.EncodeState(protocol.Handshake{ProtocolVersion: protocol.Version}, state)
+	require.NoError(t, err)
+	assert.Contains(t, string(current), `"state"`)
+
+	decoded, err := protocol.DecodeState(current)
+	require.NoError(t, err)
+	assert.Equal(t, state, decoded)
+
+	legacy, err := protocol.EncodeState(protocol.LegacyHandshake("counter", "1.0.0"), state)
+	require.NoError(t, err)
+
+	decoded, err = protocol.DecodeState(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, state, decoded)
+}
+
+func TestConn_ReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	writer := protocol.NewConn(nil, &buf)
+
+	req, err := protocol.NewRequest("1", protocol.MethodHandshake, protocol.Handshake{ProtocolVersion: protocol.Version})
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(req))
+	require.NoError(t, writer.Write(protocol.Message{Method: protocol.MethodCancel}))
+
+	reader := protocol.NewConn(strings.NewReader("\n"+buf.String()), io.Discard)
+
+	msg, err := reader.Read()
+	require.NoError(t, err)
+	assert.Equal(t, "1", msg.ID)
+	assert.Equal(t, protocol.MethodHandshake, msg.Method)
+	assert.False(t, msg.IsNotification())
+
+	msg, err = reader.Read()
+	require.NoError(t, err)
+	assert.True(t, msg.IsNotification())
+
+	_, err = reader.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWorkerPool_ExclusiveWaitsForRunningRequests(t *testing.T) {
+	assert.True(t, protocol.Concurrent(protocol.MethodHandle))
+	assert.False(t, protocol.Concurrent(protocol.MethodExportState))
+
+	pool := protocol.NewWorkerPool(4)
+	var running int32
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		pool.Go(func() {
+			atomic.AddInt32(&running, 1)
+			<-release
+			atomic.AddInt32(&running, -1)
+		})
+	}
+
+	exclusive := make(chan int32, 1)
+	go pool.Exclusive(func() { exclusive <- atomic.LoadInt32(&running) })
+
+	select {
+	case <-exclusive:
+		t.Fatal("exclusive request ran alongside others")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.Equal(t, int32(0), <-exclusive)
+}
+
+func TestCancellations_CancelAndDeadline(t *testing.T) {
+	cancels := protocol.NewCancellations()
+
+	ctx, done := cancels.Track(context.Background(), protocol.Message{ID: "7", Method: protocol.MethodHandle})
+	defer done()
+	assert.True(t, cancels.Cancel(protocol.NewCancel("7")))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.False(t, cancels.Cancel(protocol.NewCancel("7")), "already cancelled")
+
+	deadline := time.Now().Add(20 * time.Millisecond)
+	ctx, done = cancels.Track(context.Background(), protocol.Message{ID: "8", Deadline: &deadline})
+	defer done()
+	got, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.True(t, got.Equal(deadline))
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+func TestMessage_DeadlineRoundTrip(t *testing.T) {
+	deadline := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err := json.Marshal(protocol.Message{ID: "1", Method: protocol.MethodHandle, Deadline: &deadline})
+	require.NoError(t, err)
+
+	var decoded protocol.Message
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.NotNil(t, decoded.Deadline)
+	assert.True(t, decoded.Deadline.Equal(deadline))
+
+	data, err = json.Marshal(protocol.Message{ID: "2"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "deadline")
+}
+
+// streamPeer serves the stream notifications arriving on one end of a pipe
+func streamPeer(t *testing.T, r io.Reader, w io.Writer) (*protocol.Conn, *protocol.Streams) {
+	conn := protocol.NewConn(r, w)
+	streams := protocol.NewStreams(conn)
+	go func() {
+		for {
+			msg, err := conn.Read()
+			if err != nil {
+				streams.AbortAll(err)
+				return
+			}
+			streams.Dispatch(msg)
+		}
+	}()
+	return conn, streams
+}
+
+func TestStream_FlowControl(t *testing.T) {
+	aReader, bWriter := io.Pipe()
+	bReader, aWriter := io.Pipe()
+	t.Cleanup(func() {
+		aWriter.Close()
+		bWriter.Close()
+	})
+	_, sender := streamPeer(t, aReader, aWriter)
+	_, receiver := streamPeer(t, bReader, bWriter)
+
+	out := sender.Open("1")
+	in := receiver.Open("1")
+
+	// One byte more than the window needs credit the receiver hasn't given
+	body := bytes.Repeat([]byte("x"), protocol.StreamWindow*protocol.StreamChunkSize+1)
+	written := make(chan error, 1)
+	go func() {
+		_, err := out.Write(body)
+		if err == nil {
+			err = out.CloseWrite()
+		}
+		written <- err
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("sender ignored flow control")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	received, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, <-written)
+	assert.Equal(t, len(body), len(received))
+}
+
+func TestStream_EndWithError(t *testing.T) {
+	aReader, bWriter := io.Pipe()
+	bReader, aWriter := io.Pipe()
+	t.Cleanup(func() {
+		aWriter.Close()
+		bWriter.Close()
+	})
+	_, sender := streamPeer(t, aReader, aWriter)
+	_, receiver := streamPeer(t, bReader, bWriter)
+
+	out := sender.Open("1")
+	in := receiver.Open("1")
+
+	_, err := out.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, out.CloseWriteWithError(errors.New("disk full")))
+
+	data, err := io.ReadAll(in)
+	assert.Equal(t, "partial", string(data))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+
+	_, err = out.Write([]byte("more"))
+	assert.ErrorIs(t, err, protocol.ErrStreamClosed)
+
+	// Finishing a stream unblocks its reader
+	in2 := receiver.Open("2")
+	receiver.Finish("2", nil)
+	_, err = in2.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWorkerPool_NeverBlocksTheCaller(t *testing.T) {
+	pool := protocol.NewWorkerPool(1)
+	release := make(chan struct{})
+	var order []string
+	var mu sync.Mutex
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+
+	queued := make(chan struct{})
+	go func() {
+		pool.Go(func() { <-release; record("first")() })
+		pool.Go(record("second"))
+		pool.Exclusive(record("exclusive"))
+		pool.Go(record("after"))
+		close(queued)
+	}()
+
+	// Queueing returns although the only worker is busy
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("queueing blocked on a busy pool")
+	}
+	close(release)
+	pool.Wait()
+
+	assert.Equal(t, "exclusive", order[2])
+	assert.Equal(t, "after", order[3])
+	assert.ElementsMatch(t, []string{"first", "second"}, order[:2])
+}
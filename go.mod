@@ -15,6 +15,7 @@ require (
 	github.com/spf13/cobra v1.8.0
 	github.com/spf13/viper v1.18.2
 	github.com/stretchr/testify v1.10.0
+	github.com/tetratelabs/wazero v1.8.2
 	go.uber.org/zap v1.27.0
 	golang.org/x/oauth2 v0.26.0
 	google.golang.org/grpc v1.72.1
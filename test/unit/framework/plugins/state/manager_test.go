@@ -136,7 +136,7 @@ func TestStateManager_Migration(t *testing.T) {
 	}
 	
 	// Register migrator
-	manager.RegisterMigrator(pluginID, migrator)
+	require.NoError(t, manager.RegisterMigrator(pluginID, oldVersion, newVersion, migrator))
 	
 	// Save old state
 	oldState := map[string]interface{}{